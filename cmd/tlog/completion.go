@@ -0,0 +1,112 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/richhaase/tlog/internal/tlog"
+	"github.com/spf13/cobra"
+)
+
+// taskIDFlags are flags, on any command, whose values are task IDs
+var taskIDFlags = []string{"dep", "for", "needs", "remove", "on", "before", "after", "parent"}
+
+// registerCompletions wires shell completion for task ID arguments and for
+// flags whose values tlog knows: task IDs, priorities, statuses, and
+// templates. It runs after every command is added.
+func registerCompletions() {
+	commands := rootCmd.Commands()
+	for len(commands) > 0 {
+		cmd := commands[0]
+		commands = append(commands[1:], cmd.Commands()...)
+
+		// Commands whose first argument is a task ID say so in their usage;
+		// "<id>..." takes any number of them
+		if fields := strings.Fields(cmd.Use); len(fields) > 1 {
+			switch fields[1] {
+			case "<id>...":
+				cmd.ValidArgsFunction = completeTaskIDs(false)
+			case "<id>":
+				cmd.ValidArgsFunction = firstArg(completeTaskIDs(false))
+			case "<full-id>":
+				cmd.ValidArgsFunction = firstArg(completeTaskIDs(true))
+			}
+		}
+
+		for _, name := range taskIDFlags {
+			if cmd.Flags().Lookup(name) != nil {
+				_ = cmd.RegisterFlagCompletionFunc(name, completeTaskIDs(false))
+			}
+		}
+		if cmd.Flags().Lookup("priority") != nil {
+			_ = cmd.RegisterFlagCompletionFunc("priority", cobra.FixedCompletions(
+				[]string{"critical", "high", "medium", "low", "backlog"}, cobra.ShellCompDirectiveNoFileComp))
+		}
+		if cmd.Flags().Lookup("status") != nil {
+			_ = cmd.RegisterFlagCompletionFunc("status", completeList("open", "in_progress", "done", "all"))
+		}
+		if cmd.Flags().Lookup("from-template") != nil {
+			_ = cmd.RegisterFlagCompletionFunc("from-template", completeTemplates)
+		}
+	}
+}
+
+// completeTemplates completes saved template names
+func completeTemplates(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	root, err := findRoot(cmd)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	names, err := tlog.ListTemplates(root)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeTaskIDs completes task IDs, shown with their titles. With deleted
+// set, it offers deleted tasks instead of live ones.
+func completeTaskIDs(deleted bool) cobra.CompletionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		root, err := findRoot(cmd)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		tasks, err := tlog.LoadState(root)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		var completions []string
+		for id, task := range tasks {
+			if task.Deleted == deleted && strings.HasPrefix(id, toComplete) {
+				completions = append(completions, id+"\t"+task.Title)
+			}
+		}
+		sort.Strings(completions)
+		return completions, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// firstArg limits a completion to the command's first argument
+func firstArg(complete cobra.CompletionFunc) cobra.CompletionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return complete(cmd, args, toComplete)
+	}
+}
+
+// completeList completes one value of a comma-separated list, keeping the
+// values already typed
+func completeList(values ...string) cobra.CompletionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		typed := toComplete[:strings.LastIndex(toComplete, ",")+1]
+		completions := make([]string, 0, len(values))
+		for _, v := range values {
+			completions = append(completions, typed+v)
+		}
+		return completions, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+	}
+}
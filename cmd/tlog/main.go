@@ -1,9 +1,20 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/richhaase/tlog/internal/tlog"
 	"github.com/spf13/cobra"
@@ -14,6 +25,8 @@ var rootCmd = &cobra.Command{
 	Use:   "tlog",
 	Short: "Append-only task tracking for AI agents",
 	Long:  `tlog - append-only task tracking for AI agents`,
+	// Runs only after a command succeeds, since failures exit early
+	PersistentPostRun: autoSync,
 }
 
 func main() {
@@ -23,16 +36,41 @@ func main() {
 }
 
 func init() {
+	rootCmd.PersistentFlags().Bool("json", false, "Output machine-readable JSON")
+	rootCmd.PersistentFlags().String("dir", "", "Use this .tlog directory instead of searching up from the current one")
+	rootCmd.PersistentFlags().Bool("strict", false, "Refuse to run when the repo's schema version doesn't match this tlog")
+
 	// Version command
 	rootCmd.AddCommand(&cobra.Command{
 		Use:     "version",
 		Aliases: []string{"v"},
 		Short:   "Show version information",
 		Run: func(cmd *cobra.Command, args []string) {
+			if wantJSON(cmd) {
+				ver, rev, buildDate := getVersionInfo()
+				printJSON(map[string]interface{}{"version": ver, "commit": rev, "date": buildDate})
+				return
+			}
 			fmt.Println(buildVersionString())
 		},
 	})
 
+	// Schema command
+	rootCmd.AddCommand(&cobra.Command{
+		Use:       "schema [task|event]",
+		Short:     "Print the JSON Schema for tasks and events",
+		Args:      cobra.MatchAll(cobra.MaximumNArgs(1), cobra.OnlyValidArgs),
+		ValidArgs: []string{"task", "event"},
+		Run: func(cmd *cobra.Command, args []string) {
+			schemas := tlog.Schemas()
+			if len(args) == 1 {
+				printJSON(schemas[args[0]])
+				return
+			}
+			printJSON(schemas)
+		},
+	})
+
 	// Init command
 	rootCmd.AddCommand(&cobra.Command{
 		Use:   "init",
@@ -43,6 +81,10 @@ func init() {
 			if err != nil {
 				exitError(err.Error())
 			}
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
 			fmt.Printf("Initialized: %s\n", result["path"])
 		},
 	})
@@ -51,36 +93,60 @@ func init() {
 	createCmd := &cobra.Command{
 		Use:   "create <title>",
 		Short: "Create a new task",
-		Args:  cobra.ExactArgs(1),
+		Long:  "Create a new task. With --spec, the argument (or stdin if omitted) is a JSON task spec; with --json, an argument that is a JSON object is read as one too. A spec is {\"title\", \"description\", \"notes\", \"priority\", \"labels\", \"deps\", \"for\"}. With --from-template, the title is optional and other flags add to or override the template.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			spec, _ := cmd.Flags().GetBool("spec")
+			template, _ := cmd.Flags().GetString("from-template")
+			if spec || template != "" {
+				return cobra.MaximumNArgs(1)(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
 		Run: func(cmd *cobra.Command, args []string) {
+			// "create --json '{...}'" predates --spec; --json now only picks
+			// the output format, but a spec argument is still a spec
+			if spec, _ := cmd.Flags().GetBool("spec"); spec || (wantJSON(cmd) && len(args) == 1 && isSpecArg(args[0])) {
+				runCreateFromSpec(cmd, args)
+				return
+			}
+			if template, _ := cmd.Flags().GetString("from-template"); template != "" {
+				runCreateFromTemplate(cmd, args, template)
+				return
+			}
+
 			title := args[0]
-			deps, _ := cmd.Flags().GetStringSlice("dep")
-			labels, _ := cmd.Flags().GetStringSlice("label")
-			description, _ := cmd.Flags().GetString("description")
-			notes, _ := cmd.Flags().GetString("note")
-			priorityStr, _ := cmd.Flags().GetString("priority")
-			forParent, _ := cmd.Flags().GetString("for")
+			var opts tlog.CreateOptions
+			opts.Deps, _ = cmd.Flags().GetStringSlice("dep")
+			opts.Labels, _ = cmd.Flags().GetStringSlice("label")
+			opts.Description, _ = cmd.Flags().GetString("description")
+			opts.Notes, _ = cmd.Flags().GetString("note")
+			opts.PriorityFromDeps, _ = cmd.Flags().GetBool("priority-from-deps")
+			opts.Force, _ = cmd.Flags().GetBool("force")
+			opts.Estimate = estimateFlag(cmd)
 
-			var priority *tlog.Priority
-			if priorityStr != "" {
-				p := tlog.ParsePriority(priorityStr)
-				priority = &p
+			if priorityStr, _ := cmd.Flags().GetString("priority"); priorityStr != "" {
+				p, err := tlog.ParsePriorityStrict(priorityStr)
+				if err != nil {
+					exitError(err.Error())
+				}
+				opts.Priority = &p
 			}
 
-			root, err := tlog.RequireTlog()
-			if err != nil {
-				exitError(err.Error())
-			}
+			root := requireRoot(cmd)
 
-			// Resolve forParent ID if provided
-			if forParent != "" {
-				forParent = resolveID(root, forParent)
+			// Resolve the parent ID if provided
+			if forParent, _ := cmd.Flags().GetString("for"); forParent != "" {
+				opts.For = resolveID(root, forParent)
 			}
 
-			result, err := tlog.CmdCreate(root, title, deps, labels, description, notes, priority, forParent)
+			result, err := tlog.CmdCreate(root, title, opts)
 			if err != nil {
 				exitError(err.Error())
 			}
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
 			fmt.Printf("Created: %s %q\n", result["id"], result["title"])
 		},
 	}
@@ -90,19 +156,172 @@ func init() {
 	createCmd.Flags().String("note", "", "Add note (what happened)")
 	createCmd.Flags().String("priority", "", "Set priority (critical|high|medium|low|backlog)")
 	createCmd.Flags().String("for", "", "Add as subtask of parent task (parent will depend on this task)")
+	createCmd.Flags().Int("estimate", 0, "Estimated minutes of work")
+	createCmd.Flags().Bool("priority-from-deps", false, "Inherit the most urgent priority of the deps and parent (--priority overrides)")
+	createCmd.Flags().Bool("spec", false, "Read a JSON task spec from the argument or stdin")
+	createCmd.Flags().String("from-template", "", "Start from a template saved with 'tlog template save'")
+	createCmd.Flags().Bool("force", false, "Allow labels outside the configured allowed_labels")
 	rootCmd.AddCommand(createCmd)
 
-	// Done command
-	doneCmd := &cobra.Command{
-		Use:   "done <id>",
-		Short: "Mark task as done",
+	// Create-batch command
+	createBatchCmd := &cobra.Command{
+		Use:   "create-batch",
+		Short: "Create tasks from a JSON array of specs on stdin",
+		Long:  "Create tasks from a JSON array of task specs read from stdin. A spec may set \"key\" so others in the batch can reference it in \"deps\" or \"for\". The batch is validated (including for cycles) before anything is written.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				exitError(err.Error())
+			}
+			specs, err := tlog.ParseTaskSpecs(data)
+			if err != nil {
+				exitError(err.Error())
+			}
+
+			root := requireRoot(cmd)
+			force, _ := cmd.Flags().GetBool("force")
+			result, err := tlog.CmdCreateBatch(root, specs, force)
+			if err != nil {
+				exitError(err.Error())
+			}
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
+			for _, t := range result["tasks"].([]map[string]interface{}) {
+				fmt.Printf("Created: %s %q\n", t["id"], t["title"])
+			}
+		},
+	}
+	createBatchCmd.Flags().Bool("force", false, "Allow labels outside the configured allowed_labels")
+	rootCmd.AddCommand(createBatchCmd)
+
+	// Import command
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import tasks from a JSON array on stdin (as written by export) or another format",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			todoPath, _ := cmd.Flags().GetString("from-todotxt")
+			issuesPath, _ := cmd.Flags().GetString("from-github-issues")
+			preserveIDs, _ := cmd.Flags().GetBool("preserve-ids")
+			if todoPath != "" && issuesPath != "" {
+				exitError("must specify at most one import source (--from-todotxt or --from-github-issues)")
+			}
+
+			root := requireRoot(cmd)
+
+			var tasks []*tlog.Task
+			var err error
+			switch {
+			case todoPath != "":
+				r := openInput(todoPath)
+				defer func() { _ = r.Close() }()
+				tasks, err = tlog.ParseTodoTxt(r)
+			case issuesPath != "":
+				r := openInput(issuesPath)
+				defer func() { _ = r.Close() }()
+				tasks, err = tlog.ParseGitHubIssues(r)
+			default:
+				tasks, err = tlog.ParseTaskJSON(os.Stdin)
+			}
+			if err != nil {
+				exitError(err.Error())
+			}
+
+			force, _ := cmd.Flags().GetBool("force")
+			result, err := tlog.CmdImport(root, tasks, preserveIDs, force)
+			if err != nil {
+				exitError(err.Error())
+			}
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
+			fmt.Printf("Imported: %d tasks\n", result["count"])
+		},
+	}
+	importCmd.Flags().String("from-todotxt", "", "Import a todo.txt file (- for stdin)")
+	importCmd.Flags().String("from-github-issues", "", "Import a GitHub API issues JSON dump (- for stdin)")
+	importCmd.Flags().Bool("preserve-ids", false, "Keep task IDs from the input instead of generating new ones")
+	importCmd.Flags().Bool("force", false, "Allow labels outside the configured allowed_labels")
+	rootCmd.AddCommand(importCmd)
+
+	// Merge command
+	mergeCmd := &cobra.Command{
+		Use:   "merge <other-dir>",
+		Short: "Merge another tlog's events into this one, renaming colliding task IDs",
+		Long:  "Copies the events of the .tlog directory at <other-dir> (or of <other-dir>/.tlog) into this one, skipping events both already share. A task ID both sides created for different tasks is given a new ID on the merged side, and deps and blocks pointing at it follow. Merging the same tlog again adds nothing.",
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			root, err := tlog.RequireTlog()
+			root := requireRoot(cmd)
+			dir := args[0]
+			if info, err := os.Stat(filepath.Join(dir, tlog.TlogDir)); err == nil && info.IsDir() {
+				dir = filepath.Join(dir, tlog.TlogDir)
+			}
+			other, err := tlog.OpenTlog(dir)
 			if err != nil {
 				exitError(err.Error())
 			}
-			id := resolveID(root, args[0])
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+			result, err := tlog.CmdMerge(root, other, dryRun)
+			if err != nil {
+				exitError(err.Error())
+			}
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
+			remapped := result["remapped"].(map[string]string)
+			ids := make([]string, 0, len(remapped))
+			for id := range remapped {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+			for _, id := range ids {
+				fmt.Printf("Renamed: %s -> %s (ID taken here by another task)\n", id, remapped[id])
+			}
+			verb := "Merged"
+			if dryRun {
+				verb = "Would merge"
+			}
+			fmt.Printf("%s: %d events (%d already present)\n", verb, result["merged"], result["skipped"])
+		},
+	}
+	mergeCmd.Flags().Bool("dry-run", false, "Show what would be merged without writing")
+	rootCmd.AddCommand(mergeCmd)
+
+	// Export command
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Dump all tasks as a JSON array",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			root := requireRoot(cmd)
+			includeDeleted, _ := cmd.Flags().GetBool("include-deleted")
+			tasks, err := tlog.CmdExport(root, includeDeleted)
+			if err != nil {
+				exitError(err.Error())
+			}
+			printJSON(tasks)
+		},
+	}
+	exportCmd.Flags().Bool("include-deleted", false, "Include deleted tasks (tombstones)")
+	rootCmd.AddCommand(exportCmd)
+
+	// Done command
+	doneCmd := &cobra.Command{
+		Use:   "done <id>...",
+		Short: "Mark tasks as done",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			root := requireRoot(cmd)
+			target := strings.Join(args, ", ")
+			if len(args) == 1 {
+				target = resolveID(root, args[0])
+			}
 
 			var resolution tlog.Resolution
 			if wontfix, _ := cmd.Flags().GetBool("wontfix"); wontfix {
@@ -113,106 +332,265 @@ func init() {
 			notes, _ := cmd.Flags().GetString("note")
 			commit, _ := cmd.Flags().GetString("commit")
 
-			result, err := tlog.CmdDone(root, id, resolution, notes, commit)
+			// --verify always refuses; otherwise the config decides for completed tasks
+			verify, _ := cmd.Flags().GetBool("verify")
+			changes, warning, err := tlog.CheckVerifyDone(root, target, resolution, verify)
+			for _, c := range changes {
+				fmt.Fprintln(os.Stderr, "  "+c)
+			}
 			if err != nil {
 				exitError(err.Error())
 			}
-			fmt.Printf("Done: %s (%s)\n", result["id"], result["resolution"])
+			if warning != "" {
+				fmt.Fprintln(os.Stderr, "warning: "+warning)
+			}
+
+			showUnblocked, _ := cmd.Flags().GetBool("show-unblocked")
+			runBulk(cmd, root, args, func(id string) (map[string]interface{}, error) {
+				return tlog.CmdDone(root, id, resolution, notes, commit)
+			}, func(result map[string]interface{}) {
+				fmt.Printf("Done: %s (%s)\n", result["id"], result["resolution"])
+				if showUnblocked {
+					for _, t := range result["unblocked"].([]*tlog.Task) {
+						fmt.Printf("Now ready: %s  %s\n", t.ID, t.Title)
+					}
+				}
+			})
 		},
 	}
 	doneCmd.Flags().Bool("wontfix", false, "Resolution: wontfix")
 	doneCmd.Flags().Bool("duplicate", false, "Resolution: duplicate")
 	doneCmd.Flags().String("note", "", "Append closing note")
 	doneCmd.Flags().String("commit", "", "Record commit SHA that completed this task")
+	doneCmd.Flags().Bool("show-unblocked", false, "List tasks that became ready as a result")
+	doneCmd.Flags().Bool("verify", false, "Refuse if the working tree has uncommitted changes")
 	rootCmd.AddCommand(doneCmd)
 
 	// Claim command
 	claimCmd := &cobra.Command{
-		Use:   "claim <id>",
-		Short: "Mark task as in_progress",
-		Args:  cobra.ExactArgs(1),
+		Use:   "claim <id>...",
+		Short: "Mark tasks as in_progress",
+		Args:  cobra.MinimumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			root, err := tlog.RequireTlog()
-			if err != nil {
-				exitError(err.Error())
-			}
-			id := resolveID(root, args[0])
+			root := requireRoot(cmd)
 			notes, _ := cmd.Flags().GetString("note")
+			by, _ := cmd.Flags().GetString("by")
 
-			result, err := tlog.CmdClaim(root, id, notes)
-			if err != nil {
-				exitError(err.Error())
-			}
-			fmt.Printf("Claimed: %s\n", result["id"])
+			runBulk(cmd, root, args, func(id string) (map[string]interface{}, error) {
+				return tlog.CmdClaim(root, id, notes, by)
+			}, func(result map[string]interface{}) {
+				fmt.Printf("Claimed: %s\n", result["id"])
+			})
 		},
 	}
 	claimCmd.Flags().String("note", "", "Append note")
+	claimCmd.Flags().String("by", "", "Record who is claiming the task as its assignee")
 	rootCmd.AddCommand(claimCmd)
 
 	// Unclaim command
 	unclaimCmd := &cobra.Command{
-		Use:   "unclaim <id>",
-		Short: "Release claimed task back to open",
-		Args:  cobra.ExactArgs(1),
+		Use:   "unclaim <id>...",
+		Short: "Release claimed tasks back to open",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if all, _ := cmd.Flags().GetBool("all"); all {
+				return cobra.NoArgs(cmd, args)
+			}
+			if cmd.Flags().Changed("assignee") {
+				return fmt.Errorf("--assignee requires --all")
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
 		Run: func(cmd *cobra.Command, args []string) {
-			root, err := tlog.RequireTlog()
-			if err != nil {
-				exitError(err.Error())
+			root := requireRoot(cmd)
+			notes, _ := cmd.Flags().GetString("note")
+
+			if all, _ := cmd.Flags().GetBool("all"); all {
+				assignee, _ := cmd.Flags().GetString("assignee")
+				result, err := tlog.CmdUnclaimAll(root, assignee, notes)
+				if err != nil {
+					exitError(err.Error())
+				}
+				if wantJSON(cmd) {
+					printJSON(result)
+					return
+				}
+				ids := result["ids"].([]string)
+				if len(ids) == 0 {
+					fmt.Println("No in-progress tasks")
+				}
+				for _, id := range ids {
+					fmt.Printf("Unclaimed: %s\n", id)
+				}
+				return
+			}
+
+			runBulk(cmd, root, args, func(id string) (map[string]interface{}, error) {
+				return tlog.CmdUnclaim(root, id, notes)
+			}, func(result map[string]interface{}) {
+				fmt.Printf("Unclaimed: %s\n", result["id"])
+			})
+		},
+	}
+	unclaimCmd.Flags().String("note", "", "Append note")
+	unclaimCmd.Flags().Bool("all", false, "Release every in-progress task")
+	unclaimCmd.Flags().String("assignee", "", "With --all, only release tasks assigned to this name")
+	rootCmd.AddCommand(unclaimCmd)
+
+	// Assign command
+	assignCmd := &cobra.Command{
+		Use:   "assign <id> <name>",
+		Short: "Set who owns a task",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if clear, _ := cmd.Flags().GetBool("clear"); clear {
+				return cobra.ExactArgs(1)(cmd, args)
 			}
+			return cobra.ExactArgs(2)(cmd, args)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			root := requireRoot(cmd)
 			id := resolveID(root, args[0])
-			notes, _ := cmd.Flags().GetString("note")
+			assignee := ""
+			if len(args) == 2 {
+				assignee = args[1]
+			}
 
-			result, err := tlog.CmdUnclaim(root, id, notes)
+			result, err := tlog.CmdAssign(root, id, assignee)
 			if err != nil {
 				exitError(err.Error())
 			}
-			fmt.Printf("Unclaimed: %s\n", result["id"])
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
+			if result["assignee"] == "" {
+				fmt.Printf("Unassigned: %s\n", result["id"])
+				return
+			}
+			fmt.Printf("Assigned: %s to %s\n", result["id"], result["assignee"])
 		},
 	}
-	unclaimCmd.Flags().String("note", "", "Append note")
-	rootCmd.AddCommand(unclaimCmd)
+	assignCmd.Flags().Bool("clear", false, "Remove the assignee")
+	rootCmd.AddCommand(assignCmd)
 
 	// Reopen command
-	rootCmd.AddCommand(&cobra.Command{
+	reopenCmd := &cobra.Command{
 		Use:   "reopen <id>",
 		Short: "Reopen task (from done or in_progress)",
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			root, err := tlog.RequireTlog()
-			if err != nil {
-				exitError(err.Error())
-			}
+			root := requireRoot(cmd)
 			id := resolveID(root, args[0])
-			result, err := tlog.CmdReopen(root, id)
+			notes, _ := cmd.Flags().GetString("note")
+			result, err := tlog.CmdReopen(root, id, notes)
 			if err != nil {
 				exitError(err.Error())
 			}
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
 			fmt.Printf("Reopened: %s\n", result["id"])
 		},
-	})
+	}
+	reopenCmd.Flags().String("note", "", "Append note explaining why")
+	rootCmd.AddCommand(reopenCmd)
 
 	// Delete command
 	deleteCmd := &cobra.Command{
-		Use:   "delete <id>",
-		Short: "Delete task (tombstone, removed on compaction)",
+		Use:   "delete <id>...",
+		Short: "Delete tasks (tombstone, removed on compaction)",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			root := requireRoot(cmd)
+			notes, _ := cmd.Flags().GetString("note")
+
+			runBulk(cmd, root, args, func(id string) (map[string]interface{}, error) {
+				return tlog.CmdDelete(root, id, notes)
+			}, func(result map[string]interface{}) {
+				fmt.Printf("Deleted: %s\n", result["id"])
+			})
+		},
+	}
+	deleteCmd.Flags().String("note", "", "Append note explaining deletion")
+	rootCmd.AddCommand(deleteCmd)
+
+	// Archive command
+	archiveCmd := &cobra.Command{
+		Use:   "archive <id>",
+		Short: "Archive task (hidden, but kept with its history through prune)",
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			root, err := tlog.RequireTlog()
+			root := requireRoot(cmd)
+			id := resolveID(root, args[0])
+			notes, _ := cmd.Flags().GetString("note")
+
+			result, err := tlog.CmdArchive(root, id, notes)
 			if err != nil {
 				exitError(err.Error())
 			}
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
+			fmt.Printf("Archived: %s\n", result["id"])
+		},
+	}
+	archiveCmd.Flags().String("note", "", "Append note explaining why")
+	rootCmd.AddCommand(archiveCmd)
+
+	// Move command
+	moveCmd := &cobra.Command{
+		Use:   "move <id>",
+		Short: "Reorder a task before or after another of the same priority",
+		Long:  "Places a task just before or after another task of the same priority. Within a priority, list and ready show moved tasks first, in the order they were placed, then the rest by created time.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			before, _ := cmd.Flags().GetString("before")
+			after, _ := cmd.Flags().GetString("after")
+			if (before == "") == (after == "") {
+				exitError("specify exactly one of --before or --after")
+			}
+			root := requireRoot(cmd)
 			id := resolveID(root, args[0])
-			notes, _ := cmd.Flags().GetString("note")
+			other := resolveID(root, before+after)
 
-			result, err := tlog.CmdDelete(root, id, notes)
+			result, err := tlog.CmdMove(root, id, other, after != "")
 			if err != nil {
 				exitError(err.Error())
 			}
-			fmt.Printf("Deleted: %s\n", result["id"])
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
+			if after != "" {
+				fmt.Printf("Moved: %s after %s\n", id, other)
+			} else {
+				fmt.Printf("Moved: %s before %s\n", id, other)
+			}
 		},
 	}
-	deleteCmd.Flags().String("note", "", "Append note explaining deletion")
-	rootCmd.AddCommand(deleteCmd)
+	moveCmd.Flags().String("before", "", "Place the task just before this one")
+	moveCmd.Flags().String("after", "", "Place the task just after this one")
+	rootCmd.AddCommand(moveCmd)
+
+	// Undelete command
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "undelete <full-id>",
+		Short: "Restore a deleted task (before compaction removes it)",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			root := requireRoot(cmd)
+			result, err := tlog.CmdUndelete(root, args[0])
+			if err != nil {
+				exitError(err.Error())
+			}
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
+			fmt.Printf("Undeleted: %s %q\n", result["id"], result["title"])
+		},
+	})
 
 	// Update command
 	updateCmd := &cobra.Command{
@@ -220,10 +598,7 @@ func init() {
 		Short: "Update task",
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			root, err := tlog.RequireTlog()
-			if err != nil {
-				exitError(err.Error())
-			}
+			root := requireRoot(cmd)
 			id := resolveID(root, args[0])
 
 			title, _ := cmd.Flags().GetString("title")
@@ -231,17 +606,25 @@ func init() {
 			notes, _ := cmd.Flags().GetString("note")
 			labels, _ := cmd.Flags().GetStringSlice("label")
 			priorityStr, _ := cmd.Flags().GetString("priority")
+			force, _ := cmd.Flags().GetBool("force")
 
 			var priority *tlog.Priority
 			if priorityStr != "" {
-				p := tlog.ParsePriority(priorityStr)
+				p, err := tlog.ParsePriorityStrict(priorityStr)
+				if err != nil {
+					exitError(err.Error())
+				}
 				priority = &p
 			}
 
-			result, err := tlog.CmdUpdate(root, id, title, description, notes, labels, priority)
+			result, err := tlog.CmdUpdate(root, id, title, description, notes, labels, priority, estimateFlag(cmd), force)
 			if err != nil {
 				exitError(err.Error())
 			}
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
 			fmt.Printf("Updated: %s\n", result["id"])
 		},
 	}
@@ -250,102 +633,657 @@ func init() {
 	updateCmd.Flags().String("note", "", "Append note")
 	updateCmd.Flags().StringSlice("label", nil, "Set labels (repeatable)")
 	updateCmd.Flags().String("priority", "", "Set priority (critical|high|medium|low|backlog)")
+	updateCmd.Flags().Int("estimate", 0, "Set estimated minutes of work")
+	updateCmd.Flags().Bool("force", false, "Allow labels outside the configured allowed_labels")
 	rootCmd.AddCommand(updateCmd)
 
-	// List command
-	listCmd := &cobra.Command{
-		Use:   "list",
-		Short: "List tasks",
+	// Edit command
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "edit <id>",
+		Short: "Edit a task's title and description in $EDITOR",
+		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			status, _ := cmd.Flags().GetString("status")
-			label, _ := cmd.Flags().GetString("label")
-			priority, _ := cmd.Flags().GetString("priority")
-
-			root, err := tlog.RequireTlog()
+			root := requireRoot(cmd)
+			id := resolveID(root, args[0])
+			result, err := tlog.CmdEdit(root, id)
 			if err != nil {
 				exitError(err.Error())
 			}
-			result, err := tlog.CmdList(root, status, label, priority)
-			if err != nil {
-				exitError(err.Error())
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
 			}
-			tasks := result["tasks"].([]*tlog.Task)
-			if len(tasks) == 0 {
-				fmt.Println("No tasks")
-			} else {
-				for _, t := range tasks {
-					extra := ""
-					if t.Priority != tlog.PriorityMedium {
-						extra = " !" + t.Priority.String()
-					}
-					if len(t.Labels) > 0 {
-						extra += " [" + strings.Join(t.Labels, ", ") + "]"
-					}
-					fmt.Printf("%s  %s (%s)%s\n", t.ID, t.Title, t.Status, extra)
-				}
+			switch result["status"] {
+			case "aborted":
+				fmt.Println("Empty buffer; edit aborted")
+			case "unchanged":
+				fmt.Printf("No changes: %s\n", id)
+			default:
+				fmt.Printf("Updated: %s (%s)\n", id, strings.Join(result["changed"].([]string), ", "))
 			}
 		},
-	}
-	listCmd.Flags().String("status", "open", "Filter by status (open|in_progress|done|all)")
-	listCmd.Flags().String("label", "", "Filter by label")
-	listCmd.Flags().String("priority", "", "Filter by priority (critical|high|medium|low|backlog)")
-	rootCmd.AddCommand(listCmd)
+	})
 
-	// Show command
-	rootCmd.AddCommand(&cobra.Command{
-		Use:   "show <id>",
-		Short: "Show task details",
+	// Template commands
+	templateCmd := &cobra.Command{
+		Use:   "template",
+		Short: "Save tasks as templates for 'create --from-template'",
+	}
+	templateSaveCmd := &cobra.Command{
+		Use:   "save <id> --as <name>",
+		Short: "Save a task's title, description, labels, and priority as a template",
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			root, err := tlog.RequireTlog()
-			if err != nil {
-				exitError(err.Error())
-			}
+			root := requireRoot(cmd)
 			id := resolveID(root, args[0])
-			result, err := tlog.CmdShow(root, id)
+			name, _ := cmd.Flags().GetString("as")
+			result, err := tlog.CmdTemplateSave(root, id, name)
 			if err != nil {
 				exitError(err.Error())
 			}
-			task := result["task"].(*tlog.Task)
-			fmt.Printf("%s: %s\n", task.ID, task.Title)
-			fmt.Printf("Status: %s\n", task.Status)
-			fmt.Printf("Priority: %s\n", task.Priority)
-			if task.Description != "" {
-				fmt.Printf("Description: %s\n", task.Description)
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
 			}
-			if len(task.Labels) > 0 {
-				fmt.Printf("Labels: %s\n", strings.Join(task.Labels, ", "))
+			fmt.Printf("Saved template %s from %s\n", name, id)
+		},
+	}
+	templateSaveCmd.Flags().String("as", "", "Template name")
+	_ = templateSaveCmd.MarkFlagRequired("as")
+	templateCmd.AddCommand(templateSaveCmd)
+	templateCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List saved templates",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			root := requireRoot(cmd)
+			names, err := tlog.ListTemplates(root)
+			if err != nil {
+				exitError(err.Error())
 			}
-			if deps, ok := result["dep_status"].([]map[string]interface{}); ok && len(deps) > 0 {
-				fmt.Print("Deps:")
-				for _, d := range deps {
-					fmt.Printf(" %s(%s)", d["id"], d["status"])
-				}
-				fmt.Println()
+			if wantJSON(cmd) {
+				printJSON(names)
+				return
 			}
-			if task.Commit != "" {
-				fmt.Printf("Commit: %s\n", task.Commit)
+			if len(names) == 0 {
+				fmt.Println("No templates")
+				return
 			}
-			if task.Notes != "" {
-				fmt.Printf("Notes: %s\n", task.Notes)
+			for _, name := range names {
+				fmt.Println(name)
 			}
 		},
 	})
+	rootCmd.AddCommand(templateCmd)
 
-	// Ready command
-	rootCmd.AddCommand(&cobra.Command{
-		Use:   "ready",
-		Short: "List tasks ready to work on",
+	// Note command
+	noteCmd := &cobra.Command{
+		Use:   "note <id> <text>",
+		Short: "Append a note to a task",
+		Args:  cobra.ExactArgs(2),
 		Run: func(cmd *cobra.Command, args []string) {
-			root, err := tlog.RequireTlog()
+			author, _ := cmd.Flags().GetString("author")
+			root := requireRoot(cmd)
+			id := resolveID(root, args[0])
+			result, err := tlog.CmdNote(root, id, args[1], author)
 			if err != nil {
 				exitError(err.Error())
 			}
-			result, err := tlog.CmdReady(root)
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
+			fmt.Printf("Noted: %s\n", result["id"])
+		},
+	}
+	noteCmd.Flags().String("author", "", "Record who wrote the note")
+	rootCmd.AddCommand(noteCmd)
+
+	// Log-time command
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "log-time <id> <minutes>",
+		Short: "Add time spent on a task",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			minutes, err := strconv.Atoi(args[1])
 			if err != nil {
-				exitError(err.Error())
+				exitError(fmt.Sprintf("invalid minutes '%s'", args[1]))
+			}
+
+			root := requireRoot(cmd)
+			id := resolveID(root, args[0])
+			result, err := tlog.CmdLogTime(root, id, minutes)
+			if err != nil {
+				exitError(err.Error())
+			}
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
+			fmt.Printf("Logged: %s +%dm (%dm total)\n", result["id"], minutes, result["time_spent"])
+		},
+	})
+
+	// Rename command
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "rename <id> <new-title>",
+		Short: "Change a task's title",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			root := requireRoot(cmd)
+			id := resolveID(root, args[0])
+			result, err := tlog.CmdRename(root, id, args[1])
+			if err != nil {
+				exitError(err.Error())
+			}
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
+			fmt.Printf("Renamed: %s %q\n", result["id"], result["title"])
+		},
+	})
+
+	// Annotate command
+	annotateCmd := &cobra.Command{
+		Use:   "annotate <id> --key <key> --value <value>",
+		Short: "Set structured key/value metadata on a task",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			key, _ := cmd.Flags().GetString("key")
+			value, _ := cmd.Flags().GetString("value")
+			remove, _ := cmd.Flags().GetBool("remove")
+
+			root := requireRoot(cmd)
+			id := resolveID(root, args[0])
+			result, err := tlog.CmdAnnotate(root, id, key, value, remove)
+			if err != nil {
+				exitError(err.Error())
+			}
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
+			if remove {
+				fmt.Printf("Annotation removed: %s %s\n", result["id"], result["key"])
+			} else {
+				fmt.Printf("Annotated: %s %s=%s\n", result["id"], result["key"], result["value"])
+			}
+		},
+	}
+	annotateCmd.Flags().String("key", "", "Annotation key")
+	annotateCmd.Flags().String("value", "", "Annotation value")
+	annotateCmd.Flags().Bool("remove", false, "Remove the annotation instead of setting it")
+	rootCmd.AddCommand(annotateCmd)
+
+	// Touch command
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "touch <id>",
+		Short: "Mark task as recently active without changing it",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			root := requireRoot(cmd)
+			id := resolveID(root, args[0])
+			result, err := tlog.CmdTouch(root, id)
+			if err != nil {
+				exitError(err.Error())
+			}
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
+			fmt.Printf("Touched: %s\n", result["id"])
+		},
+	})
+
+	// Touch-all command
+	touchAllCmd := &cobra.Command{
+		Use:   "touch-all",
+		Short: "Mark every task matching a filter as recently active",
+		Run: func(cmd *cobra.Command, args []string) {
+			var filter tlog.ListFilter
+			filter.Status, _ = cmd.Flags().GetString("status")
+			filter.Labels, _ = cmd.Flags().GetStringSlice("label")
+			filter.Priority, _ = cmd.Flags().GetString("priority")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			if len(filter.Labels) == 0 && filter.Priority == "" {
+				exitError("touch-all requires --label or --priority")
+			}
+
+			root := requireRoot(cmd)
+			result, err := tlog.CmdTouchAll(root, filter, dryRun)
+			if err != nil {
+				exitError(err.Error())
+			}
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
+			ids := result["ids"].([]string)
+			if len(ids) == 0 {
+				fmt.Println("No matching tasks")
+				return
+			}
+			verb := "Touched"
+			if dryRun {
+				verb = "Would touch"
+			}
+			for _, id := range ids {
+				fmt.Printf("%s: %s\n", verb, id)
+			}
+		},
+	}
+	touchAllCmd.Flags().StringSlice("label", nil, "Touch tasks with this label (repeatable; tasks must have all)")
+	touchAllCmd.Flags().String("priority", "", "Touch tasks with this priority (critical|high|medium|low|backlog)")
+	touchAllCmd.Flags().String("status", "open", "Touch tasks with these statuses, comma-separated (open|in_progress|done|all)")
+	touchAllCmd.Flags().Bool("dry-run", false, "Show which tasks would be touched without writing")
+	rootCmd.AddCommand(touchAllCmd)
+
+	// Relabel-priority command
+	relabelCmd := &cobra.Command{
+		Use:   "relabel-priority",
+		Short: "Move priority:<name> labels into the priority field",
+		Run: func(cmd *cobra.Command, args []string) {
+			root := requireRoot(cmd)
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			result, err := tlog.CmdRelabelPriority(root, dryRun)
+			if err != nil {
+				exitError(err.Error())
+			}
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
+			migrated := result["tasks"].([]map[string]interface{})
+			if len(migrated) == 0 {
+				fmt.Println("No priority labels found")
+				return
+			}
+			verb := "Migrated"
+			if dryRun {
+				verb = "Would migrate"
+			}
+			for _, m := range migrated {
+				fmt.Printf("%s: %s %q -> %s (removed %s)\n", verb, m["id"], m["title"], m["priority"],
+					strings.Join(m["removed"].([]string), ", "))
+			}
+		},
+	}
+	relabelCmd.Flags().Bool("dry-run", false, "Show what would change without writing")
+	rootCmd.AddCommand(relabelCmd)
+
+	// List command
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List tasks",
+		Run: func(cmd *cobra.Command, args []string) {
+			var filter tlog.ListFilter
+			filter.Status, _ = cmd.Flags().GetString("status")
+			filter.Labels, _ = cmd.Flags().GetStringSlice("label")
+			filter.LabelMatch, _ = cmd.Flags().GetString("label-match")
+			filter.ExcludeLabels, _ = cmd.Flags().GetStringSlice("exclude-label")
+			filter.Priority, _ = cmd.Flags().GetString("priority")
+			filter.HasNotes, _ = cmd.Flags().GetBool("has-notes")
+			filter.NoNotes, _ = cmd.Flags().GetBool("no-notes")
+			filter.HasDescription, _ = cmd.Flags().GetBool("has-description")
+			filter.NoDescription, _ = cmd.Flags().GetBool("no-description")
+			filter.Annotation, _ = cmd.Flags().GetString("annotation")
+			filter.Assignee, _ = cmd.Flags().GetString("assignee")
+			filter.Parent, _ = cmd.Flags().GetString("parent")
+			filter.IncludeDeleted, _ = cmd.Flags().GetBool("include-deleted")
+			filter.IncludeArchived, _ = cmd.Flags().GetBool("include-archived")
+			filter.Limit, _ = cmd.Flags().GetInt("limit")
+			filter.Offset, _ = cmd.Flags().GetInt("offset")
+			if filter.Limit < 0 || filter.Offset < 0 {
+				exitError("--limit and --offset cannot be negative")
+			}
+			array, _ := cmd.Flags().GetBool("array")
+			jsonl, _ := cmd.Flags().GetBool("jsonl")
+			groupBy, _ := cmd.Flags().GetString("group-by")
+			depth, _ := cmd.Flags().GetInt("depth")
+			if jsonl && (wantJSON(cmd) || groupBy != "" || depth > 0) {
+				exitError("--jsonl cannot be combined with --json, --group-by, or --depth")
+			}
+
+			root := requireRoot(cmd)
+			result, err := tlog.CmdList(root, filter)
+			if err != nil {
+				exitError(err.Error())
+			}
+			tasks := result["tasks"].([]*tlog.Task)
+
+			if jsonl {
+				if err := tlog.WriteTasksJSONL(os.Stdout, root, tasks); err != nil {
+					exitError(err.Error())
+				}
+				return
+			}
+
+			if groupBy != "" {
+				groups, err := tlog.GroupTasks(tasks, groupBy)
+				if err != nil {
+					exitError(err.Error())
+				}
+				if wantJSON(cmd) {
+					result["groups"] = groups
+					delete(result, "tasks")
+					printJSON(result)
+					return
+				}
+				if len(groups) == 0 {
+					fmt.Println("No tasks")
+				}
+				for i, g := range groups {
+					if i > 0 {
+						fmt.Println()
+					}
+					fmt.Printf("== %s (%d) ==\n", g.Name, len(g.Tasks))
+					for _, t := range g.Tasks {
+						fmt.Println(formatListLine(t))
+					}
+				}
+				return
+			}
+
+			if depth > 0 {
+				tree := tlog.BuildTaskTree(tasks, depth)
+				if wantJSON(cmd) {
+					if array {
+						printJSON(tree)
+						return
+					}
+					result["tasks"] = tree
+					printJSON(result)
+					return
+				}
+				if len(tree) == 0 {
+					fmt.Println("No tasks")
+				}
+				printTaskTree(tree, "")
+				return
+			}
+
+			if wantJSON(cmd) {
+				views, err := tlog.TaskViews(root, tasks)
+				if err != nil {
+					exitError(err.Error())
+				}
+				if array {
+					printJSON(views)
+					return
+				}
+				result["tasks"] = views
+				printJSON(result)
+				return
+			}
+			if len(tasks) == 0 {
+				fmt.Println("No tasks")
+			} else {
+				wide, _ := cmd.Flags().GetBool("wide")
+				if wide {
+					fmt.Printf("%-8s  %-10s  %-10s  %4s  %s\n", "ID", "CREATED", "UPDATED", "AGE", "TITLE")
+				}
+				state, err := tlog.LoadState(root)
+				if err != nil {
+					exitError(err.Error())
+				}
+				now := time.Now()
+				for _, t := range tasks {
+					line := formatListLine(t)
+					if wide {
+						line = formatWideListLine(t, now)
+					}
+					if done, total := tlog.DepProgress(state, t.ID); total > 0 {
+						line += fmt.Sprintf(" (%d/%d)", done, total)
+					}
+					fmt.Println(line)
+				}
+				if total := result["total"].(int); len(tasks) < total {
+					fmt.Printf("(showing %d-%d of %d)\n", result["offset"].(int)+1, result["offset"].(int)+len(tasks), total)
+				}
+			}
+		},
+	}
+	listCmd.Flags().String("status", "open", "Filter by status, comma-separated (open|in_progress|done|all)")
+	listCmd.Flags().Bool("wide", false, "Add created, updated, and age columns")
+	listCmd.Flags().StringSlice("label", nil, "Filter by label (repeatable)")
+	listCmd.Flags().String("label-match", "all", "With several --label flags, require all or any of them (all|any)")
+	listCmd.Flags().StringSlice("exclude-label", nil, "Skip tasks with this label (repeatable)")
+	listCmd.Flags().String("priority", "", "Filter by priority (critical|high|medium|low|backlog)")
+	listCmd.Flags().Bool("has-notes", false, "Only tasks with notes")
+	listCmd.Flags().Bool("no-notes", false, "Only tasks without notes")
+	listCmd.Flags().Bool("has-description", false, "Only tasks with a description")
+	listCmd.Flags().Bool("no-description", false, "Only tasks without a description")
+	listCmd.Flags().String("annotation", "", "Filter by annotation (key=value, or key for presence)")
+	listCmd.Flags().String("assignee", "", "Filter by assignee")
+	listCmd.Flags().String("parent", "", "Only the direct subtasks of this task (the tasks it depends on)")
+	listCmd.Flags().Bool("include-deleted", false, "Include deleted tasks that haven't been pruned yet")
+	listCmd.Flags().Bool("include-archived", false, "Include archived tasks, and those prune --archive moved to .tlog/archive.jsonl")
+	listCmd.Flags().Int("depth", 0, "Indent subtasks under their parents, up to N levels")
+	listCmd.Flags().String("group-by", "", "Print tasks in sections by status, priority, or label")
+	listCmd.Flags().Int("limit", 0, "Show at most N tasks")
+	listCmd.Flags().Int("offset", 0, "Skip the first N matching tasks")
+	listCmd.Flags().Bool("array", false, "With --json, print only the tasks array")
+	listCmd.Flags().Bool("jsonl", false, "Print one JSON task per line (JSON Lines) instead of a table")
+	rootCmd.AddCommand(listCmd)
+
+	// Search command
+	searchCmd := &cobra.Command{
+		Use:   "search <query>",
+		Short: "Find tasks by text in their title, description, or notes",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			field, _ := cmd.Flags().GetString("field")
+
+			root := requireRoot(cmd)
+			result, err := tlog.CmdSearch(root, args[0], field)
+			if err != nil {
+				exitError(err.Error())
+			}
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
 			}
 			tasks := result["tasks"].([]*tlog.Task)
+			if len(tasks) == 0 {
+				fmt.Println("No matching tasks")
+			}
+			for _, t := range tasks {
+				fmt.Println(formatListLine(t))
+			}
+		},
+	}
+	searchCmd.Flags().String("field", "", "Only search this field (title|description|notes)")
+	rootCmd.AddCommand(searchCmd)
+
+	// Show command
+	showCmd := &cobra.Command{
+		Use:   "show <id>",
+		Short: "Show task details",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			root := requireRoot(cmd)
+			id := resolveID(root, args[0])
+			transitive, _ := cmd.Flags().GetBool("transitive-dependents")
+			result, err := tlog.CmdShow(root, id, transitive)
+			if err != nil {
+				exitError(err.Error())
+			}
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
+			task := result["task"].(*tlog.Task)
+			if field, _ := cmd.Flags().GetString("field"); field != "" {
+				value, err := tlog.TaskField(task, field)
+				if err != nil {
+					exitError(err.Error())
+				}
+				fmt.Println(value)
+				return
+			}
+			deps, _ := result["dep_status"].([]map[string]interface{})
+			fmt.Print(tlog.FormatTaskDetail(task, deps))
+			for _, depID := range result["missing_deps"].([]string) {
+				fmt.Fprintf(os.Stderr, "warning: dep %s was deleted; run 'tlog doctor --fix' to remove it\n", depID)
+			}
+			printRelated("Blocks:", result["blocks"].([]map[string]interface{}))
+			printRelated("Blocked by:", result["blocked_by"].([]map[string]interface{}))
+			if closure, ok := result["transitive_dependents"].([]map[string]interface{}); ok {
+				printRelated("Dependents (transitive):", closure)
+			}
+		},
+	}
+	showCmd.Flags().Bool("transitive-dependents", false, "Include every task that ultimately waits on this one")
+	showCmd.Flags().String("field", "", "Print only this field's value (e.g. status, priority, title, description)")
+	rootCmd.AddCommand(showCmd)
+
+	// History command
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "history <id>",
+		Short: "Show every change recorded for a task",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			root := requireRoot(cmd)
+			id := resolveID(root, args[0])
+			events, err := tlog.CmdHistory(root, id)
+			if err != nil {
+				exitError(err.Error())
+			}
+			if wantJSON(cmd) {
+				printJSON(events)
+				return
+			}
+			for _, e := range events {
+				fmt.Printf("%s  %-8s  %s\n", e.Timestamp.Format("2006-01-02 15:04:05"), e.Type, tlog.DescribeEvent(e))
+			}
+		},
+	})
+
+	// Log command
+	logCmd := &cobra.Command{
+		Use:   "log",
+		Short: "Show recent activity across all tasks, newest first",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			root := requireRoot(cmd)
+			var since time.Time
+			if s, _ := cmd.Flags().GetString("since"); s != "" {
+				var err error
+				if since, err = parseSince(s); err != nil {
+					exitError(err.Error())
+				}
+			}
+			limit, _ := cmd.Flags().GetInt("limit")
+			types, _ := cmd.Flags().GetString("type")
+			events, err := tlog.CmdLog(root, since, limit, types)
+			if err != nil {
+				exitError(err.Error())
+			}
+			if wantJSON(cmd) {
+				printJSON(events)
+				return
+			}
+			if len(events) == 0 {
+				fmt.Println("No activity")
+				return
+			}
+			for _, e := range events {
+				fmt.Printf("%s  %s  %-8s  %s\n", e.Timestamp.Format("2006-01-02 15:04:05"), e.ID, e.Type, tlog.DescribeEvent(e))
+			}
+		},
+	}
+	logCmd.Flags().String("since", "", "Only events at or after this date (YYYY-MM-DD) or time (RFC 3339)")
+	logCmd.Flags().Int("limit", 50, "Show at most this many events (0 for all)")
+	logCmd.Flags().String("type", "", "Only these event types, comma-separated (e.g. status,dep)")
+	rootCmd.AddCommand(logCmd)
+
+	// Next command
+	nextCmd := &cobra.Command{
+		Use:   "next",
+		Short: "Show the single highest-priority ready task (exits 1 if none)",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if claim, _ := cmd.Flags().GetBool("claim"); !claim {
+				for _, name := range []string{"note", "by"} {
+					if cmd.Flags().Changed(name) {
+						return fmt.Errorf("--%s requires --claim", name)
+					}
+				}
+			}
+			return cobra.NoArgs(cmd, args)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			root := requireRoot(cmd)
+			claim, _ := cmd.Flags().GetBool("claim")
+			notes, _ := cmd.Flags().GetString("note")
+			by, _ := cmd.Flags().GetString("by")
+			result, err := tlog.CmdNext(root, claim, notes, by)
+			if err != nil {
+				exitError(err.Error())
+			}
+			task, _ := result["task"].(*tlog.Task)
+			if wantJSON(cmd) {
+				printJSON(result)
+			} else if task == nil {
+				fmt.Fprintln(os.Stderr, "nothing ready")
+			} else if claim {
+				fmt.Println(task.ID)
+			} else {
+				fmt.Printf("%s  %s\n", task.ID, task.Title)
+			}
+			if task == nil {
+				os.Exit(1)
+			}
+		},
+	}
+	nextCmd.Flags().Bool("claim", false, "Also claim the task, printing only its ID")
+	nextCmd.Flags().String("note", "", "With --claim, append note")
+	nextCmd.Flags().String("by", "", "With --claim, record who is claiming the task as its assignee")
+	rootCmd.AddCommand(nextCmd)
+
+	// Ready command
+	readyCmd := &cobra.Command{
+		Use:   "ready",
+		Short: "List tasks ready to work on",
+		Run: func(cmd *cobra.Command, args []string) {
+			root := requireRoot(cmd)
+			format, _ := cmd.Flags().GetString("format")
+			limit, _ := cmd.Flags().GetInt("limit")
+			var filter tlog.ListFilter
+			filter.Labels, _ = cmd.Flags().GetStringSlice("label")
+			filter.ExcludeLabels, _ = cmd.Flags().GetStringSlice("exclude-label")
+			order, _ := cmd.Flags().GetString("order")
+
+			switch format {
+			case "", "list":
+			case "prime":
+				if wantJSON(cmd) {
+					exitError("--json cannot be combined with --format prime")
+				}
+				out, err := tlog.CmdReadyDetail(root, filter, order, limit)
+				if err != nil {
+					exitError(err.Error())
+				}
+				fmt.Print(out)
+				return
+			default:
+				exitError(fmt.Sprintf("unknown format '%s' (valid: list, prime)", format))
+			}
+
+			result, err := tlog.CmdReady(root, filter, order)
+			if err != nil {
+				exitError(err.Error())
+			}
+			tasks := result["tasks"].([]*tlog.Task)
+			if limit > 0 && limit < len(tasks) {
+				tasks = tasks[:limit]
+			}
+			if wantJSON(cmd) {
+				result["tasks"] = tasks
+				result["count"] = len(tasks)
+				printJSON(result)
+				return
+			}
 			if len(tasks) == 0 {
 				fmt.Println("No tasks ready")
 			} else {
@@ -361,20 +1299,27 @@ func init() {
 				}
 			}
 		},
-	})
+	}
+	readyCmd.Flags().String("format", "list", "Output format (list|prime); prime includes full task details")
+	readyCmd.Flags().Int("limit", 0, "Show at most N tasks")
+	readyCmd.Flags().StringSlice("label", nil, "Only tasks with this label (repeatable; tasks must have all)")
+	readyCmd.Flags().StringSlice("exclude-label", nil, "Skip tasks with this label (repeatable)")
+	readyCmd.Flags().String("order", "default", "Sort order (default|leverage); leverage prefers tasks that unblock the most work")
+	rootCmd.AddCommand(readyCmd)
 
 	// Backlog command
 	rootCmd.AddCommand(&cobra.Command{
 		Use:   "backlog",
 		Short: "List backlog tasks",
 		Run: func(cmd *cobra.Command, args []string) {
-			root, err := tlog.RequireTlog()
+			root := requireRoot(cmd)
+			result, err := tlog.CmdList(root, tlog.ListFilter{Status: "open", Priority: "backlog"})
 			if err != nil {
 				exitError(err.Error())
 			}
-			result, err := tlog.CmdList(root, "open", "", "backlog")
-			if err != nil {
-				exitError(err.Error())
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
 			}
 			tasks := result["tasks"].([]*tlog.Task)
 			if len(tasks) == 0 {
@@ -400,66 +1345,332 @@ func init() {
 			needs, _ := cmd.Flags().GetStringSlice("needs")
 			remove, _ := cmd.Flags().GetStringSlice("remove")
 
-			if len(needs) == 0 && len(remove) == 0 {
-				exitError("must specify --needs or --remove with one or more task IDs")
+			if len(needs) == 0 && len(remove) == 0 {
+				exitError("must specify --needs or --remove with one or more task IDs")
+			}
+
+			root := requireRoot(cmd)
+			id := resolveID(root, args[0])
+			added, removed := make([]string, 0), make([]string, 0)
+
+			// Add dependencies
+			for _, dep := range needs {
+				depID := resolveID(root, dep)
+				result, err := tlog.CmdDep(root, id, depID, "add")
+				if err != nil {
+					exitError(err.Error())
+				}
+				added = append(added, depID)
+				if !wantJSON(cmd) {
+					fmt.Printf("Dep added: %s -> %s\n", result["id"], result["dep"])
+				}
+			}
+
+			// Remove dependencies
+			for _, dep := range remove {
+				depID := resolveID(root, dep)
+				result, err := tlog.CmdDep(root, id, depID, "remove")
+				if err != nil {
+					exitError(err.Error())
+				}
+				removed = append(removed, depID)
+				if !wantJSON(cmd) {
+					fmt.Printf("Dep removed: %s -> %s\n", result["id"], result["dep"])
+				}
+			}
+
+			if wantJSON(cmd) {
+				printJSON(map[string]interface{}{"id": id, "added": added, "removed": removed})
+			}
+		},
+	}
+	depCmd.Flags().StringSlice("needs", nil, "Add dependencies (task must complete before this one)")
+	depCmd.Flags().StringSlice("remove", nil, "Remove dependencies")
+	rootCmd.AddCommand(depCmd)
+
+	// Block command
+	blockCmd := &cobra.Command{
+		Use:   "block <id> --on <blocker-ids...>",
+		Short: "Record that other tasks block this one (informational)",
+		Long:  "Records that a task is blocked by others. Unlike deps, blocks are informational: they show up in show and graph output but don't keep a task out of ready.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			on, _ := cmd.Flags().GetStringSlice("on")
+			remove, _ := cmd.Flags().GetStringSlice("remove")
+
+			if len(on) == 0 && len(remove) == 0 {
+				exitError("must specify --on or --remove with one or more task IDs")
+			}
+
+			root := requireRoot(cmd)
+			id := resolveID(root, args[0])
+			added, removed := make([]string, 0), make([]string, 0)
+
+			for _, other := range on {
+				blockerID := resolveID(root, other)
+				if _, err := tlog.CmdBlock(root, id, blockerID, "add"); err != nil {
+					exitError(err.Error())
+				}
+				added = append(added, blockerID)
+				if !wantJSON(cmd) {
+					fmt.Printf("Block added: %s blocked by %s\n", id, blockerID)
+				}
+			}
+
+			for _, other := range remove {
+				blockerID := resolveID(root, other)
+				if _, err := tlog.CmdBlock(root, id, blockerID, "remove"); err != nil {
+					exitError(err.Error())
+				}
+				removed = append(removed, blockerID)
+				if !wantJSON(cmd) {
+					fmt.Printf("Block removed: %s no longer blocked by %s\n", id, blockerID)
+				}
+			}
+
+			if wantJSON(cmd) {
+				printJSON(map[string]interface{}{"id": id, "added": added, "removed": removed})
+			}
+		},
+	}
+	blockCmd.Flags().StringSlice("on", nil, "Tasks that block this one")
+	blockCmd.Flags().StringSlice("remove", nil, "Tasks that no longer block this one")
+	rootCmd.AddCommand(blockCmd)
+
+	// Graph command
+	graphCmd := &cobra.Command{
+		Use:   "graph",
+		Short: "Show dependency tree",
+		Run: func(cmd *cobra.Command, args []string) {
+			root := requireRoot(cmd)
+
+			if orphans, _ := cmd.Flags().GetBool("orphans"); orphans {
+				result, err := tlog.CmdOrphans(root)
+				if err != nil {
+					exitError(err.Error())
+				}
+				if wantJSON(cmd) {
+					printJSON(result)
+					return
+				}
+				tasks := result["tasks"].([]*tlog.Task)
+				if len(tasks) == 0 {
+					fmt.Println("No orphan tasks")
+				}
+				for _, t := range tasks {
+					extra := ""
+					if t.Priority != tlog.PriorityMedium {
+						extra = " !" + t.Priority.String()
+					}
+					fmt.Printf("%s  %s%s\n", t.ID, t.Title, extra)
+				}
+				return
+			}
+
+			if cycles, _ := cmd.Flags().GetBool("cycles"); cycles {
+				result, err := tlog.CmdCycles(root)
+				if err != nil {
+					exitError(err.Error())
+				}
+				chains := result["cycles"].([][]map[string]interface{})
+				if wantJSON(cmd) {
+					printJSON(result)
+					if len(chains) > 0 {
+						os.Exit(1)
+					}
+					return
+				}
+				if len(chains) == 0 {
+					fmt.Println("No cycles")
+					return
+				}
+				for _, chain := range chains {
+					parts := make([]string, 0, len(chain)+1)
+					for _, t := range chain {
+						parts = append(parts, fmt.Sprintf("%s (%s)", t["id"], t["title"]))
+					}
+					parts = append(parts, chain[0]["id"].(string))
+					fmt.Println(strings.Join(parts, " -> "))
+				}
+				fmt.Fprintf(os.Stderr, "error: %d dependency cycle(s) found\n", len(chains))
+				os.Exit(1)
+			}
+
+			switch format, _ := cmd.Flags().GetString("format"); format {
+			case "", "tree":
+			case "gantt":
+				if wantJSON(cmd) {
+					exitError("--json cannot be combined with --format gantt")
+				}
+				groupBy, _ := cmd.Flags().GetString("group-by")
+				out, err := tlog.CmdGantt(root, groupBy)
+				if err != nil {
+					exitError(err.Error())
+				}
+				fmt.Print(out)
+				return
+			case "dot":
+				if wantJSON(cmd) {
+					exitError("--json cannot be combined with --format dot")
+				}
+				out, err := tlog.CmdDOT(root)
+				if err != nil {
+					exitError(err.Error())
+				}
+				fmt.Print(out)
+				return
+			case "mermaid":
+				if wantJSON(cmd) {
+					exitError("--json cannot be combined with --format mermaid")
+				}
+				out, err := tlog.CmdMermaid(root)
+				if err != nil {
+					exitError(err.Error())
+				}
+				fmt.Print(out)
+				return
+			default:
+				exitError(fmt.Sprintf("unknown format '%s' (valid: tree, gantt, dot, mermaid)", format))
+			}
+
+			if wantJSON(cmd) {
+				graph, err := tlog.CmdGraphData(root)
+				if err != nil {
+					exitError(err.Error())
+				}
+				printJSON(graph)
+				return
+			}
+
+			pruneDoneLeaves, _ := cmd.Flags().GetBool("prune-done-leaves")
+			result, err := tlog.CmdGraph(root, pruneDoneLeaves)
+			if err != nil {
+				exitError(err.Error())
 			}
+			fmt.Print(result)
+		},
+	}
+	graphCmd.Flags().Bool("orphans", false, "List active tasks with no deps and no dependents")
+	graphCmd.Flags().String("format", "tree", "Output format (tree|gantt|dot|mermaid); gantt emits a Mermaid Gantt chart, dot a Graphviz graph, mermaid a Mermaid flowchart")
+	graphCmd.Flags().String("group-by", "priority", "Gantt sections (priority|label)")
+	graphCmd.Flags().Bool("prune-done-leaves", false, "Collapse fully done branches, marking the parent \"(all subtasks done)\"")
+	graphCmd.Flags().Bool("cycles", false, "Report dependency cycles and exit non-zero if any exist")
+	rootCmd.AddCommand(graphCmd)
+
+	// Doctor command
+	doctorCmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check for dangling deps, cycles, and corrupt tasks",
+		Long:  "Checks the task graph for integrity problems. With --fix, appends events that repair them: dangling deps are removed, cycles are broken and the tasks on them closed as wontfix, and corrupt tasks are deleted. Use --dry-run to preview fixes. Exits non-zero if unfixed issues remain. Also warns about suspicious history: events filed under a different day than their timestamp, and done tasks taken out of done without a reopen. Warnings don't affect the exit status.",
+		Run: func(cmd *cobra.Command, args []string) {
+			root := requireRoot(cmd)
+			fix, _ := cmd.Flags().GetBool("fix")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
 
-			root, err := tlog.RequireTlog()
+			result, err := tlog.CmdDoctor(root, fix, dryRun)
 			if err != nil {
 				exitError(err.Error())
 			}
-			id := resolveID(root, args[0])
 
-			// Add dependencies
-			for _, dep := range needs {
-				depID := resolveID(root, dep)
-				result, err := tlog.CmdDep(root, id, depID, "add")
-				if err != nil {
-					exitError(err.Error())
+			if wantJSON(cmd) {
+				printJSON(result)
+				if result["fixed"] != true {
+					os.Exit(1)
 				}
-				fmt.Printf("Dep added: %s -> %s\n", result["id"], result["dep"])
+				return
 			}
 
-			// Remove dependencies
-			for _, dep := range remove {
-				depID := resolveID(root, dep)
-				result, err := tlog.CmdDep(root, id, depID, "remove")
-				if err != nil {
-					exitError(err.Error())
+			for _, w := range result["warnings"].([]tlog.DoctorIssue) {
+				fmt.Printf("warning: %s  %s  %s\n", w.Type, w.ID, w.Message)
+			}
+			issues := result["issues"].([]tlog.DoctorIssue)
+			if len(issues) == 0 {
+				fmt.Println("No issues found")
+				return
+			}
+			for _, issue := range issues {
+				fmt.Printf("%s  %s  %s\n", issue.Type, issue.ID, issue.Message)
+			}
+
+			if fixes, ok := result["fixes"].([]string); ok {
+				verb := "Fixed"
+				if dryRun {
+					verb = "Would fix"
+				}
+				for _, f := range fixes {
+					fmt.Printf("%s: %s\n", verb, f)
 				}
-				fmt.Printf("Dep removed: %s -> %s\n", result["id"], result["dep"])
+			}
+			if result["fixed"] != true {
+				os.Exit(1)
 			}
 		},
 	}
-	depCmd.Flags().StringSlice("needs", nil, "Add dependencies (task must complete before this one)")
-	depCmd.Flags().StringSlice("remove", nil, "Remove dependencies")
-	rootCmd.AddCommand(depCmd)
+	doctorCmd.Flags().Bool("fix", false, "Append events that repair the issues found")
+	doctorCmd.Flags().Bool("dry-run", false, "Show what --fix would change without writing")
+	rootCmd.AddCommand(doctorCmd)
 
-	// Graph command
-	rootCmd.AddCommand(&cobra.Command{
-		Use:   "graph",
-		Short: "Show dependency tree",
+	// Validate command
+	validateCmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check the repo's on-disk format against this tlog",
+		Long:  "With --schema-version, compares the schema version recorded in .tlog/meta.json with the one this binary reads and writes. Exits non-zero on a mismatch. Repos created before meta.json existed are unversioned and always pass.",
+		Args:  cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			root, err := tlog.RequireTlog()
+			if schemaVersion, _ := cmd.Flags().GetBool("schema-version"); !schemaVersion {
+				exitError("nothing to validate (use --schema-version)")
+			}
+
+			root, err := findRoot(cmd)
 			if err != nil {
 				exitError(err.Error())
 			}
-			result, err := tlog.CmdGraph(root)
+			meta, err := tlog.ReadMeta(root)
 			if err != nil {
 				exitError(err.Error())
 			}
-			fmt.Print(result)
+			checkErr := tlog.CheckSchemaVersion(root)
+
+			if wantJSON(cmd) {
+				result := map[string]interface{}{
+					"repo":   meta.SchemaVersion,
+					"binary": tlog.SchemaVersion,
+					"ok":     checkErr == nil,
+				}
+				if checkErr != nil {
+					result["error"] = checkErr.Error()
+				}
+				printJSON(result)
+			} else {
+				repo := fmt.Sprint(meta.SchemaVersion)
+				if meta.SchemaVersion == 0 {
+					repo = "unversioned"
+				}
+				fmt.Printf("Repo schema version: %s\n", repo)
+				fmt.Printf("tlog schema version: %d\n", tlog.SchemaVersion)
+				if checkErr != nil {
+					fmt.Fprintf(os.Stderr, "error: %s\n", checkErr)
+				}
+			}
+			if checkErr != nil {
+				os.Exit(1)
+			}
 		},
-	})
+	}
+	validateCmd.Flags().Bool("schema-version", false, "Compare the repo's schema version with this tlog's")
+	rootCmd.AddCommand(validateCmd)
 
 	// Prime command
 	rootCmd.AddCommand(&cobra.Command{
 		Use:   "prime",
 		Short: "Get AI agent context",
 		Run: func(cmd *cobra.Command, args []string) {
-			root, err := tlog.GetTlogRoot()
+			root, err := findRoot(cmd)
 			if err != nil {
-				// Silently exit if tlog not initialized
+				// Silently exit if tlog not initialized, but not if --dir is wrong
+				if dir, _ := cmd.Flags().GetString("dir"); dir != "" {
+					exitError(err.Error())
+				}
 				return
 			}
 			cliRef := generateCLIReference()
@@ -471,19 +1682,64 @@ func init() {
 		},
 	})
 
-	// Labels command
+	// Stats command
 	rootCmd.AddCommand(&cobra.Command{
-		Use:   "labels",
-		Short: "Show labels in use and conventions",
+		Use:   "stats",
+		Short: "Summarize tasks by status, priority, and label",
+		Args:  cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			root, err := tlog.RequireTlog()
+			root := requireRoot(cmd)
+			result, err := tlog.CmdStats(root)
 			if err != nil {
 				exitError(err.Error())
 			}
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
+
+			byStatus := result["by_status"].(map[string]int)
+			byPriority := result["by_priority"].(map[string]int)
+			fmt.Printf("Tasks: %d\n", result["total"])
+			fmt.Printf("  %-12s %d\n", "open", byStatus["open"])
+			fmt.Printf("  %-12s %d\n", "in_progress", byStatus["in_progress"])
+			fmt.Printf("  %-12s %d\n", "done", byStatus["done"])
+			fmt.Printf("Ready: %d  Blocked: %d\n", result["ready"], result["blocked"])
+			fmt.Println("Priority:")
+			for _, p := range []string{"critical", "high", "medium", "low", "backlog"} {
+				fmt.Printf("  %-12s %d\n", p, byPriority[p])
+			}
+			if byLabel := result["by_label"].(map[string]int); len(byLabel) > 0 {
+				labels := make([]string, 0, len(byLabel))
+				for label := range byLabel {
+					labels = append(labels, label)
+				}
+				sort.Strings(labels)
+				fmt.Println("Labels:")
+				for _, label := range labels {
+					fmt.Printf("  %-12s %d\n", label, byLabel[label])
+				}
+			}
+			if oldest, ok := result["oldest_open"].(map[string]interface{}); ok {
+				fmt.Printf("Oldest open: %s  %s (%s old)\n", oldest["id"], oldest["title"], oldest["age"])
+			}
+		},
+	})
+
+	// Labels command
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "labels",
+		Short: "Show labels in use and conventions",
+		Run: func(cmd *cobra.Command, args []string) {
+			root := requireRoot(cmd)
 			result, err := tlog.CmdLabels(root)
 			if err != nil {
 				exitError(err.Error())
 			}
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
 			inUse := result["in_use"].([]string)
 			if len(inUse) > 0 {
 				fmt.Println("Labels in use:")
@@ -497,22 +1753,117 @@ func init() {
 	})
 
 	// Sync command
-	rootCmd.AddCommand(&cobra.Command{
+	syncCmd := &cobra.Command{
 		Use:   "sync <message>",
 		Short: "Commit .tlog to git",
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			message := args[0]
+			amend, _ := cmd.Flags().GetBool("amend")
+			push, _ := cmd.Flags().GetBool("push")
+
+			root := requireRoot(cmd)
+			result, err := tlog.CmdSync(root, message, amend, push)
+			if err != nil {
+				exitError(err.Error())
+			}
+			if warning, ok := result["warning"].(string); ok {
+				fmt.Fprintln(os.Stderr, "warning: "+warning)
+			}
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
+			switch {
+			case result["status"] != "synced":
+				fmt.Println("Nothing to sync")
+			case result["amended"] == true:
+				fmt.Printf("Synced (amended): %s\n", result["message"])
+			default:
+				fmt.Printf("Synced: %s\n", result["message"])
+			}
+			if result["pushed"] == true {
+				fmt.Println("Pushed")
+			}
+		},
+	}
+	syncCmd.Flags().Bool("amend", false, "Amend the previous commit instead of creating one, if it only touches .tlog")
+	syncCmd.Flags().Bool("push", false, "Run git push after committing")
+	rootCmd.AddCommand(syncCmd)
 
-			root, err := tlog.RequireTlog()
+	// Scan-commits command
+	scanCommitsCmd := &cobra.Command{
+		Use:   "scan-commits",
+		Short: "Mark tasks done from Closes: trailers in commit messages",
+		Long:  "Reads the project's commit messages since the last scan and marks each task named in a \"Closes: <id>\" line done, recording the commit SHA. Tasks already done are skipped; IDs that match no task are reported as warnings and skipped.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			root := requireRoot(cmd)
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			result, err := tlog.CmdScanCommits(root, dryRun)
 			if err != nil {
 				exitError(err.Error())
 			}
-			result, err := tlog.CmdSync(root, message)
+			for _, warning := range result["warnings"].([]string) {
+				fmt.Fprintln(os.Stderr, "warning: "+warning)
+			}
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
+			verb := "Closed"
+			if dryRun {
+				verb = "Would close"
+			}
+			closed := result["closed"].([]map[string]interface{})
+			for _, c := range closed {
+				fmt.Printf("%s: %s  %s (commit %.7s)\n", verb, c["id"], c["title"], c["commit"])
+			}
+			for _, id := range result["skipped"].([]string) {
+				fmt.Printf("Already done: %s\n", id)
+			}
+			if len(closed) == 0 {
+				fmt.Printf("No tasks to close in %d new commits\n", result["commits"])
+			}
+		},
+	}
+	scanCommitsCmd.Flags().Bool("dry-run", false, "Show what would be closed without writing")
+	rootCmd.AddCommand(scanCommitsCmd)
+
+	// Events command
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "events",
+		Short: "Summarize the event log",
+		Run: func(cmd *cobra.Command, args []string) {
+			root := requireRoot(cmd)
+			result, err := tlog.CmdEvents(root)
 			if err != nil {
 				exitError(err.Error())
 			}
-			fmt.Printf("Synced: %s\n", result["message"])
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
+
+			fmt.Printf("Events: %d in %d file(s)\n", result["total"], result["files"])
+			byType := result["by_type"].(map[string]int)
+			types := make([]string, 0, len(byType))
+			for t := range byType {
+				types = append(types, t)
+			}
+			sort.Strings(types)
+			for _, t := range types {
+				fmt.Printf("  %-10s %d\n", t, byType[t])
+			}
+			if first, ok := result["first"].(time.Time); ok {
+				last := result["last"].(time.Time)
+				fmt.Printf("Range: %s to %s\n", first.Format("2006-01-02"), last.Format("2006-01-02"))
+			}
+			if result["compacted"].(bool) {
+				fmt.Println("Compacted snapshot: yes")
+			} else {
+				fmt.Println("Compacted snapshot: no")
+			}
 		},
 	})
 
@@ -522,32 +1873,58 @@ func init() {
 		Short: "Compact files and remove done tasks",
 		Long:  "Compacts old event files and removes done tasks in a single pass. Use --save-days to preserve recently completed tasks, or --keep-all to skip pruning entirely (just compact).",
 		Run: func(cmd *cobra.Command, args []string) {
-			root, err := tlog.RequireTlog()
-			if err != nil {
-				exitError(err.Error())
+			root := requireRoot(cmd)
+			var opts tlog.PruneOptions
+			opts.SaveDays, _ = cmd.Flags().GetInt("save-days")
+			opts.KeepAll, _ = cmd.Flags().GetBool("keep-all")
+			opts.DryRun, _ = cmd.Flags().GetBool("dry-run")
+			opts.Archive, _ = cmd.Flags().GetBool("archive")
+			opts.Log, _ = cmd.Flags().GetBool("log")
+			opts.MaxAge, _ = cmd.Flags().GetInt("max-age")
+			opts.All, _ = cmd.Flags().GetBool("all")
+			keepAll, archive := opts.KeepAll, opts.Archive
+			if archive && keepAll {
+				exitError("--archive and --keep-all cannot be combined")
+			}
+			if opts.MaxAge < 0 {
+				exitError("--max-age cannot be negative")
+			}
+			if opts.All && opts.MaxAge > 0 {
+				exitError("--all and --max-age cannot be combined")
 			}
-			saveDays, _ := cmd.Flags().GetInt("save-days")
-			keepAll, _ := cmd.Flags().GetBool("keep-all")
-			dryRun, _ := cmd.Flags().GetBool("dry-run")
 
-			result, err := tlog.CmdPrune(root, saveDays, keepAll, dryRun)
+			result, err := tlog.CmdPrune(root, opts)
 			if err != nil {
 				exitError(err.Error())
 			}
 
+			if wantJSON(cmd) {
+				printJSON(result)
+				return
+			}
 			status := result["status"].(string)
 			if status == "nothing to prune" {
-				fmt.Println("Nothing to prune (only today's file exists)")
+				if opts.MaxAge > 0 {
+					fmt.Printf("Nothing to prune (no event files older than %d days)\n", opts.MaxAge)
+				} else if opts.All {
+					fmt.Println("Nothing to prune (no event files)")
+				} else {
+					fmt.Println("Nothing to prune (only today's file exists)")
+				}
 				return
 			}
 
 			tasksBefore := result["tasks_before"].(int)
 			tasksAfter := result["tasks_after"].(int)
 			pruned := result["pruned"].(int)
+			archived := result["archived"].(int)
 
 			if strings.HasPrefix(status, "dry run") {
 				if keepAll {
 					fmt.Printf("Dry run: would compact %d tasks (no pruning)\n", tasksBefore)
+				} else if archive {
+					fmt.Printf("Dry run: would archive %d done tasks (%d -> %d tasks)\n",
+						archived, tasksBefore, tasksAfter)
 				} else {
 					fmt.Printf("Dry run: would prune %d done tasks (%d -> %d tasks)\n",
 						pruned, tasksBefore, tasksAfter)
@@ -557,6 +1934,9 @@ func init() {
 
 			if status == "compacted" {
 				fmt.Printf("Compacted: %d tasks (no pruning)\n", tasksAfter)
+			} else if archive {
+				fmt.Printf("Archived: %d done tasks moved to %s (%d -> %d tasks)\n",
+					archived, tlog.ArchiveFile, tasksBefore, tasksAfter)
 			} else {
 				fmt.Printf("Pruned: %d done tasks removed (%d -> %d tasks)\n",
 					pruned, tasksBefore, tasksAfter)
@@ -566,7 +1946,235 @@ func init() {
 	pruneCmd.Flags().Int("save-days", 0, "Preserve done tasks from the last N days")
 	pruneCmd.Flags().Bool("keep-all", false, "Compact only, do not remove done tasks")
 	pruneCmd.Flags().Bool("dry-run", false, "Show what would be pruned without making changes")
+	pruneCmd.Flags().Int("max-age", 0, "Only compact dated files older than N days")
+	pruneCmd.Flags().Bool("all", false, "Include today's file, leaving a single compacted file")
+	pruneCmd.Flags().Bool("archive", false, "Move pruned done tasks to .tlog/archive.jsonl instead of removing them")
+	pruneCmd.Flags().Bool("log", false, "Append a summary line per removed task to .tlog/prune.log")
 	rootCmd.AddCommand(pruneCmd)
+
+	// Serve command
+	serveCmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the board as a JSON HTTP API",
+		Long:  "Starts an HTTP server exposing the board as JSON: GET /tasks, GET /tasks/{id}, and GET /ready, plus POST /tasks to create a task from a JSON task spec when --write is set. The board is read-only by default.",
+		Run: func(cmd *cobra.Command, args []string) {
+			root := requireRoot(cmd)
+			addr, _ := cmd.Flags().GetString("addr")
+			write, _ := cmd.Flags().GetBool("write")
+
+			mode := "read-only"
+			if write {
+				mode = "read-write"
+			}
+			fmt.Fprintf(os.Stderr, "Serving %s on %s (%s)\n", root, addr, mode)
+			server := &http.Server{
+				Addr:              addr,
+				Handler:           tlog.NewServer(root, write),
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			if err := server.ListenAndServe(); err != nil {
+				exitError(err.Error())
+			}
+		},
+	}
+	serveCmd.Flags().String("addr", "localhost:8080", "Address to listen on")
+	serveCmd.Flags().Bool("write", false, "Allow creating tasks with POST /tasks")
+	rootCmd.AddCommand(serveCmd)
+
+	// MCP command
+	mcpCmd := &cobra.Command{
+		Use:   "mcp",
+		Short: "Run a Model Context Protocol server over stdio",
+		Long:  "Speaks the Model Context Protocol (MCP) on stdin and stdout, so AI assistants can call tlog directly. Tools: list, list_ready, show, prime, claim, create_task, and mark_done; mark_done follows verify_done like tlog done. Add it to an assistant's MCP config with the command \"tlog mcp\".",
+		Run: func(cmd *cobra.Command, args []string) {
+			root := requireRoot(cmd)
+			if err := tlog.ServeMCP(root, generateCLIReference(), os.Stdin, os.Stdout); err != nil {
+				exitError(err.Error())
+			}
+		},
+	}
+	rootCmd.AddCommand(mcpCmd)
+
+	// Watch command
+	watchCmd := &cobra.Command{
+		Use:   "watch [command...]",
+		Short: "Re-run a command whenever the event log changes",
+		Long:  "Clears the screen and re-runs a tlog command (ready by default) each time an event is appended, like tail -f for the board. Arguments are the command to run, after any watch flags, e.g. tlog watch --interval 5s list --status all.",
+		Run: func(cmd *cobra.Command, args []string) {
+			root := requireRoot(cmd)
+			interval, _ := cmd.Flags().GetDuration("interval")
+			if interval <= 0 {
+				exitError("--interval must be positive")
+			}
+			if len(args) == 0 {
+				args = []string{"ready"}
+			}
+			self, err := os.Executable()
+			if err != nil {
+				exitError(err.Error())
+			}
+
+			render := func() {
+				fmt.Print("\033[H\033[2J")
+				fmt.Printf("tlog %s  (%s, Ctrl-C to stop)\n\n", strings.Join(args, " "), time.Now().Format("15:04:05"))
+				run := exec.Command(self, append(args, "--dir", root)...)
+				run.Stdout = os.Stdout
+				run.Stderr = os.Stderr
+				// A failing command is shown like any other output
+				_ = run.Run()
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			render()
+			if err := tlog.WatchEvents(ctx, root, interval, render); err != nil {
+				exitError(err.Error())
+			}
+		},
+	}
+	watchCmd.Flags().Duration("interval", time.Second, "How often to check for new events")
+	// Flags after the command name belong to the watched command
+	watchCmd.Flags().SetInterspersed(false)
+	rootCmd.AddCommand(watchCmd)
+
+	registerCompletions()
+}
+
+// formatListLine renders a task as a single list line
+func formatListLine(t *tlog.Task) string {
+	extra := ""
+	if t.Priority != tlog.PriorityMedium {
+		extra = " !" + t.Priority.String()
+	}
+	if len(t.Labels) > 0 {
+		extra += " [" + strings.Join(t.Labels, ", ") + "]"
+	}
+	if t.Deleted {
+		extra += " (deleted)"
+	}
+	if t.Archived {
+		extra += " (archived)"
+	}
+	return fmt.Sprintf("%s  %s (%s)%s", t.ID, t.Title, t.Status, extra)
+}
+
+// formatWideListLine renders a task as a list line with created and updated
+// dates and age columns ahead of the variable-width title
+func formatWideListLine(t *tlog.Task, now time.Time) string {
+	return fmt.Sprintf("%-8s  %-10s  %-10s  %4s  %s", t.ID,
+		t.Created.Format("2006-01-02"), t.Updated.Format("2006-01-02"),
+		tlog.FormatAge(now.Sub(t.Created)), strings.TrimPrefix(formatListLine(t), t.ID+"  "))
+}
+
+// printRelated prints a heading followed by id(status) for each related task,
+// or nothing if there are none
+func printRelated(heading string, related []map[string]interface{}) {
+	if len(related) == 0 {
+		return
+	}
+	fmt.Print(heading)
+	for _, r := range related {
+		fmt.Printf(" %s(%s)", r["id"], r["status"])
+	}
+	fmt.Println()
+}
+
+// printTaskTree prints nested list lines, indenting two spaces per level
+func printTaskTree(nodes []*tlog.TaskTreeNode, indent string) {
+	for _, n := range nodes {
+		line := indent + formatListLine(n.Task)
+		if n.Cycle {
+			line += " (dependency cycle)"
+		}
+		fmt.Println(line)
+		printTaskTree(n.Subtasks, indent+"  ")
+	}
+}
+
+// estimateFlag returns the --estimate value, or nil if it wasn't given
+func estimateFlag(cmd *cobra.Command) *int {
+	if !cmd.Flags().Changed("estimate") {
+		return nil
+	}
+	estimate, _ := cmd.Flags().GetInt("estimate")
+	return &estimate
+}
+
+// findRoot returns the --dir tlog root if set, otherwise searches up from cwd
+func findRoot(cmd *cobra.Command) (string, error) {
+	if dir, _ := cmd.Flags().GetString("dir"); dir != "" {
+		return tlog.OpenTlog(dir)
+	}
+	return tlog.GetTlogRoot()
+}
+
+// requireRoot finds the tlog root, exiting if there is none. A schema
+// version mismatch is a warning, or fatal with --strict.
+func requireRoot(cmd *cobra.Command) string {
+	root, err := findRoot(cmd)
+	if err != nil {
+		exitError(err.Error())
+	}
+	if err := tlog.CheckSchemaVersion(root); err != nil {
+		if strict, _ := cmd.Flags().GetBool("strict"); strict {
+			exitError(err.Error())
+		}
+		fmt.Fprintf(os.Stderr, "warning: %s\n", err)
+	}
+	return root
+}
+
+// autoSync commits .tlog after a command that changed it, when config.json
+// sets auto_sync. Failures are warnings: the command itself succeeded.
+func autoSync(cmd *cobra.Command, args []string) {
+	root, err := findRoot(cmd)
+	if err != nil {
+		return
+	}
+	cfg, err := tlog.LoadConfig(root)
+	if err != nil || !cfg.AutoSync {
+		return
+	}
+
+	changes, err := tlog.LogChanges(root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: auto_sync: %s\n", err)
+		return
+	}
+	if len(changes) == 0 {
+		return
+	}
+	message := strings.TrimSpace(cmd.CommandPath() + " " + strings.Join(args, " "))
+	if _, err := tlog.CmdSync(root, message, false, false); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: auto_sync: %s\n", err)
+	}
+}
+
+// parseSince parses a --since value: a date (midnight UTC) or an RFC 3339 time
+func parseSince(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --since '%s' (use YYYY-MM-DD or RFC 3339)", s)
+	}
+	return t, nil
+}
+
+// wantJSON reports whether the --json output flag is set
+func wantJSON(cmd *cobra.Command) bool {
+	v, _ := cmd.Flags().GetBool("json")
+	return v
+}
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		exitError(err.Error())
+	}
+	fmt.Println(string(data))
 }
 
 func exitError(msg string) {
@@ -574,19 +2182,155 @@ func exitError(msg string) {
 	os.Exit(1)
 }
 
+// openInput opens a file for reading, or stdin when path is "-"
+func openInput(path string) io.ReadCloser {
+	if path == "-" {
+		return io.NopCloser(os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		exitError(err.Error())
+	}
+	return f
+}
+
+// runCreateFromSpec creates a task from a JSON spec given as an argument or on stdin
+func runCreateFromSpec(cmd *cobra.Command, args []string) {
+	var data []byte
+	if len(args) == 1 {
+		data = []byte(args[0])
+	} else {
+		var err error
+		data, err = io.ReadAll(os.Stdin)
+		if err != nil {
+			exitError(err.Error())
+		}
+	}
+
+	spec, err := tlog.ParseTaskSpec(data)
+	if err != nil {
+		exitError(err.Error())
+	}
+
+	root := requireRoot(cmd)
+
+	force, _ := cmd.Flags().GetBool("force")
+	result, err := tlog.CmdCreateFromSpec(root, spec, force)
+	if err != nil {
+		exitError(err.Error())
+	}
+	if wantJSON(cmd) {
+		printJSON(result)
+		return
+	}
+	fmt.Printf("Created: %s %q\n", result["id"], result["title"])
+}
+
+// isSpecArg reports whether a create argument is a JSON task spec rather
+// than a title
+func isSpecArg(arg string) bool {
+	return strings.HasPrefix(strings.TrimSpace(arg), "{")
+}
+
+// runCreateFromTemplate creates a task from a saved template. A title
+// argument and the create flags override the template's fields; labels add
+// to its labels.
+func runCreateFromTemplate(cmd *cobra.Command, args []string, name string) {
+	root := requireRoot(cmd)
+	spec, err := tlog.LoadTemplate(root, name)
+	if err != nil {
+		exitError(err.Error())
+	}
+
+	if len(args) == 1 {
+		spec.Title = args[0]
+	}
+	if description, _ := cmd.Flags().GetString("description"); description != "" {
+		spec.Description = description
+	}
+	if priority, _ := cmd.Flags().GetString("priority"); priority != "" {
+		spec.Priority = priority
+	}
+	labels, _ := cmd.Flags().GetStringSlice("label")
+	for _, label := range labels {
+		if !slices.Contains(spec.Labels, label) {
+			spec.Labels = append(spec.Labels, label)
+		}
+	}
+	if notes, _ := cmd.Flags().GetString("note"); notes != "" {
+		spec.Notes = notes
+	}
+	deps, _ := cmd.Flags().GetStringSlice("dep")
+	spec.Deps = append(spec.Deps, deps...)
+	if forParent, _ := cmd.Flags().GetString("for"); forParent != "" {
+		spec.For = forParent
+	}
+
+	force, _ := cmd.Flags().GetBool("force")
+	result, err := tlog.CmdCreateFromSpec(root, spec, force)
+	if err != nil {
+		exitError(err.Error())
+	}
+	if wantJSON(cmd) {
+		printJSON(result)
+		return
+	}
+	fmt.Printf("Created: %s %q\n", result["id"], result["title"])
+}
+
+// resolveID resolves an ID prefix, or failing that a title substring, to a
+// full task ID, exiting on failure
 func resolveID(root, prefix string) string {
-	events, err := tlog.LoadAllEvents(root)
+	tasks, err := tlog.LoadState(root)
 	if err != nil {
 		exitError(err.Error())
 	}
-	tasks := tlog.ComputeState(events)
-	id, err := tlog.ResolveID(tasks, prefix)
+	id, err := tlog.ResolveIDOrTitle(tasks, prefix)
 	if err != nil {
 		exitError(err.Error())
 	}
 	return id
 }
 
+// runBulk applies op to each task in args, printing each success with
+// report. With a single task, failure is fatal as for any command. With
+// several, a failure is reported on stderr without stopping the rest, and
+// the exit status is non-zero if any failed; --json prints every outcome.
+func runBulk(cmd *cobra.Command, root string, args []string, op func(id string) (map[string]interface{}, error), report func(result map[string]interface{})) {
+	result, err := tlog.CmdBulk(root, args, op)
+	if err != nil {
+		exitError(err.Error())
+	}
+	items := result["items"].([]tlog.BulkItem)
+
+	if len(items) == 1 {
+		if items[0].Error != "" {
+			exitError(items[0].Error)
+		}
+		if wantJSON(cmd) {
+			printJSON(items[0].Result)
+		} else {
+			report(items[0].Result)
+		}
+		return
+	}
+
+	if wantJSON(cmd) {
+		printJSON(result)
+	} else {
+		for _, item := range items {
+			if item.Error != "" {
+				fmt.Fprintf(os.Stderr, "error: %s: %s\n", item.Input, item.Error)
+			} else {
+				report(item.Result)
+			}
+		}
+	}
+	if result["failed"].(int) > 0 {
+		os.Exit(1)
+	}
+}
+
 // generateCLIReference creates a compact command reference from the command tree
 func generateCLIReference() string {
 	var sb strings.Builder
@@ -601,7 +2345,7 @@ func generateCLIReference() string {
 
 		// Build flag list (skip help flag)
 		var flags []string
-		cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		cmd.LocalFlags().VisitAll(func(f *pflag.Flag) {
 			if f.Name == "help" {
 				return
 			}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/richhaase/tlog/internal/tlog"
+)
+
+// runTlog runs the CLI with args, discarding its output
+func runTlog(t *testing.T, args ...string) {
+	t.Helper()
+	stdout := os.Stdout
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	os.Stdout = devNull
+	defer func() {
+		os.Stdout = stdout
+		_ = devNull.Close()
+	}()
+
+	rootCmd.SetArgs(args)
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("tlog %v failed: %v", args, err)
+	}
+}
+
+func TestCreateJSONSpecArgument(t *testing.T) {
+	dir := t.TempDir()
+	if err := tlog.Initialize(dir); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	root := filepath.Join(dir, tlog.TlogDir)
+
+	// The older form, from before --spec: the spec is the argument to --json
+	runTlog(t, "--dir", root, "create", "--json", `{"title":"From spec","priority":"high"}`)
+
+	tasks, err := tlog.LoadState(root)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if len(tasks) != 1 {
+		t.Fatalf("Expected 1 task, got %d", len(tasks))
+	}
+	for _, task := range tasks {
+		if task.Title != "From spec" || task.Priority != tlog.PriorityHigh {
+			t.Errorf("Expected the spec's title and priority, got %q %s", task.Title, task.Priority)
+		}
+	}
+}
+
+func TestRenameByPrefix(t *testing.T) {
+	dir := t.TempDir()
+	if err := tlog.Initialize(dir); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	root := filepath.Join(dir, tlog.TlogDir)
+	created, err := tlog.CmdCreate(root, "Old title", tlog.CreateOptions{})
+	if err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	id := created["id"].(string)
+
+	runTlog(t, "--dir", root, "rename", id[:4], "New title")
+
+	tasks, err := tlog.LoadState(root)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if tasks[id].Title != "New title" {
+		t.Errorf("Expected the task renamed by its ID prefix, got %q", tasks[id].Title)
+	}
+}
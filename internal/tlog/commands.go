@@ -1,8 +1,14 @@
 package tlog
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
 	"os/exec"
+	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -14,6 +20,12 @@ func CmdInit(path string) (map[string]interface{}, error) {
 		return nil, err
 	}
 
+	// A starter config, so the settings are discoverable
+	starter := Config{DefaultPriority: PriorityMedium.String()}
+	if err := WriteConfig(filepath.Join(path, TlogDir), starter); err != nil {
+		return nil, err
+	}
+
 	return map[string]interface{}{
 		"status":  "initialized",
 		"path":    path + "/" + TlogDir,
@@ -21,9 +33,41 @@ func CmdInit(path string) (map[string]interface{}, error) {
 	}, nil
 }
 
-// CmdCreate creates a new task
-func CmdCreate(root, title string, deps, labels []string, description, notes string, priority *Priority, forParent string) (map[string]interface{}, error) {
-	id := GenerateID()
+// idAttempts bounds how many IDs uniqueID generates before giving up
+const idAttempts = 10
+
+// newID generates task IDs; tests replace it to force collisions
+var newID = GenerateID
+
+// uniqueID returns a fresh ID that names neither an existing task nor one
+// already taken in the current batch
+func uniqueID(tasks map[string]*Task, taken map[string]bool) (string, error) {
+	for i := 0; i < idAttempts; i++ {
+		id := newID()
+		if tasks[id] == nil && !taken[id] {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("could not generate a unique task ID after %d attempts", idAttempts)
+}
+
+// CmdCreate creates a new task; see CreateOptions for the optional fields
+func CmdCreate(root, title string, opts CreateOptions) (map[string]interface{}, error) {
+	deps, labels, priority, forParent := opts.Deps, opts.Labels, opts.Priority, opts.For
+	if opts.Estimate != nil && *opts.Estimate < 0 {
+		return nil, fmt.Errorf("estimate cannot be negative")
+	}
+
+	cfg, err := LoadConfig(root)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.Force {
+		if err := cfg.CheckLabels(labels); err != nil {
+			return nil, err
+		}
+	}
+
 	now := NowISO()
 
 	if deps == nil {
@@ -33,15 +77,19 @@ func CmdCreate(root, title string, deps, labels []string, description, notes str
 		labels = []string{}
 	}
 
-	// Load events and compute state if we need to validate deps or forParent
-	var tasks map[string]*Task
-	if len(deps) > 0 || forParent != "" {
-		events, err := LoadAllEvents(root)
-		if err != nil {
-			return nil, err
-		}
-		tasks = ComputeState(events)
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+
+	// A colliding ID would silently merge two tasks on replay
+	id, err := uniqueID(tasks, nil)
+	if err != nil {
+		return nil, err
+	}
 
+	// Validate deps and forParent
+	if len(deps) > 0 || forParent != "" {
 		// Validate that all dependencies exist
 		for _, depID := range deps {
 			if _, ok := tasks[depID]; !ok {
@@ -55,6 +103,24 @@ func CmdCreate(root, title string, deps, labels []string, description, notes str
 				return nil, fmt.Errorf("parent task not found: %s", forParent)
 			}
 		}
+
+		if priority == nil && opts.PriorityFromDeps {
+			related := deps
+			if forParent != "" {
+				related = append(append([]string{}, deps...), forParent)
+			}
+			for _, relID := range related {
+				p := tasks[relID].Priority
+				if priority == nil || p < *priority {
+					priority = &p
+				}
+			}
+		}
+	}
+
+	// Explicit or inherited priority wins; otherwise fall back to configured defaults
+	if priority == nil {
+		priority = cfg.NewTaskPriority(labels)
 	}
 
 	event := Event{
@@ -66,8 +132,9 @@ func CmdCreate(root, title string, deps, labels []string, description, notes str
 		Priority:    priority,
 		Deps:        deps,
 		Labels:      labels,
-		Description: description,
-		Notes:       notes,
+		Description: opts.Description,
+		Notes:       opts.Notes,
+		Estimate:    opts.Estimate,
 	}
 
 	if err := AppendEvent(root, event); err != nil {
@@ -98,14 +165,230 @@ func CmdCreate(root, title string, deps, labels []string, description, notes str
 	}, nil
 }
 
+// ParseTaskSpec decodes a JSON task spec, rejecting unknown fields
+func ParseTaskSpec(data []byte) (TaskSpec, error) {
+	var spec TaskSpec
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&spec); err != nil {
+		return TaskSpec{}, fmt.Errorf("invalid task spec: %w", err)
+	}
+	return spec, nil
+}
+
+// CmdCreateFromSpec validates a task spec, resolves its dep and parent IDs,
+// and creates the task via CmdCreate
+func CmdCreateFromSpec(root string, spec TaskSpec, force bool) (map[string]interface{}, error) {
+	priority, err := validateSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+
+	deps := make([]string, 0, len(spec.Deps))
+	for _, dep := range spec.Deps {
+		depID, err := ResolveID(tasks, dep)
+		if err != nil {
+			return nil, fmt.Errorf("dependency: %w", err)
+		}
+		deps = append(deps, depID)
+	}
+
+	forParent := ""
+	if spec.For != "" {
+		forParent, err = ResolveID(tasks, spec.For)
+		if err != nil {
+			return nil, fmt.Errorf("parent: %w", err)
+		}
+	}
+
+	return CmdCreate(root, spec.Title, CreateOptions{
+		Deps:        deps,
+		Labels:      spec.Labels,
+		Description: spec.Description,
+		Notes:       spec.Notes,
+		Priority:    priority,
+		For:         forParent,
+		Force:       force,
+	})
+}
+
+// validateSpec checks a task spec's required fields and returns its parsed priority
+func validateSpec(spec TaskSpec) (*Priority, error) {
+	if strings.TrimSpace(spec.Title) == "" {
+		return nil, fmt.Errorf("task spec requires a title")
+	}
+	if spec.Priority == "" {
+		return nil, nil
+	}
+	p, err := ParsePriorityStrict(spec.Priority)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ParseTaskSpecs decodes a JSON array of task specs, rejecting unknown fields
+func ParseTaskSpecs(data []byte) ([]TaskSpec, error) {
+	var specs []TaskSpec
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&specs); err != nil {
+		return nil, fmt.Errorf("invalid task specs: %w", err)
+	}
+	return specs, nil
+}
+
+// CmdCreateBatch creates several tasks at once. Specs may reference each other
+// by their batch-local key in deps and for; keys are resolved to the generated
+// IDs, and the whole batch is rejected before writing if it would form a cycle.
+func CmdCreateBatch(root string, specs []TaskSpec, force bool) (map[string]interface{}, error) {
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("no task specs provided")
+	}
+
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := LoadConfig(root)
+	if err != nil {
+		return nil, err
+	}
+
+	// Assign IDs up front so keys can be resolved
+	ids := make([]string, len(specs))
+	keyToID := make(map[string]string)
+	taken := make(map[string]bool)
+	priorities := make([]*Priority, len(specs))
+	for i, spec := range specs {
+		if priorities[i], err = validateSpec(spec); err != nil {
+			return nil, fmt.Errorf("spec %d: %w", i, err)
+		}
+		if !force {
+			if err := cfg.CheckLabels(spec.Labels); err != nil {
+				return nil, fmt.Errorf("spec %d: %w", i, err)
+			}
+		}
+		if priorities[i] == nil {
+			priorities[i] = cfg.NewTaskPriority(spec.Labels)
+		}
+		id, err := uniqueID(tasks, taken)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+		taken[id] = true
+		if spec.Key != "" {
+			if _, dup := keyToID[spec.Key]; dup {
+				return nil, fmt.Errorf("spec %d: duplicate key '%s'", i, spec.Key)
+			}
+			keyToID[spec.Key] = id
+		}
+	}
+
+	resolve := func(ref string) (string, error) {
+		if id, ok := keyToID[ref]; ok {
+			return id, nil
+		}
+		return ResolveID(tasks, ref)
+	}
+
+	// Work on copies so cycle checks never touch the loaded state
+	work := make(map[string]*Task, len(tasks)+len(specs))
+	for id, t := range tasks {
+		c := *t
+		c.Deps = append([]string{}, t.Deps...)
+		work[id] = &c
+	}
+	for _, id := range ids {
+		work[id] = &Task{ID: id, Deps: []string{}}
+	}
+	addEdge := func(taskID, depID string) error {
+		if WouldCreateCycle(work, taskID, depID) {
+			return fmt.Errorf("circular dependency: %s -> %s would create a cycle", taskID, depID)
+		}
+		work[taskID].Deps = appendUnique(work[taskID].Deps, depID)
+		return nil
+	}
+
+	var parentEdges []Event
+	for i, spec := range specs {
+		for _, ref := range spec.Deps {
+			depID, err := resolve(ref)
+			if err != nil {
+				return nil, fmt.Errorf("spec %d dependency: %w", i, err)
+			}
+			if err := addEdge(ids[i], depID); err != nil {
+				return nil, err
+			}
+		}
+		if spec.For != "" {
+			parentID, err := resolve(spec.For)
+			if err != nil {
+				return nil, fmt.Errorf("spec %d parent: %w", i, err)
+			}
+			if err := addEdge(parentID, ids[i]); err != nil {
+				return nil, err
+			}
+			if !taken[parentID] {
+				parentEdges = append(parentEdges, Event{ID: parentID, Type: EventDep, Dep: ids[i], Action: "add"})
+			}
+		}
+	}
+
+	now := NowISO()
+	var batch []Event
+	created := make([]map[string]interface{}, 0, len(specs))
+	for i, spec := range specs {
+		labels := spec.Labels
+		if labels == nil {
+			labels = []string{}
+		}
+		batch = append(batch, Event{
+			ID:          ids[i],
+			Timestamp:   now,
+			Type:        EventCreate,
+			Title:       spec.Title,
+			Status:      StatusOpen,
+			Priority:    priorities[i],
+			Deps:        work[ids[i]].Deps,
+			Labels:      labels,
+			Description: spec.Description,
+			Notes:       spec.Notes,
+		})
+		created = append(created, map[string]interface{}{
+			"key":   spec.Key,
+			"id":    ids[i],
+			"title": spec.Title,
+		})
+	}
+	for _, e := range parentEdges {
+		e.Timestamp = now
+		batch = append(batch, e)
+	}
+
+	if err := AppendEvents(root, batch); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"tasks": created,
+		"count": len(created),
+	}, nil
+}
+
 // CmdDone marks a task as done
 func CmdDone(root, id string, resolution Resolution, notes, commit string) (map[string]interface{}, error) {
-	events, err := LoadAllEvents(root)
+	tasks, err := LoadState(root)
 	if err != nil {
 		return nil, err
 	}
-
-	tasks := ComputeState(events)
 	if _, ok := tasks[id]; !ok {
 		return nil, fmt.Errorf("task not found: %s", id)
 	}
@@ -129,38 +412,106 @@ func CmdDone(root, id string, resolution Resolution, notes, commit string) (map[
 		return nil, err
 	}
 
+	// Tasks that became ready because this one is done
+	wasReady := make(map[string]bool)
+	for _, t := range GetReadyTasks(tasks) {
+		wasReady[t.ID] = true
+	}
+	applyEvents(tasks, []Event{event})
+	unblocked := make([]*Task, 0)
+	for _, t := range GetReadyTasks(tasks) {
+		if !wasReady[t.ID] && t.ID != id {
+			unblocked = append(unblocked, t)
+		}
+	}
+	sortTasksByPriorityCreated(unblocked)
+
 	return map[string]interface{}{
 		"id":         id,
 		"status":     StatusDone,
 		"resolution": resolution,
 		"completed":  now,
+		"unblocked":  unblocked,
 	}, nil
 }
 
-// CmdClaim marks a task as in_progress
-func CmdClaim(root, id, notes string) (map[string]interface{}, error) {
-	events, err := LoadAllEvents(root)
+// CmdClaim marks a task as in_progress. The check and the claim happen under
+// the event log lock, so two agents can't both claim the same task.
+func CmdClaim(root, id, notes, by string) (map[string]interface{}, error) {
+	var event Event
+	err := withLock(root, func() error {
+		tasks, err := LoadState(root)
+		if err != nil {
+			return err
+		}
+		task, ok := tasks[id]
+		if !ok {
+			return fmt.Errorf("task not found: %s", id)
+		}
+		if event, err = claimEvent(root, task, notes, by); err != nil {
+			return err
+		}
+		return appendEventsLocked(root, []Event{event})
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	tasks := ComputeState(events)
-	task, ok := tasks[id]
-	if !ok {
-		return nil, fmt.Errorf("task not found: %s", id)
+	result := map[string]interface{}{
+		"id":      id,
+		"status":  StatusInProgress,
+		"claimed": event.Timestamp,
 	}
+	if by != "" {
+		result["assignee"] = by
+	}
+	return result, nil
+}
 
+// claimEvent returns the status event that claims task, or an error if it
+// can't be claimed
+func claimEvent(root string, task *Task, notes, by string) (Event, error) {
 	if task.Status != StatusOpen {
-		return nil, fmt.Errorf("can only claim open tasks, task is %s", task.Status)
+		return Event{}, fmt.Errorf("can only claim open tasks, task is %s", task.Status)
+	}
+
+	cfg, err := LoadConfig(root)
+	if err != nil {
+		return Event{}, err
+	}
+	if cfg.RequireClaimNote && strings.TrimSpace(notes) == "" {
+		return Event{}, fmt.Errorf("a claim note is required (use --note to say what you plan to do)")
+	}
+
+	return Event{
+		ID:        task.ID,
+		Timestamp: NowISO(),
+		Type:      EventStatus,
+		Status:    StatusInProgress,
+		Notes:     notes,
+		Assignee:  by,
+		Author:    by,
+	}, nil
+}
+
+// CmdAssign sets who owns a task. An empty assignee clears it.
+func CmdAssign(root, id, assignee string) (map[string]interface{}, error) {
+	assignee = strings.TrimSpace(assignee)
+
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+	if task, ok := tasks[id]; !ok || task.Deleted {
+		return nil, fmt.Errorf("task not found: %s", id)
 	}
 
 	now := NowISO()
 	event := Event{
 		ID:        id,
 		Timestamp: now,
-		Type:      EventStatus,
-		Status:    StatusInProgress,
-		Notes:     notes,
+		Type:      EventAssign,
+		Assignee:  assignee,
 	}
 
 	if err := AppendEvent(root, event); err != nil {
@@ -168,20 +519,20 @@ func CmdClaim(root, id, notes string) (map[string]interface{}, error) {
 	}
 
 	return map[string]interface{}{
-		"id":      id,
-		"status":  StatusInProgress,
-		"claimed": now,
+		"id":       id,
+		"assignee": assignee,
+		"updated":  now,
 	}, nil
 }
 
-// CmdUnclaim releases a claimed task back to open
+// CmdUnclaim releases a claimed task back to open. The assignee stays: it
+// records who owns the task, which is set separately from claiming (see
+// CmdAssign), so releasing the claim doesn't hand the task to nobody.
 func CmdUnclaim(root, id, notes string) (map[string]interface{}, error) {
-	events, err := LoadAllEvents(root)
+	tasks, err := LoadState(root)
 	if err != nil {
 		return nil, err
 	}
-
-	tasks := ComputeState(events)
 	task, ok := tasks[id]
 	if !ok {
 		return nil, fmt.Errorf("task not found: %s", id)
@@ -211,14 +562,98 @@ func CmdUnclaim(root, id, notes string) (map[string]interface{}, error) {
 	}, nil
 }
 
-// CmdReopen reopens a task (from done or in_progress back to open)
-func CmdReopen(root, id string) (map[string]interface{}, error) {
-	events, err := LoadAllEvents(root)
+// CmdBulk applies op to each task named in tokens, resolved like any <id>
+// argument. A task that fails to resolve or whose op fails is recorded and
+// skipped; the rest still run. Tokens are resolved up front, so an earlier op
+// (say, a delete) can't change what a later token means. The result holds
+// "items" ([]BulkItem, in input order), "ok", and "failed".
+func CmdBulk(root string, tokens []string, op func(id string) (map[string]interface{}, error)) (map[string]interface{}, error) {
+	tasks, err := LoadState(root)
 	if err != nil {
 		return nil, err
 	}
 
-	tasks := ComputeState(events)
+	items := make([]BulkItem, len(tokens))
+	for i, token := range tokens {
+		items[i].Input = token
+		id, err := ResolveIDOrTitle(tasks, token)
+		if err != nil {
+			items[i].Error = err.Error()
+			continue
+		}
+		items[i].ID = id
+	}
+
+	failed := 0
+	for i := range items {
+		if items[i].Error == "" {
+			result, err := op(items[i].ID)
+			if err != nil {
+				items[i].Error = err.Error()
+			} else {
+				items[i].Result = result
+			}
+		}
+		if items[i].Error != "" {
+			failed++
+		}
+	}
+
+	return map[string]interface{}{
+		"items":  items,
+		"ok":     len(items) - failed,
+		"failed": failed,
+	}, nil
+}
+
+// CmdUnclaimAll releases every in_progress task back to open in one batch,
+// appending the same note to each. With assignee set, only that owner's tasks
+// are released; as with CmdUnclaim, they stay assigned.
+func CmdUnclaimAll(root, assignee, notes string) (map[string]interface{}, error) {
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+
+	now := NowISO()
+	ids := make([]string, 0)
+	var batch []Event
+	for _, id := range sortedKeys(tasks) {
+		if t := tasks[id]; t.Deleted || t.Status != StatusInProgress {
+			continue
+		}
+		if assignee != "" && tasks[id].Assignee != assignee {
+			continue
+		}
+		ids = append(ids, id)
+		batch = append(batch, Event{
+			ID:        id,
+			Timestamp: now,
+			Type:      EventStatus,
+			Status:    StatusOpen,
+			Notes:     notes,
+		})
+	}
+
+	if len(batch) > 0 {
+		if err := AppendEvents(root, batch); err != nil {
+			return nil, err
+		}
+	}
+
+	return map[string]interface{}{
+		"ids":       ids,
+		"count":     len(ids),
+		"unclaimed": now,
+	}, nil
+}
+
+// CmdReopen reopens a task (from done or in_progress back to open)
+func CmdReopen(root, id, notes string) (map[string]interface{}, error) {
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
 	if _, ok := tasks[id]; !ok {
 		return nil, fmt.Errorf("task not found: %s", id)
 	}
@@ -229,6 +664,7 @@ func CmdReopen(root, id string) (map[string]interface{}, error) {
 		Timestamp: now,
 		Type:      EventStatus,
 		Status:    StatusOpen,
+		Notes:     notes,
 	}
 
 	if err := AppendEvent(root, event); err != nil {
@@ -244,12 +680,10 @@ func CmdReopen(root, id string) (map[string]interface{}, error) {
 
 // CmdDelete marks a task as deleted (tombstone)
 func CmdDelete(root, id, notes string) (map[string]interface{}, error) {
-	events, err := LoadAllEvents(root)
+	tasks, err := LoadState(root)
 	if err != nil {
 		return nil, err
 	}
-
-	tasks := ComputeState(events)
 	task, ok := tasks[id]
 	if !ok {
 		return nil, fmt.Errorf("task not found: %s", id)
@@ -276,185 +710,1172 @@ func CmdDelete(root, id, notes string) (map[string]interface{}, error) {
 	}, nil
 }
 
-// CmdUpdate updates a task's title, description, notes, or labels
-func CmdUpdate(root, id, title, description, notes string, labels []string, priority *Priority) (map[string]interface{}, error) {
-	events, err := LoadAllEvents(root)
+// CmdArchive puts a task away on purpose. Unlike a deleted task, an archived
+// one still resolves and is kept, with its full event history, through
+// prune; it is only hidden from list, ready, and graph.
+func CmdArchive(root, id, notes string) (map[string]interface{}, error) {
+	tasks, err := LoadState(root)
 	if err != nil {
 		return nil, err
 	}
-
-	tasks := ComputeState(events)
-	if _, ok := tasks[id]; !ok {
+	task, ok := tasks[id]
+	if !ok || task.Deleted {
 		return nil, fmt.Errorf("task not found: %s", id)
 	}
+	if task.Archived {
+		return nil, fmt.Errorf("task already archived: %s", id)
+	}
 
 	now := NowISO()
 	event := Event{
-		ID:          id,
-		Timestamp:   now,
-		Type:        EventUpdate,
-		Title:       title,
-		Description: description,
-		Notes:       notes,
-		Labels:      labels,
-		Priority:    priority,
+		ID:        id,
+		Timestamp: now,
+		Type:      EventArchive,
+		Notes:     notes,
 	}
-
 	if err := AppendEvent(root, event); err != nil {
 		return nil, err
 	}
 
 	return map[string]interface{}{
-		"id":      id,
-		"updated": now,
+		"id":       id,
+		"archived": now,
 	}, nil
 }
 
-// CmdList lists tasks with optional status, label, and priority filters
-func CmdList(root string, statusFilter string, labelFilter string, priorityFilter string) (map[string]interface{}, error) {
-	events, err := LoadAllEvents(root)
-	if err != nil {
-		return nil, err
-	}
-
-	tasks := ComputeState(events)
-
-	var taskList []*Task
-	for _, task := range tasks {
-		// Exclude deleted tasks
-		if task.Deleted {
-			continue
+// CmdMove places a task just before (or, with after, just after) another of
+// the same priority, by giving it an Order between the other task and its
+// neighbor. Tasks that were never moved sort after moved ones, by creation
+// time, so moving next to one first gives Orders to it and the unmoved tasks
+// ahead of it, following the moved tasks: every task but the one moving keeps
+// its place. When two neighbors' Orders are too close to split, the band is
+// renumbered 1, 2, 3, ... in the same batch of events.
+func CmdMove(root, id, otherID string, after bool) (map[string]interface{}, error) {
+	var order float64
+	err := withLock(root, func() error {
+		tasks, err := LoadState(root)
+		if err != nil {
+			return err
 		}
-
-		// Check status filter
-		statusMatch := statusFilter == "all" ||
-			(statusFilter == "open" && task.Status == StatusOpen) ||
-			(statusFilter == "in_progress" && task.Status == StatusInProgress) ||
-			(statusFilter == "done" && task.Status == StatusDone)
-		if !statusMatch {
-			continue
+		task, ok := tasks[id]
+		if !ok || task.Deleted {
+			return fmt.Errorf("task not found: %s", id)
+		}
+		other, ok := tasks[otherID]
+		if !ok || other.Deleted {
+			return fmt.Errorf("task not found: %s", otherID)
+		}
+		if id == otherID {
+			return fmt.Errorf("cannot move %s relative to itself", id)
+		}
+		if task.Priority != other.Priority {
+			return fmt.Errorf("cannot move %s relative to %s: priorities differ (%s, %s)", id, otherID, task.Priority, other.Priority)
 		}
 
-		// Check priority filter
-		if priorityFilter != "" {
-			if task.Priority.String() != priorityFilter {
-				continue
+		// The tasks of this priority in their current order, without the one
+		// moving; the moved ones (the band) come first
+		var peers, band []*Task
+		for _, t := range tasks {
+			if t.Priority == task.Priority && t.ID != id && !t.Deleted {
+				peers = append(peers, t)
+			}
+		}
+		sortTasksByPriorityCreated(peers)
+		for _, t := range peers {
+			if t.Order != 0 {
+				band = append(band, t)
 			}
 		}
 
-		// Check label filter
-		if labelFilter != "" {
-			hasLabel := false
-			for _, label := range task.Labels {
-				if label == labelFilter {
-					hasLabel = true
+		now := NowISO()
+		var events []Event
+		placed := make(map[string]bool)
+		if other.Order == 0 {
+			// Place other and the unmoved tasks ahead of it, in their order
+			next := 1.0
+			if len(band) > 0 {
+				next = math.Floor(band[len(band)-1].Order) + 1
+			}
+			for _, t := range peers[len(band):] {
+				events = append(events, Event{ID: t.ID, Timestamp: now, Type: EventMove, Order: next})
+				band = append(band, &Task{ID: t.ID, Order: next})
+				placed[t.ID] = true
+				next++
+				if t.ID == otherID {
 					break
 				}
 			}
-			if !hasLabel {
+		}
+
+		i := slices.IndexFunc(band, func(t *Task) bool { return t.ID == otherID })
+		if after {
+			i++
+		}
+		// Insert between band[i-1] and band[i]. Orders stay positive, since 0
+		// means never moved.
+		var lo, hi float64
+		switch {
+		case i == 0:
+			lo, hi = 0, band[0].Order
+		case i == len(band):
+			lo, hi = band[i-1].Order, band[i-1].Order+2
+		default:
+			lo, hi = band[i-1].Order, band[i].Order
+		}
+		order = lo + (hi-lo)/2
+		if order <= lo || order >= hi {
+			// No room left between them: renumber the band with the task in place
+			band = slices.Insert(band, i, task)
+			events = events[:0]
+			for j, t := range band {
+				if t.Order != float64(j+1) || t.ID == id || placed[t.ID] {
+					events = append(events, Event{ID: t.ID, Timestamp: now, Type: EventMove, Order: float64(j + 1)})
+				}
+			}
+			order = float64(i + 1)
+		} else {
+			events = append(events, Event{ID: id, Timestamp: now, Type: EventMove, Order: order})
+		}
+		return appendEventsLocked(root, events)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	where := "before"
+	if after {
+		where = "after"
+	}
+	return map[string]interface{}{
+		"id":    id,
+		where:   otherID,
+		"order": order,
+	}, nil
+}
+
+// CmdUndelete restores a deleted task that hasn't been compacted away yet.
+// Deleted tasks don't resolve by prefix, so id must be the full ID.
+func CmdUndelete(root, id string) (map[string]interface{}, error) {
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+	task, ok := tasks[id]
+	if !ok {
+		return nil, fmt.Errorf("task not found: %s (it may have been pruned)", id)
+	}
+	if !task.Deleted {
+		return nil, fmt.Errorf("task is not deleted: %s", id)
+	}
+
+	now := NowISO()
+	event := Event{
+		ID:        id,
+		Timestamp: now,
+		Type:      EventUndelete,
+	}
+
+	if err := AppendEvent(root, event); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"id":        id,
+		"title":     task.Title,
+		"undeleted": now,
+	}, nil
+}
+
+// CmdUpdate updates a task's title, description, notes, labels, priority, or
+// estimate (in minutes). force skips the configured label vocabulary check.
+func CmdUpdate(root, id, title, description, notes string, labels []string, priority *Priority, estimate *int, force bool) (map[string]interface{}, error) {
+	if estimate != nil && *estimate < 0 {
+		return nil, fmt.Errorf("estimate cannot be negative")
+	}
+	if !force {
+		cfg, err := LoadConfig(root)
+		if err != nil {
+			return nil, err
+		}
+		if err := cfg.CheckLabels(labels); err != nil {
+			return nil, err
+		}
+	}
+
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := tasks[id]; !ok {
+		return nil, fmt.Errorf("task not found: %s", id)
+	}
+
+	now := NowISO()
+	event := Event{
+		ID:          id,
+		Timestamp:   now,
+		Type:        EventUpdate,
+		Title:       title,
+		Description: description,
+		Notes:       notes,
+		Labels:      labels,
+		Priority:    priority,
+		Estimate:    estimate,
+	}
+
+	if err := AppendEvent(root, event); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"id":      id,
+		"updated": now,
+	}, nil
+}
+
+// CmdNote appends a note to a task without changing anything else. author,
+// if set, is recorded with the note.
+func CmdNote(root, id, note, author string) (map[string]interface{}, error) {
+	if strings.TrimSpace(note) == "" {
+		return nil, fmt.Errorf("note cannot be empty")
+	}
+
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+	if task, ok := tasks[id]; !ok || task.Deleted {
+		return nil, fmt.Errorf("task not found: %s", id)
+	}
+
+	event := Event{
+		ID:        id,
+		Timestamp: NowISO(),
+		Type:      EventUpdate,
+		Notes:     note,
+		Author:    strings.TrimSpace(author),
+	}
+	if err := AppendEvent(root, event); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"id":   id,
+		"note": note,
+	}, nil
+}
+
+// CmdLogTime adds minutes to the time spent on a task
+func CmdLogTime(root, id string, minutes int) (map[string]interface{}, error) {
+	if minutes <= 0 {
+		return nil, fmt.Errorf("minutes must be positive")
+	}
+
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+	task, ok := tasks[id]
+	if !ok || task.Deleted {
+		return nil, fmt.Errorf("task not found: %s", id)
+	}
+
+	event := Event{
+		ID:        id,
+		Timestamp: NowISO(),
+		Type:      EventUpdate,
+		TimeSpent: minutes,
+	}
+	if err := AppendEvent(root, event); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"id":         id,
+		"logged":     minutes,
+		"time_spent": task.TimeSpent + minutes,
+		"estimate":   task.Estimate,
+	}, nil
+}
+
+// CmdRename changes only a task's title
+func CmdRename(root, id, title string) (map[string]interface{}, error) {
+	if strings.TrimSpace(title) == "" {
+		return nil, fmt.Errorf("title cannot be empty")
+	}
+
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+	task, ok := tasks[id]
+	if !ok || task.Deleted {
+		return nil, fmt.Errorf("task not found: %s", id)
+	}
+
+	now := NowISO()
+	event := Event{
+		ID:        id,
+		Timestamp: now,
+		Type:      EventUpdate,
+		Title:     title,
+	}
+
+	if err := AppendEvent(root, event); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"id":        id,
+		"title":     title,
+		"old_title": task.Title,
+		"updated":   now,
+	}, nil
+}
+
+// CmdAnnotate sets (or with remove, deletes) a key/value annotation on a task
+func CmdAnnotate(root, id, key, value string, remove bool) (map[string]interface{}, error) {
+	if key == "" {
+		return nil, fmt.Errorf("annotation key cannot be empty")
+	}
+	if strings.Contains(key, "=") {
+		return nil, fmt.Errorf("annotation key cannot contain '='")
+	}
+
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+	task, ok := tasks[id]
+	if !ok || task.Deleted {
+		return nil, fmt.Errorf("task not found: %s", id)
+	}
+
+	now := NowISO()
+	event := Event{
+		ID:          id,
+		Timestamp:   now,
+		Type:        EventAnnotate,
+		Annotations: map[string]string{key: value},
+	}
+	if remove {
+		if _, ok := task.Annotations[key]; !ok {
+			return nil, fmt.Errorf("task %s has no annotation '%s'", id, key)
+		}
+		event.Action = "remove"
+		event.Annotations = map[string]string{key: ""}
+	}
+
+	if err := AppendEvent(root, event); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"id":      id,
+		"key":     key,
+		"value":   value,
+		"removed": remove,
+		"updated": now,
+	}, nil
+}
+
+// CmdTouch bumps a task's Updated time without changing anything else
+func CmdTouch(root, id string) (map[string]interface{}, error) {
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+	task, ok := tasks[id]
+	if !ok || task.Deleted {
+		return nil, fmt.Errorf("task not found: %s", id)
+	}
+
+	now := NowISO()
+	event := Event{
+		ID:        id,
+		Timestamp: now,
+		Type:      EventUpdate,
+	}
+
+	if err := AppendEvent(root, event); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"id":      id,
+		"updated": now,
+	}, nil
+}
+
+// matchesLabels reports whether a task carries all (or, with LabelMatch
+// "any", at least one) of the filter's Labels and none of its ExcludeLabels
+func (f ListFilter) matchesLabels(task *Task) bool {
+	if len(f.Labels) > 0 {
+		matched := 0
+		for _, label := range f.Labels {
+			if containsString(task.Labels, label) {
+				matched++
+			}
+		}
+		if matched == 0 || (f.LabelMatch != "any" && matched < len(f.Labels)) {
+			return false
+		}
+	}
+	for _, excluded := range f.ExcludeLabels {
+		if containsString(task.Labels, excluded) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkLabelMatch validates the filter's LabelMatch mode
+func (f ListFilter) checkLabelMatch() error {
+	switch f.LabelMatch {
+	case "", "all", "any":
+		return nil
+	default:
+		return fmt.Errorf("invalid label match '%s' (valid: all, any)", f.LabelMatch)
+	}
+}
+
+// CmdTouchAll bumps Updated on every task matching the filter. With dryRun,
+// the matching tasks are returned but nothing is written.
+func CmdTouchAll(root string, filter ListFilter, dryRun bool) (map[string]interface{}, error) {
+	listed, err := CmdList(root, filter)
+	if err != nil {
+		return nil, err
+	}
+	tasks := listed["tasks"].([]*Task)
+
+	now := NowISO()
+	ids := make([]string, 0, len(tasks))
+	var batch []Event
+	for _, t := range tasks {
+		ids = append(ids, t.ID)
+		batch = append(batch, Event{ID: t.ID, Timestamp: now, Type: EventUpdate})
+	}
+
+	result := map[string]interface{}{
+		"ids":   ids,
+		"count": len(ids),
+	}
+	if dryRun || len(batch) == 0 {
+		return result, nil
+	}
+
+	if err := AppendEvents(root, batch); err != nil {
+		return nil, err
+	}
+	result["updated"] = now
+	return result, nil
+}
+
+// priorityLabelPrefix marks labels that encode a priority, e.g. "priority:high"
+const priorityLabelPrefix = "priority:"
+
+// CmdRelabelPriority migrates "priority:<name>" labels into the priority
+// field: each live task carrying one gets its priority set (the most urgent,
+// if there are several) and those labels removed. Labels with an unknown
+// priority name are left alone. With dryRun, nothing is written.
+func CmdRelabelPriority(root string, dryRun bool) (map[string]interface{}, error) {
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+
+	now := NowISO()
+	var batch []Event
+	migrated := make([]map[string]interface{}, 0)
+	for _, id := range sortedKeys(tasks) {
+		task := tasks[id]
+		if task.Deleted {
+			continue
+		}
+
+		var best *Priority
+		var removed []string
+		kept := make([]string, 0, len(task.Labels))
+		for _, label := range task.Labels {
+			name, ok := strings.CutPrefix(label, priorityLabelPrefix)
+			if p := ParsePriority(name); ok && p.String() == name {
+				if best == nil || p < *best {
+					best = &p
+				}
+				removed = append(removed, label)
+				continue
+			}
+			kept = append(kept, label)
+		}
+		if best == nil {
+			continue
+		}
+
+		batch = append(batch, Event{
+			ID:        id,
+			Timestamp: now,
+			Type:      EventUpdate,
+			Priority:  best,
+			Labels:    kept,
+			Action:    "set_labels",
+		})
+		migrated = append(migrated, map[string]interface{}{
+			"id":       id,
+			"title":    task.Title,
+			"priority": best.String(),
+			"removed":  removed,
+		})
+	}
+
+	result := map[string]interface{}{
+		"tasks": migrated,
+		"count": len(migrated),
+	}
+	if dryRun || len(batch) == 0 {
+		return result, nil
+	}
+
+	if err := AppendEvents(root, batch); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// TaskViews wraps tasks with their computed readiness, judged against the
+// current state of the whole log
+func TaskViews(root string, tasks []*Task) ([]TaskView, error) {
+	ready, err := readyIDs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	views := make([]TaskView, 0, len(tasks))
+	for _, t := range tasks {
+		views = append(views, TaskView{Task: t, Ready: ready[t.ID]})
+	}
+	return views, nil
+}
+
+// WriteTasksJSONL writes tasks to w as JSON Lines, one TaskView per line,
+// encoding each as it goes so output streams for large boards
+func WriteTasksJSONL(w io.Writer, root string, tasks []*Task) error {
+	ready, err := readyIDs(root)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	for _, t := range tasks {
+		if err := enc.Encode(TaskView{Task: t, Ready: ready[t.ID]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readyIDs returns the IDs of the tasks that are ready in the current state
+func readyIDs(root string) (map[string]bool, error) {
+	state, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+	ready := make(map[string]bool)
+	for _, t := range GetReadyTasks(state) {
+		ready[t.ID] = true
+	}
+	return ready, nil
+}
+
+// parseStatusFilter parses a comma-separated list of statuses into a set.
+// It returns nil, matching every status, for "" or a list containing "all".
+func parseStatusFilter(s string) (map[TaskStatus]bool, error) {
+	if s == "" {
+		return nil, nil
+	}
+	statuses := make(map[TaskStatus]bool)
+	for _, name := range strings.Split(s, ",") {
+		switch status := TaskStatus(strings.TrimSpace(name)); status {
+		case "all":
+			return nil, nil
+		case StatusOpen, StatusInProgress, StatusDone:
+			statuses[status] = true
+		default:
+			return nil, fmt.Errorf("invalid status '%s' (valid: open, in_progress, done, all)", status)
+		}
+	}
+	return statuses, nil
+}
+
+// CmdList lists tasks matching the given filter
+func CmdList(root string, filter ListFilter) (map[string]interface{}, error) {
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+	if filter.IncludeArchived {
+		// Tasks prune --archive moved out of the log, unless since recreated
+		archived, err := LoadArchive(root)
+		if err != nil {
+			return nil, err
+		}
+		for id, task := range archived {
+			if _, ok := tasks[id]; !ok {
+				tasks[id] = task
+			}
+		}
+	}
+
+	statuses, err := parseStatusFilter(filter.Status)
+	if err != nil {
+		return nil, err
+	}
+	if err := filter.checkLabelMatch(); err != nil {
+		return nil, err
+	}
+	if filter.Priority != "" {
+		if _, err := ParsePriorityStrict(filter.Priority); err != nil {
+			return nil, err
+		}
+	}
+
+	// Subtasks follow the --for convention: the parent depends on them
+	var parentID string
+	var subtasks map[string]bool
+	if filter.Parent != "" {
+		if parentID, err = ResolveIDOrTitle(tasks, filter.Parent); err != nil {
+			return nil, err
+		}
+		subtasks = make(map[string]bool)
+		for _, depID := range tasks[parentID].Deps {
+			subtasks[depID] = true
+		}
+	}
+
+	taskList := make([]*Task, 0)
+	for _, task := range tasks {
+		// Exclude deleted tasks unless auditing
+		if task.Deleted && !filter.IncludeDeleted {
+			continue
+		}
+		if task.Archived && !filter.IncludeArchived {
+			continue
+		}
+		if subtasks != nil && !subtasks[task.ID] {
+			continue
+		}
+
+		// Check status filter
+		if statuses != nil && !statuses[task.Status] {
+			continue
+		}
+
+		// Check priority filter
+		if filter.Priority != "" {
+			if task.Priority.String() != filter.Priority {
+				continue
+			}
+		}
+
+		// Check label filters
+		if !filter.matchesLabels(task) {
+			continue
+		}
+
+		if filter.Assignee != "" && task.Assignee != filter.Assignee {
+			continue
+		}
+
+		// Check annotation filter
+		if filter.Annotation != "" {
+			key, value, hasValue := strings.Cut(filter.Annotation, "=")
+			got, ok := task.Annotations[key]
+			if !ok || (hasValue && got != value) {
 				continue
 			}
 		}
 
+		// Check notes/description presence filters
+		if (filter.HasNotes && task.Notes == "") || (filter.NoNotes && task.Notes != "") {
+			continue
+		}
+		if (filter.HasDescription && task.Description == "") || (filter.NoDescription && task.Description != "") {
+			continue
+		}
+
 		taskList = append(taskList, task)
 	}
 
-	// Sort by priority (ascending), then created time (descending)
+	// Sort by priority (ascending), then created time (descending), then ID
 	sort.Slice(taskList, func(i, j int) bool {
-		if taskList[i].Priority != taskList[j].Priority {
-			return taskList[i].Priority < taskList[j].Priority
-		}
-		return taskList[i].Created.After(taskList[j].Created)
+		return taskLess(taskList[i], taskList[j], true)
 	})
 
+	// Paginate after sorting so pages are stable
+	total := len(taskList)
+	offset := min(max(filter.Offset, 0), total)
+	end := total
+	if filter.Limit > 0 {
+		end = min(offset+filter.Limit, total)
+	}
+	taskList = taskList[offset:end]
+
+	result := map[string]interface{}{
+		"tasks":  taskList,
+		"total":  total,
+		"shown":  len(taskList),
+		"offset": offset,
+	}
+	if parentID != "" {
+		result["parent"] = parentID
+	}
+	return result, nil
+}
+
+// CmdSearch finds live tasks whose title, description, or notes contain
+// query, ignoring case. field restricts the match to one of those ("" is all).
+// Matches are sorted by priority, then created time.
+func CmdSearch(root, query, field string) (map[string]interface{}, error) {
+	switch field {
+	case "", "title", "description", "notes":
+	default:
+		return nil, fmt.Errorf("invalid field '%s' (valid: title, description, notes)", field)
+	}
+
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+
+	needle := strings.ToLower(query)
+	matches := make([]*Task, 0)
+	for _, task := range tasks {
+		if task.Deleted {
+			continue
+		}
+		var haystacks []string
+		switch field {
+		case "title":
+			haystacks = []string{task.Title}
+		case "description":
+			haystacks = []string{task.Description}
+		case "notes":
+			haystacks = []string{task.Notes}
+		default:
+			haystacks = []string{task.Title, task.Description, task.Notes}
+		}
+		for _, h := range haystacks {
+			if strings.Contains(strings.ToLower(h), needle) {
+				matches = append(matches, task)
+				break
+			}
+		}
+	}
+	sortTasksByPriorityCreated(matches)
+
 	return map[string]interface{}{
-		"tasks": taskList,
-		"count": len(taskList),
+		"tasks": matches,
+		"count": len(matches),
 	}, nil
 }
 
-// CmdShow shows details of a single task
-func CmdShow(root, id string) (map[string]interface{}, error) {
-	events, err := LoadAllEvents(root)
+// GroupTasks buckets already-sorted tasks into sections by status, priority,
+// or label, keeping their order within each section. Statuses and priorities
+// appear in workflow order; labels are sorted with unlabeled tasks last, and
+// a task appears under each of its labels. Empty sections are omitted.
+func GroupTasks(tasks []*Task, by string) ([]TaskGroup, error) {
+	var names []string
+	buckets := make(map[string][]*Task)
+	add := func(name string, t *Task) {
+		if _, ok := buckets[name]; !ok {
+			names = append(names, name)
+		}
+		buckets[name] = append(buckets[name], t)
+	}
+
+	switch by {
+	case "status":
+		for _, t := range tasks {
+			add(string(t.Status), t)
+		}
+		names = []string{string(StatusOpen), string(StatusInProgress), string(StatusDone)}
+	case "priority":
+		for _, t := range tasks {
+			add(t.Priority.String(), t)
+		}
+		names = names[:0]
+		for p := PriorityCritical; p <= PriorityBacklog; p++ {
+			names = append(names, p.String())
+		}
+	case "label":
+		var unlabeled []*Task
+		for _, t := range tasks {
+			if len(t.Labels) == 0 {
+				unlabeled = append(unlabeled, t)
+			}
+			for _, label := range t.Labels {
+				add(label, t)
+			}
+		}
+		sort.Strings(names)
+		if len(unlabeled) > 0 {
+			names = append(names, "(no label)")
+			buckets["(no label)"] = unlabeled
+		}
+	default:
+		return nil, fmt.Errorf("invalid group-by '%s' (valid: status, priority, label)", by)
+	}
+
+	groups := make([]TaskGroup, 0, len(names))
+	for _, name := range names {
+		if len(buckets[name]) > 0 {
+			groups = append(groups, TaskGroup{Name: name, Tasks: buckets[name]})
+		}
+	}
+	return groups, nil
+}
+
+// CmdShow shows details of a single task. With transitive, the result also
+// includes every task that ultimately waits on this one.
+func CmdShow(root, id string, transitive bool) (map[string]interface{}, error) {
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+	task, ok := tasks[id]
+	if !ok {
+		return nil, fmt.Errorf("task not found: %s", id)
+	}
+	if task.Deleted {
+		return nil, fmt.Errorf("task not found: %s", id)
+	}
+
+	// Get dependency status (tasks this task depends on)
+	depStatus := depStatusList(task, tasks)
+
+	// Get dependents (tasks that have this task in their deps array)
+	dependents := make([]map[string]interface{}, 0)
+	for _, other := range tasks {
+		for _, depID := range other.Deps {
+			if depID == id {
+				dependents = append(dependents, map[string]interface{}{
+					"id":     other.ID,
+					"title":  other.Title,
+					"status": other.Status,
+				})
+				break
+			}
+		}
+	}
+
+	sort.Slice(dependents, func(i, j int) bool {
+		return dependents[i]["id"].(string) < dependents[j]["id"].(string)
+	})
+
+	// Blocks are soft, so they're listed separately from deps
+	blocks := make([]map[string]interface{}, 0)
+	for _, blockedID := range task.Blocks {
+		if other, ok := tasks[blockedID]; ok && !other.Deleted {
+			blocks = append(blocks, map[string]interface{}{
+				"id":     other.ID,
+				"title":  other.Title,
+				"status": other.Status,
+			})
+		}
+	}
+	blockedBy := make([]map[string]interface{}, 0)
+	for _, other := range tasks {
+		if !other.Deleted && containsString(other.Blocks, id) {
+			blockedBy = append(blockedBy, map[string]interface{}{
+				"id":     other.ID,
+				"title":  other.Title,
+				"status": other.Status,
+			})
+		}
+	}
+	sort.Slice(blockedBy, func(i, j int) bool {
+		return blockedBy[i]["id"].(string) < blockedBy[j]["id"].(string)
+	})
+
+	// Deps on deleted or pruned tasks can never be satisfied
+	missingDeps := make([]string, 0)
+	for _, depID := range task.Deps {
+		if dep, ok := tasks[depID]; !ok || dep.Deleted {
+			missingDeps = append(missingDeps, depID)
+		}
+	}
+
+	result := map[string]interface{}{
+		"task":         task,
+		"dep_status":   depStatus,
+		"dependents":   dependents,
+		"blocks":       blocks,
+		"blocked_by":   blockedBy,
+		"missing_deps": missingDeps,
+	}
+	if done, total := DepProgress(tasks, id); total > 0 {
+		result["progress"] = map[string]int{"done": done, "total": total}
+	}
+
+	if transitive {
+		closure := make([]map[string]interface{}, 0)
+		for _, depID := range TransitiveDependents(tasks, id) {
+			other := tasks[depID]
+			closure = append(closure, map[string]interface{}{
+				"id":     other.ID,
+				"title":  other.Title,
+				"status": other.Status,
+			})
+		}
+		result["transitive_dependents"] = closure
+	}
+
+	return result, nil
+}
+
+// depStatusList returns the id, title, and status of each of a task's existing deps
+func depStatusList(task *Task, tasks map[string]*Task) []map[string]interface{} {
+	depStatus := make([]map[string]interface{}, 0)
+	for _, depID := range task.Deps {
+		if depTask, ok := tasks[depID]; ok {
+			entry := map[string]interface{}{
+				"id":     depID,
+				"title":  depTask.Title,
+				"status": depTask.Status,
+			}
+			if depTask.Deleted {
+				entry["deleted"] = true
+			}
+			depStatus = append(depStatus, entry)
+		}
+	}
+	return depStatus
+}
+
+// FormatTaskDetail renders the multi-line detail block for a task, as shown
+// by show. depStatus is the task's deps as returned by CmdShow's dep_status.
+func FormatTaskDetail(task *Task, depStatus []map[string]interface{}) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s: %s\n", task.ID, task.Title)
+	if task.Archived {
+		fmt.Fprintf(&sb, "Status: %s (archived)\n", task.Status)
+	} else {
+		fmt.Fprintf(&sb, "Status: %s\n", task.Status)
+	}
+	fmt.Fprintf(&sb, "Priority: %s\n", task.Priority)
+	if task.Assignee != "" {
+		fmt.Fprintf(&sb, "Assignee: %s\n", task.Assignee)
+	}
+	if task.Description != "" {
+		fmt.Fprintf(&sb, "Description: %s\n", task.Description)
+	}
+	if len(task.Labels) > 0 {
+		fmt.Fprintf(&sb, "Labels: %s\n", strings.Join(task.Labels, ", "))
+	}
+	if len(depStatus) > 0 {
+		sb.WriteString("Deps:")
+		done, total := 0, 0
+		for _, d := range depStatus {
+			fmt.Fprintf(&sb, " %s(%s)", d["id"], d["status"])
+			if d["deleted"] != true {
+				total++
+				if d["status"] == StatusDone {
+					done++
+				}
+			}
+		}
+		sb.WriteString("\n")
+		if total > 0 {
+			fmt.Fprintf(&sb, "Progress: %d/%d done\n", done, total)
+		}
+	}
+	if task.Estimate > 0 {
+		fmt.Fprintf(&sb, "Estimate: %s (%s remaining)\n", formatMinutes(task.Estimate), formatMinutes(max(task.Estimate-task.TimeSpent, 0)))
+	}
+	if task.TimeSpent > 0 {
+		fmt.Fprintf(&sb, "Time spent: %s\n", formatMinutes(task.TimeSpent))
+	}
+	if task.Commit != "" {
+		fmt.Fprintf(&sb, "Commit: %s\n", task.Commit)
+	}
+	if len(task.Annotations) > 0 {
+		sb.WriteString("Annotations:\n")
+		for _, k := range sortedKeys(task.Annotations) {
+			fmt.Fprintf(&sb, "  %s=%s\n", k, task.Annotations[k])
+		}
+	}
+	if len(task.NoteLog) > 0 {
+		sb.WriteString("Notes:\n")
+		for _, note := range task.NoteLog {
+			fmt.Fprintf(&sb, "  %s\n", strings.ReplaceAll(formatNote(note), "\n", "\n    "))
+		}
+	} else if task.Notes != "" {
+		fmt.Fprintf(&sb, "Notes: %s\n", task.Notes)
+	}
+	return sb.String()
+}
+
+// CmdReadyDetail renders up to limit ready tasks (0 for all) with their full
+// details, so an agent can pick one up without a separate show. Only the
+// label fields of filter apply.
+func CmdReadyDetail(root string, filter ListFilter, order string, limit int) (string, error) {
+	if err := filter.checkLabelMatch(); err != nil {
+		return "", err
+	}
+
+	tasks, err := LoadState(root)
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	ready := filterReady(GetReadyTasks(tasks), filter)
+	if err := sortReady(ready, tasks, order); err != nil {
+		return "", err
 	}
 
-	tasks := ComputeState(events)
-	task, ok := tasks[id]
-	if !ok {
-		return nil, fmt.Errorf("task not found: %s", id)
+	total := len(ready)
+	if total == 0 {
+		return "No tasks ready\n", nil
 	}
-	if task.Deleted {
-		return nil, fmt.Errorf("task not found: %s", id)
+	if limit > 0 && limit < total {
+		ready = ready[:limit]
 	}
 
-	// Get dependency status (tasks this task depends on)
-	depStatus := make([]map[string]interface{}, 0)
-	for _, depID := range task.Deps {
-		if depTask, ok := tasks[depID]; ok {
-			depStatus = append(depStatus, map[string]interface{}{
-				"id":     depID,
-				"title":  depTask.Title,
-				"status": depTask.Status,
-			})
-		}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Ready tasks (%d of %d):\n", len(ready), total)
+	for _, t := range ready {
+		sb.WriteString("\n")
+		sb.WriteString(FormatTaskDetail(t, depStatusList(t, tasks)))
 	}
+	return sb.String(), nil
+}
 
-	// Get dependents (tasks that have this task in their deps array)
-	dependents := make([]map[string]interface{}, 0)
-	for _, other := range tasks {
-		for _, depID := range other.Deps {
-			if depID == id {
-				dependents = append(dependents, map[string]interface{}{
-					"id":     other.ID,
-					"title":  other.Title,
-					"status": other.Status,
-				})
-				break
-			}
-		}
+// CmdReady returns tasks ready to be worked on. Only the label fields of
+// filter apply; see sortReady for order.
+func CmdReady(root string, filter ListFilter, order string) (map[string]interface{}, error) {
+	if err := filter.checkLabelMatch(); err != nil {
+		return nil, err
+	}
+
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+	ready := filterReady(GetReadyTasks(tasks), filter)
+	if err := sortReady(ready, tasks, order); err != nil {
+		return nil, err
 	}
 
 	return map[string]interface{}{
-		"task":       task,
-		"dep_status": depStatus,
-		"dependents": dependents,
+		"tasks": ready,
+		"count": len(ready),
 	}, nil
 }
 
-// CmdReady returns tasks ready to be worked on
-func CmdReady(root string) (map[string]interface{}, error) {
-	events, err := LoadAllEvents(root)
+// CmdNext returns the single ready task to work on next: the most urgent,
+// then oldest. With claim, it is also claimed, holding the event log lock
+// from picking to claiming so concurrent agents each get a different task.
+// notes and by are passed to the claim as in CmdClaim. "task" is nil when
+// nothing is ready.
+func CmdNext(root string, claim bool, notes, by string) (map[string]interface{}, error) {
+	var next *Task
+	pick := func() error {
+		tasks, err := LoadState(root)
+		if err != nil {
+			return err
+		}
+		ready := GetReadyTasks(tasks)
+		if len(ready) == 0 {
+			return nil
+		}
+		sortTasksByPriorityCreated(ready)
+		next = ready[0]
+		if !claim {
+			return nil
+		}
+
+		event, err := claimEvent(root, next, notes, by)
+		if err != nil {
+			return err
+		}
+		if err := appendEventsLocked(root, []Event{event}); err != nil {
+			return err
+		}
+		next.Status = StatusInProgress
+		next.Updated = event.Timestamp
+		if by != "" {
+			next.Assignee = by
+		}
+		return nil
+	}
+
+	var err error
+	if claim {
+		err = withLock(root, pick)
+	} else {
+		err = pick()
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	tasks := ComputeState(events)
-	ready := GetReadyTasks(tasks)
+	if next == nil {
+		return map[string]interface{}{
+			"task":    nil,
+			"claimed": false,
+		}, nil
+	}
+	return map[string]interface{}{
+		"task":    next,
+		"claimed": claim,
+	}, nil
+}
 
-	// Sort by priority (ascending), then created time (ascending)
-	sort.Slice(ready, func(i, j int) bool {
-		if ready[i].Priority != ready[j].Priority {
-			return ready[i].Priority < ready[j].Priority
+// sortReady orders ready tasks. The default order is priority, then created
+// time, then ID. "leverage" breaks priority ties by how many unfinished tasks
+// depend on each task, most first.
+func sortReady(ready []*Task, tasks map[string]*Task, order string) error {
+	switch order {
+	case "", "default":
+		sortTasksByPriorityCreated(ready)
+	case "leverage":
+		dependents := make(map[string]int)
+		for _, t := range tasks {
+			if t.Deleted || t.Status == StatusDone {
+				continue
+			}
+			for _, depID := range t.Deps {
+				dependents[depID]++
+			}
 		}
-		return ready[i].Created.Before(ready[j].Created)
-	})
+		sort.Slice(ready, func(i, j int) bool {
+			a, b := ready[i], ready[j]
+			if a.Priority == b.Priority && dependents[a.ID] != dependents[b.ID] {
+				return dependents[a.ID] > dependents[b.ID]
+			}
+			return taskLess(a, b, false)
+		})
+	default:
+		return fmt.Errorf("invalid order '%s' (valid: default, leverage)", order)
+	}
+	return nil
+}
 
-	return map[string]interface{}{
-		"tasks": ready,
-		"count": len(ready),
-	}, nil
+// filterReady keeps the ready tasks that match the filter's labels
+func filterReady(ready []*Task, filter ListFilter) []*Task {
+	kept := make([]*Task, 0, len(ready))
+	for _, t := range ready {
+		if filter.matchesLabels(t) {
+			kept = append(kept, t)
+		}
+	}
+	return kept
 }
 
 // CmdDep adds or removes a dependency
 func CmdDep(root, id, depID, action string) (map[string]interface{}, error) {
-	events, err := LoadAllEvents(root)
+	tasks, err := LoadState(root)
 	if err != nil {
 		return nil, err
 	}
-
-	tasks := ComputeState(events)
 	if _, ok := tasks[id]; !ok {
 		return nil, fmt.Errorf("task not found: %s", id)
 	}
@@ -490,35 +1911,350 @@ func CmdDep(root, id, depID, action string) (map[string]interface{}, error) {
 	}, nil
 }
 
+// CmdBlock records (action "add") or clears (action "remove") that blockerID
+// blocks id. Blocks are informational: unlike deps they don't affect ready.
+func CmdBlock(root, id, blockerID, action string) (map[string]interface{}, error) {
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+	if task, ok := tasks[id]; !ok || task.Deleted {
+		return nil, fmt.Errorf("task not found: %s", id)
+	}
+	if blocker, ok := tasks[blockerID]; !ok || blocker.Deleted {
+		return nil, fmt.Errorf("blocking task not found: %s", blockerID)
+	}
+
+	if action == "add" && WouldCreateBlockCycle(tasks, blockerID, id) {
+		return nil, fmt.Errorf("circular block: %s blocking %s would create a cycle", blockerID, id)
+	}
+
+	now := NowISO()
+	event := Event{
+		ID:        blockerID,
+		Timestamp: now,
+		Type:      EventBlock,
+		Block:     id,
+		Action:    action,
+	}
+
+	if err := AppendEvent(root, event); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"id":      id,
+		"on":      blockerID,
+		"action":  action,
+		"updated": now,
+	}, nil
+}
+
 // CmdGraph returns the dependency graph as readable text
-func CmdGraph(root string) (string, error) {
-	events, err := LoadAllEvents(root)
+func CmdGraph(root string, pruneDoneLeaves bool) (string, error) {
+	tasks, err := LoadState(root)
 	if err != nil {
 		return "", err
 	}
+	return FormatDependencyTree(tasks, pruneDoneLeaves), nil
+}
 
-	tasks := ComputeState(events)
-	return FormatDependencyTree(tasks), nil
+// CmdGraphData returns the dependency graph of live (non-deleted) tasks as
+// nodes and edges
+func CmdGraphData(root string) (Graph, error) {
+	tasks, err := LoadState(root)
+	if err != nil {
+		return Graph{}, err
+	}
+
+	return BuildDependencyGraph(liveTasks(tasks)), nil
+}
+
+// CmdGantt renders all live tasks as a Mermaid Gantt chart grouped by
+// priority or label
+func CmdGantt(root, groupBy string) (string, error) {
+	tasks, err := LoadState(root)
+	if err != nil {
+		return "", err
+	}
+
+	return FormatGantt(tasks, groupBy, NowISO())
+}
+
+// FormatGantt renders tasks as a Mermaid Gantt chart with one section per
+// priority or label. Each bar runs from creation to completion; tasks that
+// aren't done yet run to now. Deleted and archived tasks are left out; there
+// are no due dates, so every other task gets a bar.
+func FormatGantt(tasks map[string]*Task, groupBy string, now time.Time) (string, error) {
+	var list []*Task
+	for _, t := range liveTasks(tasks) {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Created.Equal(list[j].Created) {
+			return list[i].Created.Before(list[j].Created)
+		}
+		return list[i].ID < list[j].ID
+	})
+
+	groups, err := GroupTasks(list, groupBy)
+	if err != nil {
+		return "", err
+	}
+
+	const day = "2006-01-02"
+	var sb strings.Builder
+	sb.WriteString("gantt\n")
+	sb.WriteString("    title tlog tasks\n")
+	sb.WriteString("    dateFormat YYYY-MM-DD\n")
+	for _, g := range groups {
+		fmt.Fprintf(&sb, "    section %s\n", ganttText(g.Name))
+		for _, t := range g.Tasks {
+			end := now
+			tag := ""
+			switch t.Status {
+			case StatusDone:
+				end = t.Updated // last change of a done task is its completion
+				tag = "done, "
+			case StatusInProgress:
+				tag = "active, "
+			}
+			// Mermaid end dates are exclusive, so a same-day task still gets a bar
+			fmt.Fprintf(&sb, "    %s :%s%s, %s, %s\n", ganttText(t.Title), tag, t.ID,
+				t.Created.Format(day), end.AddDate(0, 0, 1).Format(day))
+		}
+	}
+	return sb.String(), nil
+}
+
+// ganttText strips characters that Mermaid treats as Gantt syntax
+func ganttText(s string) string {
+	return strings.NewReplacer(":", " ", "#", "", ";", ",", "\n", " ").Replace(s)
+}
+
+// CmdDOT renders the dependency graph of live tasks as Graphviz DOT
+func CmdDOT(root string) (string, error) {
+	tasks, err := LoadState(root)
+	if err != nil {
+		return "", err
+	}
+
+	live := liveTasks(tasks)
+	return FormatDOT(BuildDependencyGraph(live), live), nil
+}
+
+// dotStatusColors maps task status to a node fill color
+var dotStatusColors = map[TaskStatus]string{
+	StatusOpen:       "white",
+	StatusInProgress: "lightyellow",
+	StatusDone:       "lightgreen",
+}
+
+// FormatDOT renders a dependency graph as Graphviz DOT. Each node is labeled
+// with its ID and title (plus priority, if not medium, from tasks) and filled
+// by status; each edge points from a dep to the task that needs it, or dashed
+// from a blocker to the task it blocks. Edges to tasks outside the graph are
+// skipped so dot doesn't invent bare nodes.
+func FormatDOT(graph Graph, tasks map[string]*Task) string {
+	var sb strings.Builder
+	sb.WriteString("digraph tlog {\n")
+	sb.WriteString("    rankdir=LR;\n")
+	sb.WriteString("    node [shape=box, style=filled];\n")
+
+	inGraph := make(map[string]bool, len(graph.Nodes))
+	for _, n := range graph.Nodes {
+		inGraph[n.ID] = true
+		label := n.Title
+		if t, ok := tasks[n.ID]; ok {
+			label = formatPriorityPrefix(t.Priority) + label
+		}
+		color, ok := dotStatusColors[n.Status]
+		if !ok {
+			color = "white"
+		}
+		fmt.Fprintf(&sb, "    %s [label=%s, fillcolor=%s];\n", dotQuote(n.ID), dotQuote(n.ID+"\n"+label), color)
+	}
+	for _, e := range graph.Edges {
+		if !inGraph[e.From] || !inGraph[e.To] {
+			continue
+		}
+		style := ""
+		if e.Type == "blocks" {
+			style = " [style=dashed]"
+		}
+		fmt.Fprintf(&sb, "    %s -> %s%s;\n", dotQuote(e.From), dotQuote(e.To), style)
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// dotQuote returns s as a double-quoted DOT string
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// CmdMermaid renders the dependency graph of live tasks as a Mermaid flowchart
+func CmdMermaid(root string) (string, error) {
+	tasks, err := LoadState(root)
+	if err != nil {
+		return "", err
+	}
+
+	return FormatMermaid(tasks), nil
+}
+
+// FormatMermaid renders live tasks as a Mermaid "graph TD" flowchart,
+// suitable for pasting into GitHub markdown. Nodes are keyed by task ID and
+// labeled by title; each edge points from a task to one of its deps, or
+// dotted to a task that blocks it. Done and in-progress tasks are styled by
+// class.
+func FormatMermaid(tasks map[string]*Task) string {
+	live := liveTasks(tasks)
+	ids := make([]string, 0, len(live))
+	for id := range live {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var sb strings.Builder
+	sb.WriteString("graph TD\n")
+	for _, id := range ids {
+		fmt.Fprintf(&sb, "    %s[\"%s\"]\n", id, mermaidText(live[id].Title))
+	}
+	for _, id := range ids {
+		for _, depID := range live[id].Deps {
+			if _, ok := live[depID]; ok {
+				fmt.Fprintf(&sb, "    %s --> %s\n", id, depID)
+			}
+		}
+		for _, blockedID := range live[id].Blocks {
+			if _, ok := live[blockedID]; ok {
+				fmt.Fprintf(&sb, "    %s -.->|blocked by| %s\n", blockedID, id)
+			}
+		}
+	}
+
+	var done, inProgress []string
+	for _, id := range ids {
+		switch live[id].Status {
+		case StatusDone:
+			done = append(done, id)
+		case StatusInProgress:
+			inProgress = append(inProgress, id)
+		}
+	}
+	if len(inProgress) > 0 {
+		sb.WriteString("    classDef in_progress fill:#fff3b0\n")
+		fmt.Fprintf(&sb, "    class %s in_progress\n", strings.Join(inProgress, ","))
+	}
+	if len(done) > 0 {
+		sb.WriteString("    classDef done fill:#c8e6c9\n")
+		fmt.Fprintf(&sb, "    class %s done\n", strings.Join(done, ","))
+	}
+	return sb.String()
+}
+
+// mermaidText escapes a title for use inside a quoted Mermaid node label
+func mermaidText(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "[", "#91;", "]", "#93;", "\r\n", "<br/>", "\n", "<br/>").Replace(s)
 }
 
 // FormatDependencyTree renders tasks as a goal decomposition tree
-// Root = top-level goals (tasks nothing depends on), Leaves = ready tasks
-func FormatDependencyTree(tasks map[string]*Task) string {
+// Root = top-level goals (tasks nothing depends on), Leaves = ready tasks.
+// With pruneDoneLeaves, a task whose subtasks are all done is marked
+// "(all subtasks done)" so finished branches read as collapsed.
+func FormatDependencyTree(tasks map[string]*Task, pruneDoneLeaves bool) string {
 	var sb strings.Builder
 
-	// Find non-done, non-deleted tasks
+	active := activeTasks(tasks)
+	if len(active) == 0 {
+		return "No active tasks"
+	}
+
+	hasDependents := activeDependents(active)
+
+	var allDepsDone map[string]bool
+	if pruneDoneLeaves {
+		allDepsDone = subtasksAllDone(tasks, active)
+	}
+
+	// Root tasks: active tasks that no other active task depends on (top-level goals)
+	var roots []*Task
+	for _, t := range active {
+		if !hasDependents[t.ID] {
+			roots = append(roots, t)
+		}
+	}
+
+	// Sort: in_progress first, then by priority, then by created time, then ID
+	sort.Slice(roots, func(i, j int) bool {
+		if (roots[i].Status == StatusInProgress) != (roots[j].Status == StatusInProgress) {
+			return roots[i].Status == StatusInProgress
+		}
+		return taskLess(roots[i], roots[j], false)
+	})
+
+	// Render each root task with its dependencies (subtasks)
+	for i, task := range roots {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		seen := make(map[string]bool)
+		renderTaskTree(&sb, task, active, "", "", seen, allDepsDone)
+	}
+
+	return sb.String()
+}
+
+// subtasksAllDone returns the active tasks that have deps, all of which are
+// done (deleted deps are ignored)
+func subtasksAllDone(tasks, active map[string]*Task) map[string]bool {
+	allDone := make(map[string]bool)
+	for id, t := range active {
+		live := 0
+		done := true
+		for _, depID := range t.Deps {
+			dep, ok := tasks[depID]
+			if !ok || dep.Deleted {
+				continue
+			}
+			live++
+			if dep.Status != StatusDone {
+				done = false
+				break
+			}
+		}
+		if live > 0 && done {
+			allDone[id] = true
+		}
+	}
+	return allDone
+}
+
+// activeTasks returns the non-done, non-deleted, non-archived tasks
+func activeTasks(tasks map[string]*Task) map[string]*Task {
 	active := make(map[string]*Task)
 	for id, t := range tasks {
-		if t.Status != StatusDone && !t.Deleted {
+		if t.Status != StatusDone && !t.Deleted && !t.Archived {
 			active[id] = t
 		}
 	}
+	return active
+}
 
-	if len(active) == 0 {
-		return "No active tasks"
+// liveTasks returns the tasks that haven't been deleted or archived
+func liveTasks(tasks map[string]*Task) map[string]*Task {
+	live := make(map[string]*Task)
+	for id, t := range tasks {
+		if !t.Deleted && !t.Archived {
+			live[id] = t
+		}
 	}
+	return live
+}
 
-	// Build set of tasks that have dependents (are depended on by others)
+// activeDependents returns the set of active tasks that other active tasks depend on
+func activeDependents(active map[string]*Task) map[string]bool {
 	hasDependents := make(map[string]bool)
 	for _, t := range active {
 		for _, depID := range t.Deps {
@@ -527,40 +2263,139 @@ func FormatDependencyTree(tasks map[string]*Task) string {
 			}
 		}
 	}
+	return hasDependents
+}
 
-	// Root tasks: active tasks that no other active task depends on (top-level goals)
-	var roots []*Task
+// FindOrphans returns active tasks with no deps that no active task depends
+// on, sorted by priority then created time
+func FindOrphans(tasks map[string]*Task) []*Task {
+	active := activeTasks(tasks)
+	hasDependents := activeDependents(active)
+
+	orphans := make([]*Task, 0)
 	for _, t := range active {
-		if !hasDependents[t.ID] {
-			roots = append(roots, t)
+		if len(t.Deps) == 0 && !hasDependents[t.ID] {
+			orphans = append(orphans, t)
+		}
+	}
+	sortTasksByPriorityCreated(orphans)
+	return orphans
+}
+
+// BuildTaskTree nests an ordered task list by dependency: roots are tasks no
+// other listed task depends on, and each task's listed deps become its
+// subtasks, up to depth levels below the roots. Order follows the input.
+// Tasks on a dependency cycle that nothing outside it depends on would have
+// no root; the first such task in the list becomes one, marked Cycle.
+func BuildTaskTree(list []*Task, depth int) []*TaskTreeNode {
+	listed := make(map[string]*Task, len(list))
+	position := make(map[string]int, len(list))
+	for i, t := range list {
+		listed[t.ID] = t
+		position[t.ID] = i
+	}
+	hasDependents := activeDependents(listed)
+
+	var build func(t *Task, level int, path map[string]bool) *TaskTreeNode
+	build = func(t *Task, level int, path map[string]bool) *TaskTreeNode {
+		node := &TaskTreeNode{Task: t}
+		if level >= depth {
+			return node
+		}
+		path[t.ID] = true
+		var children []*Task
+		for _, depID := range t.Deps {
+			if dep, ok := listed[depID]; ok && !path[depID] {
+				children = append(children, dep)
+			}
+		}
+		sort.Slice(children, func(i, j int) bool {
+			return position[children[i].ID] < position[children[j].ID]
+		})
+		for _, child := range children {
+			node.Subtasks = append(node.Subtasks, build(child, level+1, path))
+		}
+		delete(path, t.ID)
+		return node
+	}
+
+	// Everything under a root, at any depth, is in the tree somewhere
+	reached := make(map[string]bool)
+	var reach func(id string)
+	reach = func(id string) {
+		if reached[id] {
+			return
+		}
+		reached[id] = true
+		for _, depID := range listed[id].Deps {
+			if _, ok := listed[depID]; ok {
+				reach(depID)
+			}
 		}
 	}
 
-	// Sort: in_progress first, then by priority, then by created time
-	sort.Slice(roots, func(i, j int) bool {
-		if roots[i].Status != roots[j].Status {
-			return roots[i].Status == StatusInProgress
+	roots := make([]*TaskTreeNode, 0)
+	for _, t := range list {
+		if !hasDependents[t.ID] {
+			roots = append(roots, build(t, 0, make(map[string]bool)))
+			reach(t.ID)
 		}
-		if roots[i].Priority != roots[j].Priority {
-			return roots[i].Priority < roots[j].Priority
+	}
+	for _, t := range list {
+		if !reached[t.ID] {
+			node := build(t, 0, make(map[string]bool))
+			node.Cycle = true
+			roots = append(roots, node)
+			reach(t.ID)
 		}
-		return roots[i].Created.Before(roots[j].Created)
-	})
+	}
+	return roots
+}
 
-	// Render each root task with its dependencies (subtasks)
-	for i, task := range roots {
-		if i > 0 {
-			sb.WriteString("\n")
+// CmdOrphans lists active tasks that are disconnected from the dependency graph
+func CmdOrphans(root string) (map[string]interface{}, error) {
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+
+	orphans := FindOrphans(tasks)
+	return map[string]interface{}{
+		"tasks": orphans,
+		"count": len(orphans),
+	}, nil
+}
+
+// CmdCycles returns the dependency cycles among live (non-deleted) tasks.
+// Each cycle is a list of {id, title} in dependency order.
+func CmdCycles(root string) (map[string]interface{}, error) {
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+
+	live := liveTasks(tasks)
+
+	cycles := make([][]map[string]interface{}, 0)
+	for _, cycle := range FindCycles(live) {
+		chain := make([]map[string]interface{}, 0, len(cycle))
+		for _, id := range cycle {
+			chain = append(chain, map[string]interface{}{
+				"id":    id,
+				"title": live[id].Title,
+			})
 		}
-		seen := make(map[string]bool)
-		renderTaskTree(&sb, task, active, "", "", seen)
+		cycles = append(cycles, chain)
 	}
 
-	return sb.String()
+	return map[string]interface{}{
+		"cycles": cycles,
+		"count":  len(cycles),
+	}, nil
 }
 
 // renderTaskTree recursively renders a task and its dependencies (subtasks)
-func renderTaskTree(sb *strings.Builder, task *Task, active map[string]*Task, prefix string, connector string, seen map[string]bool) {
+func renderTaskTree(sb *strings.Builder, task *Task, active map[string]*Task, prefix string, connector string, seen map[string]bool, allDepsDone map[string]bool) {
 	// Cycle detection
 	if seen[task.ID] {
 		return
@@ -579,7 +2414,11 @@ func renderTaskTree(sb *strings.Builder, task *Task, active map[string]*Task, pr
 	}
 
 	// Render this task
-	fmt.Fprintf(sb, "%s%s%s %s  %s\n", prefix, connector, status, task.ID, task.Title)
+	marker := ""
+	if allDepsDone[task.ID] {
+		marker = " (all subtasks done)"
+	}
+	fmt.Fprintf(sb, "%s%s%s %s  %s%s\n", prefix, connector, status, task.ID, task.Title, marker)
 
 	// Get active dependencies (subtasks that need to be done first)
 	var deps []*Task
@@ -592,13 +2431,8 @@ func renderTaskTree(sb *strings.Builder, task *Task, active map[string]*Task, pr
 		return
 	}
 
-	// Sort by priority, then by created time
-	sort.Slice(deps, func(i, j int) bool {
-		if deps[i].Priority != deps[j].Priority {
-			return deps[i].Priority < deps[j].Priority
-		}
-		return deps[i].Created.Before(deps[j].Created)
-	})
+	// Sort by priority, then by created time, then ID
+	sortTasksByPriorityCreated(deps)
 
 	// Calculate child prefix based on current connector
 	var childPrefix string
@@ -617,52 +2451,30 @@ func renderTaskTree(sb *strings.Builder, task *Task, active map[string]*Task, pr
 		if isLast {
 			childConnector = "└─ "
 		}
-		renderTaskTree(sb, dep, active, childPrefix, childConnector, seen)
+		renderTaskTree(sb, dep, active, childPrefix, childConnector, seen, allDepsDone)
 	}
 }
 
 // CmdPrime generates context for AI agents
 func CmdPrime(root string, cliReference string) (string, error) {
-	events, err := LoadAllEvents(root)
+	tasks, err := LoadState(root)
 	if err != nil {
 		return "", err
 	}
-
-	tasks := ComputeState(events)
-
-	// Categorize tasks
-	var ready, inProgress, blocked []*Task
-	for _, t := range tasks {
-		if t.Deleted {
-			continue
-		}
-		switch t.Status {
-		case StatusInProgress:
-			inProgress = append(inProgress, t)
-		case StatusOpen:
-			if t.Priority == PriorityBacklog {
-				continue // skip backlog
-			}
-			// Check if blocked on deps
-			isBlocked := false
-			for _, depID := range t.Deps {
-				if dep, ok := tasks[depID]; ok && dep.Status != StatusDone {
-					isBlocked = true
-					break
-				}
-			}
-			if isBlocked {
-				blocked = append(blocked, t)
-			} else {
-				ready = append(ready, t)
-			}
-		}
-	}
+	inProgress, ready, blocked := categorizeTasks(tasks)
 
 	// Sort ready by priority then created
 	sortTasksByPriorityCreated(ready)
 	sortTasksByPriorityCreated(blocked)
 
+	// Longest-stalled in-progress work first
+	sort.Slice(inProgress, func(i, j int) bool {
+		if !inProgress[i].Updated.Equal(inProgress[j].Updated) {
+			return inProgress[i].Updated.Before(inProgress[j].Updated)
+		}
+		return inProgress[i].ID < inProgress[j].ID
+	})
+
 	// Count stats
 	var openCount, inProgressCount, doneCount int
 	for _, t := range tasks {
@@ -679,8 +2491,18 @@ func CmdPrime(root string, cliReference string) (string, error) {
 		}
 	}
 
+	cfg, err := LoadConfig(root)
+	if err != nil {
+		return "", err
+	}
+
 	var sb strings.Builder
 
+	// WIP limit nudge goes first so it can't be missed
+	if cfg.WIPLimit > 0 && inProgressCount >= cfg.WIPLimit {
+		sb.WriteString(fmt.Sprintf("WIP LIMIT REACHED: %d in-progress (limit %d). Finish or unclaim a task before claiming another.\n\n", inProgressCount, cfg.WIPLimit))
+	}
+
 	sb.WriteString("tlog tracks tasks for AI agents in this project.\n\n")
 
 	// Summary line
@@ -721,9 +2543,10 @@ func CmdPrime(root string, cliReference string) (string, error) {
 
 	// In-progress tasks (important - shows what's being worked on)
 	if len(inProgress) > 0 {
-		sb.WriteString("\nIn-progress:\n")
+		sb.WriteString("\nIn-progress (oldest first):\n")
+		now := time.Now()
 		for _, t := range inProgress {
-			sb.WriteString(fmt.Sprintf("  %s  %s%s\n", t.ID, formatPriorityPrefix(t.Priority), t.Title))
+			sb.WriteString(fmt.Sprintf("  %s  %s%s (%s ago)\n", t.ID, formatPriorityPrefix(t.Priority), t.Title, FormatAge(now.Sub(t.Updated))))
 		}
 	}
 
@@ -743,7 +2566,7 @@ func CmdPrime(root string, cliReference string) (string, error) {
 			var waitingOn []string
 			for _, depID := range t.Deps {
 				if dep, ok := tasks[depID]; ok && dep.Status != StatusDone {
-					waitingOn = append(waitingOn, depID[:8])
+					waitingOn = append(waitingOn, depID)
 				}
 			}
 			sb.WriteString(fmt.Sprintf("  %s  %s%s (waiting: %s)\n", t.ID, formatPriorityPrefix(t.Priority), t.Title, strings.Join(waitingOn, ", ")))
@@ -757,16 +2580,145 @@ func CmdPrime(root string, cliReference string) (string, error) {
 	return sb.String(), nil
 }
 
-// sortTasksByPriorityCreated sorts by priority (asc) then created (asc)
+// categorizeTasks splits live tasks into in-progress, ready (GetReadyTasks),
+// and blocked (GetBlockedTasks). Done and backlog tasks are in none of them.
+func categorizeTasks(tasks map[string]*Task) (inProgress, ready, blocked []*Task) {
+	for _, t := range tasks {
+		if !t.Deleted && !t.Archived && t.Status == StatusInProgress {
+			inProgress = append(inProgress, t)
+		}
+	}
+	return inProgress, GetReadyTasks(tasks), GetBlockedTasks(tasks)
+}
+
+// CmdStats summarizes the board: live tasks by status, priority, and label,
+// how many are ready versus blocked, and the oldest open task
+func CmdStats(root string) (map[string]interface{}, error) {
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+	_, ready, blocked := categorizeTasks(tasks)
+
+	byStatus := map[string]int{string(StatusOpen): 0, string(StatusInProgress): 0, string(StatusDone): 0}
+	byPriority := make(map[string]int)
+	for p := PriorityCritical; p <= PriorityBacklog; p++ {
+		byPriority[p.String()] = 0
+	}
+	byLabel := make(map[string]int)
+	total := 0
+	var oldest *Task
+	for _, t := range tasks {
+		if t.Deleted {
+			continue
+		}
+		total++
+		byStatus[string(t.Status)]++
+		byPriority[t.Priority.String()]++
+		for _, label := range t.Labels {
+			byLabel[label]++
+		}
+		if t.Status != StatusOpen {
+			continue
+		}
+		if oldest == nil || t.Created.Before(oldest.Created) ||
+			(t.Created.Equal(oldest.Created) && t.ID < oldest.ID) {
+			oldest = t
+		}
+	}
+
+	result := map[string]interface{}{
+		"total":       total,
+		"by_status":   byStatus,
+		"by_priority": byPriority,
+		"by_label":    byLabel,
+		"ready":       len(ready),
+		"blocked":     len(blocked),
+	}
+	if oldest != nil {
+		result["oldest_open"] = map[string]interface{}{
+			"id":      oldest.ID,
+			"title":   oldest.Title,
+			"created": oldest.Created,
+			"age":     FormatAge(NowISO().Sub(oldest.Created)),
+		}
+	}
+	return result, nil
+}
+
+// formatNote renders a note log entry as "2006-01-02 15:04 author: text",
+// leaving out whatever the entry doesn't record
+func formatNote(note Note) string {
+	var prefix []string
+	if !note.Time.IsZero() {
+		prefix = append(prefix, note.Time.Format("2006-01-02 15:04"))
+	}
+	if note.Author != "" {
+		prefix = append(prefix, note.Author)
+	}
+	if len(prefix) == 0 {
+		return note.Text
+	}
+	return strings.Join(prefix, " ") + ": " + note.Text
+}
+
+// formatMinutes renders a duration in minutes as hours and minutes, e.g. "1h30m"
+func formatMinutes(m int) string {
+	switch {
+	case m < 60:
+		return fmt.Sprintf("%dm", m)
+	case m%60 == 0:
+		return fmt.Sprintf("%dh", m/60)
+	default:
+		return fmt.Sprintf("%dh%dm", m/60, m%60)
+	}
+}
+
+// FormatAge renders a duration coarsely, rounding down to whole minutes,
+// hours, or days (e.g. 90s is "1m", 36h is "1d")
+func FormatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "<1m"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
+
+// sortTasksByPriorityCreated sorts by priority (asc), created (asc), then ID
 func sortTasksByPriorityCreated(tasks []*Task) {
 	sort.Slice(tasks, func(i, j int) bool {
-		if tasks[i].Priority != tasks[j].Priority {
-			return tasks[i].Priority < tasks[j].Priority
-		}
-		return tasks[i].Created.Before(tasks[j].Created)
+		return taskLess(tasks[i], tasks[j], false)
 	})
 }
 
+// taskLess is the shared comparator for task ordering: priority (asc), then
+// manual order (tasks placed by move first, by Order), then created time,
+// then ID as a terminal key so output is reproducible. newestFirst orders
+// created time descending instead of ascending.
+func taskLess(a, b *Task, newestFirst bool) bool {
+	if a.Priority != b.Priority {
+		return a.Priority < b.Priority
+	}
+	if a.Order != b.Order {
+		if a.Order == 0 || b.Order == 0 {
+			return b.Order == 0
+		}
+		return a.Order < b.Order
+	}
+	if !a.Created.Equal(b.Created) {
+		if newestFirst {
+			return a.Created.After(b.Created)
+		}
+		return a.Created.Before(b.Created)
+	}
+	return a.ID < b.ID
+}
+
 // formatPriorityPrefix returns a bracketed priority prefix for display.
 // Returns empty string for medium priority (the default) to reduce noise.
 func formatPriorityPrefix(p Priority) string {
@@ -778,13 +2730,11 @@ func formatPriorityPrefix(p Priority) string {
 
 // CmdLabels shows labels in use and recommended conventions
 func CmdLabels(root string) (map[string]interface{}, error) {
-	events, err := LoadAllEvents(root)
+	tasks, err := LoadState(root)
 	if err != nil {
 		return nil, err
 	}
 
-	tasks := ComputeState(events)
-
 	// Collect unique labels (excluding deleted tasks)
 	labelSet := make(map[string]bool)
 	for _, task := range tasks {
@@ -796,7 +2746,7 @@ func CmdLabels(root string) (map[string]interface{}, error) {
 		}
 	}
 
-	var labels []string
+	labels := make([]string, 0, len(labelSet))
 	for label := range labelSet {
 		labels = append(labels, label)
 	}
@@ -815,31 +2765,292 @@ func CmdLabels(root string) (map[string]interface{}, error) {
 	}, nil
 }
 
-// CmdSync commits .tlog to git
-func CmdSync(root, message string) (map[string]interface{}, error) {
-	// git add .tlog/
-	addCmd := exec.Command("git", "add", root)
-	if err := addCmd.Run(); err != nil {
-		return nil, fmt.Errorf("git add failed: %w", err)
+// CmdExport returns the full computed task set ordered by creation time,
+// then ID, for backups and migration. Deleted tasks are omitted unless
+// includeDeleted is set.
+func CmdExport(root string, includeDeleted bool) ([]*Task, error) {
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
 	}
 
-	// git commit
-	commitCmd := exec.Command("git", "commit", "-m", message)
-	if err := commitCmd.Run(); err != nil {
-		return nil, fmt.Errorf("git commit failed: %w", err)
+	exported := make([]*Task, 0, len(tasks))
+	for _, task := range tasks {
+		if task.Deleted && !includeDeleted {
+			continue
+		}
+		exported = append(exported, task)
 	}
+	sort.Slice(exported, func(i, j int) bool {
+		if !exported[i].Created.Equal(exported[j].Created) {
+			return exported[i].Created.Before(exported[j].Created)
+		}
+		return exported[i].ID < exported[j].ID
+	})
+	return exported, nil
+}
 
-	return map[string]interface{}{
+// CmdSync commits .tlog to git. It holds the event log lock while staging
+// and committing so an in-flight append can't be committed half-written.
+// Git runs from the enclosing repository's top level and only .tlog is
+// staged and committed, minus tlog's local files. With no changes under
+// .tlog, it reports "nothing to sync" instead.
+//
+// amend folds the changes into the previous commit, but only if that commit
+// touches nothing outside .tlog; otherwise (or when there is no commit yet)
+// it makes a new commit, with a warning. push runs git push afterward, once
+// the lock is released.
+func CmdSync(root, message string, amend, push bool) (map[string]interface{}, error) {
+	result := map[string]interface{}{
 		"status":  "synced",
 		"message": message,
-	}, nil
+		"amended": false,
+		"pushed":  false,
+	}
+
+	var top string
+	err := withLock(root, func() error {
+		var err error
+		top, err = runGit(root, "rev-parse", "--show-toplevel")
+		if err != nil {
+			return err
+		}
+		rel, err := repoRelative(top, root)
+		if err != nil {
+			return err
+		}
+		// Initialize only excludes these when .tlog sits at the repo's top level
+		for _, name := range localFiles {
+			_ = addToGitExclude(top, filepath.ToSlash(filepath.Join(rel, name)))
+		}
+
+		changes, err := LogChanges(root)
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			result["status"] = "nothing to sync"
+			return nil
+		}
+		if _, err := runGit(top, "add", "--", rel); err != nil {
+			return err
+		}
+
+		args := []string{"commit", "-m", message}
+		if amend {
+			if _, err := runGit(top, "rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+				result["warning"] = "no commit to amend; created a new one"
+			} else if only, err := headOnlyTouches(top, rel); err != nil {
+				return err
+			} else if !only {
+				result["warning"] = "previous commit touches files outside " + rel + "; created a new one"
+			} else {
+				args = append(args, "--amend")
+				result["amended"] = true
+			}
+		}
+		_, err = runGit(top, append(args, "--", rel)...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if push {
+		if _, err := runGit(top, "push"); err != nil {
+			return nil, err
+		}
+		result["pushed"] = true
+	}
+
+	return result, nil
+}
+
+// headOnlyTouches reports whether every file HEAD changes is under dir (a
+// path relative to top). Merge commits are compared against each parent, so
+// they only qualify if the merge itself only brought in changes under dir.
+func headOnlyTouches(top, dir string) (bool, error) {
+	out, err := runGit(top, "diff-tree", "--no-commit-id", "--name-only", "-r", "-m", "--root", "HEAD")
+	if err != nil {
+		return false, err
+	}
+	for _, name := range strings.Split(out, "\n") {
+		if name != "" && !strings.HasPrefix(name, dir+"/") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// localFiles are tlog files that only describe this checkout and are never
+// synced
+var localFiles = []string{LockFile, StateFile, SeqFile, ScanFile, PruneJournal}
+
+// repoRelative returns path relative to the repository top level, resolving
+// symlinks on both so the two agree
+func repoRelative(top, dir string) (string, error) {
+	top, err := filepath.EvalSymlinks(top)
+	if err != nil {
+		return "", err
+	}
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(top, dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// runGit runs a git subcommand in dir (the current directory if empty) and
+// returns its trimmed output, including that output in the error if it fails
+func runGit(dir string, args ...string) (string, error) {
+	gitCmd := exec.Command("git", args...)
+	gitCmd.Dir = dir
+	out, err := gitCmd.CombinedOutput()
+	msg := strings.TrimSpace(string(out))
+	if err != nil {
+		if msg != "" {
+			return "", fmt.Errorf("git %s failed: %w: %s", args[0], err, msg)
+		}
+		return "", fmt.Errorf("git %s failed: %w", args[0], err)
+	}
+	return msg, nil
+}
+
+// LogChanges returns `git status --porcelain` lines for files under root,
+// other than tlog's local files, i.e. tlog changes that a sync would commit
+func LogChanges(root string) ([]string, error) {
+	args := []string{"status", "--porcelain", "--", "."}
+	for _, name := range localFiles {
+		args = append(args, ":(exclude)"+name)
+	}
+	statusCmd := exec.Command("git", args...)
+	statusCmd.Dir = root
+	out, err := statusCmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git status failed: %w", err)
+	}
+
+	var changes []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.TrimSpace(line) != "" {
+			changes = append(changes, line)
+		}
+	}
+	return changes, nil
+}
+
+// UncommittedChanges returns `git status --porcelain` lines for the project
+// containing root, ignoring tlog's own files
+func UncommittedChanges(root string) ([]string, error) {
+	statusCmd := exec.Command("git", "status", "--porcelain", "--", ".", ":(exclude)"+TlogDir)
+	statusCmd.Dir = filepath.Dir(root)
+	out, err := statusCmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git status failed: %w", err)
+	}
+
+	var changes []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.TrimSpace(line) != "" {
+			changes = append(changes, line)
+		}
+	}
+	return changes, nil
+}
+
+// CheckVerifyDone applies the verify_done policy before target (the task or
+// tasks, for messages) is marked done with resolution. With require set, as
+// by "done --verify", uncommitted changes always refuse; otherwise the
+// configured policy decides, and only for completed tasks. It returns the
+// uncommitted changes it found, a warning when the policy only warns about
+// them, and an error when it refuses.
+func CheckVerifyDone(root, target string, resolution Resolution, require bool) ([]string, string, error) {
+	mode := ""
+	if require {
+		mode = VerifyDoneRequire
+	} else if resolution == "" || resolution == ResolutionCompleted {
+		cfg, err := LoadConfig(root)
+		if err != nil {
+			return nil, "", err
+		}
+		mode = cfg.VerifyDone
+	}
+	if mode == "" {
+		return nil, "", nil
+	}
+
+	changes, err := UncommittedChanges(root)
+	if err != nil || len(changes) == 0 {
+		return nil, "", err
+	}
+	msg := fmt.Sprintf("%d uncommitted change(s); commit before marking %s done", len(changes), target)
+	if mode == VerifyDoneRequire {
+		return changes, "", fmt.Errorf("%s", msg)
+	}
+	return changes, msg, nil
+}
+
+// CmdEvents summarizes the event log: total and per-type event counts, the
+// number of event files, the time range covered, and whether a compacted
+// snapshot exists
+func CmdEvents(root string) (map[string]interface{}, error) {
+	files, err := ListEventFiles(root)
+	if err != nil {
+		return nil, err
+	}
+	events, err := LoadAllEvents(root)
+	if err != nil {
+		return nil, err
+	}
+
+	byType := make(map[string]int)
+	for _, e := range events {
+		byType[string(e.Type)]++
+	}
+
+	compacted := false
+	for _, f := range files {
+		if f == CompactedFile {
+			compacted = true
+		}
+	}
+
+	result := map[string]interface{}{
+		"total":     len(events),
+		"by_type":   byType,
+		"files":     len(files),
+		"compacted": compacted,
+	}
+	if len(events) > 0 {
+		// LoadAllEvents returns events sorted by timestamp
+		result["first"] = events[0].Timestamp
+		result["last"] = events[len(events)-1].Timestamp
+	}
+	return result, nil
 }
 
 // CmdPrune compacts old event files and optionally removes done tasks.
-// It combines compaction and pruning into a single pass for efficiency.
-// - keepAll: if true, keep all tasks (equivalent to old compact behavior)
-// - saveDays: if > 0 and not keepAll, preserve done tasks from the last N days
-func CmdPrune(root string, saveDays int, keepAll bool, dryRun bool) (map[string]interface{}, error) {
+// It combines compaction and pruning into a single pass for efficiency;
+// see PruneOptions for the knobs.
+//
+// Prune holds the event log lock throughout, so events appended meanwhile
+// (which, with All, land in a file being compacted) wait until it's done.
+func CmdPrune(root string, opts PruneOptions) (map[string]interface{}, error) {
+	fileLock, err := acquireLock(root)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = fileLock.Unlock() }()
+
+	// Finish or roll back a prune that was interrupted
+	if err := recoverPrune(root); err != nil {
+		return nil, fmt.Errorf("recovering interrupted prune: %w", err)
+	}
+
 	files, err := ListEventFiles(root)
 	if err != nil {
 		return nil, err
@@ -847,12 +3058,24 @@ func CmdPrune(root string, saveDays int, keepAll bool, dryRun bool) (map[string]
 
 	today := TodayStr() + ".jsonl"
 
-	// Find files to process (all except today's)
+	// With MaxAge, dated files newer than the cutoff are left alone
+	var fileCutoff time.Time
+	if opts.MaxAge > 0 {
+		fileCutoff = time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -opts.MaxAge)
+	}
+
+	// Find files to process (all except today's, unless All)
 	var filesToProcess []string
 	for _, f := range files {
-		if f != today {
-			filesToProcess = append(filesToProcess, f)
+		if f == today && !opts.All {
+			continue
+		}
+		if !fileCutoff.IsZero() {
+			if date, err := time.Parse("2006-01-02", strings.TrimSuffix(f, ".jsonl")); err == nil && !date.Before(fileCutoff) {
+				continue
+			}
 		}
+		filesToProcess = append(filesToProcess, f)
 	}
 
 	if len(filesToProcess) == 0 {
@@ -862,6 +3085,7 @@ func CmdPrune(root string, saveDays int, keepAll bool, dryRun bool) (map[string]
 			"tasks_before": 0,
 			"tasks_after":  0,
 			"pruned":       0,
+			"archived":     0,
 		}, nil
 	}
 
@@ -876,66 +3100,94 @@ func CmdPrune(root string, saveDays int, keepAll bool, dryRun bool) (map[string]
 	}
 
 	// Sort events by timestamp for correct state computation
-	sort.Slice(events, func(i, j int) bool {
-		return events[i].Timestamp.Before(events[j].Timestamp)
-	})
+	sortEvents(events)
 
 	// Compute state from these events
 	tasks := ComputeState(events)
 
+	// Archived tasks keep their raw events, and whether a task is done (and
+	// since when) decides pruning. Both come from the full state: the archive,
+	// done or reopen event may be in a file this prune leaves alone.
+	current, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+	rawEvents := make(map[string][]Event)
+	for _, event := range events {
+		if t, ok := current[event.ID]; ok && t.Archived {
+			rawEvents[event.ID] = append(rawEvents[event.ID], event)
+		}
+	}
+
 	// Calculate cutoff for save-days
 	cutoff := time.Time{}
-	if saveDays > 0 && !keepAll {
-		cutoff = time.Now().UTC().AddDate(0, 0, -saveDays)
+	if opts.SaveDays > 0 && !opts.KeepAll {
+		cutoff = time.Now().UTC().AddDate(0, 0, -opts.SaveDays)
 	}
 
-	// Generate snapshot events, filtering as needed
-	var snapshotEvents []Event
-	var prunedCount int
+	// Generate snapshot events in a stable order, filtering as needed
+	ordered := make([]*Task, 0, len(tasks))
 	for _, task := range tasks {
+		ordered = append(ordered, task)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if !ordered[i].Created.Equal(ordered[j].Created) {
+			return ordered[i].Created.Before(ordered[j].Created)
+		}
+		return ordered[i].ID < ordered[j].ID
+	})
+
+	var snapshotEvents, archiveEvents []Event
+	var removed []*Task
+	var prunedCount, keptCount int
+	for _, task := range ordered {
 		if task.Deleted {
 			continue
 		}
+		if raw, ok := rawEvents[task.ID]; ok {
+			snapshotEvents = append(snapshotEvents, raw...)
+			keptCount++
+			continue
+		}
 
 		// Decide whether to keep this task
+		latest := task
+		if t, ok := current[task.ID]; ok {
+			latest = t
+		}
 		shouldPrune := false
-		if !keepAll && task.Status == StatusDone {
-			if saveDays > 0 {
+		if !opts.KeepAll && latest.Status == StatusDone {
+			if opts.SaveDays > 0 {
 				// Prune if older than cutoff
-				shouldPrune = task.Updated.Before(cutoff)
+				shouldPrune = latest.Updated.Before(cutoff)
 			} else {
 				// Prune all done tasks
 				shouldPrune = true
 			}
 		}
 
+		if shouldPrune {
+			removed = append(removed, latest)
+		}
+		if shouldPrune && opts.Archive {
+			archiveEvents = append(archiveEvents, snapshotEvent(latest))
+			continue
+		}
 		if shouldPrune {
 			prunedCount++
 			continue
 		}
 
-		priority := task.Priority
-		snapshotEvents = append(snapshotEvents, Event{
-			ID:          task.ID,
-			Timestamp:   task.Created,
-			Type:        EventCreate,
-			Title:       task.Title,
-			Status:      task.Status,
-			Resolution:  task.Resolution,
-			Priority:    &priority,
-			Deps:        task.Deps,
-			Labels:      task.Labels,
-			Description: task.Description,
-			Notes:       task.Notes,
-		})
+		snapshotEvents = append(snapshotEvents, snapshotEvent(task))
+		keptCount++
 	}
 
 	tasksBefore := len(tasks)
-	tasksAfter := len(snapshotEvents)
+	tasksAfter := keptCount
 
-	if dryRun {
+	if opts.DryRun {
 		status := "dry run"
-		if keepAll {
+		if opts.KeepAll {
 			status = "dry run (keep-all)"
 		}
 		return map[string]interface{}{
@@ -944,29 +3196,30 @@ func CmdPrune(root string, saveDays int, keepAll bool, dryRun bool) (map[string]
 			"tasks_before":    tasksBefore,
 			"tasks_after":     tasksAfter,
 			"pruned":          prunedCount,
+			"archived":        len(archiveEvents),
 		}, nil
 	}
 
-	// Write compacted file (only if there are tasks to write)
-	compactedFilename := "compacted.jsonl"
-	if len(snapshotEvents) > 0 {
-		if err := WriteEventsToFile(root, compactedFilename, snapshotEvents); err != nil {
-			return nil, fmt.Errorf("writing compacted file: %w", err)
+	// Archive before removing anything, so a failure never loses tasks
+	if len(archiveEvents) > 0 {
+		if err := appendArchiveLocked(root, archiveEvents); err != nil {
+			return nil, fmt.Errorf("writing archive: %w", err)
 		}
-	} else {
-		// Remove compacted file if no tasks remain
-		_ = DeleteEventFile(root, compactedFilename)
+	}
+	// The prune log is written with the swap, so it records each removal once
+	var logLines []string
+	if opts.Log {
+		logLines = pruneLogLines(removed)
 	}
 
-	// Delete old files
-	for _, f := range filesToProcess {
-		if err := DeleteEventFile(root, f); err != nil {
-			return nil, fmt.Errorf("deleting %s: %w", f, err)
-		}
+	// Replace the processed files, including any previous compacted file,
+	// with a new compacted file (none if no tasks remain)
+	if err := ReplaceEventFiles(root, snapshotEvents, filesToProcess, logLines); err != nil {
+		return nil, fmt.Errorf("writing compacted file: %w", err)
 	}
 
 	status := "pruned"
-	if keepAll {
+	if opts.KeepAll {
 		status = "compacted"
 	}
 
@@ -976,5 +3229,40 @@ func CmdPrune(root string, saveDays int, keepAll bool, dryRun bool) (map[string]
 		"tasks_before":  tasksBefore,
 		"tasks_after":   tasksAfter,
 		"pruned":        prunedCount,
+		"archived":      len(archiveEvents),
 	}, nil
 }
+
+// snapshotEvent returns a single create event that reproduces a task's
+// current state, for compaction and archiving
+func snapshotEvent(task *Task) Event {
+	priority := task.Priority
+	event := Event{
+		ID:          task.ID,
+		Timestamp:   task.Created,
+		Type:        EventCreate,
+		Title:       task.Title,
+		Status:      task.Status,
+		Resolution:  task.Resolution,
+		Priority:    &priority,
+		Deps:        task.Deps,
+		Labels:      task.Labels,
+		Description: task.Description,
+		Notes:       task.Notes,
+		Commit:      task.Commit,
+		Annotations: task.Annotations,
+		TimeSpent:   task.TimeSpent,
+		Blocks:      task.Blocks,
+		Assignee:    task.Assignee,
+		Order:       task.Order,
+		NoteLog:     task.NoteLog,
+	}
+	if len(task.NoteLog) > 0 {
+		// Replay derives the plain notes from the log
+		event.Notes = ""
+	}
+	if task.Estimate != 0 {
+		event.Estimate = &task.Estimate
+	}
+	return event
+}
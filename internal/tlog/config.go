@@ -0,0 +1,145 @@
+package tlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConfigFile is the per-project config file inside the .tlog directory
+const ConfigFile = "config.json"
+
+// Config holds per-project settings. A missing config file means all defaults.
+type Config struct {
+	// LabelPriorities maps a label to the priority a new task gets when it
+	// carries that label and no explicit priority is given
+	LabelPriorities map[string]string `json:"label_priorities,omitempty"`
+
+	// WIPLimit is the number of in-progress tasks at which prime suggests
+	// finishing or unclaiming work before claiming more (0 disables)
+	WIPLimit int `json:"wip_limit,omitempty"`
+
+	// VerifyDone checks for uncommitted changes on every `done` that
+	// completes a task: "warn" prints a warning, "require" refuses. Empty
+	// means only `done --verify` checks.
+	VerifyDone string `json:"verify_done,omitempty"`
+
+	// RequireClaimNote makes claim refuse without a note stating the plan
+	RequireClaimNote bool `json:"require_claim_note,omitempty"`
+
+	// DefaultPriority is the priority of a new task when neither the command
+	// nor LabelPriorities sets one (empty means medium)
+	DefaultPriority string `json:"default_priority,omitempty"`
+
+	// AllowedLabels, if set, is the label vocabulary create and update
+	// accept. feature:<name> labels are always allowed.
+	AllowedLabels []string `json:"allowed_labels,omitempty"`
+
+	// AutoSync commits .tlog to git after every command that changes it
+	AutoSync bool `json:"auto_sync"`
+}
+
+// VerifyDone modes
+const (
+	VerifyDoneWarn    = "warn"
+	VerifyDoneRequire = "require"
+)
+
+// LoadConfig reads .tlog/config.json, returning defaults if it doesn't exist
+func LoadConfig(root string) (Config, error) {
+	var cfg Config
+
+	data, err := os.ReadFile(filepath.Join(root, ConfigFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return cfg, err
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid %s: %w", ConfigFile, err)
+	}
+
+	if cfg.WIPLimit < 0 {
+		return cfg, fmt.Errorf("invalid %s: wip_limit cannot be negative", ConfigFile)
+	}
+
+	switch cfg.VerifyDone {
+	case "", VerifyDoneWarn, VerifyDoneRequire:
+	default:
+		return cfg, fmt.Errorf("invalid %s: verify_done must be '%s' or '%s'", ConfigFile, VerifyDoneWarn, VerifyDoneRequire)
+	}
+
+	for label, name := range cfg.LabelPriorities {
+		if ParsePriority(name).String() != name {
+			return cfg, fmt.Errorf("invalid %s: label '%s' has unknown priority '%s'", ConfigFile, label, name)
+		}
+	}
+
+	if cfg.DefaultPriority != "" {
+		if ParsePriority(cfg.DefaultPriority).String() != cfg.DefaultPriority {
+			return cfg, fmt.Errorf("invalid %s: unknown default_priority '%s'", ConfigFile, cfg.DefaultPriority)
+		}
+	}
+
+	return cfg, nil
+}
+
+// CheckLabels returns an error for the first label outside AllowedLabels.
+// Anything goes when AllowedLabels is empty.
+func (c Config) CheckLabels(labels []string) error {
+	if len(c.AllowedLabels) == 0 {
+		return nil
+	}
+	for _, label := range labels {
+		if strings.HasPrefix(label, "feature:") || containsString(c.AllowedLabels, label) {
+			continue
+		}
+		return fmt.Errorf("label '%s' is not allowed (allowed: %s, or feature:<name>); use --force to add it anyway", label, strings.Join(c.AllowedLabels, ", "))
+	}
+	return nil
+}
+
+// WriteConfig writes .tlog/config.json
+func WriteConfig(root string, cfg Config) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(root, ConfigFile), append(data, '\n'), 0644)
+}
+
+// NewTaskPriority returns the priority for a new task with the given labels
+// and no explicit priority: the label default if any, else
+// DefaultPriority. It returns nil when neither is configured.
+func (c Config) NewTaskPriority(labels []string) *Priority {
+	if p := c.LabelPriority(labels); p != nil {
+		return p
+	}
+	if c.DefaultPriority == "" {
+		return nil
+	}
+	p := ParsePriority(c.DefaultPriority)
+	return &p
+}
+
+// LabelPriority returns the default priority for a set of labels, or nil if
+// none of them has one configured. When several labels map to priorities,
+// the most urgent wins.
+func (c Config) LabelPriority(labels []string) *Priority {
+	var best *Priority
+	for _, label := range labels {
+		name, ok := c.LabelPriorities[label]
+		if !ok {
+			continue
+		}
+		p := ParsePriority(name)
+		if best == nil || p < *best {
+			best = &p
+		}
+	}
+	return best
+}
@@ -0,0 +1,353 @@
+package tlog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Doctor issue types
+const (
+	IssueDanglingDep = "dangling_dep"
+	IssueCycle       = "cycle"
+	IssueCorrupt     = "corrupt"
+
+	// Warnings: suspicious history that doctor reports but can't fix
+	IssueMisfiledEvent  = "misfiled_event"
+	IssueImplicitReopen = "implicit_reopen"
+)
+
+// FindDanglingDeps returns, for each task, the dep IDs that don't resolve to a
+// live task (never existed, pruned, or tombstoned). Deleted tasks are skipped.
+func FindDanglingDeps(tasks map[string]*Task) map[string][]string {
+	dangling := make(map[string][]string)
+	for id, task := range tasks {
+		if task.Deleted {
+			continue
+		}
+		for _, depID := range task.Deps {
+			if dep, ok := tasks[depID]; !ok || dep.Deleted {
+				dangling[id] = append(dangling[id], depID)
+			}
+		}
+	}
+	return dangling
+}
+
+// FindCycles returns the dependency cycles in the stored graph. Each cycle is
+// a sequence [a, b, ..., z] where a depends on b, ..., and z depends on a,
+// rotated so the smallest ID comes first. Deleted tasks are left out of the
+// graph, as they are for readiness.
+func FindCycles(tasks map[string]*Task) [][]string {
+	const (
+		unvisited = iota
+		onStack
+		finished
+	)
+
+	state := make(map[string]int)
+	var stack []string
+	var cycles [][]string
+	seen := make(map[string]bool)
+
+	var visit func(id string)
+	visit = func(id string) {
+		state[id] = onStack
+		stack = append(stack, id)
+		for _, depID := range tasks[id].Deps {
+			if dep, ok := tasks[depID]; !ok || dep.Deleted {
+				continue
+			}
+			switch state[depID] {
+			case unvisited:
+				visit(depID)
+			case onStack:
+				start := len(stack) - 1
+				for stack[start] != depID {
+					start--
+				}
+				cycle := rotateToMin(stack[start:])
+				key := strings.Join(cycle, ",")
+				if !seen[key] {
+					seen[key] = true
+					cycles = append(cycles, cycle)
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[id] = finished
+	}
+
+	for _, id := range sortedKeys(tasks) {
+		if state[id] == unvisited && !tasks[id].Deleted {
+			visit(id)
+		}
+	}
+	return cycles
+}
+
+// rotateToMin returns a copy of cycle rotated so its smallest ID is first
+func rotateToMin(cycle []string) []string {
+	minIdx := 0
+	for i, id := range cycle {
+		if id < cycle[minIdx] {
+			minIdx = i
+		}
+	}
+	return append(append([]string{}, cycle[minIdx:]...), cycle[:minIdx]...)
+}
+
+// FindCorruptTasks returns live tasks whose fields can't have come from a
+// valid event sequence, mapped to a description of what's wrong
+func FindCorruptTasks(tasks map[string]*Task) map[string]string {
+	corrupt := make(map[string]string)
+	for id, task := range tasks {
+		if task.Deleted {
+			continue
+		}
+		var problems []string
+		if strings.TrimSpace(task.Title) == "" {
+			problems = append(problems, "empty title")
+		}
+		switch task.Status {
+		case StatusOpen, StatusInProgress, StatusDone:
+		default:
+			problems = append(problems, fmt.Sprintf("unknown status '%s'", task.Status))
+		}
+		if task.Priority < PriorityCritical || task.Priority > PriorityBacklog {
+			problems = append(problems, fmt.Sprintf("priority out of range (%d)", task.Priority))
+		}
+		if len(problems) > 0 {
+			corrupt[id] = strings.Join(problems, ", ")
+		}
+	}
+	return corrupt
+}
+
+// FindMisfiledEvents returns a warning for each event in a dated event file
+// (YYYY-MM-DD.jsonl) whose timestamp falls on another day, a sign of clock
+// skew or a manual edit. Other files, like the compacted file, hold events
+// from any day and aren't checked.
+func FindMisfiledEvents(files map[string][]Event) []DoctorIssue {
+	var warnings []DoctorIssue
+	for _, name := range sortedKeys(files) {
+		date := strings.TrimSuffix(name, ".jsonl")
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			continue
+		}
+		for _, event := range files[name] {
+			if day := event.Timestamp.UTC().Format("2006-01-02"); day != date {
+				warnings = append(warnings, DoctorIssue{
+					Type:    IssueMisfiledEvent,
+					ID:      event.ID,
+					Message: fmt.Sprintf("%s event in %s is timestamped %s", event.Type, name, event.Timestamp.UTC().Format(time.RFC3339)),
+				})
+			}
+		}
+	}
+	return warnings
+}
+
+// FindImplicitReopens returns a warning for each event that takes a done
+// task out of done without an explicit reopen (a status event back to open):
+// a status event to some other status, or a second create. events must be
+// sorted.
+func FindImplicitReopens(events []Event) []DoctorIssue {
+	var warnings []DoctorIssue
+	done := make(map[string]bool)
+	for _, event := range events {
+		switch event.Type {
+		case EventCreate:
+			if done[event.ID] && event.Status != StatusDone {
+				warnings = append(warnings, DoctorIssue{
+					Type:    IssueImplicitReopen,
+					ID:      event.ID,
+					Message: fmt.Sprintf("re-created at %s after being done", event.Timestamp.UTC().Format(time.RFC3339)),
+				})
+			}
+			done[event.ID] = event.Status == StatusDone
+		case EventStatus:
+			if done[event.ID] && event.Status != StatusDone && event.Status != StatusOpen {
+				warnings = append(warnings, DoctorIssue{
+					Type:    IssueImplicitReopen,
+					ID:      event.ID,
+					Message: fmt.Sprintf("moved to %s at %s after being done, without a reopen", event.Status, event.Timestamp.UTC().Format(time.RFC3339)),
+				})
+			}
+			done[event.ID] = event.Status == StatusDone
+		}
+	}
+	return warnings
+}
+
+// doctorWarnings audits the raw event files for misfiled events and
+// implicit reopens
+func doctorWarnings(root string) ([]DoctorIssue, error) {
+	names, err := ListEventFiles(root)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]Event, len(names))
+	var events []Event
+	for _, name := range names {
+		fileEvents, err := LoadEventsFromFile(root, name)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %w", name, err)
+		}
+		files[name] = fileEvents
+		events = append(events, fileEvents...)
+	}
+	sortEvents(events)
+
+	warnings := make([]DoctorIssue, 0)
+	warnings = append(warnings, FindMisfiledEvents(files)...)
+	warnings = append(warnings, FindImplicitReopens(events)...)
+	return warnings, nil
+}
+
+// CmdDoctor checks the task graph for integrity problems. With fix, it
+// appends events that repair them: dangling deps are removed, cycles are
+// broken by removing their closing edge and the tasks on them closed as
+// wontfix, and corrupt tasks are tombstoned.
+// With dryRun, the fixes are computed and reported but not written.
+//
+// It also audits the event history, returning misfiled events and implicit
+// reopens as "warnings". These don't count as issues and aren't fixed.
+func CmdDoctor(root string, fix, dryRun bool) (map[string]interface{}, error) {
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+	warnings, err := doctorWarnings(root)
+	if err != nil {
+		return nil, err
+	}
+
+	issues := make([]DoctorIssue, 0)
+
+	dangling := FindDanglingDeps(tasks)
+	for _, id := range sortedKeys(dangling) {
+		for _, depID := range dangling[id] {
+			issues = append(issues, DoctorIssue{
+				Type:    IssueDanglingDep,
+				ID:      id,
+				Message: fmt.Sprintf("depends on missing or deleted task %s", depID),
+			})
+		}
+	}
+
+	for _, cycle := range FindCycles(tasks) {
+		issues = append(issues, DoctorIssue{
+			Type:    IssueCycle,
+			ID:      cycle[0],
+			Message: "dependency cycle: " + strings.Join(append(cycle, cycle[0]), " -> "),
+		})
+	}
+
+	corrupt := FindCorruptTasks(tasks)
+	for _, id := range sortedKeys(corrupt) {
+		issues = append(issues, DoctorIssue{
+			Type:    IssueCorrupt,
+			ID:      id,
+			Message: corrupt[id],
+		})
+	}
+
+	result := map[string]interface{}{
+		"issues":   issues,
+		"count":    len(issues),
+		"warnings": warnings,
+	}
+	if !fix && !dryRun {
+		return result, nil
+	}
+
+	var fixEvents []Event
+	fixes := make([]string, 0)
+	now := NowISO()
+
+	// Work on copies of deps so cycle breaking sees earlier removals
+	work := make(map[string]*Task, len(tasks))
+	for id, t := range tasks {
+		c := *t
+		c.Deps = append([]string{}, t.Deps...)
+		work[id] = &c
+	}
+	removeDep := func(id, depID string) {
+		work[id].Deps = removeItem(work[id].Deps, depID)
+		fixEvents = append(fixEvents, Event{ID: id, Timestamp: now, Type: EventDep, Dep: depID, Action: "remove"})
+	}
+
+	for _, id := range sortedKeys(dangling) {
+		for _, depID := range dangling[id] {
+			removeDep(id, depID)
+			fixes = append(fixes, fmt.Sprintf("removed dangling dep %s from %s", depID, id))
+		}
+	}
+
+	// Breaking one cycle can leave others, so repeat until none remain
+	onCycle := make(map[string]bool)
+	for {
+		cycles := FindCycles(work)
+		if len(cycles) == 0 {
+			break
+		}
+		cycle := cycles[0]
+		last := cycle[len(cycle)-1]
+		removeDep(last, cycle[0])
+		fixes = append(fixes, fmt.Sprintf("broke cycle by removing dep %s from %s", cycle[0], last))
+		for _, id := range cycle {
+			onCycle[id] = true
+		}
+	}
+
+	// Tasks that were on a cycle could never have become ready, so they are
+	// closed rather than left to look actionable. Corrupt ones are deleted
+	// below instead.
+	for _, id := range sortedKeys(onCycle) {
+		if tasks[id].Status == StatusDone || corrupt[id] != "" {
+			continue
+		}
+		fixEvents = append(fixEvents, Event{
+			ID:         id,
+			Timestamp:  now,
+			Type:       EventStatus,
+			Status:     StatusDone,
+			Resolution: ResolutionWontfix,
+			Notes:      "doctor: closed after breaking a dependency cycle",
+		})
+		fixes = append(fixes, fmt.Sprintf("closed %s as wontfix after breaking its cycle", id))
+	}
+
+	for _, id := range sortedKeys(corrupt) {
+		fixEvents = append(fixEvents, Event{
+			ID:        id,
+			Timestamp: now,
+			Type:      EventDelete,
+			Notes:     "doctor: corrupt fields (" + corrupt[id] + ")",
+		})
+		fixes = append(fixes, fmt.Sprintf("deleted corrupt task %s (%s)", id, corrupt[id]))
+	}
+
+	result["fixes"] = fixes
+	if dryRun || len(fixEvents) == 0 {
+		return result, nil
+	}
+
+	if err := AppendEvents(root, fixEvents); err != nil {
+		return nil, err
+	}
+	result["fixed"] = true
+	return result, nil
+}
+
+// sortedKeys returns the keys of a string-keyed map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
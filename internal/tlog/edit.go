@@ -0,0 +1,144 @@
+package tlog
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// editScissors marks the start of the help block appended to the edit
+// buffer. Everything from it on is dropped before parsing; '#' lines above
+// it are kept, so descriptions can hold markdown headings.
+const editScissors = "# ------------------------ >8 ------------------------"
+
+// editHelp is appended to the edit buffer, after editScissors
+const editHelp = `
+` + editScissors + `
+# Do not modify or remove the line above; everything below it is ignored.
+# Edit the title (first line) and description (after it) of task %s.
+# Save an empty file to abort.
+`
+
+// CmdEdit opens a task's title and description in the user's editor and
+// records an update for whatever changed. An empty or unchanged buffer
+// records nothing.
+func CmdEdit(root, id string) (map[string]interface{}, error) {
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+	task, ok := tasks[id]
+	if !ok || task.Deleted {
+		return nil, fmt.Errorf("task not found: %s", id)
+	}
+
+	tmp, err := os.CreateTemp("", "tlog-edit-*.txt")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	_, err = tmp.WriteString(FormatEditBuffer(task))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := runEditor(tmp.Name()); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]interface{}{"id": id}
+	title, description, ok := ParseEditBuffer(string(data))
+	if !ok {
+		result["status"] = "aborted"
+		return result, nil
+	}
+
+	event := Event{ID: id, Timestamp: NowISO(), Type: EventUpdate}
+	var changed []string
+	if title != task.Title {
+		event.Title = title
+		changed = append(changed, "title")
+	}
+	if description != task.Description {
+		if description == "" {
+			// Update events can't express an empty description
+			return nil, fmt.Errorf("cannot clear the description of %s", id)
+		}
+		event.Description = description
+		changed = append(changed, "description")
+	}
+	if len(changed) == 0 {
+		result["status"] = "unchanged"
+		return result, nil
+	}
+
+	if err := AppendEvent(root, event); err != nil {
+		return nil, err
+	}
+	result["status"] = "updated"
+	result["changed"] = changed
+	return result, nil
+}
+
+// FormatEditBuffer renders a task for editing: the title on the first line,
+// then a blank line and the description, then help comments
+func FormatEditBuffer(task *Task) string {
+	var sb strings.Builder
+	sb.WriteString(task.Title + "\n\n")
+	if task.Description != "" {
+		sb.WriteString(task.Description + "\n")
+	}
+	fmt.Fprintf(&sb, editHelp, task.ID)
+	return sb.String()
+}
+
+// ParseEditBuffer reads an edited buffer back into a title and description,
+// dropping the help block from the scissors line on. It returns false if
+// nothing but whitespace is left, meaning the edit was aborted.
+func ParseEditBuffer(text string) (title, description string, ok bool) {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == editScissors {
+			break
+		}
+		lines = append(lines, line)
+	}
+
+	body := strings.TrimSpace(strings.Join(lines, "\n"))
+	if body == "" {
+		return "", "", false
+	}
+	title, description, _ = strings.Cut(body, "\n")
+	return strings.TrimSpace(title), strings.TrimSpace(description), true
+}
+
+// runEditor opens path in $VISUAL, then $EDITOR, falling back to vi. The
+// variable may include arguments, e.g. "code --wait".
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	args := strings.Fields(editor)
+	editCmd := exec.Command(args[0], append(args[1:], path)...)
+	editCmd.Stdin = os.Stdin
+	editCmd.Stdout = os.Stdout
+	editCmd.Stderr = os.Stderr
+	if err := editCmd.Run(); err != nil {
+		return fmt.Errorf("editor %s failed: %w", args[0], err)
+	}
+	return nil
+}
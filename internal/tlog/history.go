@@ -0,0 +1,199 @@
+package tlog
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CmdHistory returns every event recorded for a task, oldest first. Events
+// folded away by prune or compaction are gone, so a compacted task's history
+// starts with its snapshot create.
+func CmdHistory(root, id string) ([]Event, error) {
+	events, err := LoadAllEvents(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var history []Event
+	for _, event := range events {
+		if event.ID == id {
+			history = append(history, event)
+		}
+	}
+	if len(history) == 0 {
+		return nil, fmt.Errorf("no events for task %s", id)
+	}
+	return history, nil
+}
+
+// CmdLog returns events across all tasks, newest first: those at or after
+// since (if set) whose type is in types, a comma-separated list ("" for
+// all), truncated to limit events (0 for no limit)
+func CmdLog(root string, since time.Time, limit int, types string) ([]Event, error) {
+	wanted, err := parseEventTypeFilter(types)
+	if err != nil {
+		return nil, err
+	}
+	events, err := LoadAllEvents(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var log []Event
+	for i := len(events) - 1; i >= 0; i-- {
+		event := events[i]
+		if event.Timestamp.Before(since) {
+			// Events are sorted, so everything further back is older too
+			break
+		}
+		if wanted != nil && !wanted[event.Type] {
+			continue
+		}
+		log = append(log, event)
+		if limit > 0 && len(log) == limit {
+			break
+		}
+	}
+	return log, nil
+}
+
+// parseEventTypeFilter parses a comma-separated list of event types into a
+// set. It returns nil, matching every type, for "".
+func parseEventTypeFilter(s string) (map[EventType]bool, error) {
+	if s == "" {
+		return nil, nil
+	}
+	types := make(map[EventType]bool)
+	for _, name := range strings.Split(s, ",") {
+		eventType := EventType(strings.TrimSpace(name))
+		if !slices.Contains(AllEventTypes, eventType) {
+			return nil, fmt.Errorf("invalid event type '%s' (valid: %s)", eventType, strings.Join(eventTypeNames(), ", "))
+		}
+		types[eventType] = true
+	}
+	return types, nil
+}
+
+// DescribeEvent summarizes what an event changed in one line, e.g.
+// "status in_progress (by alice)" or "added dep 1a2b3c4d", followed by its
+// note if it has one
+func DescribeEvent(event Event) string {
+	var parts []string
+	switch event.Type {
+	case EventCreate:
+		parts = append(parts, fmt.Sprintf("created %q", event.Title))
+		if event.Status != "" && event.Status != StatusOpen {
+			parts = append(parts, "status "+statusWithResolution(event))
+		}
+		if event.Priority != nil {
+			parts = append(parts, "priority "+event.Priority.String())
+		}
+
+	case EventStatus:
+		s := "status " + statusWithResolution(event)
+		if event.Assignee != "" {
+			s += " (by " + event.Assignee + ")"
+		}
+		if event.Commit != "" {
+			s += " commit " + event.Commit
+		}
+		parts = append(parts, s)
+
+	case EventDep:
+		if event.Action == "remove" {
+			parts = append(parts, "removed dep "+event.Dep)
+		} else {
+			parts = append(parts, "added dep "+event.Dep)
+		}
+
+	case EventBlock:
+		if event.Action == "remove" {
+			parts = append(parts, "no longer blocks "+event.Block)
+		} else {
+			parts = append(parts, "blocks "+event.Block)
+		}
+
+	case EventAssign:
+		if event.Assignee == "" {
+			parts = append(parts, "unassigned")
+		} else {
+			parts = append(parts, "assigned to "+event.Assignee)
+		}
+
+	case EventUpdate:
+		if event.Title != "" {
+			parts = append(parts, fmt.Sprintf("title %q", event.Title))
+		}
+		if event.Description != "" {
+			parts = append(parts, "description changed")
+		}
+		if event.Labels != nil {
+			parts = append(parts, "labels ["+strings.Join(event.Labels, ", ")+"]")
+		} else if event.Action == "set_labels" {
+			parts = append(parts, "labels cleared")
+		}
+		if event.Priority != nil {
+			parts = append(parts, "priority "+event.Priority.String())
+		}
+		if event.Estimate != nil {
+			parts = append(parts, fmt.Sprintf("estimate %dm", *event.Estimate))
+		}
+		if event.TimeSpent != 0 {
+			parts = append(parts, fmt.Sprintf("logged %dm", event.TimeSpent))
+		}
+		if len(parts) == 0 && event.Notes == "" {
+			parts = append(parts, "updated")
+		}
+
+	case EventAnnotate:
+		keys := make([]string, 0, len(event.Annotations))
+		for k := range event.Annotations {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if event.Action == "remove" {
+				parts = append(parts, "removed annotation "+k)
+			} else {
+				parts = append(parts, fmt.Sprintf("annotation %s=%s", k, event.Annotations[k]))
+			}
+		}
+
+	case EventDelete:
+		parts = append(parts, "deleted")
+
+	case EventUndelete:
+		parts = append(parts, "restored")
+
+	case EventArchive:
+		parts = append(parts, "archived")
+
+	case EventMove:
+		parts = append(parts, fmt.Sprintf("moved to position %g", event.Order))
+
+	default:
+		parts = append(parts, string(event.Type))
+	}
+
+	// A create's notes are the task's initial notes, not news
+	if event.Notes != "" && event.Type != EventCreate {
+		label := "note"
+		if event.Author != "" {
+			label += " by " + event.Author
+		}
+		parts = append(parts, label+": "+strings.ReplaceAll(event.Notes, "\n", " "))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// statusWithResolution formats an event's status, with the resolution for
+// tasks closed other than as completed
+func statusWithResolution(event Event) string {
+	if event.Resolution != "" && event.Resolution != ResolutionCompleted {
+		return fmt.Sprintf("%s (%s)", event.Status, event.Resolution)
+	}
+	return string(event.Status)
+}
@@ -0,0 +1,355 @@
+package tlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// taskIDPattern matches IDs as GenerateID makes them
+var taskIDPattern = regexp.MustCompile(`^[0-9a-f]{8}$`)
+
+// CmdImport appends create events for tasks parsed from an external format.
+// Each task is stamped with the current time and, unless preserveIDs is set,
+// gets a freshly generated ID; preserved IDs must look like generated ones
+// (8 lowercase hex characters). A task's ID, if set, is its key within the
+// import set: deps and blocks referencing another imported task's key are
+// rewritten to that task's new ID, and others must name an existing task.
+// Any dangling reference, or (without force) a label outside the configured
+// allowed_labels, rejects the whole batch. Deleted and archived tasks, as
+// written by "export --include-deleted", come back deleted or archived.
+func CmdImport(root string, tasks []*Task, preserveIDs, force bool) (map[string]interface{}, error) {
+	if len(tasks) == 0 {
+		return nil, fmt.Errorf("no tasks to import")
+	}
+
+	existing, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := LoadConfig(root)
+	if err != nil {
+		return nil, err
+	}
+
+	// Assign IDs first so deps can be remapped
+	taken := make(map[string]bool)
+	newIDs := make([]string, len(tasks))
+	keyToID := make(map[string]string)
+	for i, task := range tasks {
+		if strings.TrimSpace(task.Title) == "" {
+			return nil, fmt.Errorf("cannot import a task without a title")
+		}
+		if !force {
+			if err := cfg.CheckLabels(task.Labels); err != nil {
+				return nil, fmt.Errorf("task %q: %w", task.Title, err)
+			}
+		}
+		var id string
+		if preserveIDs {
+			id = task.ID
+			if id == "" {
+				return nil, fmt.Errorf("task %q has no ID to preserve", task.Title)
+			}
+			if !taskIDPattern.MatchString(id) {
+				return nil, fmt.Errorf("task %q: ID %s is not 8 lowercase hex characters", task.Title, id)
+			}
+			if existing[id] != nil || taken[id] {
+				return nil, fmt.Errorf("task ID %s already exists", id)
+			}
+		} else if id, err = uniqueID(existing, taken); err != nil {
+			return nil, err
+		}
+		taken[id] = true
+		newIDs[i] = id
+		if task.ID != "" {
+			keyToID[task.ID] = id
+		}
+	}
+
+	// Map a reference to an imported task's new ID, or keep a live existing one
+	resolveRef := func(ref string) (string, bool) {
+		if mapped, ok := keyToID[ref]; ok {
+			return mapped, true
+		}
+		if task, ok := existing[ref]; ok && !task.Deleted {
+			return ref, true
+		}
+		return "", false
+	}
+
+	now := NowISO()
+	var batch, followUps []Event
+	imported := make([]map[string]interface{}, 0, len(tasks))
+	for i, task := range tasks {
+		id := newIDs[i]
+
+		deps := make([]string, 0, len(task.Deps))
+		for _, ref := range task.Deps {
+			dep, ok := resolveRef(ref)
+			if !ok {
+				return nil, fmt.Errorf("task %q depends on %s, which is neither imported nor existing", task.Title, ref)
+			}
+			deps = append(deps, dep)
+		}
+		var blocks []string
+		for _, ref := range task.Blocks {
+			blocked, ok := resolveRef(ref)
+			if !ok {
+				return nil, fmt.Errorf("task %q blocks %s, which is neither imported nor existing", task.Title, ref)
+			}
+			blocks = append(blocks, blocked)
+		}
+
+		status := task.Status
+		if status == "" {
+			status = StatusOpen
+		}
+		priority := task.Priority
+		labels := task.Labels
+		if labels == nil {
+			labels = []string{}
+		}
+
+		batch = append(batch, Event{
+			ID:          id,
+			Timestamp:   now,
+			Type:        EventCreate,
+			Title:       task.Title,
+			Status:      status,
+			Resolution:  task.Resolution,
+			Priority:    &priority,
+			Deps:        deps,
+			Labels:      labels,
+			Description: task.Description,
+			Notes:       task.Notes,
+			Commit:      task.Commit,
+			Assignee:    task.Assignee,
+			TimeSpent:   task.TimeSpent,
+			Order:       task.Order,
+			Annotations: task.Annotations,
+			Blocks:      blocks,
+			NoteLog:     task.NoteLog,
+		})
+		if len(task.NoteLog) > 0 {
+			// Replay derives the plain notes from the log
+			batch[len(batch)-1].Notes = ""
+		}
+		if task.Estimate > 0 {
+			estimate := task.Estimate
+			batch[len(batch)-1].Estimate = &estimate
+		}
+		imported = append(imported, map[string]interface{}{
+			"id":     id,
+			"title":  task.Title,
+			"status": status,
+		})
+
+		// After every create, so the batch replays in order
+		if task.Archived {
+			followUps = append(followUps, Event{ID: id, Timestamp: now, Type: EventArchive})
+		}
+		if task.Deleted {
+			followUps = append(followUps, Event{ID: id, Timestamp: now, Type: EventDelete})
+		}
+	}
+
+	if err := AppendEvents(root, append(batch, followUps...)); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"tasks": imported,
+		"count": len(imported),
+	}, nil
+}
+
+// ParseTaskJSON parses a JSON array of tasks, as written by tlog export.
+// Tasks without a priority default to medium.
+func ParseTaskJSON(r io.Reader) ([]*Task, error) {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid task JSON: %w", err)
+	}
+
+	tasks := make([]*Task, 0, len(raw))
+	for i, data := range raw {
+		task := &Task{Priority: PriorityMedium}
+		if err := json.Unmarshal(data, task); err != nil {
+			return nil, fmt.Errorf("invalid task at index %d: %w", i, err)
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+var (
+	todoDatePattern     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	todoPriorityPattern = regexp.MustCompile(`^\(([A-Z])\)$`)
+)
+
+// ParseTodoTxt parses todo.txt lines into tasks:
+//   - "x " prefix marks the task done (resolution completed)
+//   - "(A)" is critical, "(B)" high, "(C)" medium, "(D)" low, later letters backlog
+//   - "+project" becomes label "project:<name>", "@context" becomes "context:<name>"
+//   - completion and creation dates are dropped from the title
+func ParseTodoTxt(r io.Reader) ([]*Task, error) {
+	var tasks []*Task
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		task := &Task{
+			Status:   StatusOpen,
+			Priority: PriorityMedium,
+			Labels:   []string{},
+		}
+
+		if fields[0] == "x" {
+			task.Status = StatusDone
+			task.Resolution = ResolutionCompleted
+			fields = fields[1:]
+		}
+		if len(fields) > 0 {
+			if m := todoPriorityPattern.FindStringSubmatch(fields[0]); m != nil {
+				task.Priority = todoPriority(m[1][0])
+				fields = fields[1:]
+			}
+		}
+		// Up to two leading dates: completion (done tasks) and creation
+		for i := 0; i < 2 && len(fields) > 0 && todoDatePattern.MatchString(fields[0]); i++ {
+			fields = fields[1:]
+		}
+
+		var words []string
+		for _, f := range fields {
+			switch {
+			case len(f) > 1 && f[0] == '+':
+				task.Labels = appendUnique(task.Labels, "project:"+f[1:])
+			case len(f) > 1 && f[0] == '@':
+				task.Labels = appendUnique(task.Labels, "context:"+f[1:])
+			default:
+				words = append(words, f)
+			}
+		}
+
+		task.Title = strings.Join(words, " ")
+		if task.Title == "" {
+			return nil, fmt.Errorf("todo.txt line %d: no task text", lineNum)
+		}
+		tasks = append(tasks, task)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// todoPriority maps a todo.txt priority letter to a tlog priority
+func todoPriority(letter byte) Priority {
+	switch letter {
+	case 'A':
+		return PriorityCritical
+	case 'B':
+		return PriorityHigh
+	case 'C':
+		return PriorityMedium
+	case 'D':
+		return PriorityLow
+	default:
+		return PriorityBacklog
+	}
+}
+
+// githubIssue is the subset of a GitHub API issue object that import uses
+type githubIssue struct {
+	Number      int             `json:"number"`
+	Title       string          `json:"title"`
+	Body        string          `json:"body"`
+	State       string          `json:"state"`
+	StateReason string          `json:"state_reason"`
+	Labels      []githubLabel   `json:"labels"`
+	PullRequest json.RawMessage `json:"pull_request"`
+}
+
+// isPullRequest reports whether the issue object is actually a pull request
+func (i githubIssue) isPullRequest() bool {
+	return len(i.PullRequest) > 0 && string(i.PullRequest) != "null"
+}
+
+type githubLabel struct {
+	Name string `json:"name"`
+}
+
+// githubTaskListRef matches task-list items that reference an issue, e.g. "- [ ] #12"
+var githubTaskListRef = regexp.MustCompile(`(?m)^\s*[-*]\s+\[[ xX]\]\s+#(\d+)\b`)
+
+// ParseGitHubIssues parses a JSON array of GitHub API issue objects into
+// tasks. Closed issues become done (not_planned maps to wontfix), and issues
+// referenced from a task list in the body become deps. Pull requests and
+// references to issues outside the dump are skipped.
+func ParseGitHubIssues(r io.Reader) ([]*Task, error) {
+	var issues []githubIssue
+	if err := json.NewDecoder(r).Decode(&issues); err != nil {
+		return nil, fmt.Errorf("invalid GitHub issues JSON: %w", err)
+	}
+
+	inDump := make(map[string]bool)
+	for _, issue := range issues {
+		if !issue.isPullRequest() {
+			inDump[strconv.Itoa(issue.Number)] = true
+		}
+	}
+
+	var tasks []*Task
+	for _, issue := range issues {
+		if issue.isPullRequest() {
+			continue
+		}
+		key := strconv.Itoa(issue.Number)
+
+		task := &Task{
+			ID:          key,
+			Title:       issue.Title,
+			Status:      StatusOpen,
+			Priority:    PriorityMedium,
+			Description: strings.TrimSpace(issue.Body),
+			Notes:       "imported from GitHub issue #" + key,
+			Labels:      []string{},
+			Deps:        []string{},
+		}
+		for _, label := range issue.Labels {
+			task.Labels = appendUnique(task.Labels, label.Name)
+		}
+		if issue.State == "closed" {
+			task.Status = StatusDone
+			switch issue.StateReason {
+			case "not_planned":
+				task.Resolution = ResolutionWontfix
+			case "duplicate":
+				task.Resolution = ResolutionDuplicate
+			default:
+				task.Resolution = ResolutionCompleted
+			}
+		}
+		for _, m := range githubTaskListRef.FindAllStringSubmatch(issue.Body, -1) {
+			if m[1] != key && inDump[m[1]] {
+				task.Deps = appendUnique(task.Deps, m[1])
+			}
+		}
+
+		tasks = append(tasks, task)
+	}
+
+	return tasks, nil
+}
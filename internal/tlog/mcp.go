@@ -0,0 +1,450 @@
+package tlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"slices"
+)
+
+// mcpProtocolVersions are the MCP revisions ServeMCP speaks, newest first.
+// tlog only uses tools, which are the same in all of them.
+var mcpProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// JSON-RPC 2.0 error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+// rpcRequest is a JSON-RPC request, or a notification if ID is absent
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcResponse carries either a result or an error
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is a JSON-RPC error object
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// mcpParam describes one argument of an MCP tool
+type mcpParam struct {
+	Name        string
+	Type        string // JSON schema type: "string", "integer", or "array" (of strings)
+	Description string
+	Required    bool
+	Enum        []string
+}
+
+// mcpTool maps an MCP tool onto a Cmd* function
+type mcpTool struct {
+	Name        string
+	Description string
+	Params      []mcpParam
+	Call        func(s *mcpServer, args mcpArgs) (interface{}, error)
+}
+
+// mcpServer holds the state shared by MCP requests
+type mcpServer struct {
+	root   string
+	cliRef string
+}
+
+// ServeMCP speaks the Model Context Protocol over r and w (stdin and stdout
+// for "tlog mcp"): newline-delimited JSON-RPC 2.0 messages exposing tlog
+// commands as tools. cliReference is passed to the prime tool. It returns
+// when r is exhausted.
+func ServeMCP(root, cliReference string, r io.Reader, w io.Writer) error {
+	s := &mcpServer{root: root, cliRef: cliReference}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		resp := s.handle(scanner.Bytes())
+		if resp == nil {
+			continue
+		}
+		data, err := json.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// handle processes one message, returning the response to send, or nil for
+// a notification
+func (s *mcpServer) handle(line []byte) *rpcResponse {
+	var req rpcRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		if !json.Valid(line) {
+			return rpcErrorResponse(nil, rpcParseError, "parse error")
+		}
+		return rpcErrorResponse(nil, rpcInvalidRequest, "invalid request")
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return rpcErrorResponse(req.ID, rpcInvalidRequest, "invalid request")
+	}
+	if len(req.ID) == 0 {
+		// Notifications (e.g. notifications/initialized) get no response
+		return nil
+	}
+
+	result, rpcErr := s.dispatch(req.Method, req.Params)
+	if rpcErr != nil {
+		return &rpcResponse{JSONRPC: "2.0", ID: req.ID, Error: rpcErr}
+	}
+	return &rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result}
+}
+
+// dispatch runs a request's method, returning its result or error
+func (s *mcpServer) dispatch(method string, params json.RawMessage) (interface{}, *rpcError) {
+	switch method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		_ = json.Unmarshal(params, &p)
+		version := mcpProtocolVersions[0]
+		if slices.Contains(mcpProtocolVersions, p.ProtocolVersion) {
+			version = p.ProtocolVersion
+		}
+		return map[string]interface{}{
+			"protocolVersion": version,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]interface{}{"name": "tlog", "version": buildVersion()},
+		}, nil
+
+	case "ping":
+		return map[string]interface{}{}, nil
+
+	case "tools/list":
+		tools := make([]map[string]interface{}, 0, len(mcpTools))
+		for _, tool := range mcpTools {
+			tools = append(tools, map[string]interface{}{
+				"name":        tool.Name,
+				"description": tool.Description,
+				"inputSchema": tool.inputSchema(),
+			})
+		}
+		return map[string]interface{}{"tools": tools}, nil
+
+	case "tools/call":
+		var p struct {
+			Name      string                 `json:"name"`
+			Arguments map[string]interface{} `json:"arguments"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "invalid params: " + err.Error()}
+		}
+		i := slices.IndexFunc(mcpTools, func(t mcpTool) bool { return t.Name == p.Name })
+		if i < 0 {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("unknown tool '%s'", p.Name)}
+		}
+		return s.callTool(mcpTools[i], p.Arguments), nil
+
+	default:
+		return nil, &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("method not found: %s", method)}
+	}
+}
+
+// callTool runs a tool, reporting its result as text content. Tool failures
+// are results with isError set, so the model sees them, not protocol errors.
+func (s *mcpServer) callTool(tool mcpTool, args map[string]interface{}) map[string]interface{} {
+	text, err := func() (string, error) {
+		if err := tool.checkArgs(args); err != nil {
+			return "", err
+		}
+		out, err := tool.Call(s, mcpArgs(args))
+		if err != nil {
+			return "", err
+		}
+		if str, ok := out.(string); ok {
+			return str, nil
+		}
+		data, err := json.MarshalIndent(out, "", "  ")
+		return string(data), err
+	}()
+
+	result := map[string]interface{}{}
+	if err != nil {
+		text = err.Error()
+		result["isError"] = true
+	}
+	result["content"] = []map[string]interface{}{{"type": "text", "text": text}}
+	return result
+}
+
+// inputSchema derives the tool's JSON schema from its params
+func (t mcpTool) inputSchema() map[string]interface{} {
+	properties := make(map[string]interface{}, len(t.Params))
+	required := make([]string, 0)
+	for _, p := range t.Params {
+		prop := map[string]interface{}{"type": p.Type, "description": p.Description}
+		if p.Type == "array" {
+			prop["items"] = map[string]interface{}{"type": "string"}
+		}
+		if p.Enum != nil {
+			prop["enum"] = p.Enum
+		}
+		properties[p.Name] = prop
+		if p.Required {
+			required = append(required, p.Name)
+		}
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+// checkArgs validates arguments against the tool's params
+func (t mcpTool) checkArgs(args map[string]interface{}) error {
+	for name, v := range args {
+		i := slices.IndexFunc(t.Params, func(p mcpParam) bool { return p.Name == name })
+		if i < 0 {
+			return fmt.Errorf("unknown argument '%s'", name)
+		}
+		p := t.Params[i]
+		ok := false
+		switch p.Type {
+		case "string":
+			var s string
+			s, ok = v.(string)
+			if ok && p.Enum != nil && !slices.Contains(p.Enum, s) {
+				return fmt.Errorf("invalid %s '%s' (valid: %v)", name, s, p.Enum)
+			}
+		case "integer":
+			n, isNum := v.(float64)
+			ok = isNum && n == float64(int(n))
+		case "array":
+			var items []interface{}
+			items, ok = v.([]interface{})
+			for _, item := range items {
+				if _, isStr := item.(string); !isStr {
+					ok = false
+				}
+			}
+		}
+		if !ok {
+			return fmt.Errorf("argument '%s' must be of type %s", name, p.Type)
+		}
+	}
+	for _, p := range t.Params {
+		if _, ok := args[p.Name]; p.Required && !ok {
+			return fmt.Errorf("missing required argument '%s'", p.Name)
+		}
+	}
+	return nil
+}
+
+// mcpArgs are a tool call's arguments, already checked against its params
+type mcpArgs map[string]interface{}
+
+// String returns a string argument, or "" if it was omitted
+func (a mcpArgs) String(name string) string {
+	s, _ := a[name].(string)
+	return s
+}
+
+// Int returns an integer argument, or 0 if it was omitted
+func (a mcpArgs) Int(name string) int {
+	n, _ := a[name].(float64)
+	return int(n)
+}
+
+// Strings returns a string array argument, or nil if it was omitted
+func (a mcpArgs) Strings(name string) []string {
+	items, _ := a[name].([]interface{})
+	var strs []string
+	for _, item := range items {
+		strs = append(strs, item.(string))
+	}
+	return strs
+}
+
+// resolve resolves a task ID argument like the CLI: by prefix, then title
+func (s *mcpServer) resolve(token string) (string, error) {
+	tasks, err := LoadState(s.root)
+	if err != nil {
+		return "", err
+	}
+	return ResolveIDOrTitle(tasks, token)
+}
+
+// mcpTools are the tools ServeMCP offers, in the order they are listed
+var mcpTools = []mcpTool{
+	{
+		Name:        "list",
+		Description: "List tasks, most urgent first. Defaults to open tasks.",
+		Params: []mcpParam{
+			{Name: "status", Type: "string", Description: "Comma-separated statuses to include (open, in_progress, done, all); default open"},
+			{Name: "label", Type: "array", Description: "Only tasks with all of these labels"},
+			{Name: "priority", Type: "string", Description: "Only tasks with this priority", Enum: []string{"critical", "high", "medium", "low", "backlog"}},
+			{Name: "assignee", Type: "string", Description: "Only tasks assigned to this owner"},
+			{Name: "limit", Type: "integer", Description: "Return at most this many tasks"},
+		},
+		Call: func(s *mcpServer, args mcpArgs) (interface{}, error) {
+			filter := ListFilter{
+				Status:   args.String("status"),
+				Labels:   args.Strings("label"),
+				Priority: args.String("priority"),
+				Assignee: args.String("assignee"),
+				Limit:    args.Int("limit"),
+			}
+			if filter.Status == "" {
+				filter.Status = "open"
+			}
+			result, err := CmdList(s.root, filter)
+			if err != nil {
+				return nil, err
+			}
+			views, err := TaskViews(s.root, result["tasks"].([]*Task))
+			if err != nil {
+				return nil, err
+			}
+			result["tasks"] = views
+			return result, nil
+		},
+	},
+	{
+		Name:        "list_ready",
+		Description: "List tasks that are ready to work on: open, not backlog, and with all deps done.",
+		Params: []mcpParam{
+			{Name: "label", Type: "array", Description: "Only tasks with all of these labels"},
+			{Name: "order", Type: "string", Description: "Sort order; leverage prefers tasks that unblock the most work", Enum: []string{"default", "leverage"}},
+		},
+		Call: func(s *mcpServer, args mcpArgs) (interface{}, error) {
+			return CmdReady(s.root, ListFilter{Labels: args.Strings("label")}, args.String("order"))
+		},
+	},
+	{
+		Name:        "show",
+		Description: "Show a task's details, with the status of its deps and the tasks that depend on it.",
+		Params: []mcpParam{
+			{Name: "id", Type: "string", Description: "Task ID, unique ID prefix, or unique title substring", Required: true},
+		},
+		Call: func(s *mcpServer, args mcpArgs) (interface{}, error) {
+			id, err := s.resolve(args.String("id"))
+			if err != nil {
+				return nil, err
+			}
+			return CmdShow(s.root, id, false)
+		},
+	},
+	{
+		Name:        "prime",
+		Description: "Summarize the board and how to use tlog, as context for starting work.",
+		Call: func(s *mcpServer, args mcpArgs) (interface{}, error) {
+			return CmdPrime(s.root, s.cliRef)
+		},
+	},
+	{
+		Name:        "claim",
+		Description: "Claim an open task, marking it in_progress. Fails if it isn't open.",
+		Params: []mcpParam{
+			{Name: "id", Type: "string", Description: "Task ID, unique ID prefix, or unique title substring", Required: true},
+			{Name: "notes", Type: "string", Description: "Note to add to the task"},
+			{Name: "by", Type: "string", Description: "Who is claiming it; recorded as the assignee"},
+		},
+		Call: func(s *mcpServer, args mcpArgs) (interface{}, error) {
+			id, err := s.resolve(args.String("id"))
+			if err != nil {
+				return nil, err
+			}
+			return CmdClaim(s.root, id, args.String("notes"), args.String("by"))
+		},
+	},
+	{
+		Name:        "create_task",
+		Description: "Create a task. Returns its ID.",
+		Params: []mcpParam{
+			{Name: "title", Type: "string", Description: "What needs doing", Required: true},
+			{Name: "description", Type: "string", Description: "What the task is"},
+			{Name: "notes", Type: "string", Description: "Note to add to the task"},
+			{Name: "priority", Type: "string", Description: "Default medium, or the configured default", Enum: []string{"critical", "high", "medium", "low", "backlog"}},
+			{Name: "labels", Type: "array", Description: "Labels to add"},
+			{Name: "deps", Type: "array", Description: "IDs of tasks this one depends on"},
+			{Name: "for", Type: "string", Description: "Parent task ID; the parent will depend on the new task, making it a subtask"},
+		},
+		Call: func(s *mcpServer, args mcpArgs) (interface{}, error) {
+			return CmdCreateFromSpec(s.root, TaskSpec{
+				Title:       args.String("title"),
+				Description: args.String("description"),
+				Notes:       args.String("notes"),
+				Priority:    args.String("priority"),
+				Labels:      args.Strings("labels"),
+				Deps:        args.Strings("deps"),
+				For:         args.String("for"),
+			}, false)
+		},
+	},
+	{
+		Name:        "mark_done",
+		Description: "Mark a task done. Follows the verify_done policy like tlog done: refused if it requires a clean tree and there are uncommitted changes.",
+		Params: []mcpParam{
+			{Name: "id", Type: "string", Description: "Task ID, unique ID prefix, or unique title substring", Required: true},
+			{Name: "resolution", Type: "string", Description: "How it was closed; default completed", Enum: []string{"completed", "wontfix", "duplicate"}},
+			{Name: "notes", Type: "string", Description: "Note to add to the task"},
+			{Name: "commit", Type: "string", Description: "Commit that finished the task"},
+		},
+		Call: func(s *mcpServer, args mcpArgs) (interface{}, error) {
+			id, err := s.resolve(args.String("id"))
+			if err != nil {
+				return nil, err
+			}
+			resolution := Resolution(args.String("resolution"))
+			_, warning, err := CheckVerifyDone(s.root, id, resolution, false)
+			if err != nil {
+				return nil, err
+			}
+			result, err := CmdDone(s.root, id, resolution, args.String("notes"), args.String("commit"))
+			if err != nil {
+				return nil, err
+			}
+			if warning != "" {
+				result["warning"] = warning
+			}
+			return result, nil
+		},
+	},
+}
+
+// rpcErrorResponse builds an error response; a request whose ID couldn't be
+// read is answered with a null ID
+func rpcErrorResponse(id json.RawMessage, code int, msg string) *rpcResponse {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return &rpcResponse{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: code, Message: msg}}
+}
+
+// buildVersion returns the module version tlog was built from, or "devel"
+func buildVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "devel"
+}
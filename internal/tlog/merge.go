@@ -0,0 +1,174 @@
+package tlog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path/filepath"
+)
+
+// CmdMerge copies the events of the tlog at other into root's log, for
+// combining boards that were worked on separately. Events already in root
+// (shared history from before the two diverged) are skipped. A task ID
+// created on both sides for different tasks is a collision: the other side's
+// task gets a fresh ID, and every reference to it in the merged events
+// (deps, blocks) is rewritten to match. Merged events keep their timestamps
+// and go to the dated file for their day, so they replay interleaved with
+// root's own history. With dryRun, nothing is written.
+func CmdMerge(root, other string, dryRun bool) (map[string]interface{}, error) {
+	if filepath.Clean(root) == filepath.Clean(other) {
+		return nil, fmt.Errorf("cannot merge a tlog into itself")
+	}
+	theirs, err := LoadAllEvents(other)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", other, err)
+	}
+
+	result := make(map[string]interface{})
+	err = withLock(root, func() error {
+		ours, err := LoadAllEvents(root)
+		if err != nil {
+			return err
+		}
+
+		known := make(map[string]bool, len(ours))
+		created := make(map[string]Event)
+		taken := make(map[string]bool)
+		for _, event := range ours {
+			known[eventKey(event)] = true
+			if event.Type == EventCreate {
+				created[event.ID] = event
+			}
+			taken[event.ID] = true
+		}
+
+		// New events only, and their creates for IDs we already have
+		var incoming []Event
+		candidates := make(map[string]Event)
+		for _, event := range theirs {
+			taken[event.ID] = true
+			if known[eventKey(event)] {
+				continue
+			}
+			incoming = append(incoming, event)
+			if _, ok := created[event.ID]; ok && event.Type == EventCreate {
+				candidates[event.ID] = event
+			}
+		}
+
+		// A candidate collides unless it creates the same task as ours. That
+		// depends on the remap of the IDs it references, which depends on
+		// which candidates collide, so repeat until the remap settles.
+		remap := make(map[string]string)
+		for range len(candidates) + 1 {
+			next := make(map[string]string)
+			for _, id := range sortedKeys(candidates) {
+				event := candidates[id]
+				if sameCreate(created[id], event, remap) {
+					continue
+				}
+				newID, ok := remap[id]
+				if !ok {
+					if newID, err = mergedID(event, created, taken, remap); err != nil {
+						return err
+					}
+					taken[newID] = true
+				}
+				next[id] = newID
+			}
+			if maps.Equal(next, remap) {
+				break
+			}
+			remap = next
+		}
+
+		// Drop remapped events an earlier merge already brought over
+		merged := incoming[:0]
+		for _, event := range incoming {
+			if event = remapEvent(event, remap); !known[eventKey(event)] {
+				merged = append(merged, event)
+			}
+		}
+		incoming = merged
+
+		result["merged"] = len(incoming)
+		result["skipped"] = len(theirs) - len(incoming)
+		result["remapped"] = remap
+		if dryRun || len(incoming) == 0 {
+			return nil
+		}
+		return appendDatedEventsLocked(root, incoming)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// eventKey identifies an event by its content, so the same event read from
+// two logs compares equal. Seq is left out: it's assigned per checkout, and
+// a merged event gets a new one.
+func eventKey(event Event) string {
+	event.Seq = 0
+	data, _ := json.Marshal(event)
+	return string(data)
+}
+
+// mergedID picks the new ID for a colliding task from the other log. It's
+// derived from the task's create event, so merging the same log again maps
+// the task to the ID it got the first time; only if that ID belongs to
+// another task is a random one generated.
+func mergedID(create Event, created map[string]Event, taken map[string]bool, remap map[string]string) (string, error) {
+	sum := sha256.Sum256([]byte(eventKey(create)))
+	id := hex.EncodeToString(sum[:])[:8]
+	if prior, ok := created[id]; ok && sameCreate(prior, create, remap) {
+		return id, nil
+	}
+	if !taken[id] {
+		return id, nil
+	}
+	return uniqueID(nil, taken)
+}
+
+// sameCreate reports whether our create event and theirs create the same
+// task (one merged earlier, say). They must match in everything but the
+// task's own ID and the IDs theirs references, which are first mapped
+// through remap.
+func sameCreate(ours, theirs Event, remap map[string]string) bool {
+	theirs = remapEvent(theirs, remap)
+	theirs.ID = ours.ID
+	return eventKey(ours) == eventKey(theirs)
+}
+
+// remapEvent returns event with every task ID in remap replaced by its new
+// ID: the event's own, and those it references
+func remapEvent(event Event, remap map[string]string) Event {
+	if len(remap) == 0 {
+		return event
+	}
+	mapID := func(id string) string {
+		if newID, ok := remap[id]; ok {
+			return newID
+		}
+		return id
+	}
+	mapIDs := func(ids []string) []string {
+		if ids == nil {
+			return nil
+		}
+		mapped := make([]string, len(ids))
+		for i, id := range ids {
+			mapped[i] = mapID(id)
+		}
+		return mapped
+	}
+
+	event.ID = mapID(event.ID)
+	event.Dep = mapID(event.Dep)
+	event.Block = mapID(event.Block)
+	event.Deps = mapIDs(event.Deps)
+	event.Blocks = mapIDs(event.Blocks)
+	return event
+}
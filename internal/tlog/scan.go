@@ -0,0 +1,161 @@
+package tlog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// closingTrailer is the commit message trailer that marks a task done
+const closingTrailer = "closes"
+
+// commitClose is one task reference found in a commit message
+type commitClose struct {
+	Commit string
+	Ref    string
+}
+
+// parseCommitLog extracts the task references from git log output in the
+// format scanCommitsFormat writes: per commit, the SHA, a NUL, the message,
+// and a record separator. A line "Closes: <id>" anywhere in a message counts
+// (the key is case-insensitive); several IDs may share one line, separated
+// by commas or spaces. References keep log order.
+func parseCommitLog(out string) []commitClose {
+	var closes []commitClose
+	for _, record := range strings.Split(out, "\x1e") {
+		sha, message, ok := strings.Cut(strings.TrimSpace(record), "\x00")
+		if !ok {
+			continue
+		}
+		for _, line := range strings.Split(message, "\n") {
+			key, value, ok := strings.Cut(line, ":")
+			if !ok || !strings.EqualFold(strings.TrimSpace(key), closingTrailer) {
+				continue
+			}
+			for _, ref := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+				closes = append(closes, commitClose{Commit: sha, Ref: ref})
+			}
+		}
+	}
+	return closes
+}
+
+// scanCommitsFormat is the git log format parseCommitLog reads
+const scanCommitsFormat = "--format=%H%x00%B%x1e"
+
+// CmdScanCommits marks tasks done from "Closes: <id>" trailers in the
+// project's commit messages, recording each closing commit's SHA on its done
+// event. It reads the commits since the last scan (all of history the first
+// time, or if the last scanned commit is no longer an ancestor of HEAD),
+// oldest first. Tasks that are already done are skipped, and references
+// that don't resolve to a task are skipped with a warning. With dryRun,
+// nothing is written and the scan position is left alone.
+func CmdScanCommits(root string, dryRun bool) (map[string]interface{}, error) {
+	project := filepath.Dir(root)
+	result := map[string]interface{}{
+		"closed":   []map[string]interface{}{},
+		"skipped":  []string{},
+		"warnings": []string{},
+		"commits":  0,
+	}
+
+	head, err := runGit(project, "rev-parse", "--verify", "--quiet", "HEAD")
+	if err != nil {
+		// No commits yet
+		return result, nil
+	}
+	result["head"] = head
+
+	scanPath := filepath.Join(root, ScanFile)
+	logArgs := []string{"log", "--reverse", scanCommitsFormat}
+	if data, err := os.ReadFile(scanPath); err == nil {
+		since := strings.TrimSpace(string(data))
+		if since == head {
+			return result, nil
+		}
+		if _, err := runGit(project, "merge-base", "--is-ancestor", since, head); err == nil {
+			logArgs = append(logArgs, since+".."+head)
+			result["since"] = since
+		} else {
+			logArgs = append(logArgs, head)
+		}
+	} else if os.IsNotExist(err) {
+		logArgs = append(logArgs, head)
+	} else {
+		return nil, err
+	}
+
+	out, err := runGit(project, logArgs...)
+	if err != nil {
+		return nil, err
+	}
+	result["commits"] = strings.Count(out, "\x1e")
+
+	err = withLock(root, func() error {
+		tasks, err := LoadState(root)
+		if err != nil {
+			return err
+		}
+
+		now := NowISO()
+		closed := make([]map[string]interface{}, 0)
+		skipped := make([]string, 0)
+		warnings := make([]string, 0)
+		seen := make(map[string]bool)
+		var batch []Event
+		for _, c := range parseCommitLog(out) {
+			id, err := ResolveID(tasks, c.Ref)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("commit %s: %v", shortSHA(c.Commit), err))
+				continue
+			}
+			if seen[id] || tasks[id].Status == StatusDone {
+				if !seen[id] {
+					skipped = append(skipped, id)
+				}
+				seen[id] = true
+				continue
+			}
+			seen[id] = true
+			batch = append(batch, Event{
+				ID:         id,
+				Timestamp:  now,
+				Type:       EventStatus,
+				Status:     StatusDone,
+				Resolution: ResolutionCompleted,
+				Commit:     c.Commit,
+			})
+			closed = append(closed, map[string]interface{}{
+				"id":     id,
+				"title":  tasks[id].Title,
+				"commit": c.Commit,
+			})
+		}
+		result["closed"] = closed
+		result["skipped"] = skipped
+		result["warnings"] = warnings
+
+		if dryRun {
+			return nil
+		}
+		if len(batch) > 0 {
+			if err := appendEventsLocked(root, batch); err != nil {
+				return err
+			}
+		}
+		return os.WriteFile(scanPath, []byte(head+"\n"), 0644)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// shortSHA abbreviates a commit SHA for messages
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
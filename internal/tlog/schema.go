@@ -0,0 +1,193 @@
+package tlog
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// schemaEnums lists the allowed values of the named types that serialize as
+// JSON strings
+var schemaEnums = map[reflect.Type][]string{
+	reflect.TypeOf(EventType("")):  eventTypeNames(),
+	reflect.TypeOf(TaskStatus("")): {string(StatusOpen), string(StatusInProgress), string(StatusDone)},
+	reflect.TypeOf(Resolution("")): {string(ResolutionCompleted), string(ResolutionWontfix), string(ResolutionDuplicate)},
+}
+
+// Schemas returns JSON Schemas for Task and Event as emitted by the --json
+// modes and stored in the event log. They are generated from the struct
+// tags, so they can't drift from the types.
+func Schemas() map[string]interface{} {
+	// list --json prints TaskViews; show and export print bare tasks, so
+	// the computed fields are optional
+	task := structSchema("Task", reflect.TypeOf(TaskView{}))
+	task["required"] = slices.DeleteFunc(task["required"].([]string), func(name string) bool {
+		return name == "ready"
+	})
+
+	// The log stores priorities as integers (see marshalEvent), while
+	// history and log --json print names
+	event := structSchema("Event", reflect.TypeOf(Event{}))
+	props := event["properties"].(map[string]interface{})
+	props["priority"] = map[string]interface{}{
+		"anyOf": []interface{}{
+			props["priority"],
+			map[string]interface{}{"type": "integer", "minimum": int(PriorityCritical), "maximum": int(PriorityBacklog)},
+		},
+	}
+
+	return map[string]interface{}{"task": task, "event": event}
+}
+
+// structSchema builds an object schema from a struct's json tags. Fields
+// without omitempty are required.
+func structSchema(title string, t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := make([]string, 0)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if embedded := embeddedStruct(field); embedded != nil {
+			// encoding/json promotes the fields of untagged embedded structs
+			inner := structSchema("", embedded)
+			for name, schema := range inner["properties"].(map[string]interface{}) {
+				properties[name] = schema
+			}
+			required = append(required, inner["required"].([]string)...)
+			continue
+		}
+		name, omitempty, ok := jsonFieldName(field)
+		if !ok {
+			continue
+		}
+		properties[name] = typeSchema(field.Type)
+		if !omitempty {
+			required = append(required, name)
+		}
+	}
+
+	return map[string]interface{}{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                title,
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// embeddedStruct returns the struct type of an untagged embedded field, or
+// nil if the field isn't one
+func embeddedStruct(field reflect.StructField) reflect.Type {
+	if !field.Anonymous || field.Tag.Get("json") != "" {
+		return nil
+	}
+	t := field.Type
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
+
+// jsonFieldName returns the JSON name of a struct field and whether it is
+// omitempty. ok is false for fields that are never serialized.
+func jsonFieldName(field reflect.StructField) (name string, omitempty bool, ok bool) {
+	tag := field.Tag.Get("json")
+	if !field.IsExported() || tag == "-" {
+		return "", false, false
+	}
+	name, opts, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+	return name, strings.Contains(opts, "omitempty"), true
+}
+
+// TaskField returns a single task field, named as in the JSON output, as
+// plain text: lists are comma-separated, annotations are key=value lines,
+// and times are RFC 3339.
+func TaskField(task *Task, name string) (string, error) {
+	v := reflect.ValueOf(task).Elem()
+	var valid []string
+	for i := 0; i < v.NumField(); i++ {
+		fieldName, _, ok := jsonFieldName(v.Type().Field(i))
+		if !ok {
+			continue
+		}
+		if fieldName == name {
+			return formatFieldValue(v.Field(i).Interface()), nil
+		}
+		valid = append(valid, fieldName)
+	}
+	return "", fmt.Errorf("unknown field '%s' (valid: %s)", name, strings.Join(valid, ", "))
+}
+
+// formatFieldValue renders a task field value for TaskField
+func formatFieldValue(value interface{}) string {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case []string:
+		return strings.Join(v, ",")
+	case []Note:
+		lines := make([]string, 0, len(v))
+		for _, note := range v {
+			lines = append(lines, formatNote(note))
+		}
+		return strings.Join(lines, "\n")
+	case map[string]string:
+		lines := make([]string, 0, len(v))
+		for _, k := range sortedKeys(v) {
+			lines = append(lines, k+"="+v[k])
+		}
+		return strings.Join(lines, "\n")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// typeSchema returns the schema for a single field type
+func typeSchema(t reflect.Type) map[string]interface{} {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == reflect.TypeOf(Priority(0)):
+		names := make([]string, 0, PriorityBacklog+1)
+		for p := PriorityCritical; p <= PriorityBacklog; p++ {
+			names = append(names, p.String())
+		}
+		return map[string]interface{}{"type": "string", "enum": names}
+	}
+	if values, ok := schemaEnums[t]; ok {
+		return map[string]interface{}{"type": "string", "enum": values}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		schema := structSchema(t.Name(), t)
+		delete(schema, "$schema")
+		return schema
+	default:
+		return map[string]interface{}{}
+	}
+}
@@ -0,0 +1,147 @@
+package tlog
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// maxRequestBody caps the size of a POSTed task spec
+const maxRequestBody = 1 << 20
+
+// NewServer returns an HTTP handler exposing the board in root as JSON:
+//
+//	GET  /tasks       list tasks, like "tlog list --json" (query: status,
+//	                  label, priority, assignee, limit, offset)
+//	GET  /tasks/{id}  show a task, like "tlog show --json"; id may be a prefix
+//	GET  /ready       ready tasks, like "tlog ready --json" (query: label, order)
+//	POST /tasks       create a task from a JSON TaskSpec (write only)
+//
+// Without write, the board is read-only and POST /tasks is rejected with
+// 405 Method Not Allowed. Errors are returned as {"error": "..."}.
+func NewServer(root string, write bool) http.Handler {
+	s := &server{root: root}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /tasks", s.listTasks)
+	mux.HandleFunc("GET /tasks/{id}", s.showTask)
+	mux.HandleFunc("GET /ready", s.readyTasks)
+	if write {
+		mux.HandleFunc("POST /tasks", s.createTask)
+	}
+	return mux
+}
+
+// server holds the state shared by the HTTP handlers
+type server struct {
+	root string
+}
+
+func (s *server) listTasks(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := ListFilter{
+		Status:   query.Get("status"),
+		Labels:   query["label"],
+		Priority: query.Get("priority"),
+		Assignee: query.Get("assignee"),
+	}
+	if filter.Status == "" {
+		filter.Status = "open"
+	}
+	var err error
+	if filter.Limit, err = queryInt(query.Get("limit")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid limit")
+		return
+	}
+	if filter.Offset, err = queryInt(query.Get("offset")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid offset")
+		return
+	}
+
+	result, err := CmdList(s.root, filter)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	views, err := TaskViews(s.root, result["tasks"].([]*Task))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	result["tasks"] = views
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *server) showTask(w http.ResponseWriter, r *http.Request) {
+	tasks, err := LoadState(s.root)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	id, err := ResolveID(tasks, r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	result, err := CmdShow(s.root, id, false)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *server) readyTasks(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	result, err := CmdReady(s.root, ListFilter{Labels: query["label"]}, query.Get("order"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *server) createTask(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	spec, err := ParseTaskSpec(data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := CmdCreateFromSpec(s.root, spec, false)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, result)
+}
+
+// queryInt parses an optional non-negative integer query parameter
+func queryInt(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err == nil && n < 0 {
+		err = strconv.ErrRange
+	}
+	return n, err
+}
+
+// writeJSON writes v as the JSON response body with the given status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,205 @@
+package tlog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+)
+
+// StateFile caches computed task state so commands don't replay every event
+const StateFile = "state.json"
+
+// stateCacheVersion invalidates snapshots written by older binaries. Bump it
+// when ComputeState's replay rules change; Task and Event field changes are
+// picked up automatically by stateCacheKey.
+const stateCacheVersion = 1
+
+// stateSnapshot is the on-disk form of the state cache
+type stateSnapshot struct {
+	Key       string                  `json:"key"`
+	Files     map[string]snapshotFile `json:"files"`
+	LastEvent time.Time               `json:"last_event"`
+	LastSeq   uint64                  `json:"last_seq,omitempty"`
+	Tasks     map[string]*Task        `json:"tasks"`
+}
+
+// snapshotFile records how much of an event file the snapshot has applied
+type snapshotFile struct {
+	Offset int64  `json:"offset"` // Bytes of complete lines applied
+	Hash   string `json:"hash"`   // sha256 of those bytes, to catch rewrites
+}
+
+// LoadState returns the current task state, like ComputeState over
+// LoadAllEvents, but starts from the snapshot in .tlog/state.json and only
+// replays events appended since. The snapshot is rebuilt from scratch when an
+// event file it covers was rewritten or removed, or when new events predate
+// ones it already applied (e.g. after a git merge).
+func LoadState(root string) (map[string]*Task, error) {
+	files, err := ListEventFiles(root)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := make(map[string][]byte, len(files))
+	for _, name := range files {
+		data, err := os.ReadFile(filepath.Join(root, EventsDir, name))
+		if err != nil {
+			return nil, err
+		}
+		contents[name] = data
+	}
+
+	snap := readStateSnapshot(root, contents)
+	tasks, last, changed, err := applySnapshot(snap, files, contents)
+	if err != nil {
+		return nil, err
+	}
+	if changed || snap == nil {
+		// Best effort: a missing cache only costs a full replay next time
+		_ = writeStateSnapshot(root, tasks, last, files, contents)
+	}
+	return tasks, nil
+}
+
+// applySnapshot replays the events the snapshot hasn't seen, returning the
+// state, the latest event applied (only its timestamp and seq are set), and
+// whether there was anything new. A nil snapshot, or one the new events can't
+// be applied on top of, means a full replay.
+func applySnapshot(snap *stateSnapshot, files []string, contents map[string][]byte) (map[string]*Task, Event, bool, error) {
+	tasks := make(map[string]*Task)
+	var since Event
+	offsets := make(map[string]int64)
+	if snap != nil {
+		tasks = snap.Tasks
+		since = Event{Timestamp: snap.LastEvent, Seq: snap.LastSeq}
+		for name, f := range snap.Files {
+			offsets[name] = f.Offset
+		}
+	}
+
+	var pending []Event
+	for _, name := range files {
+		data := contents[name]
+		tail := data[offsets[name]:completeLines(data)]
+		for _, line := range bytes.Split(tail, []byte("\n")) {
+			if len(line) == 0 {
+				continue
+			}
+			var event Event
+			if err := json.Unmarshal(line, &event); err != nil {
+				return nil, Event{}, false, err
+			}
+			pending = append(pending, event)
+		}
+	}
+	if len(pending) == 0 {
+		return tasks, since, false, nil
+	}
+
+	sortEvents(pending)
+	if snap != nil && !eventBefore(since, pending[0]) {
+		// Replaying out of order (or unsequenced ties across files) could
+		// differ from a full replay
+		return applySnapshot(nil, files, contents)
+	}
+
+	applyEvents(tasks, pending)
+	last := pending[len(pending)-1]
+	return tasks, Event{Timestamp: last.Timestamp, Seq: last.Seq}, true, nil
+}
+
+// readStateSnapshot loads the snapshot, returning nil if there is none or it
+// no longer matches the event files
+func readStateSnapshot(root string, contents map[string][]byte) *stateSnapshot {
+	data, err := os.ReadFile(filepath.Join(root, StateFile))
+	if err != nil {
+		return nil
+	}
+	var snap stateSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil || snap.Key != stateCacheKey() || snap.Tasks == nil {
+		return nil
+	}
+
+	for name, f := range snap.Files {
+		data, ok := contents[name]
+		if !ok || int64(len(data)) < f.Offset || hashBytes(data[:f.Offset]) != f.Hash {
+			return nil
+		}
+	}
+	return &snap
+}
+
+// writeStateSnapshot saves tasks as the new snapshot, covering every complete
+// line of the event files. It writes to a temp file and renames so readers
+// never see a partial snapshot.
+func writeStateSnapshot(root string, tasks map[string]*Task, last Event, files []string, contents map[string][]byte) error {
+	snap := stateSnapshot{
+		Key:       stateCacheKey(),
+		Files:     make(map[string]snapshotFile, len(files)),
+		LastEvent: last.Timestamp,
+		LastSeq:   last.Seq,
+		Tasks:     tasks,
+	}
+	for _, name := range files {
+		data := contents[name]
+		offset := completeLines(data)
+		snap.Files[name] = snapshotFile{Offset: offset, Hash: hashBytes(data[:offset])}
+	}
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(root, StateFile+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(root, StateFile)); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	// The cache is local; keep it out of tlog sync commits
+	_ = addToGitExclude(filepath.Dir(root), filepath.Join(TlogDir, StateFile))
+	return nil
+}
+
+// completeLines returns the length of data up to and including its last
+// newline, so a line still being written is left for next time
+func completeLines(data []byte) int64 {
+	return int64(bytes.LastIndexByte(data, '\n') + 1)
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// stateCacheKey identifies the snapshot format: the cache version plus the
+// shape of Task and Event, so adding a field invalidates old snapshots
+func stateCacheKey() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "v%d", stateCacheVersion)
+	for _, t := range []reflect.Type{reflect.TypeOf(Task{}), reflect.TypeOf(Event{})} {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			fmt.Fprintf(h, ";%s %s %s", f.Name, f.Type, f.Tag)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
@@ -1,11 +1,20 @@
 package tlog
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
 
 // ComputeState replays events to build current task state
 func ComputeState(events []Event) map[string]*Task {
 	tasks := make(map[string]*Task)
+	applyEvents(tasks, events)
+	return tasks
+}
 
+// applyEvents replays events on top of existing task state
+func applyEvents(tasks map[string]*Task, events []Event) {
 	for _, event := range events {
 		switch event.Type {
 		case EventCreate:
@@ -29,6 +38,21 @@ func ComputeState(events []Event) map[string]*Task {
 				Labels:      event.Labels,
 				Description: event.Description,
 				Notes:       event.Notes,
+				Commit:      event.Commit,
+				TimeSpent:   event.TimeSpent,
+				Assignee:    event.Assignee,
+				Order:       event.Order,
+			}
+			if event.Estimate != nil {
+				tasks[event.ID].Estimate = *event.Estimate
+			}
+			if event.NoteLog != nil {
+				// Snapshots store only the note log; the plain notes follow from it
+				tasks[event.ID].NoteLog = event.NoteLog
+				tasks[event.ID].Notes = joinNotes(event.NoteLog)
+			} else if event.Notes != "" {
+				// Plain create, or a snapshot written before note logs existed
+				tasks[event.ID].NoteLog = []Note{{Time: event.Timestamp, Author: event.Author, Text: event.Notes}}
 			}
 			if tasks[event.ID].Deps == nil {
 				tasks[event.ID].Deps = []string{}
@@ -36,17 +60,29 @@ func ComputeState(events []Event) map[string]*Task {
 			if tasks[event.ID].Labels == nil {
 				tasks[event.ID].Labels = []string{}
 			}
+			if len(event.Blocks) > 0 {
+				tasks[event.ID].Blocks = append([]string{}, event.Blocks...)
+			}
+			if len(event.Annotations) > 0 {
+				tasks[event.ID].Annotations = make(map[string]string, len(event.Annotations))
+				for k, v := range event.Annotations {
+					tasks[event.ID].Annotations[k] = v
+				}
+			}
 
 		case EventStatus:
 			if task, ok := tasks[event.ID]; ok {
 				task.Status = event.Status
 				task.Resolution = event.Resolution
 				if event.Notes != "" {
-					task.Notes = appendNote(task.Notes, event.Notes)
+					addNote(task, event)
 				}
 				if event.Commit != "" {
 					task.Commit = event.Commit
 				}
+				if event.Assignee != "" {
+					task.Assignee = event.Assignee
+				}
 				task.Updated = event.Timestamp
 			}
 
@@ -61,6 +97,26 @@ func ComputeState(events []Event) map[string]*Task {
 				task.Updated = event.Timestamp
 			}
 
+		case EventAssign:
+			if task, ok := tasks[event.ID]; ok {
+				task.Assignee = event.Assignee
+				task.Updated = event.Timestamp
+			}
+
+		case EventBlock:
+			if task, ok := tasks[event.ID]; ok {
+				switch event.Action {
+				case "add":
+					task.Blocks = appendUnique(task.Blocks, event.Block)
+				case "remove":
+					task.Blocks = removeItem(task.Blocks, event.Block)
+					if len(task.Blocks) == 0 {
+						task.Blocks = nil
+					}
+				}
+				task.Updated = event.Timestamp
+			}
+
 		case EventUpdate:
 			if task, ok := tasks[event.ID]; ok {
 				if event.Title != "" {
@@ -70,14 +126,39 @@ func ComputeState(events []Event) map[string]*Task {
 					task.Description = event.Description
 				}
 				if event.Notes != "" {
-					task.Notes = appendNote(task.Notes, event.Notes)
+					addNote(task, event)
 				}
 				if event.Labels != nil {
 					task.Labels = event.Labels
+				} else if event.Action == "set_labels" {
+					// Empty label sets are omitted from JSON, so clearing is explicit
+					task.Labels = []string{}
 				}
 				if event.Priority != nil {
 					task.Priority = *event.Priority
 				}
+				if event.Estimate != nil {
+					task.Estimate = *event.Estimate
+				}
+				task.TimeSpent += event.TimeSpent
+				task.Updated = event.Timestamp
+			}
+
+		case EventAnnotate:
+			if task, ok := tasks[event.ID]; ok {
+				for k, v := range event.Annotations {
+					if event.Action == "remove" {
+						delete(task.Annotations, k)
+						continue
+					}
+					if task.Annotations == nil {
+						task.Annotations = make(map[string]string)
+					}
+					task.Annotations[k] = v
+				}
+				if len(task.Annotations) == 0 {
+					task.Annotations = nil
+				}
 				task.Updated = event.Timestamp
 			}
 
@@ -85,22 +166,63 @@ func ComputeState(events []Event) map[string]*Task {
 			if task, ok := tasks[event.ID]; ok {
 				task.Deleted = true
 				if event.Notes != "" {
-					task.Notes = appendNote(task.Notes, event.Notes)
+					addNote(task, event)
+				}
+				task.Updated = event.Timestamp
+			}
+
+		case EventUndelete:
+			if task, ok := tasks[event.ID]; ok {
+				task.Deleted = false
+				task.Updated = event.Timestamp
+			}
+
+		case EventArchive:
+			if task, ok := tasks[event.ID]; ok {
+				task.Archived = true
+				if event.Notes != "" {
+					addNote(task, event)
 				}
 				task.Updated = event.Timestamp
 			}
+
+		case EventMove:
+			if task, ok := tasks[event.ID]; ok {
+				task.Order = event.Order
+				task.Updated = event.Timestamp
+			}
 		}
 	}
+}
 
-	return tasks
+// DepProgress counts a task's direct deps, as subtasks: how many are done
+// out of the total. Deps on deleted or pruned tasks don't count either way.
+// A task with no (live) deps has a total of 0.
+func DepProgress(tasks map[string]*Task, id string) (done, total int) {
+	task, ok := tasks[id]
+	if !ok {
+		return 0, 0
+	}
+	for _, depID := range task.Deps {
+		dep, ok := tasks[depID]
+		if !ok || dep.Deleted {
+			continue
+		}
+		total++
+		if dep.Status == StatusDone {
+			done++
+		}
+	}
+	return done, total
 }
 
-// GetReadyTasks returns tasks that are open, have all deps done, and are not backlog priority
+// GetReadyTasks returns tasks that are open, have all deps done, and are not
+// backlog priority or archived
 func GetReadyTasks(tasks map[string]*Task) []*Task {
 	var ready []*Task
 	for _, task := range tasks {
-		// Exclude deleted tasks
-		if task.Deleted {
+		// Exclude deleted and archived tasks
+		if task.Deleted || task.Archived {
 			continue
 		}
 
@@ -113,17 +235,7 @@ func GetReadyTasks(tasks map[string]*Task) []*Task {
 			continue
 		}
 
-		// Check if all dependencies are done
-		allDepsDone := true
-		for _, depID := range task.Deps {
-			if depTask, ok := tasks[depID]; ok {
-				if depTask.Status != StatusDone {
-					allDepsDone = false
-					break
-				}
-			}
-		}
-		if !allDepsDone {
+		if !depsDone(tasks, task) {
 			continue
 		}
 
@@ -133,10 +245,37 @@ func GetReadyTasks(tasks map[string]*Task) []*Task {
 	return ready
 }
 
+// GetBlockedTasks returns the open tasks that GetReadyTasks leaves out only
+// because a dep isn't done yet. Backlog, deleted, and archived tasks are in
+// neither.
+func GetBlockedTasks(tasks map[string]*Task) []*Task {
+	var blocked []*Task
+	for _, task := range tasks {
+		if task.Deleted || task.Archived || task.Status != StatusOpen || task.Priority == PriorityBacklog {
+			continue
+		}
+		if !depsDone(tasks, task) {
+			blocked = append(blocked, task)
+		}
+	}
+	return blocked
+}
+
+// depsDone reports whether every dep of task is done. Deps that don't
+// resolve to a task don't hold it back.
+func depsDone(tasks map[string]*Task, task *Task) bool {
+	for _, depID := range task.Deps {
+		if dep, ok := tasks[depID]; ok && dep.Status != StatusDone {
+			return false
+		}
+	}
+	return true
+}
+
 // BuildDependencyGraph builds a graph of task dependencies
 func BuildDependencyGraph(tasks map[string]*Task) Graph {
-	var nodes []GraphNode
-	var edges []GraphEdge
+	nodes := make([]GraphNode, 0, len(tasks))
+	edges := make([]GraphEdge, 0)
 
 	for _, task := range tasks {
 		nodes = append(nodes, GraphNode{
@@ -152,13 +291,74 @@ func BuildDependencyGraph(tasks map[string]*Task) Graph {
 				Type: "depends_on",
 			})
 		}
+		for _, blockedID := range task.Blocks {
+			edges = append(edges, GraphEdge{
+				From: task.ID,
+				To:   blockedID,
+				Type: "blocks",
+			})
+		}
 	}
 
+	// Map iteration order is random; sort for reproducible output
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].ID < nodes[j].ID
+	})
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].To != edges[j].To {
+			return edges[i].To < edges[j].To
+		}
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].Type < edges[j].Type
+	})
+
 	return Graph{Nodes: nodes, Edges: edges}
 }
 
+// TransitiveDependents returns the IDs of every task that directly or
+// indirectly depends on id, sorted by ID. Cycles are guarded by a visited set.
+func TransitiveDependents(tasks map[string]*Task, id string) []string {
+	// Reverse the dep edges: dependents[x] = tasks that depend on x
+	dependents := make(map[string][]string)
+	for _, task := range tasks {
+		if task.Deleted {
+			continue
+		}
+		for _, depID := range task.Deps {
+			dependents[depID] = append(dependents[depID], task.ID)
+		}
+	}
+
+	visited := map[string]bool{id: true}
+	queue := []string{id}
+	var result []string
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, next := range dependents[current] {
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			result = append(result, next)
+			queue = append(queue, next)
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
+
 // Helper functions
 
+// addNote appends an event's note to both the plain notes and the note log
+func addNote(task *Task, event Event) {
+	task.Notes = appendNote(task.Notes, event.Notes)
+	task.NoteLog = append(task.NoteLog, Note{Time: event.Timestamp, Author: event.Author, Text: event.Notes})
+}
+
 // appendNote appends a new note to existing notes, separated by newlines
 func appendNote(existing, newNote string) string {
 	if existing == "" {
@@ -167,6 +367,15 @@ func appendNote(existing, newNote string) string {
 	return existing + "\n" + newNote
 }
 
+// joinNotes returns the plain notes for a note log
+func joinNotes(log []Note) string {
+	var notes string
+	for _, note := range log {
+		notes = appendNote(notes, note.Text)
+	}
+	return notes
+}
+
 func appendUnique(slice []string, item string) []string {
 	for _, s := range slice {
 		if s == item {
@@ -176,6 +385,15 @@ func appendUnique(slice []string, item string) []string {
 	return append(slice, item)
 }
 
+func containsString(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
+
 func removeItem(slice []string, item string) []string {
 	result := make([]string, 0, len(slice))
 	for _, s := range slice {
@@ -200,6 +418,33 @@ func WouldCreateCycle(tasks map[string]*Task, taskID, depID string) bool {
 	return isReachable(tasks, depID, taskID, visited)
 }
 
+// WouldCreateBlockCycle checks if recording that blockerID blocks blockedID
+// would make a task (indirectly) block itself
+func WouldCreateBlockCycle(tasks map[string]*Task, blockerID, blockedID string) bool {
+	if blockerID == blockedID {
+		return true
+	}
+
+	// A cycle exists if blockedID already (indirectly) blocks blockerID
+	visited := make(map[string]bool)
+	queue := []string{blockedID}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current == blockerID {
+			return true
+		}
+		if visited[current] {
+			continue
+		}
+		visited[current] = true
+		if task, ok := tasks[current]; ok {
+			queue = append(queue, task.Blocks...)
+		}
+	}
+	return false
+}
+
 // isReachable checks if targetID is reachable from startID via dependencies
 func isReachable(tasks map[string]*Task, startID, targetID string, visited map[string]bool) bool {
 	if startID == targetID {
@@ -249,6 +494,43 @@ func ResolveID(tasks map[string]*Task, prefix string) (string, error) {
 	case 1:
 		return matches[0], nil
 	default:
+		// Map iteration order is random; sort so the error is reproducible
+		sort.Strings(matches)
 		return "", fmt.Errorf("ambiguous prefix '%s' matches %d tasks: %v", prefix, len(matches), matches)
 	}
 }
+
+// ResolveIDOrTitle resolves a token like ResolveID, but when no task ID
+// starts with it, falls back to a case-insensitive substring match on titles.
+// A title match must be unique; otherwise the error lists the candidates.
+func ResolveIDOrTitle(tasks map[string]*Task, token string) (string, error) {
+	for id, task := range tasks {
+		if !task.Deleted && strings.HasPrefix(id, token) {
+			return ResolveID(tasks, token)
+		}
+	}
+
+	needle := strings.ToLower(token)
+	var matches []*Task
+	for _, task := range tasks {
+		if !task.Deleted && strings.Contains(strings.ToLower(task.Title), needle) {
+			matches = append(matches, task)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no task found matching '%s'", token)
+	case 1:
+		return matches[0].ID, nil
+	default:
+		sort.Slice(matches, func(i, j int) bool {
+			return matches[i].ID < matches[j].ID
+		})
+		candidates := make([]string, len(matches))
+		for i, task := range matches {
+			candidates[i] = task.ID + " " + task.Title
+		}
+		return "", fmt.Errorf("ambiguous title '%s' matches %d tasks:\n  %s", token, len(matches), strings.Join(candidates, "\n  "))
+	}
+}
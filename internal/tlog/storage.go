@@ -2,6 +2,7 @@ package tlog
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
@@ -10,6 +11,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,10 +19,101 @@ import (
 )
 
 const (
-	TlogDir   = ".tlog"
-	EventsDir = "events"
+	TlogDir     = ".tlog"
+	EventsDir   = "events"
+	ArchiveFile = "archive.jsonl" // Snapshots of tasks prune --archive moved out of the active log
+	PruneLog    = "prune.log"     // One summary line per task removed by prune
+	MetaFile    = "meta.json"
+	SeqFile     = "seq"     // Last event sequence number assigned in this checkout
+	ScanFile    = "scanned" // Last commit scan-commits has read in this checkout
+	LockFile    = "tlog.lock"
+	TemplateDir = "templates" // Saved task templates, one JSON file each
+
+	CompactedFile = "compacted.jsonl" // Snapshot of the tasks prune has compacted
+	PruneJournal  = "prune.pending"   // Event files a prune has superseded but not yet deleted, and its log lines
 )
 
+// compactedTemp is where prune writes the next compacted file. Without the
+// .jsonl extension, it is never read as an event file.
+const compactedTemp = CompactedFile + ".tmp"
+
+// SchemaVersion is the on-disk format this binary reads and writes. Bump it
+// whenever event fields or their encoding change.
+//
+//	1: the original event format (repos from before meta.json existed)
+//	2: priorities encoded by name
+//	3: integer priorities again; seq, estimate, time_spent, assignee, author,
+//	   note_log, blocks, and order fields; block, assign, undelete, archive,
+//	   and move events
+const SchemaVersion = 3
+
+// Meta records repo-level format information in .tlog/meta.json
+type Meta struct {
+	SchemaVersion int `json:"schema_version"`
+}
+
+// ReadMeta reads .tlog/meta.json. A repo without one predates versioning
+// and reports schema version 0.
+func ReadMeta(root string) (Meta, error) {
+	var meta Meta
+	data, err := os.ReadFile(filepath.Join(root, MetaFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return meta, nil
+		}
+		return meta, err
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, fmt.Errorf("invalid %s: %w", MetaFile, err)
+	}
+	return meta, nil
+}
+
+// WriteMeta writes .tlog/meta.json
+func WriteMeta(root string, meta Meta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(root, MetaFile), append(data, '\n'), 0644)
+}
+
+// stampSchemaVersion records this binary's schema version in meta.json
+// before it writes events, unless the repo already claims a newer one. An
+// unversioned or older repo is raised to SchemaVersion, so older binaries
+// warn about what is about to be written. The caller must hold the event log
+// lock.
+func stampSchemaVersion(root string) error {
+	meta, err := ReadMeta(root)
+	if err != nil {
+		return err
+	}
+	if meta.SchemaVersion >= SchemaVersion {
+		return nil
+	}
+	meta.SchemaVersion = SchemaVersion
+	return WriteMeta(root, meta)
+}
+
+// CheckSchemaVersion returns an error describing how the repo's schema
+// version differs from this binary's. Unversioned repos are not flagged,
+// since every binary that predates meta.json wrote a format this one reads;
+// the first write stamps them (see stampSchemaVersion).
+func CheckSchemaVersion(root string) error {
+	meta, err := ReadMeta(root)
+	if err != nil {
+		return err
+	}
+	switch {
+	case meta.SchemaVersion == 0 || meta.SchemaVersion == SchemaVersion:
+		return nil
+	case meta.SchemaVersion > SchemaVersion:
+		return fmt.Errorf("repo uses schema version %d but this tlog supports %d; upgrade tlog", meta.SchemaVersion, SchemaVersion)
+	default:
+		return fmt.Errorf("repo uses schema version %d but this tlog writes %d, which older tlog binaries can't read", meta.SchemaVersion, SchemaVersion)
+	}
+}
+
 // GetTlogRoot searches up from cwd to find .tlog directory
 func GetTlogRoot() (string, error) {
 	dir, err := os.Getwd()
@@ -42,12 +135,16 @@ func GetTlogRoot() (string, error) {
 	}
 }
 
-// RequireTlog returns tlog root or exits with error
-func RequireTlog() (string, error) {
-	root, err := GetTlogRoot()
+// OpenTlog returns dir as the tlog root without searching, after checking
+// that it looks like one
+func OpenTlog(dir string) (string, error) {
+	root, err := filepath.Abs(dir)
 	if err != nil {
 		return "", err
 	}
+	if info, err := os.Stat(filepath.Join(root, EventsDir)); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("not a tlog directory (no %s/ subdirectory): %s", EventsDir, dir)
+	}
 	return root, nil
 }
 
@@ -74,58 +171,220 @@ func TodayStr() string {
 
 // AppendEvent appends an event to today's JSONL file
 func AppendEvent(root string, event Event) error {
+	return AppendEvents(root, []Event{event})
+}
+
+// AppendEvents appends events to today's JSONL file under a single lock,
+// so a batch is never interleaved with concurrent writers
+func AppendEvents(root string, events []Event) error {
+	return withLock(root, func() error {
+		return appendEventsLocked(root, events)
+	})
+}
+
+// appendEventsLocked appends events to today's JSONL file, numbering them
+// with the next sequence numbers. The caller must hold the event log lock.
+func appendEventsLocked(root string, events []Event) error {
 	eventsPath := filepath.Join(root, EventsDir)
 	if err := os.MkdirAll(eventsPath, 0755); err != nil {
 		return err
 	}
 
-	// Acquire lock to prevent concurrent write corruption
-	lockPath := filepath.Join(root, "tlog.lock")
-	fileLock := flock.New(lockPath)
-	if err := fileLock.Lock(); err != nil {
-		return fmt.Errorf("acquiring lock: %w", err)
+	if err := stampSchemaVersion(root); err != nil {
+		return err
+	}
+	seq, err := nextSeq(root)
+	if err != nil {
+		return err
+	}
+
+	var buf []byte
+	for i, event := range events {
+		event.Seq = seq + uint64(i)
+		data, err := marshalEvent(event)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, data...)
+		buf = append(buf, '\n')
 	}
-	defer func() { _ = fileLock.Unlock() }()
 
 	filename := filepath.Join(eventsPath, TodayStr()+".jsonl")
 	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return err
 	}
-	defer func() { _ = f.Close() }()
+	_, err = f.Write(buf)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return saveSeq(root, seq+uint64(len(events))-1)
+}
+
+// appendDatedEventsLocked appends events, in order, to the dated file for
+// each event's own day rather than today's, numbering them with the next
+// sequence numbers. The caller must hold the event log lock.
+func appendDatedEventsLocked(root string, events []Event) error {
+	eventsPath := filepath.Join(root, EventsDir)
+	if err := os.MkdirAll(eventsPath, 0755); err != nil {
+		return err
+	}
 
-	data, err := json.Marshal(event)
+	if err := stampSchemaVersion(root); err != nil {
+		return err
+	}
+	seq, err := nextSeq(root)
 	if err != nil {
 		return err
 	}
 
-	_, err = f.WriteString(string(data) + "\n")
-	return err
+	byDay := make(map[string][]Event)
+	for i, event := range events {
+		event.Seq = seq + uint64(i)
+		day := event.Timestamp.UTC().Format("2006-01-02")
+		byDay[day] = append(byDay[day], event)
+	}
+	for _, day := range sortedKeys(byDay) {
+		f, err := os.OpenFile(filepath.Join(eventsPath, day+".jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(encodeEvents(byDay[day])); err != nil {
+			_ = f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return saveSeq(root, seq+uint64(len(events))-1)
+}
+
+// nextSeq returns the next unassigned sequence number. The counter lives in
+// .tlog/seq, but it only knows this checkout's appends: a fresh clone has
+// none, and a git pull can bring in events numbered past it. So saveSeq also
+// records the size of every event file once its append is written; while
+// they still match, the counter is current and nothing else is read. Any
+// other change to the log (a pull, a prune, a crash mid-append) falls back to
+// starting after the highest seq in the log. The caller must hold the event
+// log lock.
+func nextSeq(root string) (uint64, error) {
+	data, err := os.ReadFile(filepath.Join(root, SeqFile))
+	if os.IsNotExist(err) {
+		// The counter is per checkout; keep it out of tlog sync commits
+		_ = addToGitExclude(filepath.Dir(root), filepath.Join(TlogDir, SeqFile))
+	}
+	if err == nil {
+		counter, files, _ := strings.Cut(strings.TrimSpace(string(data)), "\n")
+		last, parseErr := strconv.ParseUint(counter, 10, 64)
+		current, statErr := eventFilesStamp(root)
+		if parseErr == nil && statErr == nil && files == current {
+			return last + 1, nil
+		}
+	}
+
+	logged, err := maxLoggedSeq(root)
+	if err != nil {
+		return 0, err
+	}
+	return logged + 1, nil
+}
+
+// saveSeq records last as the highest seq assigned, stamped with the event
+// files it was written to. The caller must hold the event log lock.
+func saveSeq(root string, last uint64) error {
+	stamp, err := eventFilesStamp(root)
+	if err != nil {
+		return err
+	}
+	data := strconv.FormatUint(last, 10) + "\n" + stamp + "\n"
+	return os.WriteFile(filepath.Join(root, SeqFile), []byte(data), 0644)
+}
+
+// eventFilesStamp identifies the event files by name and size, which is
+// enough to tell whether anything but this checkout's appends touched them
+func eventFilesStamp(root string) (string, error) {
+	files, err := ListEventFiles(root)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for _, name := range files {
+		info, err := os.Stat(filepath.Join(root, EventsDir, name))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "%s %d\n", name, info.Size())
+	}
+	return hashBytes([]byte(sb.String())), nil
+}
+
+// maxLoggedSeq returns the highest seq in the event files. Only the seq field
+// of each line is decoded.
+func maxLoggedSeq(root string) (uint64, error) {
+	files, err := ListEventFiles(root)
+	if err != nil {
+		return 0, err
+	}
+	var last uint64
+	for _, name := range files {
+		data, err := os.ReadFile(filepath.Join(root, EventsDir, name))
+		if err != nil {
+			return 0, err
+		}
+		for _, line := range bytes.Split(data, []byte("\n")) {
+			if len(line) == 0 {
+				continue
+			}
+			var event struct {
+				Seq uint64 `json:"seq"`
+			}
+			if err := json.Unmarshal(line, &event); err != nil {
+				return 0, fmt.Errorf("reading %s: %w", name, err)
+			}
+			last = max(last, event.Seq)
+		}
+	}
+	return last, nil
+}
+
+// withLock runs fn while holding the event log lock, so a read-decide-write
+// sequence can't interleave with other writers. fn must write with
+// appendEventsLocked; AppendEvents would wait on the lock fn already holds.
+func withLock(root string, fn func() error) error {
+	fileLock, err := acquireLock(root)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = fileLock.Unlock() }()
+	return fn()
+}
+
+// acquireLock takes the exclusive lock that guards the event log.
+// The caller must Unlock it when done.
+func acquireLock(root string) (*flock.Flock, error) {
+	fileLock := flock.New(filepath.Join(root, LockFile))
+	if err := fileLock.Lock(); err != nil {
+		return nil, fmt.Errorf("acquiring lock: %w", err)
+	}
+	return fileLock, nil
 }
 
 // LoadAllEvents loads and sorts all events chronologically
 func LoadAllEvents(root string) ([]Event, error) {
 	eventsPath := filepath.Join(root, EventsDir)
 
-	entries, err := os.ReadDir(eventsPath)
+	// Sorted by name (date order)
+	files, err := ListEventFiles(root)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return []Event{}, nil
-		}
 		return nil, err
 	}
 
 	var events []Event
 
-	// Sort files by name (date order)
-	var files []string
-	for _, entry := range entries {
-		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".jsonl" {
-			files = append(files, entry.Name())
-		}
-	}
-	sort.Strings(files)
-
 	for _, filename := range files {
 		filePath := filepath.Join(eventsPath, filename)
 		f, err := os.Open(filePath)
@@ -149,12 +408,26 @@ func LoadAllEvents(root string) ([]Event, error) {
 		}
 	}
 
-	// Sort by timestamp
-	sort.Slice(events, func(i, j int) bool {
-		return events[i].Timestamp.Before(events[j].Timestamp)
+	sortEvents(events)
+	return events, nil
+}
+
+// sortEvents orders events for replay by timestamp, then sequence number.
+// The sort is stable, so events that still tie (such as those written before
+// sequence numbers existed) keep their file and line order and replay the
+// same way on every load.
+func sortEvents(events []Event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return eventBefore(events[i], events[j])
 	})
+}
 
-	return events, nil
+// eventBefore reports whether a replays before b
+func eventBefore(a, b Event) bool {
+	if !a.Timestamp.Equal(b.Timestamp) {
+		return a.Timestamp.Before(b.Timestamp)
+	}
+	return a.Seq < b.Seq
 }
 
 // Initialize creates a new tlog repository
@@ -169,8 +442,15 @@ func Initialize(path string) error {
 		return err
 	}
 
-	// Best effort: add tlog.lock to .git/info/exclude if this is a git repo
+	if err := WriteMeta(tlogPath, Meta{SchemaVersion: SchemaVersion}); err != nil {
+		return err
+	}
+
+	// Best effort: keep the lock and local caches out of git if this is a git repo
 	_ = addToGitExclude(path, ".tlog/tlog.lock")
+	_ = addToGitExclude(path, filepath.Join(TlogDir, StateFile))
+	_ = addToGitExclude(path, filepath.Join(TlogDir, SeqFile))
+	_ = addToGitExclude(path, filepath.Join(TlogDir, ScanFile))
 
 	return nil
 }
@@ -233,9 +513,10 @@ func ListEventFiles(root string) ([]string, error) {
 		return nil, err
 	}
 
+	superseded := supersededFiles(root)
 	var files []string
 	for _, entry := range entries {
-		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".jsonl" {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".jsonl" && !superseded[entry.Name()] {
 			files = append(files, entry.Name())
 		}
 	}
@@ -243,9 +524,178 @@ func ListEventFiles(root string) ([]string, error) {
 	return files, nil
 }
 
+// ReplaceEventFiles swaps sources for a compacted file holding events, so
+// that a crash at any point leaves either the old files or the new one in
+// effect, never both or neither. The new compacted file is written aside;
+// the journal listing the sources it supersedes is the commit point; then
+// the compacted file is renamed into place, the sources deleted, and
+// logLines appended to the prune log. With no events, the compacted file is
+// removed instead. A later prune finishes or rolls back an interrupted swap
+// (see recoverPrune); until then, ListEventFiles skips the superseded files.
+func ReplaceEventFiles(root string, events []Event, sources []string, logLines []string) error {
+	eventsPath := filepath.Join(root, EventsDir)
+	var obsolete []string
+	for _, f := range sources {
+		if f != CompactedFile {
+			obsolete = append(obsolete, f)
+		}
+	}
+
+	if err := stampSchemaVersion(root); err != nil {
+		return err
+	}
+	if len(events) > 0 {
+		if err := writeFileSynced(filepath.Join(eventsPath, compactedTemp), encodeEvents(events)); err != nil {
+			return err
+		}
+	} else {
+		obsolete = append(obsolete, CompactedFile)
+	}
+
+	journal, err := json.Marshal(pruneJournal{Obsolete: obsolete, Log: logLines})
+	if err != nil {
+		return err
+	}
+	journalPath := filepath.Join(root, PruneJournal)
+	if err := writeFileSynced(journalPath+".tmp", journal); err != nil {
+		return err
+	}
+	if err := os.Rename(journalPath+".tmp", journalPath); err != nil {
+		return err
+	}
+
+	return recoverPrune(root)
+}
+
+// pruneJournal is the commit record of a swap in ReplaceEventFiles
+type pruneJournal struct {
+	Obsolete []string `json:"obsolete"`      // Event files the compacted file supersedes
+	Log      []string `json:"log,omitempty"` // Lines to append to the prune log
+}
+
+// readPruneJournal parses the journal, which older versions wrote as a bare
+// list of obsolete files
+func readPruneJournal(data []byte) (pruneJournal, error) {
+	var journal pruneJournal
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		err := json.Unmarshal(data, &journal.Obsolete)
+		return journal, err
+	}
+	err := json.Unmarshal(data, &journal)
+	return journal, err
+}
+
+// recoverPrune completes a committed swap from ReplaceEventFiles: it moves
+// the new compacted file into place, deletes the superseded files, appends
+// the journal's lines to the prune log, and removes the journal. Without a
+// journal, a leftover compacted file from a swap that never committed is
+// discarded.
+func recoverPrune(root string) error {
+	eventsPath := filepath.Join(root, EventsDir)
+	journalPath := filepath.Join(root, PruneJournal)
+	data, err := os.ReadFile(journalPath)
+	if os.IsNotExist(err) {
+		if err := os.Remove(filepath.Join(eventsPath, compactedTemp)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	journal, err := readPruneJournal(data)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", PruneJournal, err)
+	}
+
+	if err := os.Rename(filepath.Join(eventsPath, compactedTemp), filepath.Join(eventsPath, CompactedFile)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, f := range journal.Obsolete {
+		if err := DeleteEventFile(root, f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := appendPruneLog(root, journal.Log); err != nil {
+		return fmt.Errorf("writing prune log: %w", err)
+	}
+	return os.Remove(journalPath)
+}
+
+// supersededFiles returns the event files a committed but unfinished prune
+// has replaced, which must not be read alongside the compacted file
+func supersededFiles(root string) map[string]bool {
+	data, err := os.ReadFile(filepath.Join(root, PruneJournal))
+	if err != nil {
+		return nil
+	}
+	journal, err := readPruneJournal(data)
+	if err != nil {
+		return nil
+	}
+	superseded := make(map[string]bool, len(journal.Obsolete))
+	for _, f := range journal.Obsolete {
+		superseded[f] = true
+	}
+	// Until the new compacted file is in place, the old one stays in effect
+	if _, err := os.Stat(filepath.Join(root, EventsDir, compactedTemp)); err == nil {
+		superseded[CompactedFile] = true
+	}
+	return superseded
+}
+
+// storedEvent is an event as written to the log. Priorities are stored as
+// integers, which every tlog binary can read; names are for output only.
+type storedEvent struct {
+	Event
+	Priority *int `json:"priority,omitempty"`
+}
+
+// marshalEvent encodes an event for the log
+func marshalEvent(event Event) ([]byte, error) {
+	stored := storedEvent{Event: event}
+	if event.Priority != nil {
+		n := int(*event.Priority)
+		stored.Priority = &n
+	}
+	return json.Marshal(stored)
+}
+
+// encodeEvents renders events as JSONL
+func encodeEvents(events []Event) []byte {
+	var buf []byte
+	for _, event := range events {
+		data, _ := marshalEvent(event)
+		buf = append(buf, data...)
+		buf = append(buf, '\n')
+	}
+	return buf
+}
+
+// writeFileSynced writes data to path and flushes it to disk
+func writeFileSynced(path string, data []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 // LoadEventsFromFile loads events from a specific file
 func LoadEventsFromFile(root, filename string) ([]Event, error) {
-	filePath := filepath.Join(root, EventsDir, filename)
+	return readEvents(filepath.Join(root, EventsDir, filename))
+}
+
+// readEvents reads a JSONL file of events
+func readEvents(filePath string) ([]Event, error) {
 	f, err := os.Open(filePath)
 	if err != nil {
 		return nil, err
@@ -284,7 +734,7 @@ func WriteEventsToFile(root, filename string, events []Event) error {
 	defer func() { _ = f.Close() }()
 
 	for _, event := range events {
-		data, err := json.Marshal(event)
+		data, err := marshalEvent(event)
 		if err != nil {
 			return err
 		}
@@ -296,6 +746,113 @@ func WriteEventsToFile(root, filename string, events []Event) error {
 	return nil
 }
 
+// AppendArchive appends task snapshot events to the archive file. Archived
+// tasks are outside the events directory, so they no longer affect state;
+// only list --include-archived reads them back (see LoadArchive).
+func AppendArchive(root string, events []Event) error {
+	return withLock(root, func() error {
+		return appendArchiveLocked(root, events)
+	})
+}
+
+// appendArchiveLocked appends events to the archive file. The caller must
+// hold the event log lock.
+func appendArchiveLocked(root string, events []Event) error {
+	f, err := os.OpenFile(filepath.Join(root, ArchiveFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	for _, event := range events {
+		data, err := marshalEvent(event)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadArchive returns the tasks in the archive file, marked archived. A task
+// archived more than once is returned as its latest snapshot.
+func LoadArchive(root string) (map[string]*Task, error) {
+	events, err := readEvents(filepath.Join(root, ArchiveFile))
+	if os.IsNotExist(err) {
+		return map[string]*Task{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", ArchiveFile, err)
+	}
+
+	latest := make(map[string]Event)
+	for _, event := range events {
+		latest[event.ID] = event
+	}
+	snapshots := make([]Event, 0, len(latest))
+	for _, event := range latest {
+		snapshots = append(snapshots, event)
+	}
+	tasks := ComputeState(snapshots)
+	for _, task := range tasks {
+		task.Archived = true
+	}
+	return tasks, nil
+}
+
+// pruneLogLines summarizes each task in one prune log line: completion
+// date, ID, resolution, and quoted title
+func pruneLogLines(tasks []*Task) []string {
+	lines := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		resolution := task.Resolution
+		if resolution == "" {
+			resolution = ResolutionCompleted
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s %q", task.Updated.Format("2006-01-02"), task.ID, resolution, task.Title))
+	}
+	return lines
+}
+
+// appendPruneLog appends lines to the prune log, skipping any it already
+// holds: recovering an interrupted prune may repeat an append that finished.
+func appendPruneLog(root string, lines []string) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	logPath := filepath.Join(root, PruneLog)
+	existing := make(map[string]bool)
+	if data, err := os.ReadFile(logPath); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			existing[line] = true
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	var buf []byte
+	for _, line := range lines {
+		if !existing[line] {
+			buf = append(buf, line+"\n"...)
+		}
+	}
+	if len(buf) == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 // DeleteEventFile removes an event file
 func DeleteEventFile(root, filename string) error {
 	filePath := filepath.Join(root, EventsDir, filename)
@@ -0,0 +1,94 @@
+package tlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// templateNamePattern keeps template names usable as file names
+var templateNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// CmdTemplateSave stores a task's title, description, labels, and priority
+// as a reusable template in .tlog/templates/<name>.json, replacing any
+// template of that name. Deps, notes, and status are not part of a template.
+func CmdTemplateSave(root, id, name string) (map[string]interface{}, error) {
+	if !templateNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid template name '%s' (use letters, digits, '.', '_', '-')", name)
+	}
+
+	tasks, err := LoadState(root)
+	if err != nil {
+		return nil, err
+	}
+	task, ok := tasks[id]
+	if !ok || task.Deleted {
+		return nil, fmt.Errorf("task not found: %s", id)
+	}
+
+	template := TaskSpec{
+		Title:       task.Title,
+		Description: task.Description,
+		Priority:    task.Priority.String(),
+		Labels:      task.Labels,
+	}
+	data, err := json.MarshalIndent(template, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(root, TemplateDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".json"), append(data, '\n'), 0644); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"name":     name,
+		"template": template,
+	}, nil
+}
+
+// LoadTemplate reads a saved template as a task spec
+func LoadTemplate(root, name string) (TaskSpec, error) {
+	if !templateNamePattern.MatchString(name) {
+		return TaskSpec{}, fmt.Errorf("template not found: %s", name)
+	}
+	data, err := os.ReadFile(filepath.Join(root, TemplateDir, name+".json"))
+	if os.IsNotExist(err) {
+		return TaskSpec{}, fmt.Errorf("template not found: %s", name)
+	}
+	if err != nil {
+		return TaskSpec{}, err
+	}
+	spec, err := ParseTaskSpec(data)
+	if err != nil {
+		return TaskSpec{}, fmt.Errorf("template %s: %w", name, err)
+	}
+	return spec, nil
+}
+
+// ListTemplates returns the names of the saved templates, sorted
+func ListTemplates(root string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(root, TemplateDir))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if name, ok := strings.CutSuffix(entry.Name(), ".json"); ok && !entry.IsDir() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
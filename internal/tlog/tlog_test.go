@@ -1,8 +1,20 @@
 package tlog
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -309,3 +321,4985 @@ func TestWouldCreateCycle(t *testing.T) {
 		t.Error("a0000002 already depends on a0000001, adding again is not a new cycle")
 	}
 }
+
+// newTestRoot initializes a tlog repository in a temp dir and returns its .tlog path
+func newTestRoot(t *testing.T) string {
+	t.Helper()
+	tmpDir := t.TempDir()
+	if err := Initialize(tmpDir); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	return filepath.Join(tmpDir, TlogDir)
+}
+
+func TestCmdListStableOrdering(t *testing.T) {
+	root := newTestRoot(t)
+	now := time.Now().UTC()
+
+	// Same priority and created time: only the ID can break the tie
+	for _, id := range []string{"c0000003", "a0000001", "b0000002"} {
+		if err := AppendEvent(root, Event{ID: id, Timestamp: now, Type: EventCreate, Title: id, Status: StatusOpen}); err != nil {
+			t.Fatalf("AppendEvent failed: %v", err)
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		result, err := CmdList(root, ListFilter{Status: "open"})
+		if err != nil {
+			t.Fatalf("CmdList failed: %v", err)
+		}
+		tasks := result["tasks"].([]*Task)
+		if len(tasks) != 3 {
+			t.Fatalf("Expected 3 tasks, got %d", len(tasks))
+		}
+		if tasks[0].ID != "a0000001" || tasks[1].ID != "b0000002" || tasks[2].ID != "c0000003" {
+			t.Errorf("Expected ID order on ties, got %s %s %s", tasks[0].ID, tasks[1].ID, tasks[2].ID)
+		}
+	}
+}
+
+func TestTaskLessTiebreaks(t *testing.T) {
+	now := time.Now().UTC()
+	a := &Task{ID: "a0000001", Priority: PriorityMedium, Created: now}
+	b := &Task{ID: "b0000002", Priority: PriorityMedium, Created: now}
+	older := &Task{ID: "c0000003", Priority: PriorityMedium, Created: now.Add(-time.Hour)}
+	high := &Task{ID: "d0000004", Priority: PriorityHigh, Created: now}
+
+	if !taskLess(high, a, false) {
+		t.Error("Higher priority should sort first")
+	}
+	if !taskLess(older, a, false) || taskLess(older, a, true) {
+		t.Error("Created time should respect newestFirst")
+	}
+	if !taskLess(a, b, false) || !taskLess(a, b, true) {
+		t.Error("ID should break ties regardless of direction")
+	}
+}
+
+func TestCmdCreateFromSpec(t *testing.T) {
+	root := newTestRoot(t)
+
+	dep, err := CmdCreate(root, "Dependency", CreateOptions{})
+	if err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	depID := dep["id"].(string)
+
+	spec, err := ParseTaskSpec([]byte(`{"title":"From spec","priority":"high","labels":["bug"],"deps":["` + depID[:4] + `"]}`))
+	if err != nil {
+		t.Fatalf("ParseTaskSpec failed: %v", err)
+	}
+	result, err := CmdCreateFromSpec(root, spec, false)
+	if err != nil {
+		t.Fatalf("CmdCreateFromSpec failed: %v", err)
+	}
+
+	events, _ := LoadAllEvents(root)
+	task := ComputeState(events)[result["id"].(string)]
+	if task.Priority != PriorityHigh {
+		t.Errorf("Expected high priority, got %s", task.Priority)
+	}
+	if len(task.Deps) != 1 || task.Deps[0] != depID {
+		t.Errorf("Expected dep prefix to resolve to %s, got %v", depID, task.Deps)
+	}
+
+	if _, err := ParseTaskSpec([]byte(`{"title":"x","prio":"high"}`)); err == nil {
+		t.Error("Unknown fields should be rejected")
+	}
+	if _, err := CmdCreateFromSpec(root, TaskSpec{Title: "x", Priority: "hihg"}, false); err == nil {
+		t.Error("Invalid priority should be rejected")
+	}
+	if _, err := CmdCreateFromSpec(root, TaskSpec{}, false); err == nil {
+		t.Error("Missing title should be rejected")
+	}
+}
+
+func TestCmdCreateBatch(t *testing.T) {
+	root := newTestRoot(t)
+
+	specs, err := ParseTaskSpecs([]byte(`[
+		{"key":"goal","title":"Ship feature"},
+		{"key":"design","title":"Design","for":"goal"},
+		{"key":"build","title":"Build","deps":["design"],"for":"goal"}
+	]`))
+	if err != nil {
+		t.Fatalf("ParseTaskSpecs failed: %v", err)
+	}
+	result, err := CmdCreateBatch(root, specs, false)
+	if err != nil {
+		t.Fatalf("CmdCreateBatch failed: %v", err)
+	}
+	created := result["tasks"].([]map[string]interface{})
+	goalID, designID, buildID := created[0]["id"].(string), created[1]["id"].(string), created[2]["id"].(string)
+
+	events, _ := LoadAllEvents(root)
+	tasks := ComputeState(events)
+	if len(tasks[goalID].Deps) != 2 {
+		t.Errorf("Goal should depend on both subtasks, got %v", tasks[goalID].Deps)
+	}
+	if len(tasks[buildID].Deps) != 1 || tasks[buildID].Deps[0] != designID {
+		t.Errorf("Build should depend on design, got %v", tasks[buildID].Deps)
+	}
+
+	// A cycle inside the batch must be rejected before anything is written
+	cyclic := []TaskSpec{
+		{Key: "a", Title: "A", Deps: []string{"b"}},
+		{Key: "b", Title: "B", Deps: []string{"a"}},
+	}
+	if _, err := CmdCreateBatch(root, cyclic, false); err == nil {
+		t.Error("Cyclic batch should be rejected")
+	}
+	after, _ := LoadAllEvents(root)
+	if len(after) != len(events) {
+		t.Errorf("Rejected batch should write no events, got %d new", len(after)-len(events))
+	}
+}
+
+func TestCmdDoctorFix(t *testing.T) {
+	root := newTestRoot(t)
+	now := time.Now().UTC()
+
+	// a -> b -> a cycle, c depends on a missing task, d has an empty title
+	events := []Event{
+		{ID: "a0000001", Timestamp: now, Type: EventCreate, Title: "A", Status: StatusOpen, Deps: []string{"b0000002"}},
+		{ID: "b0000002", Timestamp: now, Type: EventCreate, Title: "B", Status: StatusOpen, Deps: []string{"a0000001"}},
+		{ID: "c0000003", Timestamp: now, Type: EventCreate, Title: "C", Status: StatusOpen, Deps: []string{"ffffffff"}},
+		{ID: "d0000004", Timestamp: now, Type: EventCreate, Title: "", Status: StatusOpen},
+	}
+	if err := AppendEvents(root, events); err != nil {
+		t.Fatalf("AppendEvents failed: %v", err)
+	}
+
+	result, err := CmdDoctor(root, false, false)
+	if err != nil {
+		t.Fatalf("CmdDoctor failed: %v", err)
+	}
+	if result["count"].(int) != 3 {
+		t.Errorf("Expected 3 issues, got %v", result["issues"])
+	}
+
+	// Dry run reports fixes but writes nothing
+	if _, err := CmdDoctor(root, true, true); err != nil {
+		t.Fatalf("CmdDoctor dry run failed: %v", err)
+	}
+	if after, _ := LoadAllEvents(root); len(after) != len(events) {
+		t.Errorf("Dry run should not write events")
+	}
+
+	if _, err := CmdDoctor(root, true, false); err != nil {
+		t.Fatalf("CmdDoctor fix failed: %v", err)
+	}
+	result, err = CmdDoctor(root, false, false)
+	if err != nil {
+		t.Fatalf("CmdDoctor failed: %v", err)
+	}
+	if result["count"].(int) != 0 {
+		t.Errorf("Expected no issues after fix, got %v", result["issues"])
+	}
+
+	// The tasks on the cycle are closed; the others stay open
+	tasks, _ := LoadState(root)
+	for _, id := range []string{"a0000001", "b0000002"} {
+		if task := tasks[id]; task.Status != StatusDone || task.Resolution != ResolutionWontfix {
+			t.Errorf("Expected %s closed as wontfix, got %s/%s", id, task.Status, task.Resolution)
+		}
+	}
+	if tasks["c0000003"].Status != StatusOpen {
+		t.Errorf("Expected c0000003 to stay open, got %s", tasks["c0000003"].Status)
+	}
+}
+
+func TestLabelDefaultPriority(t *testing.T) {
+	root := newTestRoot(t)
+	cfg := `{"label_priorities": {"bug": "high", "urgent": "critical", "chore": "low"}}`
+	if err := os.WriteFile(filepath.Join(root, ConfigFile), []byte(cfg), 0644); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+
+	priorityOf := func(labels []string, explicit *Priority) Priority {
+		t.Helper()
+		result, err := CmdCreate(root, "task", CreateOptions{Labels: labels, Priority: explicit})
+		if err != nil {
+			t.Fatalf("CmdCreate failed: %v", err)
+		}
+		events, _ := LoadAllEvents(root)
+		return ComputeState(events)[result["id"].(string)].Priority
+	}
+
+	if p := priorityOf([]string{"bug"}, nil); p != PriorityHigh {
+		t.Errorf("bug label should default to high, got %s", p)
+	}
+	if p := priorityOf([]string{"chore", "urgent"}, nil); p != PriorityCritical {
+		t.Errorf("Most urgent label default should win, got %s", p)
+	}
+	if p := priorityOf([]string{"other"}, nil); p != PriorityMedium {
+		t.Errorf("Unmapped label should stay medium, got %s", p)
+	}
+	low := PriorityLow
+	if p := priorityOf([]string{"bug"}, &low); p != PriorityLow {
+		t.Errorf("Explicit priority should win, got %s", p)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, ConfigFile), []byte(`{"label_priorities": {"bug": "urgentish"}}`), 0644); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+	if _, err := LoadConfig(root); err == nil {
+		t.Error("Unknown priority name in config should be rejected")
+	}
+}
+
+func TestCmdTouch(t *testing.T) {
+	root := newTestRoot(t)
+	created, err := CmdCreate(root, "Task", CreateOptions{Labels: []string{"x"}, Description: "desc"})
+	if err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	id := created["id"].(string)
+
+	events, _ := LoadAllEvents(root)
+	before := *ComputeState(events)[id]
+
+	if _, err := CmdTouch(root, id); err != nil {
+		t.Fatalf("CmdTouch failed: %v", err)
+	}
+
+	events, _ = LoadAllEvents(root)
+	after := ComputeState(events)[id]
+	if !after.Updated.After(before.Updated) {
+		t.Error("Touch should bump Updated")
+	}
+	if after.Title != before.Title || after.Description != before.Description || len(after.Labels) != 1 {
+		t.Error("Touch should not change any other field")
+	}
+}
+
+func TestCmdTouchAll(t *testing.T) {
+	root := newTestRoot(t)
+	var ids []string
+	for _, labels := range [][]string{{"ui"}, {"ui", "x"}, {"api"}} {
+		created, err := CmdCreate(root, "Task", CreateOptions{Labels: labels})
+		if err != nil {
+			t.Fatalf("CmdCreate failed: %v", err)
+		}
+		ids = append(ids, created["id"].(string))
+	}
+
+	dry, err := CmdTouchAll(root, ListFilter{Labels: []string{"ui"}}, true)
+	if err != nil {
+		t.Fatalf("CmdTouchAll failed: %v", err)
+	}
+	if dry["count"].(int) != 2 {
+		t.Errorf("Expected 2 matching tasks, got %v", dry["ids"])
+	}
+	events, _ := LoadAllEvents(root)
+	if len(events) != 3 {
+		t.Fatalf("Dry run should not write events, got %d", len(events))
+	}
+
+	if _, err := CmdTouchAll(root, ListFilter{Labels: []string{"ui"}}, false); err != nil {
+		t.Fatalf("CmdTouchAll failed: %v", err)
+	}
+	events, _ = LoadAllEvents(root)
+	tasks := ComputeState(events)
+	if !tasks[ids[0]].Updated.After(tasks[ids[0]].Created) || !tasks[ids[1]].Updated.After(tasks[ids[1]].Created) {
+		t.Error("Matching tasks should have Updated bumped")
+	}
+	if !tasks[ids[2]].Updated.Equal(tasks[ids[2]].Created) {
+		t.Error("Non-matching task should not be touched")
+	}
+}
+
+func TestTransitiveDependents(t *testing.T) {
+	now := time.Now().UTC()
+
+	// 001 <- 002 <- 003, and 001 <- 004; 005 is unrelated
+	events := []Event{
+		{ID: "a0000001", Timestamp: now, Type: EventCreate, Title: "Task 1"},
+		{ID: "a0000002", Timestamp: now, Type: EventCreate, Title: "Task 2", Deps: []string{"a0000001"}},
+		{ID: "a0000003", Timestamp: now, Type: EventCreate, Title: "Task 3", Deps: []string{"a0000002"}},
+		{ID: "a0000004", Timestamp: now, Type: EventCreate, Title: "Task 4", Deps: []string{"a0000001"}},
+		{ID: "a0000005", Timestamp: now, Type: EventCreate, Title: "Task 5"},
+	}
+	tasks := ComputeState(events)
+
+	got := TransitiveDependents(tasks, "a0000001")
+	want := []string{"a0000002", "a0000003", "a0000004"}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want, got)
+		}
+	}
+
+	// A stored cycle must not loop forever
+	tasks["a0000001"].Deps = []string{"a0000003"}
+	if got := TransitiveDependents(tasks, "a0000001"); len(got) != 3 {
+		t.Errorf("Expected 3 dependents with cycle, got %v", got)
+	}
+}
+
+func TestCmdListPresenceFilters(t *testing.T) {
+	root := newTestRoot(t)
+	mustCreate := func(title, description, notes string) {
+		t.Helper()
+		if _, err := CmdCreate(root, title, CreateOptions{Description: description, Notes: notes}); err != nil {
+			t.Fatalf("CmdCreate failed: %v", err)
+		}
+	}
+	mustCreate("bare", "", "")
+	mustCreate("described", "what", "")
+	mustCreate("noted", "", "happened")
+	mustCreate("both", "what", "happened")
+
+	cases := []struct {
+		filter ListFilter
+		want   int
+	}{
+		{ListFilter{HasNotes: true}, 2},
+		{ListFilter{NoNotes: true}, 2},
+		{ListFilter{NoDescription: true}, 2},
+		{ListFilter{HasNotes: true, NoDescription: true}, 1},
+		{ListFilter{HasDescription: true, HasNotes: true, Status: "open"}, 1},
+	}
+	for _, c := range cases {
+		result, err := CmdList(root, c.filter)
+		if err != nil {
+			t.Fatalf("CmdList failed: %v", err)
+		}
+		if got := result["total"].(int); got != c.want {
+			t.Errorf("Filter %+v: expected %d tasks, got %d", c.filter, c.want, got)
+		}
+	}
+}
+
+func TestCmdPrimeWIPLimit(t *testing.T) {
+	root := newTestRoot(t)
+	created, err := CmdCreate(root, "Task", CreateOptions{})
+	if err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	if _, err := CmdClaim(root, created["id"].(string), "", ""); err != nil {
+		t.Fatalf("CmdClaim failed: %v", err)
+	}
+
+	out, err := CmdPrime(root, "")
+	if err != nil {
+		t.Fatalf("CmdPrime failed: %v", err)
+	}
+	if strings.Contains(out, "WIP LIMIT") {
+		t.Error("No WIP warning expected without a configured limit")
+	}
+
+	if err := os.WriteFile(filepath.Join(root, ConfigFile), []byte(`{"wip_limit": 1}`), 0644); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+	out, err = CmdPrime(root, "")
+	if err != nil {
+		t.Fatalf("CmdPrime failed: %v", err)
+	}
+	if !strings.HasPrefix(out, "WIP LIMIT REACHED") {
+		t.Errorf("Expected prime to lead with WIP warning, got:\n%s", out)
+	}
+}
+
+func TestFindOrphans(t *testing.T) {
+	now := time.Now().UTC()
+	events := []Event{
+		{ID: "a0000001", Timestamp: now, Type: EventCreate, Title: "Subtask", Status: StatusOpen},
+		{ID: "a0000002", Timestamp: now, Type: EventCreate, Title: "Parent", Status: StatusOpen, Deps: []string{"a0000001"}},
+		{ID: "a0000003", Timestamp: now, Type: EventCreate, Title: "Loner", Status: StatusOpen},
+		{ID: "a0000004", Timestamp: now, Type: EventCreate, Title: "Finished", Status: StatusDone},
+	}
+
+	orphans := FindOrphans(ComputeState(events))
+	if len(orphans) != 1 || orphans[0].ID != "a0000003" {
+		t.Errorf("Expected only a0000003 to be an orphan, got %v", orphans)
+	}
+}
+
+func TestParseTodoTxt(t *testing.T) {
+	input := `(A) 2024-01-02 Call Mom +Family @phone
+x 2024-01-05 2024-01-01 Pay rent +Home
+Water plants due:2024-02-01
+
+(D) Read book`
+
+	tasks, err := ParseTodoTxt(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseTodoTxt failed: %v", err)
+	}
+	if len(tasks) != 4 {
+		t.Fatalf("Expected 4 tasks, got %d", len(tasks))
+	}
+
+	if tasks[0].Title != "Call Mom" || tasks[0].Priority != PriorityCritical {
+		t.Errorf("Unexpected first task: %q %s", tasks[0].Title, tasks[0].Priority)
+	}
+	if len(tasks[0].Labels) != 2 || tasks[0].Labels[0] != "project:Family" || tasks[0].Labels[1] != "context:phone" {
+		t.Errorf("Expected project and context labels, got %v", tasks[0].Labels)
+	}
+	if tasks[1].Status != StatusDone || tasks[1].Resolution != ResolutionCompleted || tasks[1].Title != "Pay rent" {
+		t.Errorf("Expected completed 'Pay rent', got %q %s", tasks[1].Title, tasks[1].Status)
+	}
+	if tasks[2].Title != "Water plants due:2024-02-01" || tasks[2].Priority != PriorityMedium {
+		t.Errorf("Unexpected third task: %q %s", tasks[2].Title, tasks[2].Priority)
+	}
+	if tasks[3].Priority != PriorityLow {
+		t.Errorf("(D) should map to low, got %s", tasks[3].Priority)
+	}
+
+	root := newTestRoot(t)
+	if _, err := CmdImport(root, tasks, false, false); err != nil {
+		t.Fatalf("CmdImport failed: %v", err)
+	}
+	result, _ := CmdList(root, ListFilter{Status: "all"})
+	if result["total"].(int) != 4 {
+		t.Errorf("Expected 4 imported tasks, got %d", result["total"])
+	}
+}
+
+func TestParseGitHubIssues(t *testing.T) {
+	input := `[
+		{"number": 1, "title": "Epic", "body": "Tracking:\n- [ ] #2\n- [x] #3\n- [ ] #99", "state": "open", "labels": [{"name": "epic"}]},
+		{"number": 2, "title": "Part one", "body": "", "state": "open", "labels": []},
+		{"number": 3, "title": "Part two", "body": "done", "state": "closed", "state_reason": "completed", "labels": [{"name": "bug"}]},
+		{"number": 4, "title": "Dropped", "body": "", "state": "closed", "state_reason": "not_planned", "labels": []},
+		{"number": 5, "title": "A PR", "body": "", "state": "open", "labels": [], "pull_request": {"url": "x"}}
+	]`
+
+	tasks, err := ParseGitHubIssues(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseGitHubIssues failed: %v", err)
+	}
+	if len(tasks) != 4 {
+		t.Fatalf("Expected 4 tasks (PR skipped), got %d", len(tasks))
+	}
+	if len(tasks[0].Deps) != 2 {
+		t.Errorf("Epic should depend on #2 and #3 only, got %v", tasks[0].Deps)
+	}
+	if tasks[2].Status != StatusDone || tasks[2].Resolution != ResolutionCompleted {
+		t.Errorf("Closed issue should be done/completed, got %s/%s", tasks[2].Status, tasks[2].Resolution)
+	}
+	if tasks[3].Resolution != ResolutionWontfix {
+		t.Errorf("not_planned should map to wontfix, got %s", tasks[3].Resolution)
+	}
+
+	root := newTestRoot(t)
+	result, err := CmdImport(root, tasks, false, false)
+	if err != nil {
+		t.Fatalf("CmdImport failed: %v", err)
+	}
+	imported := result["tasks"].([]map[string]interface{})
+	events, _ := LoadAllEvents(root)
+	state := ComputeState(events)
+	epic := state[imported[0]["id"].(string)]
+	if len(epic.Deps) != 2 || epic.Deps[0] != imported[1]["id"] || epic.Deps[1] != imported[2]["id"] {
+		t.Errorf("Epic deps should be remapped to new IDs, got %v", epic.Deps)
+	}
+}
+
+func TestBuildTaskTree(t *testing.T) {
+	now := time.Now().UTC()
+	events := []Event{
+		{ID: "a0000001", Timestamp: now, Type: EventCreate, Title: "Goal", Deps: []string{"a0000002"}},
+		{ID: "a0000002", Timestamp: now, Type: EventCreate, Title: "Step", Deps: []string{"a0000003"}},
+		{ID: "a0000003", Timestamp: now, Type: EventCreate, Title: "Substep"},
+		{ID: "a0000004", Timestamp: now, Type: EventCreate, Title: "Standalone"},
+	}
+	tasks := ComputeState(events)
+	list := []*Task{tasks["a0000001"], tasks["a0000002"], tasks["a0000003"], tasks["a0000004"]}
+
+	tree := BuildTaskTree(list, 1)
+	if len(tree) != 2 || tree[0].ID != "a0000001" || tree[1].ID != "a0000004" {
+		t.Fatalf("Expected roots Goal and Standalone, got %v", tree)
+	}
+	if len(tree[0].Subtasks) != 1 || tree[0].Subtasks[0].ID != "a0000002" {
+		t.Errorf("Goal should nest Step, got %v", tree[0].Subtasks)
+	}
+	if len(tree[0].Subtasks[0].Subtasks) != 0 {
+		t.Error("Depth 1 should not nest below the first level")
+	}
+
+	tree = BuildTaskTree(list, 5)
+	if len(tree[0].Subtasks[0].Subtasks) != 1 {
+		t.Error("Deeper depth should nest Substep under Step")
+	}
+}
+
+func TestBuildTaskTreeKeepsCycles(t *testing.T) {
+	now := time.Now().UTC()
+	// b and c depend on each other, and c on d; nothing outside depends on them
+	events := []Event{
+		{ID: "a0000001", Timestamp: now, Type: EventCreate, Title: "Standalone"},
+		{ID: "b0000002", Timestamp: now, Type: EventCreate, Title: "B", Deps: []string{"c0000003"}},
+		{ID: "c0000003", Timestamp: now, Type: EventCreate, Title: "C", Deps: []string{"b0000002", "d0000004"}},
+		{ID: "d0000004", Timestamp: now, Type: EventCreate, Title: "D"},
+	}
+	tasks := ComputeState(events)
+	list := []*Task{tasks["a0000001"], tasks["b0000002"], tasks["c0000003"], tasks["d0000004"]}
+
+	// Even at depth 1, nothing on the cycle becomes a second root
+	for _, depth := range []int{1, 5} {
+		tree := BuildTaskTree(list, depth)
+		if len(tree) != 2 || tree[0].ID != "a0000001" || tree[0].Cycle {
+			t.Fatalf("Expected Standalone, then one cycle root, got %+v", tree)
+		}
+		if tree[1].ID != "b0000002" || !tree[1].Cycle {
+			t.Errorf("Expected b0000002 as a marked cycle root, got %+v", tree[1])
+		}
+		if len(tree[1].Subtasks) != 1 || tree[1].Subtasks[0].ID != "c0000003" {
+			t.Errorf("Expected c0000003 under the cycle root, got %+v", tree[1].Subtasks)
+		}
+	}
+}
+
+func TestCmdAnnotate(t *testing.T) {
+	root := newTestRoot(t)
+	created, err := CmdCreate(root, "Task", CreateOptions{})
+	if err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	id := created["id"].(string)
+	if _, err := CmdCreate(root, "Other", CreateOptions{}); err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+
+	mustAnnotate := func(key, value string, remove bool) {
+		t.Helper()
+		if _, err := CmdAnnotate(root, id, key, value, remove); err != nil {
+			t.Fatalf("CmdAnnotate failed: %v", err)
+		}
+	}
+	mustAnnotate("pr_url", "https://example.com/1", false)
+	mustAnnotate("estimate_source", "gut", false)
+	mustAnnotate("pr_url", "https://example.com/2", false) // last write wins
+	mustAnnotate("estimate_source", "", true)
+
+	events, _ := LoadAllEvents(root)
+	task := ComputeState(events)[id]
+	if len(task.Annotations) != 1 || task.Annotations["pr_url"] != "https://example.com/2" {
+		t.Errorf("Expected only latest pr_url annotation, got %v", task.Annotations)
+	}
+
+	for filter, want := range map[string]int{"pr_url": 1, "pr_url=https://example.com/2": 1, "pr_url=https://example.com/1": 0, "estimate_source": 0} {
+		result, err := CmdList(root, ListFilter{Annotation: filter})
+		if err != nil {
+			t.Fatalf("CmdList failed: %v", err)
+		}
+		if got := result["total"].(int); got != want {
+			t.Errorf("Annotation filter %q: expected %d, got %d", filter, want, got)
+		}
+	}
+
+	if _, err := CmdAnnotate(root, id, "missing", "", true); err == nil {
+		t.Error("Removing a missing annotation should fail")
+	}
+}
+
+func TestCmdReadyDetail(t *testing.T) {
+	root := newTestRoot(t)
+
+	dep, err := CmdCreate(root, "Dep", CreateOptions{})
+	if err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	depID := dep["id"].(string)
+	if _, err := CmdDone(root, depID, ResolutionCompleted, "", ""); err != nil {
+		t.Fatalf("CmdDone failed: %v", err)
+	}
+	high := PriorityHigh
+	if _, err := CmdCreate(root, "Urgent", CreateOptions{Deps: []string{depID}, Description: "Fix the thing", Priority: &high}); err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	if _, err := CmdCreate(root, "Later", CreateOptions{}); err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+
+	out, err := CmdReadyDetail(root, ListFilter{}, "", 1)
+	if err != nil {
+		t.Fatalf("CmdReadyDetail failed: %v", err)
+	}
+	for _, want := range []string{"Ready tasks (1 of 2)", "Urgent", "Description: Fix the thing", "Deps: " + depID + "(done)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Later") {
+		t.Errorf("Limit should drop lower-priority task, got:\n%s", out)
+	}
+}
+
+func TestCmdCycles(t *testing.T) {
+	root := newTestRoot(t)
+
+	ids := make([]string, 3)
+	for i, title := range []string{"A", "B", "C"} {
+		created, err := CmdCreate(root, title, CreateOptions{})
+		if err != nil {
+			t.Fatalf("CmdCreate failed: %v", err)
+		}
+		ids[i] = created["id"].(string)
+	}
+
+	result, err := CmdCycles(root)
+	if err != nil {
+		t.Fatalf("CmdCycles failed: %v", err)
+	}
+	if result["count"].(int) != 0 {
+		t.Errorf("Expected no cycles, got %v", result["cycles"])
+	}
+
+	// Hand-written edges bypass WouldCreateCycle, as a bad merge would
+	var edges []Event
+	for i := range ids {
+		edges = append(edges, Event{ID: ids[i], Timestamp: NowISO(), Type: EventDep, Dep: ids[(i+1)%3], Action: "add"})
+	}
+	if err := AppendEvents(root, edges); err != nil {
+		t.Fatalf("AppendEvents failed: %v", err)
+	}
+
+	result, err = CmdCycles(root)
+	if err != nil {
+		t.Fatalf("CmdCycles failed: %v", err)
+	}
+	cycles := result["cycles"].([][]map[string]interface{})
+	if len(cycles) != 1 || len(cycles[0]) != 3 {
+		t.Fatalf("Expected one 3-task cycle, got %v", cycles)
+	}
+
+	// Deleting a task breaks the live cycle
+	if _, err := CmdDelete(root, ids[1], ""); err != nil {
+		t.Fatalf("CmdDelete failed: %v", err)
+	}
+	result, _ = CmdCycles(root)
+	if result["count"].(int) != 0 {
+		t.Errorf("Deleted tasks should not form cycles, got %v", result["cycles"])
+	}
+}
+
+func TestPriorityJSONRoundTrip(t *testing.T) {
+	for _, p := range []Priority{PriorityCritical, PriorityHigh, PriorityMedium, PriorityLow, PriorityBacklog} {
+		data, err := json.Marshal(p)
+		if err != nil {
+			t.Fatalf("Marshal(%v) failed: %v", p, err)
+		}
+		if string(data) != `"`+p.String()+`"` {
+			t.Errorf("Expected %s to encode as its name, got %s", p, data)
+		}
+		var fromName, fromInt Priority
+		if err := json.Unmarshal(data, &fromName); err != nil || fromName != p {
+			t.Errorf("Name round-trip of %s: got %v, err %v", p, fromName, err)
+		}
+		legacy, _ := json.Marshal(int(p))
+		if err := json.Unmarshal(legacy, &fromInt); err != nil || fromInt != p {
+			t.Errorf("Legacy int decode of %s: got %v, err %v", legacy, fromInt, err)
+		}
+	}
+
+	// Out-of-range values stay numeric so doctor can still see them
+	data, _ := json.Marshal(Priority(9))
+	if string(data) != "9" {
+		t.Errorf("Expected out-of-range priority to encode as 9, got %s", data)
+	}
+
+	var p Priority
+	if err := json.Unmarshal([]byte(`"urgent"`), &p); err == nil {
+		t.Error("Unknown priority name should fail to decode")
+	}
+}
+
+func TestLoadMixedPriorityEncodings(t *testing.T) {
+	root := newTestRoot(t)
+
+	// An old log line with an integer priority next to a new one with a name
+	lines := `{"id":"aaaa1111","ts":"2026-01-01T00:00:00Z","type":"create","title":"Old","status":"open","priority":1}
+{"id":"bbbb2222","ts":"2026-01-02T00:00:00Z","type":"create","title":"New","status":"open","priority":"low"}
+{"id":"aaaa1111","ts":"2026-01-03T00:00:00Z","type":"update","priority":0}
+`
+	if err := os.WriteFile(filepath.Join(root, EventsDir, "2026-01-01.jsonl"), []byte(lines), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	events, err := LoadAllEvents(root)
+	if err != nil {
+		t.Fatalf("LoadAllEvents failed: %v", err)
+	}
+	tasks := ComputeState(events)
+	if tasks["aaaa1111"].Priority != PriorityCritical {
+		t.Errorf("Expected legacy task to be critical, got %s", tasks["aaaa1111"].Priority)
+	}
+	if tasks["bbbb2222"].Priority != PriorityLow {
+		t.Errorf("Expected new task to be low, got %s", tasks["bbbb2222"].Priority)
+	}
+
+	// Events written now use names and load back the same
+	high := PriorityHigh
+	if _, err := CmdUpdate(root, "bbbb2222", "", "", "", nil, &high, nil, false); err != nil {
+		t.Fatalf("CmdUpdate failed: %v", err)
+	}
+	events, err = LoadAllEvents(root)
+	if err != nil {
+		t.Fatalf("LoadAllEvents failed: %v", err)
+	}
+	if got := ComputeState(events)["bbbb2222"].Priority; got != PriorityHigh {
+		t.Errorf("Expected high after update, got %s", got)
+	}
+}
+
+func TestCreatePriorityFromDeps(t *testing.T) {
+	root := newTestRoot(t)
+
+	critical, high := PriorityCritical, PriorityHigh
+	parent, err := CmdCreate(root, "Parent", CreateOptions{Priority: &critical})
+	if err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	dep, err := CmdCreate(root, "Dep", CreateOptions{Priority: &high})
+	if err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	parentID, depID := parent["id"].(string), dep["id"].(string)
+
+	priorityOf := func(id string) Priority {
+		events, _ := LoadAllEvents(root)
+		return ComputeState(events)[id].Priority
+	}
+
+	inherited, err := CmdCreate(root, "Inherits", CreateOptions{Deps: []string{depID}, For: parentID, PriorityFromDeps: true})
+	if err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	if got := priorityOf(inherited["id"].(string)); got != PriorityCritical {
+		t.Errorf("Expected most urgent of dep and parent (critical), got %s", got)
+	}
+
+	low := PriorityLow
+	explicit, err := CmdCreate(root, "Explicit", CreateOptions{Deps: []string{depID}, Priority: &low, PriorityFromDeps: true})
+	if err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	if got := priorityOf(explicit["id"].(string)); got != PriorityLow {
+		t.Errorf("Explicit priority should win, got %s", got)
+	}
+
+	plain, err := CmdCreate(root, "Plain", CreateOptions{Deps: []string{depID}})
+	if err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	if got := priorityOf(plain["id"].(string)); got != PriorityMedium {
+		t.Errorf("Without the flag deps should not affect priority, got %s", got)
+	}
+}
+
+func TestCmdListPagination(t *testing.T) {
+	root := newTestRoot(t)
+
+	for _, title := range []string{"one", "two", "three", "four", "five"} {
+		if _, err := CmdCreate(root, title, CreateOptions{}); err != nil {
+			t.Fatalf("CmdCreate failed: %v", err)
+		}
+	}
+	all, _ := CmdList(root, ListFilter{})
+	allTasks := all["tasks"].([]*Task)
+
+	cases := []struct {
+		offset, limit       int
+		wantShown, wantFrom int
+		wantOffset          int
+	}{
+		{0, 0, 5, 0, 0},
+		{0, 2, 2, 0, 0},
+		{2, 2, 2, 2, 2},
+		{4, 2, 1, 4, 4},
+		{9, 2, 0, 0, 5},
+	}
+	for _, c := range cases {
+		result, err := CmdList(root, ListFilter{Offset: c.offset, Limit: c.limit})
+		if err != nil {
+			t.Fatalf("CmdList failed: %v", err)
+		}
+		if result["total"].(int) != 5 {
+			t.Errorf("offset %d limit %d: expected total 5, got %v", c.offset, c.limit, result["total"])
+		}
+		if result["shown"].(int) != c.wantShown || result["offset"].(int) != c.wantOffset {
+			t.Errorf("offset %d limit %d: expected shown %d offset %d, got %v %v",
+				c.offset, c.limit, c.wantShown, c.wantOffset, result["shown"], result["offset"])
+		}
+		tasks := result["tasks"].([]*Task)
+		if len(tasks) > 0 && tasks[0].ID != allTasks[c.wantFrom].ID {
+			t.Errorf("offset %d limit %d: page starts at the wrong task", c.offset, c.limit)
+		}
+	}
+}
+
+func TestCmdReadyExcludeLabel(t *testing.T) {
+	root := newTestRoot(t)
+	for _, labels := range [][]string{{"backend"}, {"backend", "needs-human-review"}, {"frontend"}, nil} {
+		if _, err := CmdCreate(root, "Task", CreateOptions{Labels: labels}); err != nil {
+			t.Fatalf("CmdCreate failed: %v", err)
+		}
+	}
+
+	cases := []struct {
+		filter ListFilter
+		want   int
+	}{
+		{ListFilter{}, 4},
+		{ListFilter{ExcludeLabels: []string{"needs-human-review"}}, 3},
+		{ListFilter{ExcludeLabels: []string{"needs-human-review", "frontend"}}, 2},
+		{ListFilter{Labels: []string{"backend"}, ExcludeLabels: []string{"needs-human-review"}}, 1},
+	}
+	for _, c := range cases {
+		result, err := CmdReady(root, c.filter, "")
+		if err != nil {
+			t.Fatalf("CmdReady failed: %v", err)
+		}
+		if got := result["count"].(int); got != c.want {
+			t.Errorf("Filter %+v: expected %d ready tasks, got %d", c.filter, c.want, got)
+		}
+	}
+}
+
+func TestUncommittedChanges(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	if out, err := exec.Command("git", "init", dir).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v: %s", err, out)
+	}
+	if err := Initialize(dir); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	root := filepath.Join(dir, TlogDir)
+	if _, err := CmdCreate(root, "Task", CreateOptions{}); err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+
+	changes, err := UncommittedChanges(root)
+	if err != nil {
+		t.Fatalf("UncommittedChanges failed: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("tlog's own files should be ignored, got %v", changes)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	changes, err = UncommittedChanges(root)
+	if err != nil {
+		t.Fatalf("UncommittedChanges failed: %v", err)
+	}
+	if len(changes) != 1 || !strings.Contains(changes[0], "main.go") {
+		t.Errorf("Expected main.go to be reported, got %v", changes)
+	}
+}
+
+func TestSchemas(t *testing.T) {
+	task := Schemas()["task"].(map[string]interface{})
+	props := task["properties"].(map[string]interface{})
+
+	// Every field Task serializes must be described
+	data, _ := json.Marshal(&Task{ID: "a", Resolution: ResolutionCompleted, Description: "d", Notes: "n", Commit: "c", Deleted: true, Annotations: map[string]string{"k": "v"}})
+	var emitted map[string]interface{}
+	if err := json.Unmarshal(data, &emitted); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	for key := range emitted {
+		if _, ok := props[key]; !ok {
+			t.Errorf("Schema is missing task field %q", key)
+		}
+	}
+
+	priority := props["priority"].(map[string]interface{})
+	if enum := priority["enum"].([]string); len(enum) != 5 || enum[0] != "critical" {
+		t.Errorf("Expected priority enum of names, got %v", enum)
+	}
+	required := strings.Join(task["required"].([]string), ",")
+	if !strings.Contains(required, "title") || strings.Contains(required, "notes") {
+		t.Errorf("Required fields should follow omitempty, got %s", required)
+	}
+
+	event := Schemas()["event"].(map[string]interface{})
+	if _, ok := event["properties"].(map[string]interface{})["ts"]; !ok {
+		t.Error("Event schema should use json tag names")
+	}
+}
+
+func TestCmdPruneArchive(t *testing.T) {
+	root := newTestRoot(t)
+	old := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := []Event{
+		{ID: "a0000001", Timestamp: old, Type: EventCreate, Title: "Open", Status: StatusOpen},
+		{ID: "a0000002", Timestamp: old, Type: EventCreate, Title: "Finished", Status: StatusOpen},
+		{ID: "a0000002", Timestamp: old.Add(time.Hour), Type: EventStatus, Status: StatusDone, Resolution: ResolutionCompleted},
+	}
+	if err := WriteEventsToFile(root, "2026-01-01.jsonl", events); err != nil {
+		t.Fatalf("WriteEventsToFile failed: %v", err)
+	}
+
+	result, err := CmdPrune(root, PruneOptions{Archive: true})
+	if err != nil {
+		t.Fatalf("CmdPrune failed: %v", err)
+	}
+	if result["archived"].(int) != 1 || result["pruned"].(int) != 0 {
+		t.Errorf("Expected 1 archived and 0 pruned, got %v archived, %v pruned", result["archived"], result["pruned"])
+	}
+
+	loaded, _ := LoadAllEvents(root)
+	tasks := ComputeState(loaded)
+	if _, ok := tasks["a0000002"]; ok || tasks["a0000001"] == nil {
+		t.Errorf("Expected only the open task to remain active, got %v", tasks)
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, ArchiveFile))
+	if err != nil {
+		t.Fatalf("Reading archive failed: %v", err)
+	}
+	var archived Event
+	if err := json.Unmarshal(data, &archived); err != nil {
+		t.Fatalf("Archive is not an event line: %v", err)
+	}
+	if archived.ID != "a0000002" || archived.Status != StatusDone || archived.Resolution != ResolutionCompleted {
+		t.Errorf("Archive should hold a done snapshot of the task, got %+v", archived)
+	}
+	// Archived tasks are hidden from list unless asked for, wherever they are
+	if _, err := CmdArchive(root, "a0000001", ""); err != nil {
+		t.Fatalf("CmdArchive failed: %v", err)
+	}
+	for _, tc := range []struct {
+		filter ListFilter
+		want   []string
+	}{
+		{ListFilter{Status: "all"}, nil},
+		{ListFilter{Status: "all", IncludeArchived: true}, []string{"a0000001", "a0000002"}},
+	} {
+		list, err := CmdList(root, tc.filter)
+		if err != nil {
+			t.Fatalf("CmdList failed: %v", err)
+		}
+		var ids []string
+		for _, task := range list["tasks"].([]*Task) {
+			if !task.Archived {
+				t.Errorf("Expected %s marked archived", task.ID)
+			}
+			ids = append(ids, task.ID)
+		}
+		sort.Strings(ids)
+		if fmt.Sprint(ids) != fmt.Sprint(tc.want) {
+			t.Errorf("Expected %v listed with %+v, got %v", tc.want, tc.filter, ids)
+		}
+	}
+}
+
+func TestGroupTasks(t *testing.T) {
+	tasks := []*Task{
+		{ID: "a1", Status: StatusDone, Priority: PriorityHigh, Labels: []string{"ui", "api"}},
+		{ID: "a2", Status: StatusOpen, Priority: PriorityLow, Labels: []string{"api"}},
+		{ID: "a3", Status: StatusOpen, Priority: PriorityHigh},
+	}
+
+	summarize := func(groups []TaskGroup) string {
+		var parts []string
+		for _, g := range groups {
+			ids := make([]string, 0, len(g.Tasks))
+			for _, task := range g.Tasks {
+				ids = append(ids, task.ID)
+			}
+			parts = append(parts, g.Name+":"+strings.Join(ids, ","))
+		}
+		return strings.Join(parts, " ")
+	}
+
+	want := map[string]string{
+		"status":   "open:a2,a3 done:a1",
+		"priority": "high:a1,a3 low:a2",
+		"label":    "api:a1,a2 ui:a1 (no label):a3",
+	}
+	for by, expected := range want {
+		groups, err := GroupTasks(tasks, by)
+		if err != nil {
+			t.Fatalf("GroupTasks(%s) failed: %v", by, err)
+		}
+		if got := summarize(groups); got != expected {
+			t.Errorf("GroupTasks(%s): expected %q, got %q", by, expected, got)
+		}
+	}
+
+	if _, err := GroupTasks(tasks, "owner"); err == nil {
+		t.Error("Unknown group-by should fail")
+	}
+}
+
+func TestTaskField(t *testing.T) {
+	task := &Task{
+		ID:          "a1",
+		Title:       "Fix login",
+		Status:      StatusInProgress,
+		Priority:    PriorityHigh,
+		Labels:      []string{"auth", "bug"},
+		Annotations: map[string]string{"pr": "12", "branch": "fix"},
+	}
+
+	for name, want := range map[string]string{
+		"title":       "Fix login",
+		"status":      "in_progress",
+		"priority":    "high",
+		"description": "",
+		"labels":      "auth,bug",
+		"annotations": "branch=fix\npr=12",
+	} {
+		got, err := TaskField(task, name)
+		if err != nil {
+			t.Fatalf("TaskField(%s) failed: %v", name, err)
+		}
+		if got != want {
+			t.Errorf("TaskField(%s): expected %q, got %q", name, want, got)
+		}
+	}
+
+	if _, err := TaskField(task, "Title"); err == nil {
+		t.Error("Field names should match the JSON names exactly")
+	}
+}
+
+func TestCmdPruneMaxAge(t *testing.T) {
+	root := newTestRoot(t)
+	now := time.Now().UTC()
+	oldDay, recentDay := now.AddDate(0, 0, -10), now.AddDate(0, 0, -2)
+
+	files := map[time.Time]Event{
+		oldDay:    {ID: "a0000001", Timestamp: oldDay, Type: EventCreate, Title: "Old", Status: StatusOpen},
+		recentDay: {ID: "a0000002", Timestamp: recentDay, Type: EventCreate, Title: "Recent", Status: StatusOpen},
+	}
+	for day, event := range files {
+		if err := WriteEventsToFile(root, day.Format("2006-01-02")+".jsonl", []Event{event}); err != nil {
+			t.Fatalf("WriteEventsToFile failed: %v", err)
+		}
+	}
+
+	if _, err := CmdPrune(root, PruneOptions{KeepAll: true, MaxAge: 5}); err != nil {
+		t.Fatalf("CmdPrune failed: %v", err)
+	}
+
+	remaining, _ := ListEventFiles(root)
+	want := []string{recentDay.Format("2006-01-02") + ".jsonl", "compacted.jsonl"}
+	if strings.Join(remaining, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected %v to remain, got %v", want, remaining)
+	}
+	events, _ := LoadAllEvents(root)
+	if len(ComputeState(events)) != 2 {
+		t.Errorf("Compaction should keep both tasks, got %d", len(ComputeState(events)))
+	}
+}
+
+func TestCmdPruneMaxAgeUsesFullState(t *testing.T) {
+	root := newTestRoot(t)
+	now := time.Now().UTC()
+	oldDay, recentDay := now.AddDate(0, 0, -10), now.AddDate(0, 0, -2)
+
+	// Done in an old file, reopened in a recent one
+	old := []Event{
+		{ID: "a0000001", Timestamp: oldDay, Type: EventCreate, Title: "Reopened", Status: StatusOpen},
+		{ID: "a0000001", Timestamp: oldDay.Add(time.Hour), Type: EventStatus, Status: StatusDone, Resolution: ResolutionCompleted},
+	}
+	recent := []Event{
+		{ID: "a0000001", Timestamp: recentDay, Type: EventStatus, Status: StatusOpen},
+	}
+	if err := WriteEventsToFile(root, oldDay.Format("2006-01-02")+".jsonl", old); err != nil {
+		t.Fatalf("WriteEventsToFile failed: %v", err)
+	}
+	if err := WriteEventsToFile(root, recentDay.Format("2006-01-02")+".jsonl", recent); err != nil {
+		t.Fatalf("WriteEventsToFile failed: %v", err)
+	}
+
+	result, err := CmdPrune(root, PruneOptions{MaxAge: 5})
+	if err != nil {
+		t.Fatalf("CmdPrune failed: %v", err)
+	}
+	if result["pruned"].(int) != 0 {
+		t.Errorf("A reopened task should not be pruned, got %v pruned", result["pruned"])
+	}
+	tasks, _ := LoadState(root)
+	if task := tasks["a0000001"]; task == nil || task.Status != StatusOpen {
+		t.Errorf("Expected the reopened task to survive open, got %+v", task)
+	}
+}
+
+func TestCmdEvents(t *testing.T) {
+	root := newTestRoot(t)
+
+	result, err := CmdEvents(root)
+	if err != nil {
+		t.Fatalf("CmdEvents failed: %v", err)
+	}
+	if result["total"].(int) != 0 || result["files"].(int) != 0 {
+		t.Errorf("Expected an empty log, got %v", result)
+	}
+	if _, ok := result["first"]; ok {
+		t.Error("An empty log has no time range")
+	}
+
+	created, err := CmdCreate(root, "Task", CreateOptions{})
+	if err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	if _, err := CmdClaim(root, created["id"].(string), "", ""); err != nil {
+		t.Fatalf("CmdClaim failed: %v", err)
+	}
+
+	result, err = CmdEvents(root)
+	if err != nil {
+		t.Fatalf("CmdEvents failed: %v", err)
+	}
+	byType := result["by_type"].(map[string]int)
+	if result["total"].(int) != 2 || byType["create"] != 1 || byType["status"] != 1 {
+		t.Errorf("Expected one create and one status event, got %v", byType)
+	}
+	if result["files"].(int) != 1 || result["compacted"].(bool) {
+		t.Errorf("Expected one uncompacted file, got %v", result)
+	}
+	if !result["last"].(time.Time).After(result["first"].(time.Time)) {
+		t.Error("Expected range to span both events")
+	}
+}
+
+func TestCmdDoneUnblocked(t *testing.T) {
+	root := newTestRoot(t)
+	mustCreate := func(title string, deps ...string) string {
+		t.Helper()
+		created, err := CmdCreate(root, title, CreateOptions{Deps: deps})
+		if err != nil {
+			t.Fatalf("CmdCreate failed: %v", err)
+		}
+		return created["id"].(string)
+	}
+
+	a := mustCreate("A")
+	b := mustCreate("B")
+	onlyA := mustCreate("Needs A", a)
+	mustCreate("Needs A and B", a, b)
+	mustCreate("Unrelated")
+
+	result, err := CmdDone(root, a, "", "", "")
+	if err != nil {
+		t.Fatalf("CmdDone failed: %v", err)
+	}
+	unblocked := result["unblocked"].([]*Task)
+	if len(unblocked) != 1 || unblocked[0].ID != onlyA {
+		t.Errorf("Expected only %s to become ready, got %v", onlyA, unblocked)
+	}
+}
+
+func TestCmdListIncludeDeleted(t *testing.T) {
+	root := newTestRoot(t)
+	var ids []string
+	for _, title := range []string{"Kept", "Removed"} {
+		created, err := CmdCreate(root, title, CreateOptions{})
+		if err != nil {
+			t.Fatalf("CmdCreate failed: %v", err)
+		}
+		ids = append(ids, created["id"].(string))
+	}
+	if _, err := CmdDelete(root, ids[1], ""); err != nil {
+		t.Fatalf("CmdDelete failed: %v", err)
+	}
+
+	result, _ := CmdList(root, ListFilter{})
+	if result["total"].(int) != 1 {
+		t.Errorf("Deleted tasks should be excluded by default, got %d", result["total"])
+	}
+
+	result, _ = CmdList(root, ListFilter{IncludeDeleted: true})
+	tasks := result["tasks"].([]*Task)
+	if len(tasks) != 2 {
+		t.Fatalf("Expected 2 tasks with deleted included, got %d", len(tasks))
+	}
+	for _, task := range tasks {
+		if task.Deleted != (task.ID == ids[1]) {
+			t.Errorf("Task %s has deleted=%v", task.ID, task.Deleted)
+		}
+	}
+}
+
+func TestCmdRelabelPriority(t *testing.T) {
+	root := newTestRoot(t)
+	var ids []string
+	for _, labels := range [][]string{{"priority:high", "bug"}, {"priority:low", "priority:critical"}, {"priority:urgent"}, {"bug"}} {
+		created, err := CmdCreate(root, "Task", CreateOptions{Labels: labels})
+		if err != nil {
+			t.Fatalf("CmdCreate failed: %v", err)
+		}
+		ids = append(ids, created["id"].(string))
+	}
+
+	dry, err := CmdRelabelPriority(root, true)
+	if err != nil {
+		t.Fatalf("CmdRelabelPriority failed: %v", err)
+	}
+	if dry["count"].(int) != 2 {
+		t.Errorf("Expected 2 tasks to migrate, got %v", dry["tasks"])
+	}
+	events, _ := LoadAllEvents(root)
+	if len(events) != 4 {
+		t.Fatalf("Dry run should not write events, got %d", len(events))
+	}
+
+	if _, err := CmdRelabelPriority(root, false); err != nil {
+		t.Fatalf("CmdRelabelPriority failed: %v", err)
+	}
+	events, _ = LoadAllEvents(root)
+	tasks := ComputeState(events)
+
+	want := []struct {
+		priority Priority
+		labels   string
+	}{
+		{PriorityHigh, "bug"},
+		{PriorityCritical, ""},
+		{PriorityMedium, "priority:urgent"},
+		{PriorityMedium, "bug"},
+	}
+	for i, w := range want {
+		task := tasks[ids[i]]
+		if task.Priority != w.priority || strings.Join(task.Labels, ",") != w.labels {
+			t.Errorf("Task %d: expected %s [%s], got %s [%s]", i, w.priority, w.labels, task.Priority, strings.Join(task.Labels, ","))
+		}
+	}
+}
+
+func TestCmdPrimeInProgressOrder(t *testing.T) {
+	root := newTestRoot(t)
+	old := time.Now().UTC().Add(-50 * time.Hour)
+	events := []Event{
+		{ID: "a0000001", Timestamp: old, Type: EventCreate, Title: "Recent"},
+		{ID: "a0000002", Timestamp: old, Type: EventCreate, Title: "Stalled"},
+		{ID: "a0000002", Timestamp: old.Add(time.Hour), Type: EventStatus, Status: StatusInProgress},
+		{ID: "a0000001", Timestamp: time.Now().UTC().Add(-3 * time.Hour), Type: EventStatus, Status: StatusInProgress},
+	}
+	if err := AppendEvents(root, events); err != nil {
+		t.Fatalf("AppendEvents failed: %v", err)
+	}
+
+	out, err := CmdPrime(root, "")
+	if err != nil {
+		t.Fatalf("CmdPrime failed: %v", err)
+	}
+	stalled := strings.Index(out, "Stalled (2d ago)")
+	recent := strings.Index(out, "Recent (3h ago)")
+	if stalled < 0 || recent < 0 || stalled > recent {
+		t.Errorf("Expected stalled task with age before recent one, got:\n%s", out)
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		30 * time.Second: "<1m",
+		90 * time.Second: "1m",
+		5 * time.Minute:  "5m",
+		3 * time.Hour:    "3h",
+		36 * time.Hour:   "1d",
+		49 * time.Hour:   "2d",
+	} {
+		if got := FormatAge(d); got != want {
+			t.Errorf("FormatAge(%s): expected %s, got %s", d, want, got)
+		}
+	}
+}
+
+func TestFormatDependencyTreePruneDoneLeaves(t *testing.T) {
+	now := time.Now().UTC()
+	events := []Event{
+		{ID: "a0000001", Timestamp: now, Type: EventCreate, Title: "Finished parent", Deps: []string{"a0000002"}},
+		{ID: "a0000002", Timestamp: now, Type: EventCreate, Title: "Done child", Status: StatusDone},
+		{ID: "a0000003", Timestamp: now, Type: EventCreate, Title: "Active parent", Deps: []string{"a0000002", "a0000004"}},
+		{ID: "a0000004", Timestamp: now, Type: EventCreate, Title: "Open child"},
+	}
+	tasks := ComputeState(events)
+
+	plain := FormatDependencyTree(tasks, false)
+	if strings.Contains(plain, "all subtasks done") {
+		t.Errorf("Marker should only appear with pruneDoneLeaves, got:\n%s", plain)
+	}
+
+	pruned := FormatDependencyTree(tasks, true)
+	if !strings.Contains(pruned, "Finished parent (all subtasks done)") {
+		t.Errorf("Expected finished parent to be marked, got:\n%s", pruned)
+	}
+	if strings.Contains(pruned, "Active parent (all subtasks done)") || strings.Contains(pruned, "Open child (all") {
+		t.Errorf("Tasks with remaining work should not be marked, got:\n%s", pruned)
+	}
+}
+
+func TestFormatGantt(t *testing.T) {
+	created := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	now := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	high := PriorityHigh
+	events := []Event{
+		{ID: "a0000001", Timestamp: created, Type: EventCreate, Title: "Design: API", Priority: &high},
+		{ID: "a0000001", Timestamp: created.AddDate(0, 0, 2), Type: EventStatus, Status: StatusDone, Resolution: ResolutionCompleted},
+		{ID: "a0000002", Timestamp: created.AddDate(0, 0, 1), Type: EventCreate, Title: "Build"},
+		{ID: "a0000002", Timestamp: created.AddDate(0, 0, 3), Type: EventStatus, Status: StatusInProgress},
+		{ID: "a0000003", Timestamp: created, Type: EventCreate, Title: "Gone"},
+		{ID: "a0000003", Timestamp: created, Type: EventDelete},
+		{ID: "a0000004", Timestamp: created, Type: EventCreate, Title: "Shelved"},
+		{ID: "a0000004", Timestamp: created, Type: EventArchive},
+	}
+
+	out, err := FormatGantt(ComputeState(events), "priority", now)
+	if err != nil {
+		t.Fatalf("FormatGantt failed: %v", err)
+	}
+	for _, want := range []string{
+		"section high\n    Design  API :done, a0000001, 2026-03-01, 2026-03-04\n",
+		"section medium\n    Build :active, a0000002, 2026-03-02, 2026-03-11\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Gone") || strings.Contains(out, "Shelved") {
+		t.Errorf("Deleted and archived tasks should be skipped, got:\n%s", out)
+	}
+}
+
+func TestCmdClaimRequireNote(t *testing.T) {
+	root := newTestRoot(t)
+	created, err := CmdCreate(root, "Task", CreateOptions{})
+	if err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	id := created["id"].(string)
+
+	if err := os.WriteFile(filepath.Join(root, ConfigFile), []byte(`{"require_claim_note": true}`), 0644); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+
+	if _, err := CmdClaim(root, id, "", ""); err == nil {
+		t.Fatal("Claim without a note should fail when require_claim_note is set")
+	}
+	if _, err := CmdClaim(root, id, "   ", ""); err == nil {
+		t.Fatal("A blank note should not satisfy require_claim_note")
+	}
+	events, _ := LoadAllEvents(root)
+	if ComputeState(events)[id].Status != StatusOpen {
+		t.Fatal("Rejected claim should leave the task open")
+	}
+
+	if _, err := CmdClaim(root, id, "start with the parser", ""); err != nil {
+		t.Fatalf("Claim with a note failed: %v", err)
+	}
+	events, _ = LoadAllEvents(root)
+	task := ComputeState(events)[id]
+	if task.Status != StatusInProgress || task.Notes != "start with the parser" {
+		t.Errorf("Expected in-progress task with the claim note, got %s %q", task.Status, task.Notes)
+	}
+}
+
+func TestTaskViewsReady(t *testing.T) {
+	root := newTestRoot(t)
+	dep, err := CmdCreate(root, "Dep", CreateOptions{})
+	if err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	depID := dep["id"].(string)
+	if _, err := CmdCreate(root, "Blocked", CreateOptions{Deps: []string{depID}}); err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+
+	result, _ := CmdList(root, ListFilter{})
+	views, err := TaskViews(root, result["tasks"].([]*Task))
+	if err != nil {
+		t.Fatalf("TaskViews failed: %v", err)
+	}
+	for _, v := range views {
+		if v.Ready != (v.ID == depID) {
+			t.Errorf("Task %s: expected ready=%v", v.Title, v.ID == depID)
+		}
+	}
+
+	data, _ := json.Marshal(views[0])
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if _, ok := decoded["ready"]; !ok || decoded["title"] == nil {
+		t.Errorf("Expected task fields flattened alongside ready, got %s", data)
+	}
+}
+
+func TestCmdUnclaimAll(t *testing.T) {
+	root := newTestRoot(t)
+	var ids []string
+	for _, title := range []string{"One", "Two", "Three"} {
+		created, err := CmdCreate(root, title, CreateOptions{})
+		if err != nil {
+			t.Fatalf("CmdCreate failed: %v", err)
+		}
+		ids = append(ids, created["id"].(string))
+	}
+	for _, id := range ids[:2] {
+		if _, err := CmdClaim(root, id, "", ""); err != nil {
+			t.Fatalf("CmdClaim failed: %v", err)
+		}
+	}
+
+	result, err := CmdUnclaimAll(root, "", "handing off")
+	if err != nil {
+		t.Fatalf("CmdUnclaimAll failed: %v", err)
+	}
+	if result["count"].(int) != 2 {
+		t.Errorf("Expected 2 tasks released, got %v", result["ids"])
+	}
+
+	events, _ := LoadAllEvents(root)
+	tasks := ComputeState(events)
+	for _, id := range ids {
+		if tasks[id].Status != StatusOpen {
+			t.Errorf("Task %s should be open, got %s", id, tasks[id].Status)
+		}
+	}
+	if tasks[ids[0]].Notes != "handing off" || tasks[ids[2]].Notes != "" {
+		t.Error("The shared note should only be added to released tasks")
+	}
+
+	// With an assignee, only that owner's claims are released, and they stay
+	// assigned
+	if _, err := CmdClaim(root, ids[0], "", "alice"); err != nil {
+		t.Fatalf("CmdClaim failed: %v", err)
+	}
+	if _, err := CmdClaim(root, ids[1], "", "bob"); err != nil {
+		t.Fatalf("CmdClaim failed: %v", err)
+	}
+	result, err = CmdUnclaimAll(root, "alice", "")
+	if err != nil {
+		t.Fatalf("CmdUnclaimAll failed: %v", err)
+	}
+	if fmt.Sprint(result["ids"]) != fmt.Sprint([]string{ids[0]}) {
+		t.Errorf("Expected only alice's task released, got %v", result["ids"])
+	}
+	tasks, _ = LoadState(root)
+	if tasks[ids[0]].Status != StatusOpen || tasks[ids[0]].Assignee != "alice" {
+		t.Errorf("Expected alice's task open and still hers, got %s %q", tasks[ids[0]].Status, tasks[ids[0]].Assignee)
+	}
+	if tasks[ids[1]].Status != StatusInProgress {
+		t.Errorf("Expected bob's task still in progress, got %s", tasks[ids[1]].Status)
+	}
+}
+
+func TestCmdReadyOrderLeverage(t *testing.T) {
+	now := time.Now().UTC()
+	root := newTestRoot(t)
+	high := PriorityHigh
+	events := []Event{
+		// a1 is older, but a2 unblocks two tasks; a3 is higher priority than both
+		{ID: "a0000001", Timestamp: now, Type: EventCreate, Title: "Old"},
+		{ID: "a0000002", Timestamp: now.Add(time.Second), Type: EventCreate, Title: "Leverage"},
+		{ID: "a0000003", Timestamp: now.Add(2 * time.Second), Type: EventCreate, Title: "Urgent", Priority: &high},
+		{ID: "b0000001", Timestamp: now, Type: EventCreate, Title: "Waits 1", Deps: []string{"a0000002"}},
+		{ID: "b0000002", Timestamp: now, Type: EventCreate, Title: "Waits 2", Deps: []string{"a0000002"}},
+	}
+	if err := AppendEvents(root, events); err != nil {
+		t.Fatalf("AppendEvents failed: %v", err)
+	}
+
+	order := func(mode string) string {
+		t.Helper()
+		result, err := CmdReady(root, ListFilter{}, mode)
+		if err != nil {
+			t.Fatalf("CmdReady failed: %v", err)
+		}
+		var ids []string
+		for _, task := range result["tasks"].([]*Task) {
+			ids = append(ids, task.ID)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	if got := order(""); got != "a0000003,a0000001,a0000002" {
+		t.Errorf("Default order: got %s", got)
+	}
+	if got := order("leverage"); got != "a0000003,a0000002,a0000001" {
+		t.Errorf("Leverage order: got %s", got)
+	}
+	if _, err := CmdReady(root, ListFilter{}, "random"); err == nil {
+		t.Error("Unknown order should fail")
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	root := newTestRoot(t)
+
+	meta, err := ReadMeta(root)
+	if err != nil {
+		t.Fatalf("ReadMeta failed: %v", err)
+	}
+	if meta.SchemaVersion != SchemaVersion {
+		t.Errorf("init should record schema version %d, got %d", SchemaVersion, meta.SchemaVersion)
+	}
+	if err := CheckSchemaVersion(root); err != nil {
+		t.Errorf("fresh repo should match: %v", err)
+	}
+
+	// Repos from before meta.json existed are accepted
+	if err := os.Remove(filepath.Join(root, MetaFile)); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSchemaVersion(root); err != nil {
+		t.Errorf("unversioned repo should pass: %v", err)
+	}
+
+	for _, version := range []int{SchemaVersion - 1, SchemaVersion + 1} {
+		if err := WriteMeta(root, Meta{SchemaVersion: version}); err != nil {
+			t.Fatalf("WriteMeta failed: %v", err)
+		}
+		if err := CheckSchemaVersion(root); err == nil {
+			t.Errorf("schema version %d should be reported as a mismatch", version)
+		}
+	}
+}
+
+func TestJSONResultsUseEmptyArrays(t *testing.T) {
+	root := newTestRoot(t)
+
+	list, err := CmdList(root, ListFilter{})
+	if err != nil {
+		t.Fatalf("CmdList failed: %v", err)
+	}
+	ready, err := CmdReady(root, ListFilter{}, "")
+	if err != nil {
+		t.Fatalf("CmdReady failed: %v", err)
+	}
+	labels, err := CmdLabels(root)
+	if err != nil {
+		t.Fatalf("CmdLabels failed: %v", err)
+	}
+	graph, err := CmdGraphData(root)
+	if err != nil {
+		t.Fatalf("CmdGraphData failed: %v", err)
+	}
+
+	for name, v := range map[string]interface{}{"list": list, "ready": ready, "labels": labels, "graph": graph} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("%s: marshal failed: %v", name, err)
+		}
+		if strings.Contains(string(data), "null") {
+			t.Errorf("%s: empty results should be [] not null: %s", name, data)
+		}
+	}
+}
+
+func TestCmdGraphDataSkipsDeleted(t *testing.T) {
+	root := newTestRoot(t)
+
+	dep, _ := CmdCreate(root, "Dep", CreateOptions{})
+	parent, _ := CmdCreate(root, "Parent", CreateOptions{Deps: []string{dep["id"].(string)}})
+	gone, _ := CmdCreate(root, "Gone", CreateOptions{})
+	if _, err := CmdDelete(root, gone["id"].(string), ""); err != nil {
+		t.Fatalf("CmdDelete failed: %v", err)
+	}
+
+	graph, err := CmdGraphData(root)
+	if err != nil {
+		t.Fatalf("CmdGraphData failed: %v", err)
+	}
+	if len(graph.Nodes) != 2 {
+		t.Errorf("expected 2 live nodes, got %d", len(graph.Nodes))
+	}
+	if len(graph.Edges) != 1 || graph.Edges[0].From != dep["id"] || graph.Edges[0].To != parent["id"] {
+		t.Errorf("expected one edge dep -> parent, got %+v", graph.Edges)
+	}
+}
+
+func TestFormatDOTEmpty(t *testing.T) {
+	out := FormatDOT(BuildDependencyGraph(map[string]*Task{}), map[string]*Task{})
+	want := "digraph tlog {\n    rankdir=LR;\n    node [shape=box, style=filled];\n}\n"
+	if out != want {
+		t.Errorf("Expected empty digraph, got:\n%s", out)
+	}
+}
+
+func TestFormatDOTDiamond(t *testing.T) {
+	now := time.Now().UTC()
+	high := PriorityHigh
+	// top needs left and right, which both need base
+	events := []Event{
+		{ID: "a0000001", Timestamp: now, Type: EventCreate, Title: "Base"},
+		{ID: "a0000001", Timestamp: now, Type: EventStatus, Status: StatusDone, Resolution: ResolutionCompleted},
+		{ID: "a0000002", Timestamp: now, Type: EventCreate, Title: "Left", Deps: []string{"a0000001"}},
+		{ID: "a0000002", Timestamp: now, Type: EventStatus, Status: StatusInProgress},
+		{ID: "a0000003", Timestamp: now, Type: EventCreate, Title: `Right "side"`, Deps: []string{"a0000001"}, Priority: &high},
+		{ID: "a0000004", Timestamp: now, Type: EventCreate, Title: "Top", Deps: []string{"a0000002", "a0000003"}},
+	}
+	tasks := ComputeState(events)
+
+	out := FormatDOT(BuildDependencyGraph(tasks), tasks)
+	for _, want := range []string{
+		`"a0000001" [label="a0000001\nBase", fillcolor=lightgreen];`,
+		`"a0000002" [label="a0000002\nLeft", fillcolor=lightyellow];`,
+		`"a0000003" [label="a0000003\n[high] Right \"side\"", fillcolor=white];`,
+		`"a0000001" -> "a0000002";`,
+		`"a0000001" -> "a0000003";`,
+		`"a0000002" -> "a0000004";`,
+		`"a0000003" -> "a0000004";`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+	if n := strings.Count(out, "->"); n != 4 {
+		t.Errorf("Expected 4 edges, got %d:\n%s", n, out)
+	}
+}
+
+func TestFormatMermaid(t *testing.T) {
+	now := time.Now().UTC()
+	events := []Event{
+		{ID: "a0000001", Timestamp: now, Type: EventCreate, Title: `Say "hi" [twice]`},
+		{ID: "a0000001", Timestamp: now, Type: EventStatus, Status: StatusDone, Resolution: ResolutionCompleted},
+		{ID: "a0000002", Timestamp: now, Type: EventCreate, Title: "Line one\nline two", Deps: []string{"a0000001", "missing1"}},
+		{ID: "a0000003", Timestamp: now, Type: EventCreate, Title: "Gone"},
+		{ID: "a0000003", Timestamp: now, Type: EventDelete},
+	}
+
+	out := FormatMermaid(ComputeState(events))
+	for _, want := range []string{
+		"graph TD\n",
+		`    a0000001["Say #quot;hi#quot; #91;twice#93;"]` + "\n",
+		`    a0000002["Line one<br/>line two"]` + "\n",
+		"    a0000002 --> a0000001\n",
+		"    class a0000001 done\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Gone") || strings.Contains(out, "missing1") {
+		t.Errorf("Deleted tasks and dangling deps should be skipped, got:\n%s", out)
+	}
+}
+
+func TestCmdSearch(t *testing.T) {
+	root := newTestRoot(t)
+	low := PriorityLow
+	high := PriorityHigh
+
+	a, _ := CmdCreate(root, "Fix login bug", CreateOptions{Priority: &low})
+	b, _ := CmdCreate(root, "Refactor auth", CreateOptions{Description: "Touches the LOGIN flow", Priority: &high})
+	c, _ := CmdCreate(root, "Write docs", CreateOptions{Notes: "login page screenshots"})
+	gone, _ := CmdCreate(root, "Old login task", CreateOptions{})
+	if _, err := CmdDelete(root, gone["id"].(string), ""); err != nil {
+		t.Fatalf("CmdDelete failed: %v", err)
+	}
+
+	result, err := CmdSearch(root, "Login", "")
+	if err != nil {
+		t.Fatalf("CmdSearch failed: %v", err)
+	}
+	tasks := result["tasks"].([]*Task)
+	want := []string{b["id"].(string), c["id"].(string), a["id"].(string)}
+	if len(tasks) != len(want) {
+		t.Fatalf("Expected %d matches, got %d", len(want), len(tasks))
+	}
+	for i, id := range want {
+		if tasks[i].ID != id {
+			t.Errorf("match %d: expected %s, got %s (%s)", i, id, tasks[i].ID, tasks[i].Title)
+		}
+	}
+
+	result, err = CmdSearch(root, "login", "title")
+	if err != nil {
+		t.Fatalf("CmdSearch failed: %v", err)
+	}
+	if tasks := result["tasks"].([]*Task); len(tasks) != 1 || tasks[0].ID != a["id"] {
+		t.Errorf("--field title should only match the title, got %v", tasks)
+	}
+
+	if _, err := CmdSearch(root, "login", "labels"); err == nil {
+		t.Error("Expected error for unknown field")
+	}
+}
+
+func TestCmdLogTime(t *testing.T) {
+	root := newTestRoot(t)
+	estimate := 120
+	created, err := CmdCreate(root, "Task", CreateOptions{Estimate: &estimate})
+	if err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	id := created["id"].(string)
+
+	for _, m := range []int{30, 45, 15} {
+		if _, err := CmdLogTime(root, id, m); err != nil {
+			t.Fatalf("CmdLogTime failed: %v", err)
+		}
+	}
+	if _, err := CmdLogTime(root, id, 0); err == nil {
+		t.Error("Expected error logging zero minutes")
+	}
+
+	events, _ := LoadAllEvents(root)
+	task := ComputeState(events)[id]
+	if task.TimeSpent != 90 {
+		t.Errorf("Expected 90 minutes spent, got %d", task.TimeSpent)
+	}
+	if task.Estimate != 120 {
+		t.Errorf("Expected estimate 120, got %d", task.Estimate)
+	}
+
+	detail := FormatTaskDetail(task, nil)
+	for _, want := range []string{"Estimate: 2h (30m remaining)\n", "Time spent: 1h30m\n"} {
+		if !strings.Contains(detail, want) {
+			t.Errorf("Expected detail to contain %q, got:\n%s", want, detail)
+		}
+	}
+
+	// Re-estimating keeps the time already spent
+	estimate = 60
+	if _, err := CmdUpdate(root, id, "", "", "", nil, nil, &estimate, false); err != nil {
+		t.Fatalf("CmdUpdate failed: %v", err)
+	}
+	events, _ = LoadAllEvents(root)
+	task = ComputeState(events)[id]
+	if task.Estimate != 60 || task.TimeSpent != 90 {
+		t.Errorf("Expected estimate 60 and 90 spent, got %d and %d", task.Estimate, task.TimeSpent)
+	}
+
+	// Compaction snapshots carry both fields
+	replayed := ComputeState([]Event{snapshotEvent(task)})[id]
+	if replayed.Estimate != 60 || replayed.TimeSpent != 90 {
+		t.Errorf("Snapshot lost time tracking: estimate %d, spent %d", replayed.Estimate, replayed.TimeSpent)
+	}
+}
+
+func TestCmdBlock(t *testing.T) {
+	root := newTestRoot(t)
+	a, _ := CmdCreate(root, "A", CreateOptions{})
+	b, _ := CmdCreate(root, "B", CreateOptions{})
+	c, _ := CmdCreate(root, "C", CreateOptions{})
+	aID, bID, cID := a["id"].(string), b["id"].(string), c["id"].(string)
+
+	// B is blocked by A, C is blocked by B
+	if _, err := CmdBlock(root, bID, aID, "add"); err != nil {
+		t.Fatalf("CmdBlock failed: %v", err)
+	}
+	if _, err := CmdBlock(root, cID, bID, "add"); err != nil {
+		t.Fatalf("CmdBlock failed: %v", err)
+	}
+	if _, err := CmdBlock(root, aID, cID, "add"); err == nil {
+		t.Error("Expected error for a block cycle")
+	}
+	if _, err := CmdBlock(root, aID, aID, "add"); err == nil {
+		t.Error("Expected error for a task blocking itself")
+	}
+
+	// Blocks are soft: every task is still ready
+	ready, err := CmdReady(root, ListFilter{}, "")
+	if err != nil {
+		t.Fatalf("CmdReady failed: %v", err)
+	}
+	if n := len(ready["tasks"].([]*Task)); n != 3 {
+		t.Errorf("Blocks shouldn't affect ready, got %d ready tasks", n)
+	}
+
+	shown, err := CmdShow(root, bID, false)
+	if err != nil {
+		t.Fatalf("CmdShow failed: %v", err)
+	}
+	blocks := shown["blocks"].([]map[string]interface{})
+	blockedBy := shown["blocked_by"].([]map[string]interface{})
+	if len(blocks) != 1 || blocks[0]["id"] != cID {
+		t.Errorf("Expected B to block C, got %v", blocks)
+	}
+	if len(blockedBy) != 1 || blockedBy[0]["id"] != aID {
+		t.Errorf("Expected B to be blocked by A, got %v", blockedBy)
+	}
+	if deps := shown["dep_status"].([]map[string]interface{}); len(deps) != 0 {
+		t.Errorf("Blocks shouldn't appear as deps, got %v", deps)
+	}
+
+	if _, err := CmdBlock(root, bID, aID, "remove"); err != nil {
+		t.Fatalf("CmdBlock remove failed: %v", err)
+	}
+	events, _ := LoadAllEvents(root)
+	tasks := ComputeState(events)
+	if len(tasks[aID].Blocks) != 0 {
+		t.Errorf("Expected A to block nothing after removal, got %v", tasks[aID].Blocks)
+	}
+
+	// Compaction snapshots keep blocks
+	replayed := ComputeState([]Event{snapshotEvent(tasks[bID])})[bID]
+	if len(replayed.Blocks) != 1 || replayed.Blocks[0] != cID {
+		t.Errorf("Snapshot lost blocks: %v", replayed.Blocks)
+	}
+}
+
+func TestCmdAssign(t *testing.T) {
+	root := newTestRoot(t)
+	a, _ := CmdCreate(root, "A", CreateOptions{})
+	b, _ := CmdCreate(root, "B", CreateOptions{})
+	aID, bID := a["id"].(string), b["id"].(string)
+
+	if _, err := CmdClaim(root, aID, "", "agent-1"); err != nil {
+		t.Fatalf("CmdClaim failed: %v", err)
+	}
+	if _, err := CmdAssign(root, bID, "agent-1"); err != nil {
+		t.Fatalf("CmdAssign failed: %v", err)
+	}
+	if _, err := CmdAssign(root, bID, "agent-2"); err != nil {
+		t.Fatalf("CmdAssign failed: %v", err)
+	}
+
+	events, _ := LoadAllEvents(root)
+	tasks := ComputeState(events)
+	if tasks[aID].Assignee != "agent-1" {
+		t.Errorf("claim --by should assign, got %q", tasks[aID].Assignee)
+	}
+	if tasks[bID].Assignee != "agent-2" {
+		t.Errorf("Expected reassignment to agent-2, got %q", tasks[bID].Assignee)
+	}
+
+	result, err := CmdList(root, ListFilter{Assignee: "agent-1"})
+	if err != nil {
+		t.Fatalf("CmdList failed: %v", err)
+	}
+	if listed := result["tasks"].([]*Task); len(listed) != 1 || listed[0].ID != aID {
+		t.Errorf("Expected only A assigned to agent-1, got %v", listed)
+	}
+
+	// An unattributed status change keeps the assignee; assigning "" clears it
+	if _, err := CmdUnclaim(root, aID, ""); err != nil {
+		t.Fatalf("CmdUnclaim failed: %v", err)
+	}
+	if _, err := CmdAssign(root, bID, ""); err != nil {
+		t.Fatalf("CmdAssign failed: %v", err)
+	}
+	events, _ = LoadAllEvents(root)
+	tasks = ComputeState(events)
+	if tasks[aID].Assignee != "agent-1" {
+		t.Errorf("Unclaim shouldn't clear the assignee, got %q", tasks[aID].Assignee)
+	}
+	if tasks[bID].Assignee != "" {
+		t.Errorf("Expected B unassigned, got %q", tasks[bID].Assignee)
+	}
+	if detail := FormatTaskDetail(tasks[aID], nil); !strings.Contains(detail, "Assignee: agent-1\n") {
+		t.Errorf("Expected show to include the assignee, got:\n%s", detail)
+	}
+}
+
+func TestCmdListMultipleStatuses(t *testing.T) {
+	root := newTestRoot(t)
+	open, _ := CmdCreate(root, "Open", CreateOptions{})
+	claimed, _ := CmdCreate(root, "Claimed", CreateOptions{})
+	done, _ := CmdCreate(root, "Done", CreateOptions{})
+	if _, err := CmdClaim(root, claimed["id"].(string), "", ""); err != nil {
+		t.Fatalf("CmdClaim failed: %v", err)
+	}
+	if _, err := CmdDone(root, done["id"].(string), "", "", ""); err != nil {
+		t.Fatalf("CmdDone failed: %v", err)
+	}
+
+	for status, want := range map[string][]string{
+		"open,in_progress": {open["id"].(string), claimed["id"].(string)},
+		"done, open":       {open["id"].(string), done["id"].(string)},
+		"in_progress":      {claimed["id"].(string)},
+		"open,all":         {open["id"].(string), claimed["id"].(string), done["id"].(string)},
+		"done,done,done":   {done["id"].(string)},
+	} {
+		result, err := CmdList(root, ListFilter{Status: status})
+		if err != nil {
+			t.Fatalf("status %q: CmdList failed: %v", status, err)
+		}
+		got := make(map[string]bool)
+		for _, task := range result["tasks"].([]*Task) {
+			got[task.ID] = true
+		}
+		if len(got) != len(want) {
+			t.Errorf("status %q: expected %d tasks, got %d", status, len(want), len(got))
+		}
+		for _, id := range want {
+			if !got[id] {
+				t.Errorf("status %q: missing %s", status, id)
+			}
+		}
+	}
+
+	for _, status := range []string{"open,closed", "open,"} {
+		if _, err := CmdList(root, ListFilter{Status: status}); err == nil {
+			t.Errorf("status %q: expected an error instead of matching nothing", status)
+		}
+	}
+}
+
+func TestCmdListLabelMatch(t *testing.T) {
+	root := newTestRoot(t)
+	abc, _ := CmdCreate(root, "ABC", CreateOptions{Labels: []string{"a", "b", "c"}})
+	ac, _ := CmdCreate(root, "AC", CreateOptions{Labels: []string{"a", "c"}})
+	if _, err := CmdCreate(root, "C", CreateOptions{Labels: []string{"c"}}); err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+
+	tests := []struct {
+		match string
+		want  []string
+	}{
+		{"", []string{abc["id"].(string)}},
+		{"all", []string{abc["id"].(string)}},
+		{"any", []string{abc["id"].(string), ac["id"].(string)}},
+	}
+	for _, tt := range tests {
+		result, err := CmdList(root, ListFilter{Labels: []string{"a", "b"}, LabelMatch: tt.match})
+		if err != nil {
+			t.Fatalf("match %q: CmdList failed: %v", tt.match, err)
+		}
+		tasks := result["tasks"].([]*Task)
+		got := make(map[string]bool)
+		for _, task := range tasks {
+			got[task.ID] = true
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("match %q: expected %d tasks, got %d", tt.match, len(tt.want), len(got))
+		}
+		for _, id := range tt.want {
+			if !got[id] {
+				t.Errorf("match %q: missing %s", tt.match, id)
+			}
+		}
+	}
+
+	if _, err := CmdList(root, ListFilter{Labels: []string{"a"}, LabelMatch: "some"}); err == nil {
+		t.Error("Expected error for an unknown label match mode")
+	}
+}
+
+func TestCmdStats(t *testing.T) {
+	root := newTestRoot(t)
+	backlog := PriorityBacklog
+	high := PriorityHigh
+
+	base, _ := CmdCreate(root, "Base", CreateOptions{Labels: []string{"api"}, Priority: &high})
+	baseID := base["id"].(string)
+	if _, err := CmdCreate(root, "Blocked", CreateOptions{Deps: []string{baseID}, Labels: []string{"api", "ui"}}); err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	claimed, _ := CmdCreate(root, "Claimed", CreateOptions{})
+	done, _ := CmdCreate(root, "Done", CreateOptions{})
+	if _, err := CmdCreate(root, "Someday", CreateOptions{Priority: &backlog}); err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	gone, _ := CmdCreate(root, "Gone", CreateOptions{Labels: []string{"api"}})
+	if _, err := CmdClaim(root, claimed["id"].(string), "", ""); err != nil {
+		t.Fatalf("CmdClaim failed: %v", err)
+	}
+	if _, err := CmdDone(root, done["id"].(string), "", "", ""); err != nil {
+		t.Fatalf("CmdDone failed: %v", err)
+	}
+	if _, err := CmdDelete(root, gone["id"].(string), ""); err != nil {
+		t.Fatalf("CmdDelete failed: %v", err)
+	}
+
+	stats, err := CmdStats(root)
+	if err != nil {
+		t.Fatalf("CmdStats failed: %v", err)
+	}
+	if stats["total"] != 5 {
+		t.Errorf("Expected 5 live tasks, got %v", stats["total"])
+	}
+	byStatus := stats["by_status"].(map[string]int)
+	if byStatus["open"] != 3 || byStatus["in_progress"] != 1 || byStatus["done"] != 1 {
+		t.Errorf("Unexpected status counts: %v", byStatus)
+	}
+	byPriority := stats["by_priority"].(map[string]int)
+	if byPriority["high"] != 1 || byPriority["medium"] != 3 || byPriority["backlog"] != 1 || byPriority["critical"] != 0 {
+		t.Errorf("Unexpected priority counts: %v", byPriority)
+	}
+	// Backlog tasks are neither ready nor blocked
+	if stats["ready"] != 1 || stats["blocked"] != 1 {
+		t.Errorf("Expected 1 ready and 1 blocked, got %v and %v", stats["ready"], stats["blocked"])
+	}
+	byLabel := stats["by_label"].(map[string]int)
+	if byLabel["api"] != 2 || byLabel["ui"] != 1 {
+		t.Errorf("Unexpected label counts: %v", byLabel)
+	}
+	if oldest := stats["oldest_open"].(map[string]interface{}); oldest["id"] != baseID {
+		t.Errorf("Expected the oldest open task to be %s, got %v", baseID, oldest["id"])
+	}
+}
+
+// assertStateMatches checks LoadState against a full replay of the log
+func assertStateMatches(t *testing.T, root string) {
+	t.Helper()
+	events, err := LoadAllEvents(root)
+	if err != nil {
+		t.Fatalf("LoadAllEvents failed: %v", err)
+	}
+	want, _ := json.Marshal(ComputeState(events))
+	tasks, err := LoadState(root)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	got, _ := json.Marshal(tasks)
+	if string(got) != string(want) {
+		t.Errorf("LoadState differs from a full replay:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestLoadStateSnapshot(t *testing.T) {
+	root := newTestRoot(t)
+	a, _ := CmdCreate(root, "A", CreateOptions{})
+	assertStateMatches(t, root)
+	if _, err := os.Stat(filepath.Join(root, StateFile)); err != nil {
+		t.Fatalf("Expected a state snapshot to be written: %v", err)
+	}
+
+	// Events appended after the snapshot are replayed on top of it
+	b, _ := CmdCreate(root, "B", CreateOptions{Deps: []string{a["id"].(string)}})
+	if _, err := CmdDone(root, a["id"].(string), "", "", ""); err != nil {
+		t.Fatalf("CmdDone failed: %v", err)
+	}
+	assertStateMatches(t, root)
+
+	// Rewriting a file the snapshot covers forces a rebuild
+	files, _ := ListEventFiles(root)
+	events, _ := LoadEventsFromFile(root, files[0])
+	if err := WriteEventsToFile(root, files[0], events[:1]); err != nil {
+		t.Fatalf("WriteEventsToFile failed: %v", err)
+	}
+	tasks, err := LoadState(root)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if _, ok := tasks[b["id"].(string)]; ok {
+		t.Error("Expected the rewritten log to drop task B")
+	}
+	assertStateMatches(t, root)
+
+	// A partial trailing line is left for the next load
+	f, _ := os.OpenFile(filepath.Join(root, EventsDir, files[0]), os.O_APPEND|os.O_WRONLY, 0644)
+	_, _ = f.WriteString(`{"type":"status"`)
+	_ = f.Close()
+	if _, err := LoadState(root); err != nil {
+		t.Errorf("Expected a partial line to be skipped, got %v", err)
+	}
+}
+
+func TestLoadStateOutOfOrderEvents(t *testing.T) {
+	root := newTestRoot(t)
+	old := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := WriteEventsToFile(root, "2026-01-02.jsonl", []Event{
+		{ID: "a0000001", Type: EventCreate, Timestamp: old.Add(48 * time.Hour), Title: "A", Status: StatusOpen},
+	}); err != nil {
+		t.Fatalf("WriteEventsToFile failed: %v", err)
+	}
+	assertStateMatches(t, root)
+
+	// A merged-in file with earlier events must not be applied after later ones
+	if err := WriteEventsToFile(root, "2026-01-01.jsonl", []Event{
+		{ID: "a0000001", Type: EventCreate, Timestamp: old, Title: "Older A", Status: StatusOpen},
+	}); err != nil {
+		t.Fatalf("WriteEventsToFile failed: %v", err)
+	}
+	tasks, err := LoadState(root)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if tasks["a0000001"].Title != "A" {
+		t.Errorf("Expected the later create to win, got %q", tasks["a0000001"].Title)
+	}
+	assertStateMatches(t, root)
+}
+
+// writeBenchmarkLog writes n events spread over a few hundred tasks
+func writeBenchmarkLog(b *testing.B, n int) string {
+	b.Helper()
+	dir := b.TempDir()
+	if err := Initialize(dir); err != nil {
+		b.Fatalf("Initialize failed: %v", err)
+	}
+	root := filepath.Join(dir, TlogDir)
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := make([]Event, 0, n)
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("b%07d", i%500)
+		event := Event{ID: id, Type: EventUpdate, Timestamp: start.Add(time.Duration(i) * time.Second), Notes: "progress"}
+		if i < 500 {
+			event = Event{ID: id, Type: EventCreate, Timestamp: event.Timestamp, Title: "Task " + id, Status: StatusOpen, Deps: []string{}, Labels: []string{}}
+		}
+		events = append(events, event)
+	}
+	if err := WriteEventsToFile(root, "2026-01-01.jsonl", events); err != nil {
+		b.Fatalf("WriteEventsToFile failed: %v", err)
+	}
+	return root
+}
+
+func BenchmarkComputeState(b *testing.B) {
+	root := writeBenchmarkLog(b, 5000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		events, err := LoadAllEvents(root)
+		if err != nil {
+			b.Fatal(err)
+		}
+		ComputeState(events)
+	}
+}
+
+func BenchmarkLoadState(b *testing.B) {
+	root := writeBenchmarkLog(b, 5000)
+	if _, err := LoadState(root); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := LoadState(root); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCmdExport(t *testing.T) {
+	root := newTestRoot(t)
+	first, _ := CmdCreate(root, "First", CreateOptions{})
+	second, _ := CmdCreate(root, "Second", CreateOptions{})
+	gone, _ := CmdCreate(root, "Gone", CreateOptions{})
+	if _, err := CmdDelete(root, gone["id"].(string), ""); err != nil {
+		t.Fatalf("CmdDelete failed: %v", err)
+	}
+
+	tasks, err := CmdExport(root, false)
+	if err != nil {
+		t.Fatalf("CmdExport failed: %v", err)
+	}
+	if len(tasks) != 2 || tasks[0].ID != first["id"] || tasks[1].ID != second["id"] {
+		t.Errorf("Expected First then Second without the deleted task, got %v", tasks)
+	}
+
+	tasks, err = CmdExport(root, true)
+	if err != nil {
+		t.Fatalf("CmdExport failed: %v", err)
+	}
+	if len(tasks) != 3 || !tasks[2].Deleted {
+		t.Errorf("Expected the deleted task to be included last, got %v", tasks)
+	}
+}
+
+func TestCmdImportJSON(t *testing.T) {
+	root := newTestRoot(t)
+	existing, _ := CmdCreate(root, "Existing", CreateOptions{})
+
+	input := `[
+		{"id": "a0000001", "title": "Design", "status": "done", "resolution": "completed", "priority": "high", "deps": [], "labels": ["api"]},
+		{"id": "a0000002", "title": "Build", "priority": "medium", "deps": ["a0000001", "` + existing["id"].(string) + `"], "labels": []}
+	]`
+	tasks, err := ParseTaskJSON(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseTaskJSON failed: %v", err)
+	}
+
+	if _, err := CmdImport(root, tasks, true, false); err != nil {
+		t.Fatalf("CmdImport failed: %v", err)
+	}
+	state, _ := LoadState(root)
+	build := state["a0000002"]
+	if build == nil || len(build.Deps) != 2 || build.Deps[0] != "a0000001" {
+		t.Fatalf("Expected preserved IDs and deps, got %+v", build)
+	}
+	if state["a0000001"].Status != StatusDone || state["a0000001"].Priority != PriorityHigh {
+		t.Errorf("Expected status and priority to carry over, got %+v", state["a0000001"])
+	}
+
+	// Importing the same IDs again collides
+	if _, err := CmdImport(root, tasks, true, false); err == nil {
+		t.Error("Expected an error for IDs that already exist")
+	}
+}
+
+func TestCmdImportRejectsDanglingDeps(t *testing.T) {
+	root := newTestRoot(t)
+	tasks := []*Task{
+		{ID: "one", Title: "One"},
+		{ID: "two", Title: "Two", Deps: []string{"one", "missing"}},
+	}
+
+	if _, err := CmdImport(root, tasks, false, false); err == nil {
+		t.Fatal("Expected an error for a dangling dep")
+	}
+	state, _ := LoadState(root)
+	if len(state) != 0 {
+		t.Errorf("Expected the whole batch to be rejected, got %d tasks", len(state))
+	}
+}
+
+func TestOpenTlog(t *testing.T) {
+	root := newTestRoot(t)
+	got, err := OpenTlog(root)
+	if err != nil {
+		t.Fatalf("OpenTlog failed: %v", err)
+	}
+	if got != root {
+		t.Errorf("Expected %s, got %s", root, got)
+	}
+
+	// The parent of .tlog isn't itself a tlog directory
+	if _, err := OpenTlog(filepath.Dir(root)); err == nil {
+		t.Error("Expected an error for a directory without events/")
+	}
+}
+
+func TestCmdNote(t *testing.T) {
+	root := newTestRoot(t)
+	created, _ := CmdCreate(root, "Investigate", CreateOptions{})
+	id := created["id"].(string)
+
+	for _, note := range []string{"first lead", "dead end", "found it"} {
+		if _, err := CmdNote(root, id, note, ""); err != nil {
+			t.Fatalf("CmdNote failed: %v", err)
+		}
+	}
+
+	tasks, _ := LoadState(root)
+	task := tasks[id]
+	if task.Notes != "first lead\ndead end\nfound it" {
+		t.Errorf("Expected notes to accumulate in order, got %q", task.Notes)
+	}
+	if task.Status != StatusOpen || task.Title != "Investigate" {
+		t.Errorf("Expected a note to change nothing else, got %+v", task)
+	}
+
+	if _, err := CmdNote(root, id, "  ", ""); err == nil {
+		t.Error("Expected an error for an empty note")
+	}
+	if _, err := CmdDelete(root, id, ""); err != nil {
+		t.Fatalf("CmdDelete failed: %v", err)
+	}
+	if _, err := CmdNote(root, id, "too late", ""); err == nil {
+		t.Error("Expected an error noting a deleted task")
+	}
+}
+
+func TestNoteLog(t *testing.T) {
+	root := newTestRoot(t)
+	created, _ := CmdCreate(root, "Investigate", CreateOptions{Notes: "initial hunch"})
+	id := created["id"].(string)
+	if _, err := CmdClaim(root, id, "taking it", "agent-1"); err != nil {
+		t.Fatalf("CmdClaim failed: %v", err)
+	}
+	if _, err := CmdNote(root, id, "found it", "alice"); err != nil {
+		t.Fatalf("CmdNote failed: %v", err)
+	}
+
+	tasks, _ := LoadState(root)
+	log := tasks[id].NoteLog
+	if len(log) != 3 {
+		t.Fatalf("Expected 3 note log entries, got %+v", log)
+	}
+	if log[0].Text != "initial hunch" || log[1].Author != "agent-1" || log[2].Author != "alice" || log[2].Text != "found it" {
+		t.Errorf("Unexpected note log: %+v", log)
+	}
+	if log[1].Time.Before(log[0].Time) || log[2].Time.Before(log[1].Time) {
+		t.Errorf("Expected note log in chronological order: %+v", log)
+	}
+	if tasks[id].Notes != "initial hunch\ntaking it\nfound it" {
+		t.Errorf("Expected plain notes to still accumulate, got %q", tasks[id].Notes)
+	}
+
+	detail := FormatTaskDetail(tasks[id], nil)
+	if !strings.Contains(detail, "alice: found it") || !strings.Contains(detail, log[2].Time.Format("2006-01-02 15:04")) {
+		t.Errorf("Expected show to render the note log, got:\n%s", detail)
+	}
+
+	// Snapshots written before note logs existed still read as one entry
+	legacy := ComputeState([]Event{{ID: "a0000001", Type: EventCreate, Timestamp: NowISO(), Title: "Old", Notes: "one\ntwo"}})
+	if entries := legacy["a0000001"].NoteLog; len(entries) != 1 || entries[0].Text != "one\ntwo" {
+		t.Errorf("Expected legacy notes as a single entry, got %+v", entries)
+	}
+
+	// Snapshots store the notes once, in the log, and replay the plain notes
+	snapshot := snapshotEvent(tasks[id])
+	if snapshot.Notes != "" || len(snapshot.NoteLog) != 3 {
+		t.Errorf("Expected a snapshot with only the note log, got %q and %+v", snapshot.Notes, snapshot.NoteLog)
+	}
+	replayed := ComputeState([]Event{snapshot})[id]
+	if replayed.Notes != tasks[id].Notes || len(replayed.NoteLog) != 3 {
+		t.Errorf("Expected the snapshot to replay both forms, got %q and %+v", replayed.Notes, replayed.NoteLog)
+	}
+}
+
+func TestDoneWithCommit(t *testing.T) {
+	root := newTestRoot(t)
+	created, _ := CmdCreate(root, "Ship it", CreateOptions{})
+	id := created["id"].(string)
+	if _, err := CmdDone(root, id, "", "", "abc1234"); err != nil {
+		t.Fatalf("CmdDone failed: %v", err)
+	}
+
+	tasks, _ := LoadState(root)
+	if tasks[id].Commit != "abc1234" {
+		t.Errorf("Expected commit abc1234, got %q", tasks[id].Commit)
+	}
+	if detail := FormatTaskDetail(tasks[id], nil); !strings.Contains(detail, "Commit: abc1234") {
+		t.Errorf("Expected show to include the commit, got:\n%s", detail)
+	}
+
+	// Compaction keeps the commit
+	compacted := ComputeState([]Event{snapshotEvent(tasks[id])})
+	if compacted[id].Commit != "abc1234" {
+		t.Errorf("Expected the snapshot to carry the commit, got %q", compacted[id].Commit)
+	}
+}
+
+func TestCmdReopenWithNote(t *testing.T) {
+	root := newTestRoot(t)
+	created, _ := CmdCreate(root, "Fix login", CreateOptions{})
+	id := created["id"].(string)
+	if _, err := CmdDone(root, id, "", "fixed", ""); err != nil {
+		t.Fatalf("CmdDone failed: %v", err)
+	}
+	if _, err := CmdReopen(root, id, "regressed on mobile"); err != nil {
+		t.Fatalf("CmdReopen failed: %v", err)
+	}
+
+	tasks, _ := LoadState(root)
+	task := tasks[id]
+	if task.Status != StatusOpen {
+		t.Errorf("Expected open, got %s", task.Status)
+	}
+	if task.Notes != "fixed\nregressed on mobile" {
+		t.Errorf("Expected the reopen note to be appended, got %q", task.Notes)
+	}
+}
+
+func TestCmdShowMissingDeps(t *testing.T) {
+	root := newTestRoot(t)
+	a, _ := CmdCreate(root, "A", CreateOptions{})
+	aID := a["id"].(string)
+	b, _ := CmdCreate(root, "B", CreateOptions{Deps: []string{aID}})
+	bID := b["id"].(string)
+
+	result, err := CmdShow(root, bID, false)
+	if err != nil {
+		t.Fatalf("CmdShow failed: %v", err)
+	}
+	if missing := result["missing_deps"].([]string); len(missing) != 0 {
+		t.Errorf("Expected no missing deps, got %v", missing)
+	}
+
+	if _, err := CmdDelete(root, aID, ""); err != nil {
+		t.Fatalf("CmdDelete failed: %v", err)
+	}
+	result, err = CmdShow(root, bID, false)
+	if err != nil {
+		t.Fatalf("CmdShow failed: %v", err)
+	}
+	if missing := result["missing_deps"].([]string); len(missing) != 1 || missing[0] != aID {
+		t.Errorf("Expected %s to be reported missing, got %v", aID, missing)
+	}
+
+	tasks, _ := LoadState(root)
+	if dangling := FindDanglingDeps(tasks); len(dangling[bID]) != 1 {
+		t.Errorf("Expected doctor to flag the deleted dep, got %v", dangling)
+	}
+}
+
+func TestCmdUndelete(t *testing.T) {
+	root := newTestRoot(t)
+	created, _ := CmdCreate(root, "Oops", CreateOptions{})
+	id := created["id"].(string)
+
+	if _, err := CmdUndelete(root, id); err == nil {
+		t.Error("Expected an error undeleting a live task")
+	}
+	if _, err := CmdDelete(root, id, "mistake"); err != nil {
+		t.Fatalf("CmdDelete failed: %v", err)
+	}
+	if _, err := CmdUndelete(root, id); err != nil {
+		t.Fatalf("CmdUndelete failed: %v", err)
+	}
+
+	result, err := CmdList(root, ListFilter{})
+	if err != nil {
+		t.Fatalf("CmdList failed: %v", err)
+	}
+	tasks := result["tasks"].([]*Task)
+	if len(tasks) != 1 || tasks[0].ID != id {
+		t.Errorf("Expected the undeleted task to be listed again, got %v", tasks)
+	}
+
+	if _, err := CmdUndelete(root, "ffffffff"); err == nil {
+		t.Error("Expected an error for an unknown ID")
+	}
+}
+
+func TestParsePriorityStrict(t *testing.T) {
+	for _, name := range []string{"critical", "high", "medium", "low", "backlog"} {
+		p, err := ParsePriorityStrict(name)
+		if err != nil {
+			t.Errorf("ParsePriorityStrict(%q) failed: %v", name, err)
+		}
+		if p.String() != name {
+			t.Errorf("ParsePriorityStrict(%q) = %s", name, p)
+		}
+	}
+
+	for _, name := range []string{"hihg", "High", "", "2"} {
+		if _, err := ParsePriorityStrict(name); err == nil {
+			t.Errorf("Expected an error for %q", name)
+		}
+	}
+	// Replay stays lenient
+	if ParsePriority("hihg") != PriorityMedium {
+		t.Error("Expected ParsePriority to default to medium")
+	}
+
+	root := newTestRoot(t)
+	if _, err := CmdList(root, ListFilter{Priority: "hihg"}); err == nil || !strings.Contains(err.Error(), "valid: critical") {
+		t.Errorf("Expected list to reject an unknown priority, got %v", err)
+	}
+}
+
+func TestConfigDefaultPriority(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := CmdInit(dir); err != nil {
+		t.Fatalf("CmdInit failed: %v", err)
+	}
+	root := filepath.Join(dir, TlogDir)
+
+	cfg, err := LoadConfig(root)
+	if err != nil {
+		t.Fatalf("LoadConfig failed on the starter config: %v", err)
+	}
+	if cfg.DefaultPriority != "medium" || cfg.AutoSync {
+		t.Errorf("Unexpected starter config: %+v", cfg)
+	}
+
+	cfg.DefaultPriority = "low"
+	cfg.LabelPriorities = map[string]string{"bug": "high"}
+	if err := WriteConfig(root, cfg); err != nil {
+		t.Fatalf("WriteConfig failed: %v", err)
+	}
+	critical := PriorityCritical
+	plain, _ := CmdCreate(root, "Plain", CreateOptions{})
+	bug, _ := CmdCreate(root, "Bug", CreateOptions{Labels: []string{"bug"}})
+	explicit, _ := CmdCreate(root, "Explicit", CreateOptions{Priority: &critical})
+
+	tasks, _ := LoadState(root)
+	if p := tasks[plain["id"].(string)].Priority; p != PriorityLow {
+		t.Errorf("Expected the default priority, got %s", p)
+	}
+	if p := tasks[bug["id"].(string)].Priority; p != PriorityHigh {
+		t.Errorf("Expected the label priority to beat the default, got %s", p)
+	}
+	if p := tasks[explicit["id"].(string)].Priority; p != PriorityCritical {
+		t.Errorf("Expected the explicit priority to win, got %s", p)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, ConfigFile), []byte(`{"default_priority": "urgent"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(root); err == nil {
+		t.Error("Expected an error for an unknown default_priority")
+	}
+}
+
+func TestAllowedLabels(t *testing.T) {
+	root := newTestRoot(t)
+	if err := WriteConfig(root, Config{AllowedLabels: []string{"bug", "chore"}}); err != nil {
+		t.Fatalf("WriteConfig failed: %v", err)
+	}
+
+	if _, err := CmdCreate(root, "Typo", CreateOptions{Labels: []string{"bugg"}}); err == nil || !strings.Contains(err.Error(), "bugg") {
+		t.Errorf("Expected an unknown label to be rejected, got %v", err)
+	}
+	created, err := CmdCreate(root, "Ok", CreateOptions{Labels: []string{"bug", "feature:login"}})
+	if err != nil {
+		t.Fatalf("Expected allowed and feature: labels to pass, got %v", err)
+	}
+	id := created["id"].(string)
+
+	if _, err := CmdUpdate(root, id, "", "", "", []string{"misc"}, nil, nil, false); err == nil {
+		t.Error("Expected update to reject an unknown label")
+	}
+	if _, err := CmdUpdate(root, id, "", "", "", []string{"misc"}, nil, nil, true); err != nil {
+		t.Errorf("Expected --force to bypass the check, got %v", err)
+	}
+	if _, err := CmdCreateBatch(root, []TaskSpec{{Title: "A", Labels: []string{"chore"}}, {Title: "B", Labels: []string{"nope"}}}, false); err == nil {
+		t.Error("Expected create-batch to reject an unknown label")
+	}
+
+	// No list means no restriction
+	if err := (Config{}).CheckLabels([]string{"anything"}); err != nil {
+		t.Errorf("Expected no restriction without allowed_labels, got %v", err)
+	}
+}
+
+func TestCmdNext(t *testing.T) {
+	root := newTestRoot(t)
+
+	result, err := CmdNext(root, false, "", "")
+	if err != nil {
+		t.Fatalf("CmdNext failed: %v", err)
+	}
+	if result["task"] != nil {
+		t.Errorf("Expected nothing ready on an empty board, got %v", result["task"])
+	}
+
+	// At equal priority the older task wins; equally old tasks fall back to ID
+	now := NowISO()
+	if err := AppendEvents(root, []Event{
+		{ID: "b0000001", Type: EventCreate, Timestamp: now, Title: "Newer"},
+		{ID: "a0000001", Type: EventCreate, Timestamp: now.Add(-time.Hour), Title: "Older"},
+		{ID: "a0000002", Type: EventCreate, Timestamp: now.Add(-time.Hour), Title: "Older twin"},
+	}); err != nil {
+		t.Fatalf("AppendEvents failed: %v", err)
+	}
+
+	result, err = CmdNext(root, false, "", "")
+	if err != nil {
+		t.Fatalf("CmdNext failed: %v", err)
+	}
+	if task := result["task"].(*Task); task.ID != "a0000001" {
+		t.Errorf("Expected the oldest task a0000001, got %s", task.ID)
+	}
+
+	result, err = CmdNext(root, true, "", "")
+	if err != nil {
+		t.Fatalf("CmdNext --claim failed: %v", err)
+	}
+	tasks, _ := LoadState(root)
+	if tasks["a0000001"].Status != StatusInProgress || result["claimed"] != true {
+		t.Errorf("Expected a0000001 to be claimed, got %s", tasks["a0000001"].Status)
+	}
+	if task, _ := CmdNext(root, false, "", ""); task["task"].(*Task).ID != "a0000002" {
+		t.Errorf("Expected the claimed task to be skipped next time, got %v", task["task"])
+	}
+}
+
+func TestCmdNextClaimNote(t *testing.T) {
+	root := newTestRoot(t)
+	created, err := CmdCreate(root, "Task", CreateOptions{})
+	if err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	id := created["id"].(string)
+	if err := os.WriteFile(filepath.Join(root, ConfigFile), []byte(`{"require_claim_note": true}`), 0644); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+
+	if _, err := CmdNext(root, true, "", "alice"); err == nil {
+		t.Fatal("next --claim without a note should fail when require_claim_note is set")
+	}
+	result, err := CmdNext(root, true, "start with the parser", "alice")
+	if err != nil {
+		t.Fatalf("next --claim with a note failed: %v", err)
+	}
+	if task := result["task"].(*Task); task.ID != id || task.Assignee != "alice" {
+		t.Errorf("Expected %s claimed by alice, got %+v", id, task)
+	}
+	tasks, _ := LoadState(root)
+	if task := tasks[id]; task.Status != StatusInProgress || task.Assignee != "alice" || !strings.Contains(task.Notes, "start with the parser") {
+		t.Errorf("Expected the note and assignee to be recorded, got %+v", task)
+	}
+}
+
+func TestCmdNextClaimConcurrent(t *testing.T) {
+	root := newTestRoot(t)
+	const agents = 8
+	now := NowISO()
+	var events []Event
+	for i := 0; i < agents; i++ {
+		events = append(events, Event{ID: fmt.Sprintf("a%07d", i), Type: EventCreate, Timestamp: now.Add(time.Duration(i-agents) * time.Second), Title: "Task"})
+	}
+	if err := AppendEvents(root, events); err != nil {
+		t.Fatalf("AppendEvents failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	claimed := make([]string, agents)
+	errs := make([]error, agents)
+	for i := 0; i < agents; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result, err := CmdNext(root, true, "", "")
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			if task, ok := result["task"].(*Task); ok {
+				claimed[i] = task.ID
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for i, id := range claimed {
+		if errs[i] != nil {
+			t.Fatalf("CmdNext failed: %v", errs[i])
+		}
+		if id == "" || seen[id] {
+			t.Errorf("Expected every agent to claim a distinct task, got %v", claimed)
+			break
+		}
+		seen[id] = true
+	}
+
+	tasks, _ := LoadState(root)
+	for id, task := range tasks {
+		if task.Status != StatusInProgress {
+			t.Errorf("Expected %s to be claimed, got %s", id, task.Status)
+		}
+	}
+}
+
+func TestCmdCreateRetriesIDCollision(t *testing.T) {
+	root := newTestRoot(t)
+	first, _ := CmdCreate(root, "First", CreateOptions{})
+	taken := first["id"].(string)
+
+	// Hand out the existing ID twice before a fresh one
+	calls := 0
+	newID = func() string {
+		calls++
+		if calls <= 2 {
+			return taken
+		}
+		return GenerateID()
+	}
+	defer func() { newID = GenerateID }()
+
+	second, err := CmdCreate(root, "Second", CreateOptions{})
+	if err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	if second["id"] == taken || calls != 3 {
+		t.Errorf("Expected a retry past the collision, got %v after %d attempts", second["id"], calls)
+	}
+	tasks, _ := LoadState(root)
+	if tasks[taken].Title != "First" {
+		t.Errorf("Expected the existing task to be untouched, got %q", tasks[taken].Title)
+	}
+
+	// A generator stuck on one ID gives up instead of merging tasks
+	newID = func() string { return taken }
+	if _, err := CmdCreate(root, "Third", CreateOptions{}); err == nil {
+		t.Error("Expected an error when no unique ID can be generated")
+	}
+}
+
+func TestSameTimestampEventsReplayInFileOrder(t *testing.T) {
+	root := newTestRoot(t)
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	events := []Event{
+		{ID: "a0000001", Type: EventCreate, Timestamp: at.Add(-time.Hour), Title: "A"},
+		{ID: "a0000002", Type: EventCreate, Timestamp: at.Add(-time.Hour), Title: "B"},
+	}
+	// Same-instant notes interleaved with earlier events, so the sort has to
+	// move things around them
+	var want []string
+	for i := 0; i < 200; i++ {
+		if i%3 == 0 {
+			events = append(events, Event{ID: "a0000002", Type: EventUpdate, Timestamp: at.Add(-time.Duration(200-i) * time.Second), Notes: "earlier"})
+			continue
+		}
+		note := strconv.Itoa(i)
+		events = append(events, Event{ID: "a0000001", Type: EventUpdate, Timestamp: at, Notes: note})
+		want = append(want, note)
+	}
+	if err := WriteEventsToFile(root, "2026-01-01.jsonl", events); err != nil {
+		t.Fatalf("WriteEventsToFile failed: %v", err)
+	}
+
+	loaded, err := LoadAllEvents(root)
+	if err != nil {
+		t.Fatalf("LoadAllEvents failed: %v", err)
+	}
+	if notes := ComputeState(loaded)["a0000001"].Notes; notes != strings.Join(want, "\n") {
+		t.Errorf("Expected same-instant events to replay in file order, got %q", notes)
+	}
+	assertStateMatches(t, root)
+}
+
+func TestEventSeqOrdersSameTimestampEvents(t *testing.T) {
+	root := newTestRoot(t)
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	events := []Event{{ID: "a0000001", Type: EventCreate, Timestamp: at, Title: "A"}}
+	for i := 0; i < 5; i++ {
+		events = append(events, Event{ID: "a0000001", Type: EventUpdate, Timestamp: at, Notes: strconv.Itoa(i)})
+	}
+	if err := AppendEvents(root, events); err != nil {
+		t.Fatalf("AppendEvents failed: %v", err)
+	}
+	// A second append continues the sequence
+	if err := AppendEvents(root, []Event{{ID: "a0000001", Type: EventUpdate, Timestamp: at, Notes: "5"}}); err != nil {
+		t.Fatalf("AppendEvents failed: %v", err)
+	}
+
+	files, err := ListEventFiles(root)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected one event file, got %v (%v)", files, err)
+	}
+	written, err := LoadEventsFromFile(root, files[0])
+	if err != nil {
+		t.Fatalf("LoadEventsFromFile failed: %v", err)
+	}
+	for i, event := range written {
+		if event.Seq != uint64(i+1) {
+			t.Fatalf("Expected event %d to have seq %d, got %d", i, i+1, event.Seq)
+		}
+	}
+
+	// Reverse the file: seq, not line order, decides the replay order
+	for i, j := 0, len(written)-1; i < j; i, j = i+1, j-1 {
+		written[i], written[j] = written[j], written[i]
+	}
+	if err := WriteEventsToFile(root, files[0], written); err != nil {
+		t.Fatalf("WriteEventsToFile failed: %v", err)
+	}
+	loaded, err := LoadAllEvents(root)
+	if err != nil {
+		t.Fatalf("LoadAllEvents failed: %v", err)
+	}
+	task := ComputeState(loaded)["a0000001"]
+	if task == nil || task.Notes != "0\n1\n2\n3\n4\n5" {
+		t.Errorf("Expected seq order to survive a rewrite, got %+v", task)
+	}
+	assertStateMatches(t, root)
+
+	// Without the counter file, numbering resumes after the highest seq
+	if err := os.Remove(filepath.Join(root, SeqFile)); err != nil {
+		t.Fatalf("Failed to remove seq file: %v", err)
+	}
+	if err := AppendEvents(root, []Event{{ID: "a0000001", Type: EventUpdate, Timestamp: at, Notes: "6"}}); err != nil {
+		t.Fatalf("AppendEvents failed: %v", err)
+	}
+	loaded, err = LoadAllEvents(root)
+	if err != nil {
+		t.Fatalf("LoadAllEvents failed: %v", err)
+	}
+	if last := loaded[len(loaded)-1]; last.Notes != "6" || last.Seq != 8 {
+		t.Errorf("Expected the new event last with seq 8, got %+v", last)
+	}
+
+	// A pull can bring in events numbered past this checkout's counter;
+	// numbering catches up instead of reusing their seqs
+	pulled := []Event{{ID: "a0000001", Type: EventUpdate, Timestamp: at, Notes: "7", Seq: 20}}
+	if err := WriteEventsToFile(root, "2000-01-01.jsonl", pulled); err != nil {
+		t.Fatalf("WriteEventsToFile failed: %v", err)
+	}
+	if err := AppendEvents(root, []Event{{ID: "a0000001", Type: EventUpdate, Timestamp: at, Notes: "8"}}); err != nil {
+		t.Fatalf("AppendEvents failed: %v", err)
+	}
+	loaded, err = LoadAllEvents(root)
+	if err != nil {
+		t.Fatalf("LoadAllEvents failed: %v", err)
+	}
+	sortEvents(loaded)
+	if last := loaded[len(loaded)-1]; last.Notes != "8" || last.Seq != 21 {
+		t.Errorf("Expected the new event after the pulled one with seq 21, got %+v", last)
+	}
+}
+
+// newGitRepo initializes an empty git repo that can commit, returning its path
+func newGitRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", dir},
+		{"-C", dir, "config", "user.name", "Test"},
+		{"-C", dir, "config", "user.email", "test@example.com"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, out)
+		}
+	}
+	return dir
+}
+
+// newGitTestRoot initializes a git repo with tlog in it, returning the .tlog path
+func newGitTestRoot(t *testing.T) string {
+	t.Helper()
+	dir := newGitRepo(t)
+	if err := Initialize(dir); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	return filepath.Join(dir, TlogDir)
+}
+
+func TestSyncNothingToCommit(t *testing.T) {
+	root := newGitTestRoot(t)
+	t.Chdir(filepath.Dir(root))
+
+	if _, err := CmdCreate(root, "Task", CreateOptions{}); err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	result, err := CmdSync(root, "first", false, false)
+	if err != nil {
+		t.Fatalf("CmdSync failed: %v", err)
+	}
+	if result["status"] != "synced" {
+		t.Errorf("Expected synced, got %v", result["status"])
+	}
+
+	result, err = CmdSync(root, "second", false, false)
+	if err != nil {
+		t.Fatalf("Expected an empty sync to succeed, got %v", err)
+	}
+	if result["status"] != "nothing to sync" {
+		t.Errorf("Expected nothing to sync, got %v", result["status"])
+	}
+}
+
+func TestRunGitIncludesOutput(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	_, err := runGit(t.TempDir(), "rev-parse", "--no-such-flag-for-test")
+	if err == nil {
+		t.Fatal("Expected git to fail")
+	}
+	if !strings.Contains(err.Error(), "git rev-parse failed") || !strings.Contains(err.Error(), "not a git repository") {
+		t.Errorf("Expected git's stderr in the error, got %v", err)
+	}
+}
+
+func TestSyncFromSubdirectoryRepo(t *testing.T) {
+	repo := newGitRepo(t)
+	project := filepath.Join(repo, "sub", "project")
+	if err := os.MkdirAll(project, 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := Initialize(project); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	root := filepath.Join(project, TlogDir)
+	if _, err := CmdCreate(root, "Task", CreateOptions{}); err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+
+	// Unrelated staged work stays staged, not swept into the sync commit
+	if err := os.WriteFile(filepath.Join(repo, "other.txt"), []byte("x\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if out, err := exec.Command("git", "-C", repo, "add", "other.txt").CombinedOutput(); err != nil {
+		t.Fatalf("git add failed: %v: %s", err, out)
+	}
+
+	// Run from outside the repo entirely
+	t.Chdir(t.TempDir())
+	result, err := CmdSync(root, "sync tasks", false, false)
+	if err != nil {
+		t.Fatalf("CmdSync failed: %v", err)
+	}
+	if result["status"] != "synced" {
+		t.Fatalf("Expected synced, got %v", result["status"])
+	}
+
+	out, err := exec.Command("git", "-C", repo, "show", "--name-only", "--format=", "HEAD").CombinedOutput()
+	if err != nil {
+		t.Fatalf("git show failed: %v: %s", err, out)
+	}
+	committed := strings.Fields(string(out))
+	if len(committed) == 0 {
+		t.Fatal("Expected files in the sync commit")
+	}
+	for _, name := range committed {
+		if !strings.HasPrefix(name, "sub/project/.tlog/") {
+			t.Errorf("Sync committed %s outside .tlog", name)
+		}
+		for _, local := range localFiles {
+			if filepath.Base(name) == local {
+				t.Errorf("Sync committed local file %s", name)
+			}
+		}
+	}
+
+	// A second sync has nothing to do, even though the lock file exists
+	result, err = CmdSync(root, "again", false, false)
+	if err != nil {
+		t.Fatalf("CmdSync failed: %v", err)
+	}
+	if result["status"] != "nothing to sync" {
+		t.Errorf("Expected nothing to sync, got %v", result["status"])
+	}
+}
+
+func TestSyncAmendAndPush(t *testing.T) {
+	root := newGitTestRoot(t)
+	repo := filepath.Dir(root)
+	git := func(args ...string) string {
+		t.Helper()
+		out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	// With no commit yet, --amend falls back to a normal commit
+	if _, err := CmdCreate(root, "First", CreateOptions{}); err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	result, err := CmdSync(root, "tlog state", true, false)
+	if err != nil {
+		t.Fatalf("CmdSync failed: %v", err)
+	}
+	if result["amended"] != false || result["warning"] == nil {
+		t.Errorf("Expected a fallback commit with a warning, got %v", result)
+	}
+	if count := git("rev-list", "--count", "HEAD"); count != "1" {
+		t.Fatalf("Expected one commit, got %s", count)
+	}
+
+	// Against the existing commit, --amend keeps a single rolling commit
+	if _, err := CmdCreate(root, "Second", CreateOptions{}); err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	result, err = CmdSync(root, "tlog state, again", true, false)
+	if err != nil {
+		t.Fatalf("CmdSync failed: %v", err)
+	}
+	if result["amended"] != true || result["warning"] != nil {
+		t.Errorf("Expected an amend without a warning, got %v", result)
+	}
+	if count := git("rev-list", "--count", "HEAD"); count != "1" {
+		t.Errorf("Expected the amend to keep one commit, got %s", count)
+	}
+	if msg := git("log", "-1", "--format=%s"); msg != "tlog state, again" {
+		t.Errorf("Expected the amended message, got %q", msg)
+	}
+	if changes, err := LogChanges(root); err != nil || len(changes) != 0 {
+		t.Errorf("Expected everything committed, got %v (%v)", changes, err)
+	}
+
+	// A previous commit with work outside .tlog is never amended
+	if err := os.WriteFile(filepath.Join(repo, "code.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	git("add", "code.go")
+	git("commit", "-q", "-m", "add code")
+	if _, err := CmdCreate(root, "Fourth", CreateOptions{}); err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	result, err = CmdSync(root, "tlog after code", true, false)
+	if err != nil {
+		t.Fatalf("CmdSync failed: %v", err)
+	}
+	if result["amended"] != false || result["warning"] == nil {
+		t.Errorf("Expected a new commit with a warning, got %v", result)
+	}
+	if count := git("rev-list", "--count", "HEAD"); count != "3" {
+		t.Errorf("Expected a third commit, got %s", count)
+	}
+	if msg := git("log", "-1", "--format=%s", "HEAD~1"); msg != "add code" {
+		t.Errorf("Expected the code commit left alone, got %q", msg)
+	}
+
+	// --push sends the commit to the upstream
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	if out, err := exec.Command("git", "init", "--bare", remote).CombinedOutput(); err != nil {
+		t.Fatalf("git init --bare failed: %v: %s", err, out)
+	}
+	git("remote", "add", "origin", remote)
+	git("push", "-q", "-u", "origin", "HEAD")
+	if _, err := CmdCreate(root, "Third", CreateOptions{}); err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	result, err = CmdSync(root, "third", false, true)
+	if err != nil {
+		t.Fatalf("CmdSync failed: %v", err)
+	}
+	if result["pushed"] != true {
+		t.Errorf("Expected pushed, got %v", result)
+	}
+	local := git("rev-parse", "HEAD")
+	if out, err := exec.Command("git", "-C", remote, "rev-parse", "HEAD").CombinedOutput(); err != nil || strings.TrimSpace(string(out)) != local {
+		t.Errorf("Expected the remote at %s, got %s (%v)", local, out, err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	root := newTestRoot(t)
+	create := func(title string) string {
+		t.Helper()
+		result, err := CmdCreate(root, title, CreateOptions{})
+		if err != nil {
+			t.Fatalf("CmdCreate failed: %v", err)
+		}
+		return result["id"].(string)
+	}
+	dep := create("Dep")
+	id := create("Task")
+
+	if _, err := CmdClaim(root, id, "starting", "alice"); err != nil {
+		t.Fatalf("CmdClaim failed: %v", err)
+	}
+	if _, err := CmdDep(root, id, dep, "add"); err != nil {
+		t.Fatalf("CmdDep failed: %v", err)
+	}
+	if _, err := CmdDone(root, id, "", "", "abc123"); err != nil {
+		t.Fatalf("CmdDone failed: %v", err)
+	}
+
+	events, err := CmdHistory(root, id)
+	if err != nil {
+		t.Fatalf("CmdHistory failed: %v", err)
+	}
+	var types []EventType
+	var lines []string
+	for _, e := range events {
+		if e.ID != id {
+			t.Errorf("History included another task's event: %+v", e)
+		}
+		types = append(types, e.Type)
+		lines = append(lines, DescribeEvent(e))
+	}
+	wantTypes := []EventType{EventCreate, EventStatus, EventDep, EventStatus}
+	if fmt.Sprint(types) != fmt.Sprint(wantTypes) {
+		t.Fatalf("Expected %v, got %v", wantTypes, types)
+	}
+	wantLines := []string{
+		`created "Task"`,
+		"status in_progress (by alice), note by alice: starting",
+		"added dep " + dep,
+		"status done commit abc123",
+	}
+	for i, want := range wantLines {
+		if lines[i] != want {
+			t.Errorf("Event %d: expected %q, got %q", i, want, lines[i])
+		}
+	}
+
+	if _, err := CmdHistory(root, "ffffffff"); err == nil {
+		t.Error("Expected an error for a task with no events")
+	}
+}
+
+func TestLog(t *testing.T) {
+	root := newTestRoot(t)
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	events := []Event{
+		{ID: "a0000001", Type: EventCreate, Timestamp: base, Title: "A"},
+		{ID: "a0000002", Type: EventCreate, Timestamp: base.Add(time.Minute), Title: "B"},
+		{ID: "a0000001", Type: EventStatus, Timestamp: base.Add(2 * time.Minute), Status: StatusInProgress},
+		{ID: "a0000002", Type: EventDep, Timestamp: base.Add(3 * time.Minute), Action: "add", Dep: "a0000001"},
+		{ID: "a0000001", Type: EventStatus, Timestamp: base.Add(4 * time.Minute), Status: StatusDone},
+	}
+	if err := WriteEventsToFile(root, "2026-01-01.jsonl", events); err != nil {
+		t.Fatalf("WriteEventsToFile failed: %v", err)
+	}
+
+	log, err := CmdLog(root, time.Time{}, 0, "")
+	if err != nil {
+		t.Fatalf("CmdLog failed: %v", err)
+	}
+	if len(log) != len(events) {
+		t.Fatalf("Expected %d events, got %d", len(events), len(log))
+	}
+	for i := range log {
+		if want := events[len(events)-1-i]; !log[i].Timestamp.Equal(want.Timestamp) {
+			t.Errorf("Event %d: expected %v, got %v (want newest first)", i, want.Timestamp, log[i].Timestamp)
+		}
+	}
+
+	log, err = CmdLog(root, time.Time{}, 2, "")
+	if err != nil {
+		t.Fatalf("CmdLog failed: %v", err)
+	}
+	if len(log) != 2 || log[0].Type != EventStatus || log[1].Type != EventDep {
+		t.Errorf("Expected the two newest events, got %+v", log)
+	}
+
+	log, err = CmdLog(root, base.Add(time.Minute), 0, "")
+	if err != nil {
+		t.Fatalf("CmdLog failed: %v", err)
+	}
+	if len(log) != 4 || log[3].ID != "a0000002" || log[3].Type != EventCreate {
+		t.Errorf("Expected events since B's create, got %+v", log)
+	}
+
+	log, err = CmdLog(root, time.Time{}, 1, "status,dep")
+	if err != nil {
+		t.Fatalf("CmdLog failed: %v", err)
+	}
+	if len(log) != 1 || log[0].Status != StatusDone {
+		t.Errorf("Expected the latest status event, got %+v", log)
+	}
+	log, err = CmdLog(root, time.Time{}, 0, "create")
+	if err != nil {
+		t.Fatalf("CmdLog failed: %v", err)
+	}
+	if len(log) != 2 || log[0].Title != "B" || log[1].Title != "A" {
+		t.Errorf("Expected both creates, newest first, got %+v", log)
+	}
+
+	if _, err := CmdLog(root, time.Time{}, 0, "bogus"); err == nil {
+		t.Error("Expected an error for an unknown event type")
+	}
+}
+
+func TestResolveIDAmbiguityIsSorted(t *testing.T) {
+	tasks := map[string]*Task{
+		"ab000003": {ID: "ab000003"},
+		"ab000001": {ID: "ab000001"},
+		"ab000002": {ID: "ab000002"},
+		"ab000004": {ID: "ab000004", Deleted: true},
+	}
+	want := "ambiguous prefix 'ab' matches 3 tasks: [ab000001 ab000002 ab000003]"
+	for i := 0; i < 20; i++ {
+		_, err := ResolveID(tasks, "ab")
+		if err == nil || err.Error() != want {
+			t.Fatalf("Expected %q, got %v", want, err)
+		}
+	}
+}
+
+func TestResolveIDOrTitle(t *testing.T) {
+	tasks := map[string]*Task{
+		"a1000001": {ID: "a1000001", Title: "Fix login redirect"},
+		"b2000002": {ID: "b2000002", Title: "Add logout button"},
+		"c3000003": {ID: "c3000003", Title: "Log out stale sessions"},
+		"d4000004": {ID: "d4000004", Title: "Fix login on mobile", Deleted: true},
+	}
+
+	// ID prefixes still win
+	if id, err := ResolveIDOrTitle(tasks, "b2"); err != nil || id != "b2000002" {
+		t.Errorf("Expected b2000002, got %q (%v)", id, err)
+	}
+
+	// Unique title substring, case-insensitive, ignoring deleted tasks
+	if id, err := ResolveIDOrTitle(tasks, "FIX LOGIN"); err != nil || id != "a1000001" {
+		t.Errorf("Expected a1000001, got %q (%v)", id, err)
+	}
+
+	if _, err := ResolveIDOrTitle(tasks, "payments"); err == nil || !strings.Contains(err.Error(), "no task found") {
+		t.Errorf("Expected a no-match error, got %v", err)
+	}
+
+	_, err := ResolveIDOrTitle(tasks, "log")
+	if err == nil {
+		t.Fatal("Expected an ambiguity error")
+	}
+	want := "ambiguous title 'log' matches 3 tasks:\n  a1000001 Fix login redirect\n  b2000002 Add logout button\n  c3000003 Log out stale sessions"
+	if err.Error() != want {
+		t.Errorf("Expected %q, got %q", want, err.Error())
+	}
+}
+
+// fakeEditor points $EDITOR at a script that runs body with the file as $1
+func fakeEditor(t *testing.T, body string) {
+	t.Helper()
+	script := filepath.Join(t.TempDir(), "editor.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", script)
+}
+
+func TestEdit(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	root := newTestRoot(t)
+	result, err := CmdCreate(root, "Old title", CreateOptions{Description: "Old description"})
+	if err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	id := result["id"].(string)
+	eventCount := func() int {
+		t.Helper()
+		events, err := LoadAllEvents(root)
+		if err != nil {
+			t.Fatalf("LoadAllEvents failed: %v", err)
+		}
+		return len(events)
+	}
+
+	// Saving without changes records nothing
+	fakeEditor(t, "true")
+	result, err = CmdEdit(root, id)
+	if err != nil {
+		t.Fatalf("CmdEdit failed: %v", err)
+	}
+	if result["status"] != "unchanged" || eventCount() != 1 {
+		t.Errorf("Expected no change, got %v with %d events", result, eventCount())
+	}
+
+	// An empty buffer aborts
+	fakeEditor(t, `: > "$1"`)
+	result, err = CmdEdit(root, id)
+	if err != nil {
+		t.Fatalf("CmdEdit failed: %v", err)
+	}
+	if result["status"] != "aborted" || eventCount() != 1 {
+		t.Errorf("Expected an abort, got %v with %d events", result, eventCount())
+	}
+
+	// Only the fields that changed are recorded
+	fakeEditor(t, `sed -i.bak 's/Old description/New description\
+over two lines/' "$1"`)
+	result, err = CmdEdit(root, id)
+	if err != nil {
+		t.Fatalf("CmdEdit failed: %v", err)
+	}
+	if result["status"] != "updated" || fmt.Sprint(result["changed"]) != "[description]" {
+		t.Errorf("Expected a description update, got %v", result)
+	}
+	events, err := CmdHistory(root, id)
+	if err != nil {
+		t.Fatalf("CmdHistory failed: %v", err)
+	}
+	last := events[len(events)-1]
+	if last.Type != EventUpdate || last.Title != "" || last.Description != "New description\nover two lines" {
+		t.Errorf("Expected an update with only the description, got %+v", last)
+	}
+
+	fakeEditor(t, `printf 'New title\n\nNew description\nover two lines\n`+editScissors+`\n# comment\n' > "$1"`)
+	result, err = CmdEdit(root, id)
+	if err != nil {
+		t.Fatalf("CmdEdit failed: %v", err)
+	}
+	if fmt.Sprint(result["changed"]) != "[title]" {
+		t.Errorf("Expected a title update, got %v", result)
+	}
+	tasks, err := LoadState(root)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if task := tasks[id]; task.Title != "New title" || task.Description != "New description\nover two lines" {
+		t.Errorf("Unexpected task after edits: %+v", task)
+	}
+
+	// A failing editor is an error, not an edit
+	fakeEditor(t, "exit 1")
+	if _, err := CmdEdit(root, id); err == nil {
+		t.Error("Expected an error when the editor fails")
+	}
+}
+
+func TestParseEditBuffer(t *testing.T) {
+	task := &Task{ID: "a0000001", Title: "Title", Description: "Line one\n\nLine two"}
+	title, description, ok := ParseEditBuffer(FormatEditBuffer(task))
+	if !ok || title != task.Title || description != task.Description {
+		t.Errorf("Expected the buffer to round-trip, got %q %q %v", title, description, ok)
+	}
+	if _, _, ok := ParseEditBuffer(FormatEditBuffer(&Task{ID: "a0000001"})); ok {
+		t.Error("Expected a buffer with only the help block to abort")
+	}
+}
+
+func TestParseEditBufferKeepsHashLines(t *testing.T) {
+	task := &Task{
+		ID:          "a0000001",
+		Title:       "#123 follow-up",
+		Description: "# Heading\n\nSee #42.\n\n## Steps\n- one",
+	}
+	title, description, ok := ParseEditBuffer(FormatEditBuffer(task))
+	if !ok || title != task.Title || description != task.Description {
+		t.Errorf("Expected '#' lines above the help block to round-trip, got %q %q %v", title, description, ok)
+	}
+}
+
+func TestTemplateRoundTrip(t *testing.T) {
+	root := newTestRoot(t)
+	dep, err := CmdCreate(root, "Dep", CreateOptions{})
+	if err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	high := PriorityHigh
+	source, err := CmdCreate(root, "Weekly dependency audit", CreateOptions{Deps: []string{dep["id"].(string)}, Labels: []string{"chore"}, Description: "Run the audit", Notes: "first run", Priority: &high})
+	if err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	sourceID := source["id"].(string)
+
+	if _, err := CmdTemplateSave(root, sourceID, "weekly-audit"); err != nil {
+		t.Fatalf("CmdTemplateSave failed: %v", err)
+	}
+	if names, err := ListTemplates(root); err != nil || fmt.Sprint(names) != "[weekly-audit]" {
+		t.Errorf("Expected [weekly-audit], got %v (%v)", names, err)
+	}
+
+	spec, err := LoadTemplate(root, "weekly-audit")
+	if err != nil {
+		t.Fatalf("LoadTemplate failed: %v", err)
+	}
+	if len(spec.Deps) != 0 || spec.Notes != "" || spec.For != "" {
+		t.Errorf("Templates should not carry deps, notes, or a parent: %+v", spec)
+	}
+
+	time.Sleep(time.Millisecond)
+	created, err := CmdCreateFromSpec(root, spec, false)
+	if err != nil {
+		t.Fatalf("CmdCreateFromSpec failed: %v", err)
+	}
+	tasks, err := LoadState(root)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	task, orig := tasks[created["id"].(string)], tasks[sourceID]
+	if task.ID == orig.ID {
+		t.Fatal("Expected a fresh ID")
+	}
+	if task.Title != orig.Title || task.Description != orig.Description || task.Priority != PriorityHigh || fmt.Sprint(task.Labels) != "[chore]" {
+		t.Errorf("Expected the template's fields, got %+v", task)
+	}
+	if len(task.Deps) != 0 || task.Notes != "" || !task.Created.After(orig.Created) {
+		t.Errorf("Expected no deps or notes and a fresh timestamp, got %+v", task)
+	}
+
+	if _, err := LoadTemplate(root, "missing"); err == nil || !strings.Contains(err.Error(), "template not found") {
+		t.Errorf("Expected a not-found error, got %v", err)
+	}
+	if _, err := CmdTemplateSave(root, sourceID, "../escape"); err == nil {
+		t.Error("Expected an invalid template name to be rejected")
+	}
+}
+
+func TestArchiveVersusDelete(t *testing.T) {
+	root := newTestRoot(t)
+	old := time.Now().UTC().AddDate(0, 0, -10)
+	events := []Event{
+		{ID: "a0000001", Type: EventCreate, Timestamp: old, Title: "Archived"},
+		{ID: "a0000001", Type: EventStatus, Timestamp: old.Add(time.Minute), Status: StatusInProgress},
+		{ID: "a0000001", Type: EventStatus, Timestamp: old.Add(2 * time.Minute), Status: StatusDone, Resolution: ResolutionCompleted},
+		{ID: "a0000002", Type: EventCreate, Timestamp: old, Title: "Deleted"},
+		{ID: "a0000002", Type: EventDelete, Timestamp: old.Add(time.Minute)},
+		{ID: "a0000003", Type: EventCreate, Timestamp: old, Title: "Open and archived"},
+		{ID: "a0000004", Type: EventCreate, Timestamp: old, Title: "Visible"},
+	}
+	if err := WriteEventsToFile(root, old.Format("2006-01-02")+".jsonl", events); err != nil {
+		t.Fatalf("WriteEventsToFile failed: %v", err)
+	}
+	for _, id := range []string{"a0000001", "a0000003"} {
+		if _, err := CmdArchive(root, id, "kept for the record"); err != nil {
+			t.Fatalf("CmdArchive failed: %v", err)
+		}
+	}
+	if _, err := CmdArchive(root, "a0000001", ""); err == nil {
+		t.Error("Expected archiving twice to fail")
+	}
+
+	listIDs := func(filter ListFilter) string {
+		t.Helper()
+		result, err := CmdList(root, filter)
+		if err != nil {
+			t.Fatalf("CmdList failed: %v", err)
+		}
+		var ids []string
+		for _, task := range result["tasks"].([]*Task) {
+			ids = append(ids, task.ID)
+		}
+		sort.Strings(ids)
+		return strings.Join(ids, " ")
+	}
+	if got := listIDs(ListFilter{Status: "all"}); got != "a0000004" {
+		t.Errorf("Expected archived and deleted tasks hidden, got %s", got)
+	}
+	if got := listIDs(ListFilter{Status: "all", IncludeArchived: true}); got != "a0000001 a0000003 a0000004" {
+		t.Errorf("Expected archived tasks with --include-archived, got %s", got)
+	}
+	ready, err := CmdReady(root, ListFilter{}, "")
+	if err != nil {
+		t.Fatalf("CmdReady failed: %v", err)
+	}
+	if ready["count"].(int) != 1 {
+		t.Errorf("Expected only the visible task ready, got %v", ready["count"])
+	}
+	graph, err := CmdGraphData(root)
+	if err != nil {
+		t.Fatalf("CmdGraphData failed: %v", err)
+	}
+	if len(graph.Nodes) != 1 || graph.Nodes[0].ID != "a0000004" {
+		t.Errorf("Expected archived tasks out of the graph, got %+v", graph.Nodes)
+	}
+
+	// Prune purges the deleted task but keeps the archived ones, history and
+	// all, even though their archive events are in today's file
+	if _, err := CmdPrune(root, PruneOptions{}); err != nil {
+		t.Fatalf("CmdPrune failed: %v", err)
+	}
+	tasks, err := LoadState(root)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if _, ok := tasks["a0000002"]; ok {
+		t.Error("Expected the deleted task to be purged")
+	}
+	if task := tasks["a0000001"]; task == nil || !task.Archived || task.Status != StatusDone {
+		t.Fatalf("Expected the archived done task to survive prune, got %+v", task)
+	}
+	history, err := CmdHistory(root, "a0000001")
+	if err != nil {
+		t.Fatalf("CmdHistory failed: %v", err)
+	}
+	var types []EventType
+	for _, e := range history {
+		types = append(types, e.Type)
+	}
+	if fmt.Sprint(types) != "[create status status archive]" {
+		t.Errorf("Expected the archived task's full history, got %v", types)
+	}
+	if tasks["a0000003"] == nil || !tasks["a0000003"].Archived {
+		t.Error("Expected the open archived task to survive prune")
+	}
+	assertStateMatches(t, root)
+}
+
+func TestCmdPruneLog(t *testing.T) {
+	root := newTestRoot(t)
+	old := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := []Event{
+		{ID: "a0000001", Timestamp: old, Type: EventCreate, Title: "Open"},
+		{ID: "a0000002", Timestamp: old, Type: EventCreate, Title: "Finished"},
+		{ID: "a0000002", Timestamp: old.Add(time.Hour), Type: EventStatus, Status: StatusDone, Resolution: ResolutionCompleted},
+		{ID: "a0000003", Timestamp: old, Type: EventCreate, Title: `Won't "fix"`},
+		{ID: "a0000003", Timestamp: old.Add(48 * time.Hour), Type: EventStatus, Status: StatusDone, Resolution: ResolutionWontfix},
+	}
+	if err := WriteEventsToFile(root, "2026-01-01.jsonl", events); err != nil {
+		t.Fatalf("WriteEventsToFile failed: %v", err)
+	}
+
+	// A dry run writes nothing
+	if _, err := CmdPrune(root, PruneOptions{DryRun: true, Log: true}); err != nil {
+		t.Fatalf("CmdPrune failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, PruneLog)); !os.IsNotExist(err) {
+		t.Errorf("Expected no prune log after a dry run, got %v", err)
+	}
+
+	if _, err := CmdPrune(root, PruneOptions{Log: true}); err != nil {
+		t.Fatalf("CmdPrune failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(root, PruneLog))
+	if err != nil {
+		t.Fatalf("Reading prune log failed: %v", err)
+	}
+	want := "2026-01-01 a0000002 completed \"Finished\"\n" +
+		"2026-01-03 a0000003 wontfix \"Won't \\\"fix\\\"\"\n"
+	if string(data) != want {
+		t.Errorf("Expected prune log:\n%s\ngot:\n%s", want, data)
+	}
+}
+
+func TestCmdPruneTwiceIsIdempotent(t *testing.T) {
+	root := newTestRoot(t)
+	old := time.Now().UTC().AddDate(0, 0, -3)
+	events := []Event{
+		{ID: "a0000001", Timestamp: old, Type: EventCreate, Title: "Open", Notes: "first"},
+		{ID: "a0000001", Timestamp: old.Add(time.Minute), Type: EventUpdate, Notes: "second", TimeSpent: 15},
+		{ID: "a0000002", Timestamp: old, Type: EventCreate, Title: "Finished"},
+		{ID: "a0000002", Timestamp: old.Add(time.Hour), Type: EventStatus, Status: StatusDone, Resolution: ResolutionCompleted},
+	}
+	if err := WriteEventsToFile(root, old.Format("2006-01-02")+".jsonl", events); err != nil {
+		t.Fatalf("WriteEventsToFile failed: %v", err)
+	}
+
+	if _, err := CmdPrune(root, PruneOptions{}); err != nil {
+		t.Fatalf("First prune failed: %v", err)
+	}
+	first, err := LoadState(root)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if len(first) != 1 || first["a0000001"] == nil {
+		t.Fatalf("Expected only the open task after pruning, got %v", first)
+	}
+
+	if _, err := CmdPrune(root, PruneOptions{}); err != nil {
+		t.Fatalf("Second prune failed: %v", err)
+	}
+	second, err := LoadState(root)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	a, _ := json.Marshal(first)
+	b, _ := json.Marshal(second)
+	if string(a) != string(b) {
+		t.Errorf("Expected a second prune to change nothing:\nfirst:  %s\nsecond: %s", a, b)
+	}
+	assertStateMatches(t, root)
+}
+
+func TestCmdPruneRecoversFromInterruptedSwap(t *testing.T) {
+	setup := func(t *testing.T) (string, string) {
+		root := newTestRoot(t)
+		old := time.Now().UTC().AddDate(0, 0, -3)
+		oldFile := old.Format("2006-01-02") + ".jsonl"
+		if err := WriteEventsToFile(root, oldFile, []Event{
+			{ID: "a0000001", Timestamp: old, Type: EventCreate, Title: "Open"},
+		}); err != nil {
+			t.Fatalf("WriteEventsToFile failed: %v", err)
+		}
+		return root, oldFile
+	}
+	compacted := []byte(`{"id":"a0000001","ts":"2020-01-01T00:00:00Z","type":"create","title":"Open"}` + "\n")
+
+	t.Run("crash before commit rolls back", func(t *testing.T) {
+		root, oldFile := setup(t)
+		// The new compacted file was written, but no journal
+		if err := os.WriteFile(filepath.Join(root, EventsDir, compactedTemp), compacted, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		files, _ := ListEventFiles(root)
+		if strings.Join(files, ",") != oldFile {
+			t.Errorf("Expected only %s before recovery, got %v", oldFile, files)
+		}
+		if err := recoverPrune(root); err != nil {
+			t.Fatalf("recoverPrune failed: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(root, EventsDir, compactedTemp)); !os.IsNotExist(err) {
+			t.Errorf("Expected leftover compacted file to be removed, got %v", err)
+		}
+		tasks, _ := LoadState(root)
+		if len(tasks) != 1 {
+			t.Errorf("Expected 1 task after rollback, got %d", len(tasks))
+		}
+	})
+
+	t.Run("crash after commit rolls forward", func(t *testing.T) {
+		root, oldFile := setup(t)
+		// Journal written, compacted file not yet renamed into place
+		if err := os.WriteFile(filepath.Join(root, EventsDir, compactedTemp), compacted, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, PruneJournal), []byte(`["`+oldFile+`"]`), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// Readers see neither the superseded file nor a half-installed one
+		files, _ := ListEventFiles(root)
+		if len(files) != 0 {
+			t.Errorf("Expected no event files mid-swap, got %v", files)
+		}
+
+		if _, err := CmdPrune(root, PruneOptions{}); err != nil {
+			t.Fatalf("CmdPrune failed: %v", err)
+		}
+		files, _ = ListEventFiles(root)
+		if strings.Join(files, ",") != CompactedFile {
+			t.Errorf("Expected only %s after recovery, got %v", CompactedFile, files)
+		}
+		if _, err := os.Stat(filepath.Join(root, PruneJournal)); !os.IsNotExist(err) {
+			t.Errorf("Expected journal to be removed, got %v", err)
+		}
+		tasks, _ := LoadState(root)
+		if task := tasks["a0000001"]; task == nil || task.Title != "Open" {
+			t.Errorf("Expected task to survive recovery, got %v", tasks)
+		}
+		assertStateMatches(t, root)
+	})
+
+	t.Run("recovery writes the prune log once", func(t *testing.T) {
+		root, oldFile := setup(t)
+		// The first line was appended before the crash, the second wasn't
+		first := `2026-01-01 a0000002 completed "Done"`
+		second := `2026-01-02 a0000003 wontfix "Dropped"`
+		if err := os.WriteFile(filepath.Join(root, PruneLog), []byte(first+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		journal, _ := json.Marshal(pruneJournal{Obsolete: []string{oldFile}, Log: []string{first, second}})
+		if err := os.WriteFile(filepath.Join(root, PruneJournal), journal, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, EventsDir, compactedTemp), compacted, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := recoverPrune(root); err != nil {
+			t.Fatalf("recoverPrune failed: %v", err)
+		}
+		data, err := os.ReadFile(filepath.Join(root, PruneLog))
+		if err != nil {
+			t.Fatalf("Reading prune log failed: %v", err)
+		}
+		if want := first + "\n" + second + "\n"; string(data) != want {
+			t.Errorf("Expected prune log:\n%s\ngot:\n%s", want, data)
+		}
+	})
+}
+
+func TestCmdPruneAllThenAppendSameDay(t *testing.T) {
+	root := newTestRoot(t)
+	old := time.Now().UTC().AddDate(0, 0, -3)
+	if err := WriteEventsToFile(root, old.Format("2006-01-02")+".jsonl", []Event{
+		{ID: "a0000001", Timestamp: old, Type: EventCreate, Title: "Old"},
+	}); err != nil {
+		t.Fatalf("WriteEventsToFile failed: %v", err)
+	}
+	if err := AppendEvent(root, Event{ID: "a0000002", Timestamp: NowISO(), Type: EventCreate, Title: "Today"}); err != nil {
+		t.Fatalf("AppendEvent failed: %v", err)
+	}
+
+	if _, err := CmdPrune(root, PruneOptions{KeepAll: true, All: true}); err != nil {
+		t.Fatalf("CmdPrune failed: %v", err)
+	}
+	files, _ := ListEventFiles(root)
+	if strings.Join(files, ",") != CompactedFile {
+		t.Fatalf("Expected only %s after compacting everything, got %v", CompactedFile, files)
+	}
+
+	// Appending the same day starts a fresh today's file beside the snapshot
+	if err := AppendEvent(root, Event{ID: "a0000002", Timestamp: NowISO(), Type: EventUpdate, Title: "Today, renamed"}); err != nil {
+		t.Fatalf("AppendEvent failed: %v", err)
+	}
+	tasks, err := LoadState(root)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if len(tasks) != 2 || tasks["a0000001"].Title != "Old" || tasks["a0000002"].Title != "Today, renamed" {
+		t.Errorf("Expected both tasks with the new title, got %v", tasks)
+	}
+	assertStateMatches(t, root)
+
+	// Compacting everything again folds the new append in
+	if _, err := CmdPrune(root, PruneOptions{KeepAll: true, All: true}); err != nil {
+		t.Fatalf("Second CmdPrune failed: %v", err)
+	}
+	files, _ = ListEventFiles(root)
+	if strings.Join(files, ",") != CompactedFile {
+		t.Errorf("Expected only %s, got %v", CompactedFile, files)
+	}
+	tasks, _ = LoadState(root)
+	if task := tasks["a0000002"]; task == nil || task.Title != "Today, renamed" {
+		t.Errorf("Expected the renamed task to survive, got %v", tasks)
+	}
+	assertStateMatches(t, root)
+}
+
+func TestCmdDoctorHistoryWarnings(t *testing.T) {
+	root := newTestRoot(t)
+
+	// A 2023 event misfiled under 2024-01-05, and a done task moved back to
+	// in_progress without a reopen
+	fixture := `{"id":"a0000001","ts":"2024-01-05T09:00:00Z","type":"create","title":"Filed right"}
+{"id":"b0000002","ts":"2023-12-30T09:00:00Z","type":"create","title":"Filed wrong"}
+{"id":"a0000001","ts":"2024-01-05T10:00:00Z","type":"status","status":"done","resolution":"completed"}
+{"id":"a0000001","ts":"2024-01-05T11:00:00Z","type":"status","status":"in_progress"}
+{"id":"b0000002","ts":"2024-01-05T10:00:00Z","type":"status","status":"done","resolution":"completed"}
+{"id":"b0000002","ts":"2024-01-05T11:00:00Z","type":"status","status":"open"}
+`
+	if err := os.WriteFile(filepath.Join(root, EventsDir, "2024-01-05.jsonl"), []byte(fixture), 0644); err != nil {
+		t.Fatalf("writing fixture: %v", err)
+	}
+
+	result, err := CmdDoctor(root, false, false)
+	if err != nil {
+		t.Fatalf("CmdDoctor failed: %v", err)
+	}
+	if result["count"].(int) != 0 {
+		t.Errorf("Warnings should not count as issues, got %v", result["issues"])
+	}
+	warnings := result["warnings"].([]DoctorIssue)
+	if len(warnings) != 2 {
+		t.Fatalf("Expected 2 warnings, got %v", warnings)
+	}
+	if w := warnings[0]; w.Type != IssueMisfiledEvent || w.ID != "b0000002" || !strings.Contains(w.Message, "2023-12-30") {
+		t.Errorf("Expected misfiled event warning for b0000002, got %+v", w)
+	}
+	// b0000002 was reopened explicitly, so only a0000001 is flagged
+	if w := warnings[1]; w.Type != IssueImplicitReopen || w.ID != "a0000001" {
+		t.Errorf("Expected implicit reopen warning for a0000001, got %+v", w)
+	}
+
+	// Compacted files hold events from any day
+	if err := os.Rename(filepath.Join(root, EventsDir, "2024-01-05.jsonl"), filepath.Join(root, EventsDir, CompactedFile)); err != nil {
+		t.Fatal(err)
+	}
+	result, _ = CmdDoctor(root, false, false)
+	for _, w := range result["warnings"].([]DoctorIssue) {
+		if w.Type == IssueMisfiledEvent {
+			t.Errorf("Expected no misfiled warnings for %s, got %+v", CompactedFile, w)
+		}
+	}
+}
+
+func TestWriteTasksJSONL(t *testing.T) {
+	root := newTestRoot(t)
+	for _, title := range []string{"First", "Second\nwith a newline", "Third"} {
+		if _, err := CmdCreate(root, title, CreateOptions{}); err != nil {
+			t.Fatalf("CmdCreate failed: %v", err)
+		}
+	}
+	result, err := CmdList(root, ListFilter{Status: "open"})
+	if err != nil {
+		t.Fatalf("CmdList failed: %v", err)
+	}
+	tasks := result["tasks"].([]*Task)
+
+	var buf strings.Builder
+	if err := WriteTasksJSONL(&buf, root, tasks); err != nil {
+		t.Fatalf("WriteTasksJSONL failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(tasks) {
+		t.Fatalf("Expected %d lines, got %d:\n%s", len(tasks), len(lines), buf.String())
+	}
+	for i, line := range lines {
+		var task Task
+		if err := json.Unmarshal([]byte(line), &task); err != nil {
+			t.Fatalf("Line %d doesn't parse as a Task: %v\n%s", i+1, err, line)
+		}
+		if task.ID != tasks[i].ID || task.Title != tasks[i].Title {
+			t.Errorf("Line %d: expected %s %q, got %s %q", i+1, tasks[i].ID, tasks[i].Title, task.ID, task.Title)
+		}
+		if !strings.Contains(line, `"ready":true`) {
+			t.Errorf("Line %d: expected ready open task, got %s", i+1, line)
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	root := newTestRoot(t)
+	created, err := CmdCreate(root, "Existing", CreateOptions{Labels: []string{"api"}})
+	if err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	id := created["id"].(string)
+
+	do := func(h http.Handler, method, path, body string) (int, map[string]interface{}) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		var result map[string]interface{}
+		if rec.Code != http.StatusMethodNotAllowed {
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatalf("%s %s: invalid JSON %q: %v", method, path, rec.Body.String(), err)
+			}
+		}
+		return rec.Code, result
+	}
+
+	readOnly := NewServer(root, false)
+	code, result := do(readOnly, "GET", "/tasks?label=api", "")
+	if code != http.StatusOK {
+		t.Fatalf("GET /tasks: expected 200, got %d %v", code, result)
+	}
+	if tasks := result["tasks"].([]interface{}); len(tasks) != 1 || tasks[0].(map[string]interface{})["ready"] != true {
+		t.Errorf("GET /tasks: expected one ready task, got %v", tasks)
+	}
+	if code, result = do(readOnly, "GET", "/tasks?status=bogus", ""); code != http.StatusBadRequest || result["error"] == nil {
+		t.Errorf("GET /tasks with a bad status: expected 400 with an error, got %d %v", code, result)
+	}
+
+	code, result = do(readOnly, "GET", "/tasks/"+id[:4], "")
+	if code != http.StatusOK || result["task"].(map[string]interface{})["id"] != id {
+		t.Errorf("GET /tasks/{prefix}: expected task %s, got %d %v", id, code, result)
+	}
+	if code, _ = do(readOnly, "GET", "/tasks/ffffffff", ""); code != http.StatusNotFound {
+		t.Errorf("GET /tasks/{missing}: expected 404, got %d", code)
+	}
+
+	if code, result = do(readOnly, "GET", "/ready", ""); code != http.StatusOK || result["count"] != float64(1) {
+		t.Errorf("GET /ready: expected 1 task, got %d %v", code, result)
+	}
+
+	// Mutations need write
+	if code, _ = do(readOnly, "POST", "/tasks", `{"title": "Nope"}`); code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /tasks read-only: expected 405, got %d", code)
+	}
+
+	readWrite := NewServer(root, true)
+	code, result = do(readWrite, "POST", "/tasks", `{"title": "From API", "deps": ["`+id[:4]+`"]}`)
+	if code != http.StatusCreated {
+		t.Fatalf("POST /tasks: expected 201, got %d %v", code, result)
+	}
+	tasks, _ := LoadState(root)
+	if task := tasks[result["id"].(string)]; task == nil || task.Title != "From API" || len(task.Deps) != 1 || task.Deps[0] != id {
+		t.Errorf("POST /tasks: expected new task depending on %s, got %+v", id, task)
+	}
+	if code, result = do(readWrite, "POST", "/tasks", `{"name": "unknown field"}`); code != http.StatusBadRequest {
+		t.Errorf("POST /tasks with a bad spec: expected 400, got %d %v", code, result)
+	}
+}
+
+func TestServeMCP(t *testing.T) {
+	root := newTestRoot(t)
+	created, err := CmdCreate(root, "Wire up MCP", CreateOptions{})
+	if err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	id := created["id"].(string)
+
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"test","version":"0"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":"three","method":"tools/call","params":{"name":"list_ready","arguments":{}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"claim","arguments":{"id":"` + id[:4] + `","by":"agent"}}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"claim","arguments":{"id":"` + id + `"}}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"tools/call","params":{"name":"mark_done","arguments":{"id":"` + id + `","resolution":"bogus"}}}`,
+		`{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"show"}}`,
+		`{"jsonrpc":"2.0","id":8,"method":"tools/call","params":{"name":"nope","arguments":{}}}`,
+		`{"jsonrpc":"2.0","id":9,"method":"resources/list"}`,
+		`{not json`,
+		`{"id":10,"method":"ping"}`,
+		`{"jsonrpc":"2.0","id":11,"method":"ping"}`,
+	}, "\n") + "\n"
+
+	var out strings.Builder
+	if err := ServeMCP(root, "", strings.NewReader(input), &out); err != nil {
+		t.Fatalf("ServeMCP failed: %v", err)
+	}
+
+	type response struct {
+		ID     json.RawMessage `json:"id"`
+		Result struct {
+			ProtocolVersion string `json:"protocolVersion"`
+			Tools           []struct {
+				Name        string                 `json:"name"`
+				InputSchema map[string]interface{} `json:"inputSchema"`
+			} `json:"tools"`
+			Content []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"content"`
+			IsError bool `json:"isError"`
+		} `json:"result"`
+		Error *struct {
+			Code int `json:"code"`
+		} `json:"error"`
+	}
+	var responses []response
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		var r response
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("Response isn't JSON: %v\n%s", err, line)
+		}
+		responses = append(responses, r)
+	}
+	// Every request but the notification gets exactly one response, in order
+	if len(responses) != 12 {
+		t.Fatalf("Expected 12 responses, got %d:\n%s", len(responses), out.String())
+	}
+	wantIDs := []string{"1", "2", `"three"`, "4", "5", "6", "7", "8", "9", "null", "10", "11"}
+	for i, r := range responses {
+		if string(r.ID) != wantIDs[i] {
+			t.Errorf("Response %d: expected id %s, got %s", i, wantIDs[i], r.ID)
+		}
+	}
+
+	if v := responses[0].Result.ProtocolVersion; v != "2024-11-05" {
+		t.Errorf("initialize: expected the client's protocol version, got %q", v)
+	}
+
+	var names []string
+	for _, tool := range responses[1].Result.Tools {
+		names = append(names, tool.Name)
+		if tool.InputSchema["type"] != "object" {
+			t.Errorf("tools/list: %s schema should be an object, got %v", tool.Name, tool.InputSchema)
+		}
+	}
+	if strings.Join(names, ",") != "list,list_ready,show,prime,claim,create_task,mark_done" {
+		t.Errorf("tools/list: unexpected tools %v", names)
+	}
+
+	if r := responses[2].Result; r.IsError || !strings.Contains(r.Content[0].Text, id) {
+		t.Errorf("list_ready: expected the task in the result, got %+v", r)
+	}
+	if r := responses[3].Result; r.IsError || !strings.Contains(r.Content[0].Text, `"in_progress"`) {
+		t.Errorf("claim: expected success, got %+v", r)
+	}
+	tasks, _ := LoadState(root)
+	if task := tasks[id]; task.Status != StatusInProgress || task.Assignee != "agent" {
+		t.Errorf("claim: expected task in progress for agent, got %s %q", task.Status, task.Assignee)
+	}
+
+	// Tool failures are results with isError, not protocol errors
+	for i, want := range map[int]string{4: "can only claim open tasks", 5: "invalid resolution", 6: "missing required argument 'id'"} {
+		r := responses[i]
+		if r.Error != nil || !r.Result.IsError || !strings.Contains(r.Result.Content[0].Text, want) {
+			t.Errorf("Response %d: expected tool error containing %q, got %+v", i, want, r)
+		}
+	}
+
+	for i, code := range map[int]int{7: -32602, 8: -32601, 9: -32700, 10: -32600} {
+		if r := responses[i]; r.Error == nil || r.Error.Code != code {
+			t.Errorf("Response %d: expected error code %d, got %+v", i, code, r.Error)
+		}
+	}
+	if r := responses[11]; r.Error != nil {
+		t.Errorf("ping: expected success, got %+v", r.Error)
+	}
+}
+
+func TestWatchEvents(t *testing.T) {
+	root := newTestRoot(t)
+	if _, err := CmdCreate(root, "Before watching", CreateOptions{}); err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan struct{}, 10)
+	done := make(chan error)
+	go func() {
+		done <- WatchEvents(ctx, root, 5*time.Millisecond, func() { changes <- struct{}{} })
+	}()
+	expectChange := func(what string) {
+		t.Helper()
+		select {
+		case <-changes:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected a change after %s", what)
+		}
+	}
+
+	// Let the watcher take its first look before changing anything
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case <-changes:
+		t.Fatal("Expected no change before anything was appended")
+	default:
+	}
+
+	if _, err := CmdCreate(root, "While watching", CreateOptions{}); err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	expectChange("an append")
+
+	// Day rollover: a new date file appears
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1)
+	if err := WriteEventsToFile(root, tomorrow.Format("2006-01-02")+".jsonl", []Event{
+		{ID: "a0000001", Timestamp: tomorrow, Type: EventCreate, Title: "Tomorrow"},
+	}); err != nil {
+		t.Fatalf("WriteEventsToFile failed: %v", err)
+	}
+	expectChange("a new day's file")
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("WatchEvents returned %v", err)
+	}
+}
+
+func TestCmdBulkContinuesPastFailures(t *testing.T) {
+	root := newTestRoot(t)
+	var ids []string
+	for _, title := range []string{"One", "Two", "Three"} {
+		result, err := CmdCreate(root, title, CreateOptions{})
+		if err != nil {
+			t.Fatalf("CmdCreate failed: %v", err)
+		}
+		ids = append(ids, result["id"].(string))
+	}
+	done := func(id string) (map[string]interface{}, error) {
+		return CmdDone(root, id, ResolutionWontfix, "", "")
+	}
+
+	result, err := CmdBulk(root, []string{ids[0], "zzzzzzzz", ids[2][:4]}, done)
+	if err != nil {
+		t.Fatalf("CmdBulk failed: %v", err)
+	}
+	if result["ok"] != 2 || result["failed"] != 1 {
+		t.Errorf("Expected 2 ok and 1 failed, got %v", result)
+	}
+	items := result["items"].([]BulkItem)
+	if items[1].Input != "zzzzzzzz" || items[1].ID != "" || !strings.Contains(items[1].Error, "no task found") {
+		t.Errorf("Expected the middle item to fail to resolve, got %+v", items[1])
+	}
+	if items[2].ID != ids[2] || items[2].Result["resolution"] != ResolutionWontfix {
+		t.Errorf("Expected the last item to be resolved and closed, got %+v", items[2])
+	}
+
+	tasks, _ := LoadState(root)
+	for i, want := range []TaskStatus{StatusDone, StatusOpen, StatusDone} {
+		if got := tasks[ids[i]].Status; got != want {
+			t.Errorf("Task %d: expected %s, got %s", i, want, got)
+		}
+	}
+
+	// An op that fails for one task doesn't stop the others either
+	result, err = CmdBulk(root, ids, func(id string) (map[string]interface{}, error) {
+		return CmdClaim(root, id, "", "")
+	})
+	if err != nil {
+		t.Fatalf("CmdBulk failed: %v", err)
+	}
+	items = result["items"].([]BulkItem)
+	if result["failed"] != 2 || items[1].Error != "" || !strings.Contains(items[0].Error, "can only claim open tasks") {
+		t.Errorf("Expected only the open task to be claimed, got %+v", items)
+	}
+}
+
+func TestCmdMove(t *testing.T) {
+	root := newTestRoot(t)
+	now := time.Now().UTC()
+	var events []Event
+	for i, id := range []string{"a0000001", "b0000002", "c0000003", "d0000004"} {
+		events = append(events, Event{ID: id, Timestamp: now.Add(time.Duration(i-4) * time.Minute), Type: EventCreate, Title: id})
+	}
+	events = append(events, Event{ID: "e0000005", Timestamp: now.Add(-time.Hour), Type: EventCreate, Title: "High", Priority: func() *Priority { p := PriorityHigh; return &p }()})
+	if err := AppendEvents(root, events); err != nil {
+		t.Fatalf("AppendEvents failed: %v", err)
+	}
+
+	readyOrder := func() string {
+		t.Helper()
+		result, err := CmdReady(root, ListFilter{}, "")
+		if err != nil {
+			t.Fatalf("CmdReady failed: %v", err)
+		}
+		var ids []string
+		for _, task := range result["tasks"].([]*Task) {
+			if task.Priority == PriorityMedium {
+				ids = append(ids, task.ID[:1])
+			}
+		}
+		return strings.Join(ids, "")
+	}
+	if got := readyOrder(); got != "abcd" {
+		t.Fatalf("Expected created order abcd, got %s", got)
+	}
+
+	// d before b: a and b get placed first, then d ahead of b
+	if _, err := CmdMove(root, "d0000004", "b0000002", false); err != nil {
+		t.Fatalf("CmdMove failed: %v", err)
+	}
+	if got := readyOrder(); got != "adbc" {
+		t.Errorf("Expected adbc after moving d before b, got %s", got)
+	}
+
+	// Insert a between d and b
+	if _, err := CmdMove(root, "a0000001", "d0000004", true); err != nil {
+		t.Fatalf("CmdMove failed: %v", err)
+	}
+	if got := readyOrder(); got != "dabc" {
+		t.Errorf("Expected dabc after moving a after d, got %s", got)
+	}
+	tasks, _ := LoadState(root)
+	if d, a, b := tasks["d0000004"].Order, tasks["a0000001"].Order, tasks["b0000002"].Order; !(d < a && a < b) {
+		t.Errorf("Expected a's order between d and b, got d=%g a=%g b=%g", d, a, b)
+	}
+
+	// Order survives compaction, and list (newest first) still puts moved tasks first
+	if _, err := CmdPrune(root, PruneOptions{KeepAll: true, All: true}); err != nil {
+		t.Fatalf("CmdPrune failed: %v", err)
+	}
+	if got := readyOrder(); got != "dabc" {
+		t.Errorf("Expected dabc after compaction, got %s", got)
+	}
+	result, _ := CmdList(root, ListFilter{Status: "open", Priority: "medium"})
+	var listed []string
+	for _, task := range result["tasks"].([]*Task) {
+		listed = append(listed, task.ID[:1])
+	}
+	if got := strings.Join(listed, ""); got != "dabc" {
+		t.Errorf("Expected list order dabc, got %s", got)
+	}
+
+	// Repeatedly splitting one gap eventually renumbers instead of colliding
+	for i := 0; i < 60; i++ {
+		mover, anchor := "c0000003", "a0000001"
+		if i%2 == 1 {
+			mover, anchor = "a0000001", "c0000003"
+		}
+		if _, err := CmdMove(root, mover, anchor, true); err != nil {
+			t.Fatalf("CmdMove %d failed: %v", i, err)
+		}
+	}
+	if got := readyOrder(); got != "dcab" {
+		t.Errorf("Expected dcab after repeated moves, got %s", got)
+	}
+
+	if _, err := CmdMove(root, "a0000001", "e0000005", false); err == nil || !strings.Contains(err.Error(), "priorities differ") {
+		t.Errorf("Expected an error moving across priorities, got %v", err)
+	}
+	assertStateMatches(t, root)
+}
+
+func TestDepProgress(t *testing.T) {
+	root := newTestRoot(t)
+	now := time.Now().UTC().Add(-time.Hour)
+	events := []Event{
+		{ID: "a0000001", Timestamp: now, Type: EventCreate, Title: "Dep A"},
+		{ID: "b0000002", Timestamp: now, Type: EventCreate, Title: "Dep B"},
+		{ID: "c0000003", Timestamp: now, Type: EventCreate, Title: "Dep C"},
+		{ID: "p0000004", Timestamp: now.Add(time.Second), Type: EventCreate, Title: "Parent", Deps: []string{"a0000001", "b0000002", "c0000003", "gone0000"}},
+		{ID: "n0000005", Timestamp: now, Type: EventCreate, Title: "No deps"},
+		{ID: "a0000001", Timestamp: now.Add(2 * time.Second), Type: EventStatus, Status: StatusDone},
+		{ID: "c0000003", Timestamp: now.Add(2 * time.Second), Type: EventDelete},
+	}
+	if err := AppendEvents(root, events); err != nil {
+		t.Fatalf("AppendEvents failed: %v", err)
+	}
+
+	tasks, err := LoadState(root)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	// The deleted and missing deps don't count
+	if done, total := DepProgress(tasks, "p0000004"); done != 1 || total != 2 {
+		t.Errorf("Expected 1/2, got %d/%d", done, total)
+	}
+	if _, total := DepProgress(tasks, "n0000005"); total != 0 {
+		t.Errorf("Expected no progress for a task without deps, got total %d", total)
+	}
+
+	result, err := CmdShow(root, "p0000004", false)
+	if err != nil {
+		t.Fatalf("CmdShow failed: %v", err)
+	}
+	progress, ok := result["progress"].(map[string]int)
+	if !ok || progress["done"] != 1 || progress["total"] != 2 {
+		t.Errorf("Expected progress 1/2, got %v", result["progress"])
+	}
+
+	if err := AppendEvents(root, []Event{{ID: "b0000002", Timestamp: now.Add(3 * time.Second), Type: EventStatus, Status: StatusDone}}); err != nil {
+		t.Fatalf("AppendEvents failed: %v", err)
+	}
+	result, err = CmdShow(root, "p0000004", false)
+	if err != nil {
+		t.Fatalf("CmdShow failed: %v", err)
+	}
+	progress = result["progress"].(map[string]int)
+	if progress["done"] != 2 || progress["total"] != 2 {
+		t.Errorf("Expected progress 2/2, got %v", progress)
+	}
+
+	result, err = CmdShow(root, "n0000005", false)
+	if err != nil {
+		t.Fatalf("CmdShow failed: %v", err)
+	}
+	if _, ok := result["progress"]; ok {
+		t.Errorf("Expected no progress for a task without deps, got %v", result["progress"])
+	}
+}
+
+func TestFindCycles(t *testing.T) {
+	now := time.Now().UTC()
+	// A stored cycle, as a bad merge could leave behind: A -> B -> C -> A
+	events := []Event{
+		{ID: "a0000001", Timestamp: now, Type: EventCreate, Title: "A", Deps: []string{"b0000002"}},
+		{ID: "b0000002", Timestamp: now, Type: EventCreate, Title: "B", Deps: []string{"c0000003"}},
+		{ID: "c0000003", Timestamp: now, Type: EventCreate, Title: "C", Deps: []string{"a0000001"}},
+		{ID: "d0000004", Timestamp: now, Type: EventCreate, Title: "D", Deps: []string{"a0000001"}},
+	}
+
+	cycles := FindCycles(ComputeState(events))
+	if len(cycles) != 1 {
+		t.Fatalf("Expected 1 cycle, got %v", cycles)
+	}
+	if got := strings.Join(cycles[0], ","); got != "a0000001,b0000002,c0000003" {
+		t.Errorf("Expected cycle a0000001,b0000002,c0000003, got %s", got)
+	}
+
+	root := newTestRoot(t)
+	if err := AppendEvents(root, events); err != nil {
+		t.Fatalf("AppendEvents failed: %v", err)
+	}
+	result, err := CmdDoctor(root, false, false)
+	if err != nil {
+		t.Fatalf("CmdDoctor failed: %v", err)
+	}
+	found := false
+	for _, issue := range result["issues"].([]DoctorIssue) {
+		if issue.Type == IssueCycle && issue.ID == "a0000001" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected doctor to report the cycle, got %v", result["issues"])
+	}
+}
+
+func TestCmdDoctorFixesEveryCycle(t *testing.T) {
+	now := time.Now().UTC()
+	// Two separate cycles, e <-> f and g -> h -> i -> g, plus one through a
+	// deleted task, which isn't part of the graph
+	events := []Event{
+		{ID: "e0000001", Timestamp: now, Type: EventCreate, Title: "E", Deps: []string{"f0000002"}},
+		{ID: "f0000002", Timestamp: now, Type: EventCreate, Title: "F", Deps: []string{"e0000001"}},
+		{ID: "g0000003", Timestamp: now, Type: EventCreate, Title: "G", Deps: []string{"h0000004"}},
+		{ID: "h0000004", Timestamp: now, Type: EventCreate, Title: "H", Deps: []string{"i0000005"}},
+		{ID: "i0000005", Timestamp: now, Type: EventCreate, Title: "I", Deps: []string{"g0000003"}},
+		{ID: "j0000006", Timestamp: now, Type: EventCreate, Title: "J", Deps: []string{"k0000007"}},
+		{ID: "k0000007", Timestamp: now, Type: EventCreate, Title: "K", Deps: []string{"j0000006"}},
+		{ID: "k0000007", Timestamp: now.Add(time.Second), Type: EventDelete},
+	}
+
+	cycles := FindCycles(ComputeState(events))
+	var got []string
+	for _, cycle := range cycles {
+		got = append(got, strings.Join(cycle, ","))
+	}
+	sort.Strings(got)
+	if want := "e0000001,f0000002 g0000003,h0000004,i0000005"; strings.Join(got, " ") != want {
+		t.Errorf("Expected cycles %s, got %v", want, got)
+	}
+
+	root := newTestRoot(t)
+	if err := AppendEvents(root, events); err != nil {
+		t.Fatalf("AppendEvents failed: %v", err)
+	}
+	if _, err := CmdDoctor(root, true, false); err != nil {
+		t.Fatalf("CmdDoctor fix failed: %v", err)
+	}
+	tasks, err := LoadState(root)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if cycles := FindCycles(tasks); len(cycles) != 0 {
+		t.Errorf("Expected every cycle broken, got %v", cycles)
+	}
+	result, err := CmdDoctor(root, false, false)
+	if err != nil {
+		t.Fatalf("CmdDoctor failed: %v", err)
+	}
+	if result["count"].(int) != 0 {
+		t.Errorf("Expected no issues after fix, got %v", result["issues"])
+	}
+}
+
+func TestCmdMergeRemapsCollidingIDs(t *testing.T) {
+	ours := newTestRoot(t)
+	theirs := newTestRoot(t)
+	base := time.Now().UTC().Add(-48 * time.Hour)
+
+	// Shared history from before the two logs diverged
+	shared := Event{ID: "s0000001", Timestamp: base, Type: EventCreate, Title: "Shared"}
+	for _, root := range []string{ours, theirs} {
+		if err := AppendEvents(root, []Event{shared}); err != nil {
+			t.Fatalf("AppendEvents failed: %v", err)
+		}
+	}
+	if err := AppendEvents(ours, []Event{
+		{ID: "a0000001", Timestamp: base.Add(time.Hour), Type: EventCreate, Title: "Ours"},
+	}); err != nil {
+		t.Fatalf("AppendEvents failed: %v", err)
+	}
+	if err := AppendEvents(theirs, []Event{
+		{ID: "a0000001", Timestamp: base.Add(2 * time.Hour), Type: EventCreate, Title: "Theirs"},
+		{ID: "b0000002", Timestamp: base.Add(3 * time.Hour), Type: EventCreate, Title: "Needs theirs", Deps: []string{"a0000001"}},
+		{ID: "a0000001", Timestamp: base.Add(4 * time.Hour), Type: EventStatus, Status: StatusDone},
+	}); err != nil {
+		t.Fatalf("AppendEvents failed: %v", err)
+	}
+
+	result, err := CmdMerge(ours, theirs, false)
+	if err != nil {
+		t.Fatalf("CmdMerge failed: %v", err)
+	}
+	if result["merged"] != 3 || result["skipped"] != 1 {
+		t.Errorf("Expected 3 merged and 1 skipped, got %v", result)
+	}
+	newID := result["remapped"].(map[string]string)["a0000001"]
+	if newID == "" || newID == "a0000001" {
+		t.Fatalf("Expected a0000001 to be remapped, got %v", result["remapped"])
+	}
+
+	tasks, err := LoadState(ours)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if len(tasks) != 4 {
+		t.Errorf("Expected 4 tasks, got %d", len(tasks))
+	}
+	if tasks["a0000001"].Title != "Ours" || tasks["a0000001"].Status != StatusOpen {
+		t.Errorf("Expected our a0000001 untouched, got %q %s", tasks["a0000001"].Title, tasks["a0000001"].Status)
+	}
+	if task := tasks[newID]; task == nil || task.Title != "Theirs" || task.Status != StatusDone {
+		t.Errorf("Expected their task done under %s, got %+v", newID, task)
+	}
+	if deps := tasks["b0000002"].Deps; len(deps) != 1 || deps[0] != newID {
+		t.Errorf("Expected b0000002 to depend on %s, got %v", newID, deps)
+	}
+
+	// Merging the same log again adds nothing
+	result, err = CmdMerge(ours, theirs, false)
+	if err != nil {
+		t.Fatalf("CmdMerge failed: %v", err)
+	}
+	if result["merged"] != 0 {
+		t.Errorf("Expected a second merge to add nothing, got %v", result)
+	}
+	if tasks, _ = LoadState(ours); len(tasks) != 4 {
+		t.Errorf("Expected 4 tasks after merging twice, got %d", len(tasks))
+	}
+}
+
+func TestCmdMergeComparesWholeCreates(t *testing.T) {
+	ours := newTestRoot(t)
+	theirs := newTestRoot(t)
+	at := time.Now().UTC().Add(-time.Hour)
+
+	// Same ID, title, and time, but different tasks
+	if err := AppendEvents(ours, []Event{
+		{ID: "a0000001", Timestamp: at, Type: EventCreate, Title: "Same", Description: "Ours"},
+	}); err != nil {
+		t.Fatalf("AppendEvents failed: %v", err)
+	}
+	if err := AppendEvents(theirs, []Event{
+		{ID: "a0000001", Timestamp: at, Type: EventCreate, Title: "Same", Description: "Theirs"},
+	}); err != nil {
+		t.Fatalf("AppendEvents failed: %v", err)
+	}
+
+	result, err := CmdMerge(ours, theirs, false)
+	if err != nil {
+		t.Fatalf("CmdMerge failed: %v", err)
+	}
+	newID := result["remapped"].(map[string]string)["a0000001"]
+	if newID == "" {
+		t.Fatalf("Expected a0000001 to be remapped, got %v", result)
+	}
+	tasks, err := LoadState(ours)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if tasks["a0000001"].Description != "Ours" || tasks[newID] == nil || tasks[newID].Description != "Theirs" {
+		t.Errorf("Expected both tasks kept, got %+v and %+v", tasks["a0000001"], tasks[newID])
+	}
+
+	if result, err = CmdMerge(ours, theirs, false); err != nil || result["merged"] != 0 {
+		t.Errorf("Expected a second merge to add nothing, got %v (%v)", result, err)
+	}
+}
+
+func TestParseCommitLog(t *testing.T) {
+	fixture := "1111111aaaa\x00Fix login\n\nCloses: a0000001\n\x1e\n" +
+		"2222222bbbb\x00Refactor\n\nNo trailers here\n\x1e\n" +
+		"3333333cccc\x00Tidy up\n\ncloses: b0000002, c0000003\nSigned-off-by: Someone\n\x1e"
+
+	var got []string
+	for _, c := range parseCommitLog(fixture) {
+		got = append(got, c.Commit[:1]+":"+c.Ref)
+	}
+	if want := "1:a0000001 3:b0000002 3:c0000003"; strings.Join(got, " ") != want {
+		t.Errorf("Expected %s, got %s", want, strings.Join(got, " "))
+	}
+}
+
+func TestCmdScanCommits(t *testing.T) {
+	root := newGitTestRoot(t)
+	dir := filepath.Dir(root)
+	now := time.Now().UTC().Add(-time.Hour)
+	if err := AppendEvents(root, []Event{
+		{ID: "a0000001", Timestamp: now, Type: EventCreate, Title: "Open task"},
+		{ID: "b0000002", Timestamp: now, Type: EventCreate, Title: "Finished task", Status: StatusDone},
+	}); err != nil {
+		t.Fatalf("AppendEvents failed: %v", err)
+	}
+	commit := func(message string) string {
+		t.Helper()
+		if out, err := exec.Command("git", "-C", dir, "commit", "--allow-empty", "-m", message).CombinedOutput(); err != nil {
+			t.Fatalf("git commit failed: %v: %s", err, out)
+		}
+		out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+		if err != nil {
+			t.Fatalf("git rev-parse failed: %v", err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	sha := commit("Fix it\n\nCloses: a0000001, b0000002, zzzz9999")
+
+	result, err := CmdScanCommits(root, false)
+	if err != nil {
+		t.Fatalf("CmdScanCommits failed: %v", err)
+	}
+	closed := result["closed"].([]map[string]interface{})
+	if len(closed) != 1 || closed[0]["id"] != "a0000001" || closed[0]["commit"] != sha {
+		t.Errorf("Expected a0000001 closed by %s, got %v", sha, closed)
+	}
+	if skipped := result["skipped"].([]string); len(skipped) != 1 || skipped[0] != "b0000002" {
+		t.Errorf("Expected already-done b0000002 skipped, got %v", skipped)
+	}
+	if warnings := result["warnings"].([]string); len(warnings) != 1 || !strings.Contains(warnings[0], "zzzz9999") {
+		t.Errorf("Expected a warning for the unknown ID, got %v", warnings)
+	}
+
+	tasks, err := LoadState(root)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if task := tasks["a0000001"]; task.Status != StatusDone || task.Commit != sha {
+		t.Errorf("Expected a0000001 done with commit %s, got %s %q", sha, task.Status, task.Commit)
+	}
+
+	// Only commits since the last scan are read
+	commit("Unrelated change")
+	result, err = CmdScanCommits(root, false)
+	if err != nil {
+		t.Fatalf("CmdScanCommits failed: %v", err)
+	}
+	if result["commits"] != 1 || len(result["warnings"].([]string)) != 0 {
+		t.Errorf("Expected only the new commit scanned, got %v", result)
+	}
+}
+
+func TestCmdListParent(t *testing.T) {
+	root := newTestRoot(t)
+	now := time.Now().UTC().Add(-time.Hour)
+	priority := func(p Priority) *Priority { return &p }
+	if err := AppendEvents(root, []Event{
+		{ID: "c0000001", Timestamp: now, Type: EventCreate, Title: "Low child", Priority: priority(PriorityLow)},
+		{ID: "c0000002", Timestamp: now.Add(time.Second), Type: EventCreate, Title: "High child", Priority: priority(PriorityHigh)},
+		{ID: "c0000003", Timestamp: now.Add(2 * time.Second), Type: EventCreate, Title: "Medium child"},
+		{ID: "u0000004", Timestamp: now, Type: EventCreate, Title: "Unrelated"},
+		{ID: "p0000005", Timestamp: now.Add(3 * time.Second), Type: EventCreate, Title: "Parent", Deps: []string{"c0000001", "c0000002", "c0000003"}},
+		// A dependent of the parent is not its subtask
+		{ID: "d0000006", Timestamp: now.Add(4 * time.Second), Type: EventCreate, Title: "Needs parent", Deps: []string{"p0000005"}},
+	}); err != nil {
+		t.Fatalf("AppendEvents failed: %v", err)
+	}
+
+	result, err := CmdList(root, ListFilter{Parent: "p000"})
+	if err != nil {
+		t.Fatalf("CmdList failed: %v", err)
+	}
+	var ids []string
+	for _, task := range result["tasks"].([]*Task) {
+		ids = append(ids, task.ID)
+	}
+	if got := strings.Join(ids, ","); got != "c0000002,c0000003,c0000001" {
+		t.Errorf("Expected subtasks by priority c0000002,c0000003,c0000001, got %s", got)
+	}
+	if result["parent"] != "p0000005" {
+		t.Errorf("Expected parent p0000005, got %v", result["parent"])
+	}
+
+	if _, err := CmdList(root, ListFilter{Parent: "zzzz"}); err == nil {
+		t.Error("Expected an error for an unknown parent")
+	}
+}
+
+func TestStoredEventsKeepIntegerPriorities(t *testing.T) {
+	root := newTestRoot(t)
+	high := PriorityHigh
+	event := Event{ID: "a0000001", Timestamp: time.Now().UTC(), Type: EventCreate, Title: "Task", Priority: &high}
+	if err := AppendEvent(root, event); err != nil {
+		t.Fatalf("AppendEvent failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, EventsDir, TodayStr()+".jsonl"))
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if !strings.Contains(string(data), `"priority":1`) {
+		t.Errorf("Expected the stored event to keep an integer priority, got %s", data)
+	}
+
+	// Output still names it
+	tasks, err := LoadState(root)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	out, _ := json.Marshal(tasks["a0000001"])
+	if !strings.Contains(string(out), `"priority":"high"`) {
+		t.Errorf("Expected JSON output to name the priority, got %s", out)
+	}
+}
+
+func TestAppendStampsSchemaVersion(t *testing.T) {
+	root := newTestRoot(t)
+	event := Event{ID: "a0000001", Timestamp: time.Now().UTC(), Type: EventCreate, Title: "Task"}
+
+	// Unversioned and older repos are raised before anything is written
+	for _, version := range []int{0, SchemaVersion - 1} {
+		if err := WriteMeta(root, Meta{SchemaVersion: version}); err != nil {
+			t.Fatalf("WriteMeta failed: %v", err)
+		}
+		if err := AppendEvent(root, event); err != nil {
+			t.Fatalf("AppendEvent failed: %v", err)
+		}
+		if meta, _ := ReadMeta(root); meta.SchemaVersion != SchemaVersion {
+			t.Errorf("Expected schema version %d to be stamped %d, got %d", version, SchemaVersion, meta.SchemaVersion)
+		}
+	}
+
+	// A newer repo is never downgraded
+	if err := WriteMeta(root, Meta{SchemaVersion: SchemaVersion + 1}); err != nil {
+		t.Fatalf("WriteMeta failed: %v", err)
+	}
+	if err := AppendEvent(root, event); err != nil {
+		t.Fatalf("AppendEvent failed: %v", err)
+	}
+	if meta, _ := ReadMeta(root); meta.SchemaVersion != SchemaVersion+1 {
+		t.Errorf("Expected a newer schema version to be kept, got %d", meta.SchemaVersion)
+	}
+}
+
+func TestMCPMarkDoneFollowsVerifyDone(t *testing.T) {
+	root := newGitTestRoot(t)
+	if err := WriteConfig(root, Config{VerifyDone: VerifyDoneRequire}); err != nil {
+		t.Fatalf("WriteConfig failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(filepath.Dir(root), "wip.go"), []byte("package wip\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"create_task","arguments":{"title":"Ship it","priority":"high"}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"mark_done","arguments":{"id":"Ship it"}}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"mark_done","arguments":{"id":"Ship it","resolution":"wontfix"}}}`,
+	}, "\n") + "\n"
+	var out strings.Builder
+	if err := ServeMCP(root, "", strings.NewReader(input), &out); err != nil {
+		t.Fatalf("ServeMCP failed: %v", err)
+	}
+
+	type toolResult struct {
+		Result struct {
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+			IsError bool `json:"isError"`
+		} `json:"result"`
+	}
+	var results []toolResult
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var r toolResult
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("Response isn't JSON: %v\n%s", err, line)
+		}
+		results = append(results, r)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 responses, got %d:\n%s", len(results), out.String())
+	}
+	if results[0].Result.IsError {
+		t.Fatalf("create_task failed: %s", results[0].Result.Content[0].Text)
+	}
+
+	// Completing with a dirty tree is refused, as tlog done would refuse it
+	if r := results[1].Result; !r.IsError || !strings.Contains(r.Content[0].Text, "uncommitted change") {
+		t.Errorf("Expected mark_done to be refused, got %+v", r)
+	}
+	tasks, err := LoadState(root)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	var task *Task
+	for _, candidate := range tasks {
+		task = candidate
+	}
+	if task == nil || task.Priority != PriorityHigh {
+		t.Fatalf("Expected the created task, got %+v", task)
+	}
+
+	// The policy only covers completed tasks
+	if r := results[2].Result; r.IsError {
+		t.Errorf("Expected wontfix to skip verify_done, got %s", r.Content[0].Text)
+	}
+	tasks, _ = LoadState(root)
+	if task = tasks[task.ID]; task.Status != StatusDone || task.Resolution != ResolutionWontfix {
+		t.Errorf("Expected the task closed as wontfix, got %s %s", task.Status, task.Resolution)
+	}
+}
+
+func TestCmdImportRoundTripsExport(t *testing.T) {
+	src := newTestRoot(t)
+	ids := make(map[string]string)
+	for _, title := range []string{"Live", "Gone", "Shelved", "Blocker"} {
+		result, err := CmdCreate(src, title, CreateOptions{})
+		if err != nil {
+			t.Fatalf("CmdCreate failed: %v", err)
+		}
+		ids[title] = result["id"].(string)
+	}
+	if _, err := CmdAnnotate(src, ids["Live"], "owner", "ops", false); err != nil {
+		t.Fatalf("CmdAnnotate failed: %v", err)
+	}
+	if _, err := CmdBlock(src, ids["Live"], ids["Blocker"], "add"); err != nil {
+		t.Fatalf("CmdBlock failed: %v", err)
+	}
+	if _, err := CmdDelete(src, ids["Gone"], ""); err != nil {
+		t.Fatalf("CmdDelete failed: %v", err)
+	}
+	if _, err := CmdArchive(src, ids["Shelved"], ""); err != nil {
+		t.Fatalf("CmdArchive failed: %v", err)
+	}
+	exported, err := CmdExport(src, true)
+	if err != nil {
+		t.Fatalf("CmdExport failed: %v", err)
+	}
+
+	dst := newTestRoot(t)
+	if _, err := CmdImport(dst, exported, true, false); err != nil {
+		t.Fatalf("CmdImport failed: %v", err)
+	}
+	tasks, err := LoadState(dst)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if !tasks[ids["Gone"]].Deleted {
+		t.Error("Expected the deleted task to stay deleted")
+	}
+	if task := tasks[ids["Shelved"]]; !task.Archived || task.Deleted {
+		t.Errorf("Expected the archived task to stay archived, got archived=%v deleted=%v", task.Archived, task.Deleted)
+	}
+	if got := tasks[ids["Live"]].Annotations["owner"]; got != "ops" {
+		t.Errorf("Expected the annotation to survive, got %q", got)
+	}
+	if blocks := tasks[ids["Blocker"]].Blocks; len(blocks) != 1 || blocks[0] != ids["Live"] {
+		t.Errorf("Expected the blocker to still block Live, got %v", blocks)
+	}
+}
+
+func TestCmdImportChecksAllowedLabels(t *testing.T) {
+	root := newTestRoot(t)
+	if err := WriteConfig(root, Config{AllowedLabels: []string{"bug"}}); err != nil {
+		t.Fatalf("WriteConfig failed: %v", err)
+	}
+	tasks := []*Task{{Title: "Odd", Labels: []string{"whatever"}}}
+
+	if _, err := CmdImport(root, tasks, false, false); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("Expected a disallowed label to reject the import, got %v", err)
+	}
+	if _, err := CmdImport(root, tasks, false, true); err != nil {
+		t.Errorf("Expected force to allow the label, got %v", err)
+	}
+}
+
+func TestCmdRename(t *testing.T) {
+	root := newTestRoot(t)
+	created, err := CmdCreate(root, "Old title", CreateOptions{Description: "Keep me"})
+	if err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	id := created["id"].(string)
+
+	// A unique prefix resolves to the task, as for any <id> argument
+	tasks, _ := LoadState(root)
+	resolved, err := ResolveID(tasks, id[:4])
+	if err != nil || resolved != id {
+		t.Fatalf("Expected prefix %s to resolve to %s, got %q (%v)", id[:4], id, resolved, err)
+	}
+	result, err := CmdRename(root, resolved, "New title")
+	if err != nil {
+		t.Fatalf("CmdRename failed: %v", err)
+	}
+	if result["old_title"] != "Old title" || result["title"] != "New title" {
+		t.Errorf("Expected old and new titles in the result, got %v", result)
+	}
+	tasks, _ = LoadState(root)
+	if task := tasks[id]; task.Title != "New title" || task.Description != "Keep me" {
+		t.Errorf("Expected only the title changed, got %q %q", task.Title, task.Description)
+	}
+
+	for _, title := range []string{"", "   "} {
+		if _, err := CmdRename(root, id, title); err == nil {
+			t.Errorf("Expected renaming to %q to fail", title)
+		}
+	}
+
+	if _, err := CmdDelete(root, id, ""); err != nil {
+		t.Fatalf("CmdDelete failed: %v", err)
+	}
+	if _, err := CmdRename(root, id, "Too late"); err == nil {
+		t.Error("Expected renaming a deleted task to fail")
+	}
+	tasks, _ = LoadState(root)
+	if tasks[id].Title != "New title" {
+		t.Errorf("Expected failed renames to change nothing, got %q", tasks[id].Title)
+	}
+}
+
+func TestGetBlockedTasks(t *testing.T) {
+	now := time.Now().UTC()
+	backlog := PriorityBacklog
+	events := []Event{
+		{ID: "a0000001", Timestamp: now, Type: EventCreate, Title: "Dep"},
+		{ID: "a0000002", Timestamp: now, Type: EventCreate, Title: "Blocked", Deps: []string{"a0000001"}},
+		{ID: "a0000003", Timestamp: now, Type: EventCreate, Title: "Someday", Deps: []string{"a0000001"}, Priority: &backlog},
+		{ID: "a0000004", Timestamp: now, Type: EventCreate, Title: "Missing dep", Deps: []string{"ffffffff"}},
+		{ID: "a0000005", Timestamp: now, Type: EventCreate, Title: "Working", Deps: []string{"a0000001"}},
+		{ID: "a0000005", Timestamp: now.Add(time.Second), Type: EventStatus, Status: StatusInProgress},
+	}
+	tasks := ComputeState(events)
+
+	ids := func(list []*Task) string {
+		var out []string
+		for _, task := range list {
+			out = append(out, task.ID)
+		}
+		sort.Strings(out)
+		return strings.Join(out, ",")
+	}
+	if got := ids(GetBlockedTasks(tasks)); got != "a0000002" {
+		t.Errorf("Expected only a0000002 blocked, got %s", got)
+	}
+
+	// categorizeTasks agrees with the ready and blocked lists
+	inProgress, ready, blocked := categorizeTasks(tasks)
+	if ids(inProgress) != "a0000005" || ids(ready) != ids(GetReadyTasks(tasks)) || ids(blocked) != "a0000002" {
+		t.Errorf("Unexpected categories: in progress %s, ready %s, blocked %s", ids(inProgress), ids(ready), ids(blocked))
+	}
+}
+
+func TestEventTypeListsAgree(t *testing.T) {
+	names := eventTypeNames()
+	types, err := parseEventTypeFilter(strings.Join(names, ","))
+	if err != nil || len(types) != len(AllEventTypes) {
+		t.Errorf("Expected every event type accepted by the filter, got %v (%v)", types, err)
+	}
+	if _, err := parseEventTypeFilter("create,bogus"); err == nil || !strings.Contains(err.Error(), strings.Join(names, ", ")) {
+		t.Errorf("Expected an unknown type to fail listing the valid ones, got %v", err)
+	}
+	if enum := schemaEnums[reflect.TypeOf(EventType(""))]; fmt.Sprint(enum) != fmt.Sprint(names) {
+		t.Errorf("Expected the schema enum to match AllEventTypes, got %v", enum)
+	}
+}
+
+func TestCmdMoveKeepsUnmovedTasksInPlace(t *testing.T) {
+	now := time.Now().UTC()
+	ids := []string{"a0000001", "b0000002", "c0000003", "d0000004", "e0000005"}
+	setup := func(t *testing.T) string {
+		root := newTestRoot(t)
+		var events []Event
+		for i, id := range ids {
+			events = append(events, Event{ID: id, Timestamp: now.Add(time.Duration(i-10) * time.Minute), Type: EventCreate, Title: id})
+		}
+		if err := AppendEvents(root, events); err != nil {
+			t.Fatalf("AppendEvents failed: %v", err)
+		}
+		return root
+	}
+	readyOrder := func(t *testing.T, root string) string {
+		t.Helper()
+		result, err := CmdReady(root, ListFilter{}, "")
+		if err != nil {
+			t.Fatalf("CmdReady failed: %v", err)
+		}
+		var order []string
+		for _, task := range result["tasks"].([]*Task) {
+			order = append(order, task.ID[:1])
+		}
+		return strings.Join(order, "")
+	}
+
+	for _, tc := range []struct {
+		mover, other string
+		after        bool
+		want         string
+	}{
+		{"c0000003", "b0000002", false, "acbde"},
+		{"e0000005", "b0000002", true, "abecd"},
+		{"a0000001", "d0000004", false, "bcade"},
+		{"b0000002", "e0000005", true, "acdeb"},
+	} {
+		root := setup(t)
+		if _, err := CmdMove(root, tc.mover, tc.other, tc.after); err != nil {
+			t.Fatalf("CmdMove failed: %v", err)
+		}
+		if got := readyOrder(t, root); got != tc.want {
+			t.Errorf("Moving %s next to %s (after=%v): expected %s, got %s", tc.mover, tc.other, tc.after, tc.want, got)
+		}
+	}
+}
+
+func TestCmdImportRejectsMalformedPreservedIDs(t *testing.T) {
+	root := newTestRoot(t)
+	tasks := []*Task{{ID: "12", Title: "Short"}}
+	if _, err := CmdImport(root, tasks, true, false); err == nil {
+		t.Fatal("Expected an error for a preserved ID that isn't 8 hex characters")
+	}
+	state, _ := LoadState(root)
+	if len(state) != 0 {
+		t.Errorf("Expected nothing imported, got %d tasks", len(state))
+	}
+}
+
+func TestCmdPrimeHandlesShortDepIDs(t *testing.T) {
+	root := newTestRoot(t)
+	// Logs written before preserved IDs were checked may hold short IDs
+	now := NowISO()
+	if err := AppendEvents(root, []Event{
+		{ID: "12", Timestamp: now, Type: EventCreate, Title: "Short", Status: StatusOpen},
+		{ID: "abcd1234", Timestamp: now, Type: EventCreate, Title: "Waiting", Status: StatusOpen, Deps: []string{"12"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := CmdPrime(root, "")
+	if err != nil {
+		t.Fatalf("CmdPrime failed: %v", err)
+	}
+	if !strings.Contains(out, "(waiting: 12)") {
+		t.Errorf("Expected the short dep ID in the blocked line, got:\n%s", out)
+	}
+}
+
+// schemaErrors lists where value breaks schema. It covers the keywords
+// Schemas emits.
+func schemaErrors(path string, schema map[string]interface{}, value interface{}) []string {
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		for _, option := range anyOf {
+			if len(schemaErrors(path, option.(map[string]interface{}), value)) == 0 {
+				return nil
+			}
+		}
+		return []string{fmt.Sprintf("%s: %v matches no anyOf option", path, value)}
+	}
+
+	var errs []string
+	switch schema["type"] {
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected a string, got %v", path, value)}
+		}
+		if enum, ok := schema["enum"].([]string); ok && !slices.Contains(enum, s) {
+			errs = append(errs, fmt.Sprintf("%s: %q is not one of %v", path, s, enum))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			errs = append(errs, fmt.Sprintf("%s: expected a boolean, got %v", path, value))
+		}
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok || (schema["type"] == "integer" && n != float64(int64(n))) {
+			return []string{fmt.Sprintf("%s: expected %s, got %v", path, schema["type"], value)}
+		}
+		if min, ok := schema["minimum"].(int); ok && n < float64(min) {
+			errs = append(errs, fmt.Sprintf("%s: %v is below %d", path, n, min))
+		}
+		if max, ok := schema["maximum"].(int); ok && n > float64(max) {
+			errs = append(errs, fmt.Sprintf("%s: %v is above %d", path, n, max))
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected an array, got %v", path, value)}
+		}
+		for i, item := range items {
+			errs = append(errs, schemaErrors(fmt.Sprintf("%s[%d]", path, i), schema["items"].(map[string]interface{}), item)...)
+		}
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected an object, got %v", path, value)}
+		}
+		required, _ := schema["required"].([]string)
+		for _, name := range required {
+			if _, ok := obj[name]; !ok {
+				errs = append(errs, fmt.Sprintf("%s: missing required %q", path, name))
+			}
+		}
+		props, _ := schema["properties"].(map[string]interface{})
+		for name, v := range obj {
+			if prop, ok := props[name].(map[string]interface{}); ok {
+				errs = append(errs, schemaErrors(path+"."+name, prop, v)...)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case map[string]interface{}:
+				errs = append(errs, schemaErrors(path+"."+name, extra, v)...)
+			case bool:
+				if !extra {
+					errs = append(errs, fmt.Sprintf("%s: unexpected property %q", path, name))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+func TestSchemasMatchRealOutput(t *testing.T) {
+	root := newTestRoot(t)
+	high := PriorityHigh
+	dep, _ := CmdCreate(root, "Dep", CreateOptions{})
+	result, err := CmdCreate(root, "Main", CreateOptions{
+		Deps:        []string{dep["id"].(string)},
+		Labels:      []string{"a"},
+		Description: "d",
+		Priority:    &high,
+	})
+	if err != nil {
+		t.Fatalf("CmdCreate failed: %v", err)
+	}
+	id := result["id"].(string)
+	if _, err := CmdClaim(root, id, "started", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CmdNote(root, id, "more", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CmdAnnotate(root, id, "k", "v", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CmdDone(root, dep["id"].(string), ResolutionCompleted, "", "abc123"); err != nil {
+		t.Fatal(err)
+	}
+	schemas := Schemas()
+
+	tasks, _ := LoadState(root)
+	var out strings.Builder
+	if err := WriteTasksJSONL(&out, root, []*Task{tasks[id], tasks[dep["id"].(string)]}); err != nil {
+		t.Fatalf("WriteTasksJSONL failed: %v", err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var value interface{}
+		if err := json.Unmarshal([]byte(line), &value); err != nil {
+			t.Fatal(err)
+		}
+		for _, problem := range schemaErrors("task", schemas["task"].(map[string]interface{}), value) {
+			t.Error(problem)
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(root, EventsDir, "*.jsonl"))
+	var lines int
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			var value interface{}
+			if err := json.Unmarshal([]byte(line), &value); err != nil {
+				t.Fatal(err)
+			}
+			for _, problem := range schemaErrors("event", schemas["event"].(map[string]interface{}), value) {
+				t.Error(problem)
+			}
+			lines++
+		}
+	}
+	if lines == 0 {
+		t.Fatal("Expected log lines to check")
+	}
+}
+
+func TestNextSeqTrustsCounterWhileLogUnchanged(t *testing.T) {
+	root := newTestRoot(t)
+	at := time.Now().UTC()
+	if err := AppendEvents(root, []Event{{ID: "a0000001", Type: EventCreate, Timestamp: at, Title: "A", Status: StatusOpen}}); err != nil {
+		t.Fatalf("AppendEvents failed: %v", err)
+	}
+
+	// While the event files are as saveSeq left them, the counter alone
+	// decides the next seq
+	if err := saveSeq(root, 100); err != nil {
+		t.Fatalf("saveSeq failed: %v", err)
+	}
+	if seq, err := nextSeq(root); err != nil || seq != 101 {
+		t.Errorf("Expected seq 101 from the counter, got %d (%v)", seq, err)
+	}
+
+	// Once something else writes to the log, it is scanned again
+	if err := WriteEventsToFile(root, "2000-01-01.jsonl", []Event{{ID: "a0000001", Type: EventUpdate, Timestamp: at, Notes: "x", Seq: 7}}); err != nil {
+		t.Fatalf("WriteEventsToFile failed: %v", err)
+	}
+	if seq, err := nextSeq(root); err != nil || seq != 8 {
+		t.Errorf("Expected seq 8 after the log changed, got %d (%v)", seq, err)
+	}
+
+	// A counter file that can't be read is rebuilt from the log too
+	if err := os.WriteFile(filepath.Join(root, SeqFile), []byte("garbage\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if seq, err := nextSeq(root); err != nil || seq != 8 {
+		t.Errorf("Expected seq 8 from a bad counter file, got %d (%v)", seq, err)
+	}
+}
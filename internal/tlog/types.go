@@ -1,6 +1,8 @@
 package tlog
 
 import (
+	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -8,13 +10,34 @@ import (
 type EventType string
 
 const (
-	EventCreate EventType = "create"
-	EventStatus EventType = "status"
-	EventDep    EventType = "dep"
-	EventUpdate EventType = "update"
-	EventDelete EventType = "delete"
+	EventCreate   EventType = "create"
+	EventStatus   EventType = "status"
+	EventDep      EventType = "dep"
+	EventUpdate   EventType = "update"
+	EventDelete   EventType = "delete"
+	EventUndelete EventType = "undelete"
+	EventAnnotate EventType = "annotate"
+	EventBlock    EventType = "block"
+	EventAssign   EventType = "assign"
+	EventArchive  EventType = "archive"
+	EventMove     EventType = "move"
 )
 
+// AllEventTypes lists every event type, for validation and the JSON schema
+var AllEventTypes = []EventType{
+	EventCreate, EventStatus, EventDep, EventUpdate, EventDelete, EventUndelete,
+	EventAnnotate, EventBlock, EventAssign, EventArchive, EventMove,
+}
+
+// eventTypeNames returns AllEventTypes as strings
+func eventTypeNames() []string {
+	names := make([]string, len(AllEventTypes))
+	for i, eventType := range AllEventTypes {
+		names[i] = string(eventType)
+	}
+	return names
+}
+
 // TaskStatus represents the status of a task
 type TaskStatus string
 
@@ -62,7 +85,49 @@ func (p Priority) String() string {
 	}
 }
 
-// ParsePriority converts a string to a Priority
+// MarshalJSON encodes a priority as its name, for JSON output. Event logs
+// keep the integer encoding (see marshalEvent). Values outside the known
+// range stay numeric so they round-trip and doctor can still flag them.
+func (p Priority) MarshalJSON() ([]byte, error) {
+	if p < PriorityCritical || p > PriorityBacklog {
+		return json.Marshal(int(p))
+	}
+	return json.Marshal(p.String())
+}
+
+// UnmarshalJSON decodes a priority from either its name or the legacy
+// integer encoding used by older event logs
+func (p *Priority) UnmarshalJSON(data []byte) error {
+	var n int
+	if err := json.Unmarshal(data, &n); err == nil {
+		*p = Priority(n)
+		return nil
+	}
+
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return fmt.Errorf("priority must be a name or integer, got %s", data)
+	}
+	parsed := ParsePriority(name)
+	if parsed.String() != name {
+		return fmt.Errorf("unknown priority '%s'", name)
+	}
+	*p = parsed
+	return nil
+}
+
+// ParsePriorityStrict converts a priority name to a Priority, rejecting
+// anything that isn't one of the five names
+func ParsePriorityStrict(s string) (Priority, error) {
+	p := ParsePriority(s)
+	if p.String() != s {
+		return p, fmt.Errorf("invalid priority '%s' (valid: critical, high, medium, low, backlog)", s)
+	}
+	return p, nil
+}
+
+// ParsePriority converts a string to a Priority, defaulting to medium for
+// anything unrecognized. User input should go through ParsePriorityStrict.
 func ParsePriority(s string) Priority {
 	switch s {
 	case "critical":
@@ -84,6 +149,7 @@ func ParsePriority(s string) Priority {
 type Event struct {
 	ID          string     `json:"id"`
 	Timestamp   time.Time  `json:"ts"`
+	Seq         uint64     `json:"seq,omitempty"` // Append order; breaks timestamp ties (0 in logs written before it existed)
 	Type        EventType  `json:"type"`
 	Title       string     `json:"title,omitempty"`
 	Status      TaskStatus `json:"status,omitempty"`
@@ -93,27 +159,131 @@ type Event struct {
 	Labels      []string   `json:"labels,omitempty"`
 	Description string     `json:"description,omitempty"` // Mutable: what is this task
 	Notes       string     `json:"notes,omitempty"`       // Append-only: what happened
-	Commit      string     `json:"commit,omitempty"`      // For status events: commit SHA that completed the task
-	// For dep events
+	Commit      string     `json:"commit,omitempty"`      // For status and create events: commit SHA that completed the task
+	Estimate    *int       `json:"estimate,omitempty"`    // Minutes; pointer to distinguish unset from zero
+	TimeSpent   int        `json:"time_spent,omitempty"`  // Minutes; added to the task's total on update events
+	Assignee    string     `json:"assignee,omitempty"`    // Who owns the task; on assign events, empty clears it
+	Order       float64    `json:"order,omitempty"`       // For move and create events: manual sort key within the priority
+	Author      string     `json:"author,omitempty"`      // Who wrote Notes
+	// For create and annotate events: key/value metadata to set (or remove, with Action "remove")
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// For create events: tasks this task blocks, and the task's note log
+	Blocks  []string `json:"blocks,omitempty"`
+	NoteLog []Note   `json:"note_log,omitempty"`
+	// For dep and block events
 	Dep    string `json:"dep,omitempty"`
-	Action string `json:"action,omitempty"` // "add" or "remove"
+	Block  string `json:"block,omitempty"`  // Task that ID blocks
+	Action string `json:"action,omitempty"` // "add" or "remove"; "set_labels" on update events allows clearing labels
+}
+
+// Note is one entry in a task's note log
+type Note struct {
+	Time   time.Time `json:"time"`
+	Author string    `json:"author,omitempty"`
+	Text   string    `json:"text"`
 }
 
 // Task represents the computed state of a task
 type Task struct {
-	ID          string     `json:"id"`
-	Title       string     `json:"title"`
-	Status      TaskStatus `json:"status"`
-	Resolution  Resolution `json:"resolution,omitempty"`
-	Priority    Priority   `json:"priority"`
-	Deps        []string   `json:"deps"`
-	Created     time.Time  `json:"created"`
-	Updated     time.Time  `json:"updated"`
-	Labels      []string   `json:"labels"`
-	Description string     `json:"description,omitempty"` // Mutable: what is this task
-	Notes       string     `json:"notes,omitempty"`       // Append-only: what happened
-	Commit      string     `json:"commit,omitempty"`      // Commit SHA that completed the task
-	Deleted     bool       `json:"deleted,omitempty"`     // Tombstone: task is deleted
+	ID          string            `json:"id"`
+	Title       string            `json:"title"`
+	Status      TaskStatus        `json:"status"`
+	Resolution  Resolution        `json:"resolution,omitempty"`
+	Priority    Priority          `json:"priority"`
+	Deps        []string          `json:"deps"`
+	Created     time.Time         `json:"created"`
+	Updated     time.Time         `json:"updated"`
+	Labels      []string          `json:"labels"`
+	Description string            `json:"description,omitempty"` // Mutable: what is this task
+	Notes       string            `json:"notes,omitempty"`       // Append-only: what happened
+	Commit      string            `json:"commit,omitempty"`      // Commit SHA that completed the task
+	Estimate    int               `json:"estimate,omitempty"`    // Estimated minutes of work
+	TimeSpent   int               `json:"time_spent,omitempty"`  // Minutes logged so far
+	Assignee    string            `json:"assignee,omitempty"`    // Who is working on the task
+	Order       float64           `json:"order,omitempty"`       // Manual sort key within the priority, set by move (0 if never moved)
+	Deleted     bool              `json:"deleted,omitempty"`     // Tombstone: task is deleted
+	Archived    bool              `json:"archived,omitempty"`    // Put away on purpose: hidden, but kept with its history through prune
+	Annotations map[string]string `json:"annotations,omitempty"` // Structured metadata for tooling
+	Blocks      []string          `json:"blocks,omitempty"`      // Tasks this one blocks (informational; unlike deps, ready ignores them)
+	NoteLog     []Note            `json:"note_log,omitempty"`    // Notes in order, with when and by whom each was written
+}
+
+// ListFilter narrows the tasks returned by CmdList. Zero values match everything.
+type ListFilter struct {
+	Status          string   // Comma-separated open|in_progress|done, or all ("" is all)
+	Labels          []string // Only tasks carrying these labels
+	LabelMatch      string   // "all" (default) or "any" of Labels
+	ExcludeLabels   []string // Skip tasks carrying any of these labels
+	Assignee        string
+	Priority        string
+	HasNotes        bool
+	NoNotes         bool
+	HasDescription  bool
+	NoDescription   bool
+	Annotation      string // "key=value" to match a value, or "key" to match presence
+	Parent          string // Only this task's direct subtasks (its deps); an ID, prefix, or title
+	IncludeDeleted  bool   // Also return tombstoned tasks (until pruned)
+	IncludeArchived bool   // Also return archived tasks, including those prune --archive moved out
+	Offset          int    // Skip this many matching tasks
+	Limit           int    // Return at most this many tasks (0 is no limit)
+}
+
+// CreateOptions holds CmdCreate's optional fields. The zero value creates an
+// open task with the configured default priority.
+type CreateOptions struct {
+	Deps             []string // IDs of tasks the new one depends on
+	Labels           []string
+	Description      string
+	Notes            string
+	Priority         *Priority // nil for the configured default
+	For              string    // Parent task ID; the parent will depend on the new task
+	PriorityFromDeps bool      // With no Priority, inherit the most urgent among Deps and For
+	Estimate         *int      // Minutes (nil for none)
+	Force            bool      // Skip the configured label vocabulary check
+}
+
+// PruneOptions controls CmdPrune. The zero value prunes every done task from
+// all files except today's.
+type PruneOptions struct {
+	SaveDays int  // Preserve done tasks updated in the last N days
+	KeepAll  bool // Compact only; keep every task
+	DryRun   bool // Report what would happen without writing
+	Archive  bool // Move prunable done tasks to the archive file instead of dropping them
+	Log      bool // Record a summary line for each removed task in .tlog/prune.log
+	MaxAge   int  // Only process dated files older than N days (0 is all but today's)
+	All      bool // Process today's file too, leaving only the compacted file
+}
+
+// TaskGroup is a headed section of tasks, as produced by GroupTasks
+type TaskGroup struct {
+	Name  string  `json:"name"`
+	Tasks []*Task `json:"tasks"`
+}
+
+// TaskSpec describes a task to create from structured JSON input
+type TaskSpec struct {
+	Key         string   `json:"key,omitempty"` // Batch-local name other specs may use in deps/for
+	Title       string   `json:"title"`
+	Description string   `json:"description,omitempty"`
+	Notes       string   `json:"notes,omitempty"`
+	Priority    string   `json:"priority,omitempty"`
+	Labels      []string `json:"labels,omitempty"`
+	Deps        []string `json:"deps,omitempty"`
+	For         string   `json:"for,omitempty"` // Parent task that will depend on this one
+}
+
+// TaskView is a task plus fields computed from the whole graph, for JSON
+// output only
+type TaskView struct {
+	*Task
+	Ready bool `json:"ready"` // Open, not backlog, and all deps done
+}
+
+// TaskTreeNode is a task with its subtasks (deps) nested beneath it
+type TaskTreeNode struct {
+	*Task
+	Subtasks []*TaskTreeNode `json:"subtasks,omitempty"`
+	Cycle    bool            `json:"cycle,omitempty"` // A root only because it's on a dependency cycle
 }
 
 // GraphNode represents a node in the dependency graph
@@ -127,7 +297,7 @@ type GraphNode struct {
 type GraphEdge struct {
 	From string `json:"from"`
 	To   string `json:"to"`
-	Type string `json:"type"` // "depends_on"
+	Type string `json:"type"` // "depends_on" or "blocks"
 }
 
 // Graph represents the full dependency graph
@@ -136,6 +306,22 @@ type Graph struct {
 	Edges []GraphEdge `json:"edges"`
 }
 
+// BulkItem is the outcome of a bulk operation on one task: the operation's
+// result, or the error that stopped it
+type BulkItem struct {
+	Input  string                 `json:"input"`        // ID, prefix, or title as given
+	ID     string                 `json:"id,omitempty"` // Resolved task ID, if it resolved
+	Result map[string]interface{} `json:"result,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+}
+
+// DoctorIssue describes an integrity problem found by the doctor command
+type DoctorIssue struct {
+	Type    string `json:"type"` // "dangling_dep", "cycle", "corrupt", or for warnings "misfiled_event" or "implicit_reopen"
+	ID      string `json:"id"`
+	Message string `json:"message"`
+}
+
 // PrimeOutput represents the output of the prime command
 type PrimeOutput struct {
 	Instructions    string `json:"instructions"`
@@ -0,0 +1,77 @@
+package tlog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// fileStamp is what WatchEvents compares to notice a changed event file
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// WatchEvents polls the event files every interval and calls onChange when
+// any of them is added, removed, or changed: an append, a new day's file at
+// rollover, or a rewrite by prune. It returns nil when ctx is done.
+func WatchEvents(ctx context.Context, root string, interval time.Duration, onChange func()) error {
+	last, err := stampEventFiles(root)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		current, err := stampEventFiles(root)
+		if err != nil {
+			return err
+		}
+		if !sameStamps(last, current) {
+			last = current
+			onChange()
+		}
+	}
+}
+
+// stampEventFiles returns the size and modification time of each event file
+func stampEventFiles(root string) (map[string]fileStamp, error) {
+	files, err := ListEventFiles(root)
+	if err != nil {
+		return nil, err
+	}
+	stamps := make(map[string]fileStamp, len(files))
+	for _, name := range files {
+		info, err := os.Stat(filepath.Join(root, EventsDir, name))
+		if os.IsNotExist(err) {
+			// Removed since it was listed, e.g. by a prune
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		stamps[name] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+	}
+	return stamps, nil
+}
+
+// sameStamps reports whether two sets of stamps describe the same files
+func sameStamps(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, stamp := range a {
+		if other, ok := b[name]; !ok || other.size != stamp.size || !other.modTime.Equal(stamp.modTime) {
+			return false
+		}
+	}
+	return true
+}